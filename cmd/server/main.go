@@ -14,6 +14,7 @@ import (
 	"time-machine/pkg/services/snapshot"
 	"time-machine/pkg/services/video"
 	"time-machine/pkg/stats"
+	"time-machine/pkg/util"
 	"time-machine/pkg/worker"
 )
 
@@ -48,6 +49,20 @@ func main() {
 		}
 	}
 
+	// Refresh camera names, models and capabilities from the controller. Failure is
+	// not fatal: cameras listed in TARGET_CAMERA_ID are still captured.
+	if _, err := snapshot.DiscoverCameras(); err != nil {
+		log.Printf("WARNING: camera discovery failed: %v", err)
+	}
+
+	// Bring the snapshot index in line with the files on disk. Files that are
+	// already indexed are skipped, so this is quick after the first run.
+	go func() {
+		if _, _, err := util.ReindexSnapshots(); err != nil {
+			log.Printf("WARNING: snapshot reindex failed: %v", err)
+		}
+	}()
+
 	// Start background workers and schedulers
 	cachedstats.Cache.RunUpdater()
 	stats.StartStatsCollector()
@@ -56,7 +71,7 @@ func main() {
 	go snapshot.StartSnapshotScheduler()
 	go video.StartVideoGeneratorScheduler()
 	go share.StartShareLinkCleanupScheduler()
-	log.Printf("✅ Snapshot Scheduler started (interval: %ds)", settings.GetInt("snapshot.interval_sec", 3600))
+	log.Printf("✅ Snapshot Scheduler started (interval: %ds, aligned to the clock)", settings.GetInt("snapshot.interval_sec", 3600))
 	log.Printf("✅ Video Generation Scheduler started (interval: %ds)", settings.GetInt("video.cron_interval_sec", 300))
 
 	server.StartServer()
@@ -6,8 +6,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"time-machine/pkg/services/health"
 	"time-machine/pkg/services/snapshot"
 	"time-machine/pkg/stats"
+	"time-machine/pkg/util"
 )
 
 // CachedStats holds the cached statistics data.
@@ -33,6 +35,8 @@ func getLoadingData() gin.H {
 		"system_info":          stats.GetSystemInfo(), // This is fast and has its own "Loading..." state
 		"camera_status":        gin.H{"Name": "Loading...", "Model": "Loading...", "Status": "Loading...", "Connected": "false", "HQCapable": "false", "HQEnabled": "false", "HQSetting": "auto", "SnapshotQuality": "Loading..."},
 		"daily_gallery":        []map[string]string{},
+		"camera_health":        []health.Day{},
+		"cameras":              gin.H{},
 		"is_loading":           true, // Flag for the frontend to know the data is temporary
 	}
 }
@@ -52,20 +56,46 @@ func (cs *CachedStats) RunUpdater() {
 	}()
 }
 
+// healthDays is how many days of uptime timeline the dashboard shows.
+const healthDays = 7
+
+// cameraStats gathers the per-camera portion of the cache. The camera status is
+// also recorded in the health history on each poll.
+func cameraStats(cameraID, defaultDate string) gin.H {
+	status := snapshot.GetFormattedCameraStatus(cameraID)
+	health.Observe(cameraID, status)
+	return gin.H{
+		"total_images":    stats.GetTotalImagesCount(cameraID),
+		"last_image_time": stats.GetLastImageTime(cameraID),
+		"missed_slots":    stats.GetMissedSlotCount(cameraID),
+		"available_dates": stats.GetAvailableImageDates(cameraID),
+		"camera_status":   status,
+		"camera_health":   health.GetDays(cameraID, healthDays),
+		"daily_gallery":   stats.GetDailyGallery(cameraID, defaultDate),
+	}
+}
+
 // Update fetches the latest stats and updates the cache.
+// Per-camera stats are stored under "cameras" keyed by camera ID; the first
+// enabled camera's stats are also copied to the top level as the default view.
 func (cs *CachedStats) Update() {
 	defaultDate := time.Now().Format("2006-01-02")
+	cameraIDs := util.ActiveCameraIDs()
+	cameras := gin.H{}
+	for _, id := range cameraIDs {
+		cameras[id] = cameraStats(id, defaultDate)
+	}
+
 	newData := gin.H{
-		"total_images":         stats.GetTotalImagesCount(),
 		"image_size":           stats.GetImagesDiskUsage(),
-		"last_image_time":      stats.GetLastImageTime(),
 		"last_processed_image": stats.GetLastProcessedImageName(),
-		"available_dates":      stats.GetAvailableImageDates(),
 		"system_info":          stats.GetSystemInfo(),
-		"camera_status":        snapshot.GetFormattedCameraStatus(),
-		"daily_gallery":        stats.GetDailyGallery(defaultDate),
+		"cameras":              cameras,
 		"is_loading":           false,
 	}
+	for k, v := range cameras[cameraIDs[0]].(gin.H) {
+		newData[k] = v
+	}
 
 	cs.Lock()
 	defer cs.Unlock()
@@ -87,3 +117,22 @@ func (cs *CachedStats) GetData() gin.H {
 	}
 	return cs.Data
 }
+
+// GetCameraData returns the cached data with the per-camera fields of cameraID
+// in place of the default camera's. Unknown cameras get the default view.
+func (cs *CachedStats) GetCameraData(cameraID string) gin.H {
+	data := cs.GetData()
+	cameras, _ := data["cameras"].(gin.H)
+	perCamera, ok := cameras[cameraID].(gin.H)
+	if !ok {
+		return data
+	}
+	merged := make(gin.H, len(data))
+	for k, v := range data {
+		merged[k] = v
+	}
+	for k, v := range perCamera {
+		merged[k] = v
+	}
+	return merged
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"time-machine/pkg/services/health"
 	"time-machine/pkg/services/snapshot"
 	"time-machine/pkg/stats"
 
@@ -14,7 +15,7 @@ import (
 func TestUpdateAndGetData(t *testing.T) {
 	// Overwrite the original functions with mock implementations
 	originalGetTotalImagesCount := stats.GetTotalImagesCount
-	stats.GetTotalImagesCount = func() int { return 100 }
+	stats.GetTotalImagesCount = func(string) int { return 100 }
 	defer func() { stats.GetTotalImagesCount = originalGetTotalImagesCount }()
 
 	originalGetImagesDiskUsage := stats.GetImagesDiskUsage
@@ -29,15 +30,19 @@ func TestUpdateAndGetData(t *testing.T) {
 	defer func() { stats.GetImagesDiskUsage = originalGetImagesDiskUsage }()
 
 	originalGetLastImageTime := stats.GetLastImageTime
-	stats.GetLastImageTime = func() string { return "2023-10-27 10:00:00" }
+	stats.GetLastImageTime = func(string) string { return "2023-10-27 10:00:00" }
 	defer func() { stats.GetLastImageTime = originalGetLastImageTime }()
 
+	originalGetMissedSlotCount := stats.GetMissedSlotCount
+	stats.GetMissedSlotCount = func(string) int { return 2 }
+	defer func() { stats.GetMissedSlotCount = originalGetMissedSlotCount }()
+
 	originalGetLastProcessedImageName := stats.GetLastProcessedImageName
 	stats.GetLastProcessedImageName = func() string { return "image.jpg" }
 	defer func() { stats.GetLastProcessedImageName = originalGetLastProcessedImageName }()
 
 	originalGetAvailableImageDates := stats.GetAvailableImageDates
-	stats.GetAvailableImageDates = func() []map[string]string {
+	stats.GetAvailableImageDates = func(string) []map[string]string {
 		return []map[string]string{
 			{"value": "2023-10-27", "display": "27/10/2023"},
 		}
@@ -51,13 +56,22 @@ func TestUpdateAndGetData(t *testing.T) {
 	defer func() { stats.GetSystemInfo = originalGetSystemInfo }()
 
 	originalGetFormattedCameraStatus := snapshot.GetFormattedCameraStatus
-	snapshot.GetFormattedCameraStatus = func() map[string]string {
+	snapshot.GetFormattedCameraStatus = func(string) map[string]string {
 		return map[string]string{"status": "active"}
 	}
 	defer func() { snapshot.GetFormattedCameraStatus = originalGetFormattedCameraStatus }()
 
+	var observed []string
+	originalObserve := health.Observe
+	health.Observe = func(cameraID string, status map[string]string) { observed = append(observed, status["status"]) }
+	defer func() { health.Observe = originalObserve }()
+
+	originalGetDays := health.GetDays
+	health.GetDays = func(string, int) []health.Day { return []health.Day{{Date: "2023-10-27", Availability: 100}} }
+	defer func() { health.GetDays = originalGetDays }()
+
 	originalGetDailyGallery := stats.GetDailyGallery
-	stats.GetDailyGallery = func(date string) []map[string]string {
+	stats.GetDailyGallery = func(cameraID, date string) []map[string]string {
 		return []map[string]string{{"images": "5"}, {"videos": "1"}}
 	}
 	defer func() { stats.GetDailyGallery = originalGetDailyGallery }()
@@ -77,13 +91,35 @@ func TestUpdateAndGetData(t *testing.T) {
 	assert.Equal(t, 100, data["total_images"])
 	assert.Equal(t, "10.00 GB", data["image_size"].(gin.H)["image_usage_gb"])
 	assert.Equal(t, "2023-10-27 10:00:00", data["last_image_time"])
+	assert.Equal(t, 2, data["missed_slots"])
 	assert.Equal(t, "image.jpg", data["last_processed_image"])
 	assert.Equal(t, []map[string]string{{"value": "2023-10-27", "display": "27/10/2023"}}, data["available_dates"])
 	assert.Equal(t, gin.H{"cpu": "50%"}, data["system_info"])
 	assert.Equal(t, map[string]string{"status": "active"}, data["camera_status"])
+	assert.Equal(t, []string{"active"}, observed, "each poll is recorded in the health history")
+	assert.Equal(t, []health.Day{{Date: "2023-10-27", Availability: 100}}, data["camera_health"])
 	assert.Equal(t, []map[string]string{{"images": "5"}, {"videos": "1"}}, data["daily_gallery"])
 }
 
+func TestGetCameraData(t *testing.T) {
+	cs := &CachedStats{
+		Data: gin.H{
+			"total_images": 1,
+			"system_info":  gin.H{"cpu": "50%"},
+			"cameras": gin.H{
+				"cam1": gin.H{"total_images": 1},
+				"cam2": gin.H{"total_images": 2},
+			},
+		},
+		isInitialized: true,
+	}
+
+	assert.Equal(t, 2, cs.GetCameraData("cam2")["total_images"])
+	assert.Equal(t, gin.H{"cpu": "50%"}, cs.GetCameraData("cam2")["system_info"])
+	assert.Equal(t, 1, cs.GetCameraData("unknown")["total_images"])
+	assert.Equal(t, 1, cs.GetData()["total_images"], "GetCameraData must not modify the cached map")
+}
+
 func TestGetDataLoading(t *testing.T) {
 	cs := &CachedStats{
 		Data:          make(gin.H),
@@ -5,16 +5,22 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
+// cameraIDPattern restricts camera IDs to characters that are safe to use as a
+// single path component and inside a scoped timelapse name.
+var cameraIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 // Config holds bootstrap configuration that must be available before the database
 // is initialised (credentials, paths).  All operational tuning lives in the
 // settings DB table managed by pkg/services/settings.
 type Config struct {
 	UFPHost        string
 	UFPAPIKey      string
-	TargetCameraID string
+	TargetCameraID string   // first entry of CameraIDs; kept for single-camera installs
+	CameraIDs      []string // every camera listed in TARGET_CAMERA_ID (comma-separated)
 	DataDir        string
 	SnapshotsDir   string
 	GalleryDir     string
@@ -54,6 +60,12 @@ func LoadConfig() {
 	AppConfig.SnapshotsDir = filepath.Join(AppConfig.DataDir, AppConfig.SnapshotsDir)
 	AppConfig.GalleryDir = filepath.Join(AppConfig.DataDir, AppConfig.GalleryDir)
 
+	AppConfig.CameraIDs = ParseCameraIDs(AppConfig.TargetCameraID)
+	AppConfig.TargetCameraID = ""
+	if len(AppConfig.CameraIDs) > 0 {
+		AppConfig.TargetCameraID = AppConfig.CameraIDs[0]
+	}
+
 	AppConfig.UFPHost = getEnv("UFP_HOST", "")
 	if AppConfig.UFPHost != "" && !strings.Contains(AppConfig.UFPHost, "://") {
 		AppConfig.UFPHost = "https://" + AppConfig.UFPHost
@@ -61,7 +73,7 @@ func LoadConfig() {
 
 	log.Println("--- Bootstrap Configuration ---")
 	log.Printf("UFP Host: %s", AppConfig.UFPHost)
-	log.Printf("Target Camera ID: %s", AppConfig.TargetCameraID)
+	log.Printf("Target Camera IDs: %s", strings.Join(AppConfig.CameraIDs, ", "))
 	log.Printf("Data Directory: %s", AppConfig.DataDir)
 	log.Println("(Operational settings loaded from DB via settings service)")
 	log.Println("--------------------------------")
@@ -74,3 +86,65 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// ParseCameraIDs splits a comma-separated TARGET_CAMERA_ID value into individual
+// camera IDs, dropping blanks, duplicates and IDs that are not path-safe.
+func ParseCameraIDs(raw string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(raw, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if !ValidCameraID(id) {
+			log.Printf("WARNING: ignoring invalid camera ID %q in TARGET_CAMERA_ID", id)
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ValidCameraID reports whether id can be used as a camera directory name.
+func ValidCameraID(id string) bool {
+	return cameraIDPattern.MatchString(id)
+}
+
+// CameraDataDir returns the per-camera root under DataDir/cameras/<id>, which holds
+// that camera's snapshots, gallery, timelapse videos, HLS streams and latest frame.
+// An empty cameraID refers to the legacy single-camera layout rooted at DataDir.
+func CameraDataDir(cameraID string) string {
+	if cameraID == "" {
+		return AppConfig.DataDir
+	}
+	return filepath.Join(AppConfig.DataDir, "cameras", cameraID)
+}
+
+// CameraSnapshotsDir returns the snapshot tree (YYYY-MM/DD/HH) for cameraID.
+func CameraSnapshotsDir(cameraID string) string {
+	if cameraID == "" {
+		return AppConfig.SnapshotsDir
+	}
+	return filepath.Join(CameraDataDir(cameraID), "snapshots")
+}
+
+// CameraGalleryDir returns the flat hourly gallery directory for cameraID.
+func CameraGalleryDir(cameraID string) string {
+	if cameraID == "" {
+		return AppConfig.GalleryDir
+	}
+	return filepath.Join(CameraDataDir(cameraID), "gallery")
+}
+
+// CameraQuarantineDir returns the directory holding cameraID's rejected snapshots.
+func CameraQuarantineDir(cameraID string) string {
+	return filepath.Join(CameraDataDir(cameraID), "quarantine")
+}
+
+// CameraEventsDir returns the tree (YYYY-MM/DD) of cameraID's event-triggered
+// frames. They are kept apart from the snapshot tree so the scheduled timelapses
+// are unaffected by bursts of motion.
+func CameraEventsDir(cameraID string) string {
+	return filepath.Join(CameraDataDir(cameraID), "events")
+}
@@ -41,3 +41,25 @@ func TestLoadConfig(t *testing.T) {
 	assert.True(t, strings.HasSuffix(AppConfig.SnapshotsDir, "snapshots"))
 	assert.True(t, strings.HasSuffix(AppConfig.GalleryDir, "gallery"))
 }
+
+func TestParseCameraIDs(t *testing.T) {
+	assert.Equal(t, []string{"cam1"}, ParseCameraIDs("cam1"))
+	assert.Equal(t, []string{"cam1", "cam2"}, ParseCameraIDs(" cam1, cam2 ,,cam1"))
+	assert.Equal(t, []string{"ok_id"}, ParseCameraIDs("../etc,ok_id,bad/id"))
+	assert.Nil(t, ParseCameraIDs(""))
+}
+
+func TestCameraDirs(t *testing.T) {
+	AppConfig.DataDir = "/data"
+	AppConfig.SnapshotsDir = "/data/snapshots"
+	AppConfig.GalleryDir = "/data/gallery"
+
+	assert.Equal(t, "/data", CameraDataDir(""))
+	assert.Equal(t, "/data/snapshots", CameraSnapshotsDir(""))
+	assert.Equal(t, "/data/gallery", CameraGalleryDir(""))
+
+	assert.Equal(t, "/data/cameras/cam1", CameraDataDir("cam1"))
+	assert.Equal(t, "/data/cameras/cam1/snapshots", CameraSnapshotsDir("cam1"))
+	assert.Equal(t, "/data/cameras/cam1/gallery", CameraGalleryDir("cam1"))
+	assert.Equal(t, "/data/cameras/cam1/quarantine", CameraQuarantineDir("cam1"))
+}
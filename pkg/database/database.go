@@ -14,8 +14,8 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/argon2"
 	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/argon2"
 
 	"time-machine/pkg/config"
 	"time-machine/pkg/models"
@@ -94,6 +94,96 @@ var migrations = []migration{
 	{9, `CREATE TRIGGER IF NOT EXISTS update_settings_updated_at
 		AFTER UPDATE ON settings FOR EACH ROW
 		BEGIN UPDATE settings SET updated_at = CURRENT_TIMESTAMP WHERE key = OLD.key; END`},
+	{10, `CREATE TABLE IF NOT EXISTS cameras (
+		"id" TEXT NOT NULL PRIMARY KEY,
+		"name" TEXT NOT NULL DEFAULT '',
+		"enabled" INTEGER NOT NULL DEFAULT 1,
+		"created_at" DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`},
+	{11, `ALTER TABLE cameras ADD COLUMN "model" TEXT NOT NULL DEFAULT '';
+		ALTER TABLE cameras ADD COLUMN "state" TEXT NOT NULL DEFAULT '';
+		ALTER TABLE cameras ADD COLUMN "feature_flags" TEXT NOT NULL DEFAULT ''`},
+	{12, `ALTER TABLE cameras ADD COLUMN "source_type" TEXT NOT NULL DEFAULT 'protect';
+		ALTER TABLE cameras ADD COLUMN "source_url" TEXT NOT NULL DEFAULT '';
+		ALTER TABLE cameras ADD COLUMN "source_username" TEXT NOT NULL DEFAULT '';
+		ALTER TABLE cameras ADD COLUMN "source_password" TEXT NOT NULL DEFAULT '';
+		ALTER TABLE cameras ADD COLUMN "source_auth" TEXT NOT NULL DEFAULT ''`},
+	{13, `CREATE TABLE IF NOT EXISTS missed_snapshots (
+		"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"camera_id" TEXT NOT NULL,
+		"slot_time" DATETIME NOT NULL,
+		"attempts" INTEGER NOT NULL DEFAULT 0,
+		"reason" TEXT NOT NULL DEFAULT '',
+		"created_at" DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_missed_snapshots_camera_slot ON missed_snapshots (camera_id, slot_time)`},
+	{14, `CREATE TABLE IF NOT EXISTS snapshots (
+		"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"camera_id" TEXT NOT NULL DEFAULT '',
+		"path" TEXT NOT NULL UNIQUE,
+		"captured_at" DATETIME NOT NULL,
+		"size" INTEGER NOT NULL DEFAULT 0,
+		"width" INTEGER NOT NULL DEFAULT 0,
+		"height" INTEGER NOT NULL DEFAULT 0,
+		"hash" TEXT NOT NULL DEFAULT '',
+		"source" TEXT NOT NULL DEFAULT '',
+		"in_gallery" INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS idx_snapshots_camera_gallery_time ON snapshots (camera_id, in_gallery, captured_at)`},
+	{15, `CREATE TABLE IF NOT EXISTS capture_windows (
+		"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"name" TEXT NOT NULL UNIQUE,
+		"interval_sec" INTEGER NOT NULL,
+		"start_anchor" TEXT NOT NULL DEFAULT 'clock',
+		"start_offset_min" INTEGER NOT NULL DEFAULT 0,
+		"end_anchor" TEXT NOT NULL DEFAULT 'clock',
+		"end_offset_min" INTEGER NOT NULL DEFAULT 0,
+		"weekdays" INTEGER NOT NULL DEFAULT 127,
+		"enabled" INTEGER NOT NULL DEFAULT 1,
+		"created_at" DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`},
+	{16, `ALTER TABLE snapshots ADD COLUMN "tags" TEXT NOT NULL DEFAULT '';
+	ALTER TABLE cameras ADD COLUMN "mac" TEXT NOT NULL DEFAULT ''`},
+	{17, `CREATE TABLE IF NOT EXISTS camera_health (
+		"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"camera_id" TEXT NOT NULL,
+		"checked_at" DATETIME NOT NULL,
+		"state" TEXT NOT NULL DEFAULT '',
+		"connected" INTEGER NOT NULL DEFAULT 0,
+		"up_since" DATETIME,
+		"snapshot" TEXT NOT NULL DEFAULT '',
+		"change" TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_camera_health_camera_time ON camera_health (camera_id, checked_at)`},
+	{18, `ALTER TABLE jobs ADD COLUMN "result" TEXT`},
+	{19, `ALTER TABLE timelapse_trackers ADD COLUMN "params" TEXT NOT NULL DEFAULT ''`},
+	// Trackers are kept per output format. Existing rows belong to the format
+	// that was configured when they were written.
+	{20, `CREATE TABLE timelapse_trackers_by_format (
+		"timelapse_name" TEXT NOT NULL,
+		"format" TEXT NOT NULL DEFAULT 'webm',
+		"last_snapshot_path" TEXT NOT NULL,
+		"params" TEXT NOT NULL DEFAULT '',
+		"updated_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (timelapse_name, format)
+	);
+	INSERT INTO timelapse_trackers_by_format (timelapse_name, format, last_snapshot_path, params, updated_at)
+		SELECT timelapse_name, COALESCE((SELECT value FROM settings WHERE key = 'video.format'), 'webm'),
+		       last_snapshot_path, params, updated_at
+		FROM timelapse_trackers;
+	DROP TABLE timelapse_trackers;
+	ALTER TABLE timelapse_trackers_by_format RENAME TO timelapse_trackers`},
+	{21, `ALTER TABLE jobs ADD COLUMN "priority" INTEGER NOT NULL DEFAULT 0`},
+	// Finished jobs are kept as history, and failed ones retried.
+	{22, `ALTER TABLE jobs ADD COLUMN "attempts" INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE jobs ADD COLUMN "max_attempts" INTEGER NOT NULL DEFAULT 3;
+	ALTER TABLE jobs ADD COLUMN "run_after" DATETIME;
+	ALTER TABLE jobs ADD COLUMN "started_at" DATETIME;
+	ALTER TABLE jobs ADD COLUMN "finished_at" DATETIME;
+	ALTER TABLE jobs ADD COLUMN "duration_ms" INTEGER`},
+	{23, `ALTER TABLE cameras ADD COLUMN "source_fingerprint" TEXT NOT NULL DEFAULT ''`},
+	// Jobs that ran out of attempts used to be marked "failed"; they are now dead-lettered.
+	{24, `UPDATE jobs SET status = 'dead' WHERE status = 'failed'`},
 }
 
 // RunMigrations creates the schema_migrations table if needed and applies any
@@ -211,6 +301,98 @@ func MigrateLogFiles() {
 	}
 }
 
+// SeedConfiguredCameras registers every camera listed in TARGET_CAMERA_ID.
+// Existing rows are left alone so an admin's enable/disable choice survives restarts.
+func SeedConfiguredCameras() {
+	for _, id := range config.AppConfig.CameraIDs {
+		if err := AddCamera(id, ""); err != nil {
+			log.Printf("Warning: could not register camera %s: %v", id, err)
+		}
+	}
+}
+
+// MigrateLegacyCameraLayout moves data from the original single-camera layout
+// (snapshots/, gallery/, timelapse_* and hls/ directly under DataDir) into the
+// per-camera layout of the primary TARGET_CAMERA_ID, and scopes the matching
+// timelapse tracker rows and share links to that camera. Safe to run repeatedly:
+// once the root directories are empty there is nothing left to move.
+func MigrateLegacyCameraLayout() {
+	cameraID := config.AppConfig.TargetCameraID
+	if cameraID == "" {
+		return
+	}
+	dataDir := config.AppConfig.DataDir
+	cameraDir := config.CameraDataDir(cameraID)
+
+	type move struct{ from, to string }
+	var moves []move
+
+	snapshotMonths, _ := filepath.Glob(filepath.Join(config.AppConfig.SnapshotsDir, "[0-9][0-9][0-9][0-9]-[0-9][0-9]"))
+	for _, m := range snapshotMonths {
+		moves = append(moves, move{m, filepath.Join(config.CameraSnapshotsDir(cameraID), filepath.Base(m))})
+	}
+	galleryFiles, _ := filepath.Glob(filepath.Join(config.AppConfig.GalleryDir, "*.jpg"))
+	for _, f := range galleryFiles {
+		moves = append(moves, move{f, filepath.Join(config.CameraGalleryDir(cameraID), filepath.Base(f))})
+	}
+	for _, pattern := range []string{"timelapse_*.webm", "timelapse_*.mp4", "latest_snapshot.jpg"} {
+		files, _ := filepath.Glob(filepath.Join(dataDir, pattern))
+		for _, f := range files {
+			moves = append(moves, move{f, filepath.Join(cameraDir, filepath.Base(f))})
+		}
+	}
+	hlsDirs, _ := filepath.Glob(filepath.Join(dataDir, "hls", "timelapse_*"))
+	for _, d := range hlsDirs {
+		moves = append(moves, move{d, filepath.Join(cameraDir, "hls", filepath.Base(d))})
+	}
+
+	var unscopedTrackers int
+	db.QueryRow("SELECT COUNT(*) FROM timelapse_trackers WHERE instr(timelapse_name, '/') = 0").Scan(&unscopedTrackers)
+	if len(moves) == 0 && unscopedTrackers == 0 {
+		return
+	}
+
+	log.Printf("Migrating single-camera data layout to camera %s (%d item(s))...", cameraID, len(moves))
+	for _, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.to), 0755); err != nil {
+			log.Printf("Warning: could not create %s: %v", filepath.Dir(m.to), err)
+			continue
+		}
+		if _, err := os.Stat(m.to); err == nil {
+			log.Printf("Warning: %s already exists, leaving %s in place", m.to, m.from)
+			continue
+		}
+		if err := os.Rename(m.from, m.to); err != nil {
+			log.Printf("Warning: could not move %s to %s: %v", m.from, m.to, err)
+		}
+	}
+
+	// Tracker rows hold absolute snapshot paths, so rewrite both the name and the
+	// path; otherwise every timelapse would fall back to a full regeneration.
+	_, err := db.Exec(
+		`UPDATE timelapse_trackers SET
+		     timelapse_name = ? || '/' || timelapse_name,
+		     last_snapshot_path = replace(replace(last_snapshot_path, ?, ?), ?, ?)
+		 WHERE instr(timelapse_name, '/') = 0`,
+		cameraID,
+		config.AppConfig.SnapshotsDir+string(filepath.Separator), config.CameraSnapshotsDir(cameraID)+string(filepath.Separator),
+		config.AppConfig.GalleryDir+string(filepath.Separator), config.CameraGalleryDir(cameraID)+string(filepath.Separator),
+	)
+	if err != nil {
+		log.Printf("Warning: could not scope timelapse trackers to camera %s: %v", cameraID, err)
+	}
+
+	_, err = db.Exec(
+		`UPDATE shared_links SET file_path = '/data/cameras/' || ? || '/' || substr(file_path, 7)
+		 WHERE file_path LIKE '/data/timelapse\_%' ESCAPE '\' OR file_path LIKE '/data/hls/%' OR file_path LIKE '/data/gallery/%'`,
+		cameraID,
+	)
+	if err != nil {
+		log.Printf("Warning: could not rewrite share links for camera %s: %v", cameraID, err)
+	}
+	log.Printf("✅ Single-camera data migrated to %s", cameraDir)
+}
+
 // InitDB opens the database, runs migrations, and imports any legacy .txt files.
 func InitDB() {
 	dbPath := filepath.Join(config.AppConfig.DataDir, "lapse.db")
@@ -223,6 +405,8 @@ func InitDB() {
 	RunMigrations()
 	MigrateTrackerFiles()
 	MigrateLogFiles()
+	SeedConfiguredCameras()
+	MigrateLegacyCameraLayout()
 
 	log.Println("Database initialized successfully.")
 }
@@ -275,15 +459,541 @@ func GetAllSettings() (map[string]string, error) {
 	return m, rows.Err()
 }
 
+// --- Cameras ---
+
+// AddCamera registers a camera if it is not already known. New cameras start enabled.
+func AddCamera(id, name string) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec("INSERT OR IGNORE INTO cameras (id, name) VALUES (?, ?)", id, name)
+	return err
+}
+
+// UpsertDiscoveredCamera records a camera reported by the Protect controller.
+// Cameras seen for the first time are added disabled so capture only starts once
+// an admin opts in; known cameras keep their enabled flag and get fresh details.
+func UpsertDiscoveredCamera(cam models.Camera) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec(
+		`INSERT INTO cameras (id, name, model, state, feature_flags, mac, enabled) VALUES (?, ?, ?, ?, ?, ?, 0)
+		 ON CONFLICT(id) DO UPDATE SET
+		     name = excluded.name,
+		     model = excluded.model,
+		     state = excluded.state,
+		     feature_flags = excluded.feature_flags,
+		     mac = excluded.mac`,
+		cam.ID, cam.Name, cam.Model, cam.State, cam.FeatureFlags, cam.MAC,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert camera '%s': %w", cam.ID, err)
+	}
+	return nil
+}
+
+// SaveCameraSource creates or updates a camera together with its snapshot source.
+// New cameras start enabled because the admin configured them explicitly.
+func SaveCameraSource(cam models.Camera) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec(
+		`INSERT INTO cameras (id, name, source_type, source_url, source_username, source_password, source_auth, source_fingerprint)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET
+		     name = CASE WHEN excluded.name = '' THEN cameras.name ELSE excluded.name END,
+		     source_type = excluded.source_type,
+		     source_url = excluded.source_url,
+		     source_username = excluded.source_username,
+		     source_password = excluded.source_password,
+		     source_auth = excluded.source_auth,
+		     source_fingerprint = excluded.source_fingerprint`,
+		cam.ID, cam.Name, cam.SourceType, cam.SourceURL, cam.SourceUsername, cam.SourcePassword, cam.SourceAuth, cam.SourceFingerprint,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save camera '%s': %w", cam.ID, err)
+	}
+	return nil
+}
+
+// SetCameraName updates the display name reported by the camera API.
+func SetCameraName(id, name string) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec("UPDATE cameras SET name = ? WHERE id = ?", name, id)
+	return err
+}
+
+// SetCameraEnabled toggles capture and timelapse generation for a camera.
+func SetCameraEnabled(id string, enabled bool) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	result, err := db.Exec("UPDATE cameras SET enabled = ? WHERE id = ?", enabled, id)
+	if err != nil {
+		return fmt.Errorf("failed to update camera: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("camera '%s' not found", id)
+	}
+	return nil
+}
+
+const cameraColumns = `id, name, model, state, feature_flags, enabled, created_at,
+	source_type, source_url, source_username, source_password, source_auth, mac, source_fingerprint`
+
+// GetCamera returns the camera with the given ID, or nil if it is not registered.
+func GetCamera(id string) (*models.Camera, error) {
+	cameras, err := queryCameras("SELECT "+cameraColumns+" FROM cameras WHERE id = ?", id)
+	if err != nil || len(cameras) == 0 {
+		return nil, err
+	}
+	return &cameras[0], nil
+}
+
+// GetCameraByMAC returns the camera whose Protect MAC address is mac, or nil if
+// none matches. Separators and case are ignored, since Protect reports MACs both
+// as "F4E2C6A1B2C3" and "f4:e2:c6:a1:b2:c3".
+func GetCameraByMAC(mac string) (*models.Camera, error) {
+	mac = NormaliseMAC(mac)
+	if mac == "" {
+		return nil, nil
+	}
+	cameras, err := queryCameras("SELECT "+cameraColumns+" FROM cameras WHERE mac = ?", mac)
+	if err != nil || len(cameras) == 0 {
+		return nil, err
+	}
+	return &cameras[0], nil
+}
+
+// NormaliseMAC returns mac in the form stored in the cameras table: upper-case
+// hex digits without separators.
+func NormaliseMAC(mac string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.TrimSpace(mac)))
+}
+
+// GetCameras returns every registered camera ordered by creation time.
+func GetCameras() ([]models.Camera, error) {
+	return queryCameras("SELECT " + cameraColumns + " FROM cameras ORDER BY created_at, id")
+}
+
+// GetEnabledCameras returns the cameras that should be captured from.
+func GetEnabledCameras() ([]models.Camera, error) {
+	return queryCameras("SELECT " + cameraColumns + " FROM cameras WHERE enabled = 1 ORDER BY created_at, id")
+}
+
+func queryCameras(query string, args ...interface{}) ([]models.Camera, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cameras: %w", err)
+	}
+	defer rows.Close()
+
+	var cameras []models.Camera
+	for rows.Next() {
+		var cam models.Camera
+		if err := rows.Scan(&cam.ID, &cam.Name, &cam.Model, &cam.State, &cam.FeatureFlags, &cam.Enabled, &cam.CreatedAt,
+			&cam.SourceType, &cam.SourceURL, &cam.SourceUsername, &cam.SourcePassword, &cam.SourceAuth, &cam.MAC, &cam.SourceFingerprint); err != nil {
+			return nil, fmt.Errorf("failed to scan camera row: %w", err)
+		}
+		cameras = append(cameras, cam)
+	}
+	return cameras, rows.Err()
+}
+
+// --- Missed snapshot slots ---
+
+// RecordMissedSnapshot stores a capture slot that produced no snapshot.
+func RecordMissedSnapshot(m models.MissedSnapshot) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec(
+		"INSERT INTO missed_snapshots (camera_id, slot_time, attempts, reason) VALUES (?, ?, ?, ?)",
+		m.CameraID, m.SlotTime.UTC(), m.Attempts, m.Reason,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record missed snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetMissedSnapshots returns cameraID's missed slots at or after since, newest first.
+func GetMissedSnapshots(cameraID string, since time.Time) ([]models.MissedSnapshot, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := db.Query(
+		`SELECT camera_id, slot_time, attempts, reason FROM missed_snapshots
+		 WHERE camera_id = ? AND slot_time >= ? ORDER BY slot_time DESC`,
+		cameraID, since.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query missed snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var missed []models.MissedSnapshot
+	for rows.Next() {
+		var m models.MissedSnapshot
+		if err := rows.Scan(&m.CameraID, &m.SlotTime, &m.Attempts, &m.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan missed snapshot row: %w", err)
+		}
+		missed = append(missed, m)
+	}
+	return missed, rows.Err()
+}
+
+// DeleteMissedSnapshotsBefore prunes missed-slot records older than cutoff.
+func DeleteMissedSnapshotsBefore(cutoff time.Time) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec("DELETE FROM missed_snapshots WHERE slot_time < ?", cutoff.UTC())
+	return err
+}
+
+// --- Camera health ---
+
+// RecordCameraHealth stores one observation of a camera's status.
+func RecordCameraHealth(h models.CameraHealth) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	var upSince sql.NullTime
+	if !h.UpSince.IsZero() {
+		upSince = sql.NullTime{Time: h.UpSince.UTC(), Valid: true}
+	}
+	_, err := db.Exec(
+		`INSERT INTO camera_health (camera_id, checked_at, state, connected, up_since, snapshot, change)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		h.CameraID, h.CheckedAt.UTC(), h.State, h.Connected, upSince, h.Snapshot, h.Change,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record camera health: %w", err)
+	}
+	return nil
+}
+
+// GetCameraHealth returns cameraID's observations with from <= checked_at < to,
+// oldest first.
+func GetCameraHealth(cameraID string, from, to time.Time) ([]models.CameraHealth, error) {
+	return queryCameraHealth(
+		`WHERE camera_id = ? AND checked_at >= ? AND checked_at < ? ORDER BY checked_at`,
+		cameraID, from.UTC(), to.UTC(),
+	)
+}
+
+// GetLatestCameraHealth returns cameraID's most recent observation before t, or
+// nil if there is none.
+func GetLatestCameraHealth(cameraID string, t time.Time) (*models.CameraHealth, error) {
+	health, err := queryCameraHealth(
+		`WHERE camera_id = ? AND checked_at < ? ORDER BY checked_at DESC LIMIT 1`,
+		cameraID, t.UTC(),
+	)
+	if err != nil || len(health) == 0 {
+		return nil, err
+	}
+	return &health[0], nil
+}
+
+func queryCameraHealth(where string, args ...interface{}) ([]models.CameraHealth, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := db.Query(
+		`SELECT camera_id, checked_at, state, connected, up_since, snapshot, change FROM camera_health `+where,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query camera health: %w", err)
+	}
+	defer rows.Close()
+
+	var health []models.CameraHealth
+	for rows.Next() {
+		var h models.CameraHealth
+		var upSince sql.NullTime
+		if err := rows.Scan(&h.CameraID, &h.CheckedAt, &h.State, &h.Connected, &upSince, &h.Snapshot, &h.Change); err != nil {
+			return nil, fmt.Errorf("failed to scan camera health row: %w", err)
+		}
+		if upSince.Valid {
+			h.UpSince = upSince.Time
+		}
+		health = append(health, h)
+	}
+	return health, rows.Err()
+}
+
+// DeleteCameraHealthBefore prunes health observations older than cutoff.
+func DeleteCameraHealthBefore(cutoff time.Time) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec("DELETE FROM camera_health WHERE checked_at < ?", cutoff.UTC())
+	return err
+}
+
+// --- Snapshot index ---
+
+// UpsertSnapshot adds or refreshes the index row for s.Path. A blank hash or
+// source keeps the stored value, so reindexing does not erase capture-time data.
+func UpsertSnapshot(s models.Snapshot) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec(
+		`INSERT INTO snapshots (camera_id, path, captured_at, size, width, height, hash, source, in_gallery, tags)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(path) DO UPDATE SET
+			camera_id = excluded.camera_id,
+			captured_at = excluded.captured_at,
+			size = excluded.size,
+			width = excluded.width,
+			height = excluded.height,
+			hash = COALESCE(NULLIF(excluded.hash, ''), snapshots.hash),
+			source = COALESCE(NULLIF(excluded.source, ''), snapshots.source),
+			in_gallery = excluded.in_gallery,
+			tags = excluded.tags`,
+		s.CameraID, s.Path, s.CapturedAt.UTC(), s.Size, s.Width, s.Height, s.Hash, s.Source, s.InGallery, strings.Join(s.Tags, ","),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to index snapshot %s: %w", s.Path, err)
+	}
+	return nil
+}
+
+const snapshotColumns = "camera_id, path, captured_at, size, width, height, hash, source, in_gallery, tags"
+
+// GetSnapshots returns cameraID's indexed snapshots (or gallery images when
+// inGallery is set) captured in [from, to), oldest first. A zero to means no
+// upper bound. Event frames are not included; see GetEventSnapshots.
+func GetSnapshots(cameraID string, inGallery bool, from, to time.Time) ([]models.Snapshot, error) {
+	query := "SELECT " + snapshotColumns + " FROM snapshots WHERE camera_id = ? AND in_gallery = ? AND tags = '' AND captured_at >= ?"
+	args := []interface{}{cameraID, inGallery, from.UTC()}
+	if !to.IsZero() {
+		query += " AND captured_at < ?"
+		args = append(args, to.UTC())
+	}
+	return querySnapshots(query+" ORDER BY captured_at, path", args...)
+}
+
+// GetEventSnapshots returns cameraID's event frames captured in [from, to),
+// oldest first. A non-empty tag keeps only frames carrying that tag; a zero to
+// means no upper bound.
+func GetEventSnapshots(cameraID, tag string, from, to time.Time) ([]models.Snapshot, error) {
+	query := "SELECT " + snapshotColumns + " FROM snapshots WHERE camera_id = ? AND tags != '' AND captured_at >= ?"
+	args := []interface{}{cameraID, from.UTC()}
+	if !to.IsZero() {
+		query += " AND captured_at < ?"
+		args = append(args, to.UTC())
+	}
+	if tag != "" {
+		query += " AND ',' || tags || ',' LIKE ?"
+		args = append(args, "%,"+tag+",%")
+	}
+	return querySnapshots(query+" ORDER BY captured_at, path", args...)
+}
+
+func querySnapshots(query string, args ...interface{}) ([]models.Snapshot, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []models.Snapshot
+	for rows.Next() {
+		var s models.Snapshot
+		var tags string
+		if err := rows.Scan(&s.CameraID, &s.Path, &s.CapturedAt, &s.Size, &s.Width, &s.Height, &s.Hash, &s.Source, &s.InGallery, &tags); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot row: %w", err)
+		}
+		if tags != "" {
+			s.Tags = strings.Split(tags, ",")
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// CountSnapshots returns how many snapshots (or gallery images) are indexed for
+// cameraID and when the newest was captured (zero if there are none). Event
+// frames are not counted.
+func CountSnapshots(cameraID string, inGallery bool) (int, time.Time, error) {
+	if db == nil {
+		return 0, time.Time{}, fmt.Errorf("database not initialized")
+	}
+	var count int
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM snapshots WHERE camera_id = ? AND in_gallery = ? AND tags = ''", cameraID, inGallery,
+	).Scan(&count); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to count snapshots: %w", err)
+	}
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+	var latest time.Time
+	if err := db.QueryRow(
+		"SELECT captured_at FROM snapshots WHERE camera_id = ? AND in_gallery = ? AND tags = '' ORDER BY captured_at DESC LIMIT 1", cameraID, inGallery,
+	).Scan(&latest); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to query latest snapshot: %w", err)
+	}
+	return count, latest, nil
+}
+
+// GetIndexedSnapshotPaths returns the path of every indexed file.
+func GetIndexedSnapshotPaths() (map[string]bool, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := db.Query("SELECT path FROM snapshots")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshot paths: %w", err)
+	}
+	defer rows.Close()
+
+	paths := make(map[string]bool)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot path: %w", err)
+		}
+		paths[path] = true
+	}
+	return paths, rows.Err()
+}
+
+// DeleteSnapshotRecords removes the index rows for paths.
+func DeleteSnapshotRecords(paths ...string) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if _, err := tx.Exec("DELETE FROM snapshots WHERE path = ?", path); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to delete snapshot record %s: %w", path, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// --- Capture windows ---
+
+const captureWindowColumns = "id, name, interval_sec, start_anchor, start_offset_min, end_anchor, end_offset_min, weekdays, enabled"
+
+// SaveCaptureWindow creates w, or updates the window with the same name.
+func SaveCaptureWindow(w models.CaptureWindow) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := db.Exec(
+		`INSERT INTO capture_windows (name, interval_sec, start_anchor, start_offset_min, end_anchor, end_offset_min, weekdays, enabled)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET
+			interval_sec = excluded.interval_sec,
+			start_anchor = excluded.start_anchor,
+			start_offset_min = excluded.start_offset_min,
+			end_anchor = excluded.end_anchor,
+			end_offset_min = excluded.end_offset_min,
+			weekdays = excluded.weekdays,
+			enabled = excluded.enabled`,
+		w.Name, w.IntervalSec, w.StartAnchor, w.StartOffset, w.EndAnchor, w.EndOffset, w.Weekdays, w.Enabled,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save capture window %s: %w", w.Name, err)
+	}
+	return nil
+}
+
+// GetCaptureWindow returns the capture window called name, or nil if there is none.
+func GetCaptureWindow(name string) (*models.CaptureWindow, error) {
+	windows, err := queryCaptureWindows("SELECT "+captureWindowColumns+" FROM capture_windows WHERE name = ?", name)
+	if err != nil || len(windows) == 0 {
+		return nil, err
+	}
+	return &windows[0], nil
+}
+
+// GetCaptureWindows returns every capture window ordered by name.
+func GetCaptureWindows() ([]models.CaptureWindow, error) {
+	return queryCaptureWindows("SELECT " + captureWindowColumns + " FROM capture_windows ORDER BY name")
+}
+
+// GetEnabledCaptureWindows returns the capture windows the scheduler should apply.
+func GetEnabledCaptureWindows() ([]models.CaptureWindow, error) {
+	return queryCaptureWindows("SELECT " + captureWindowColumns + " FROM capture_windows WHERE enabled = 1 ORDER BY name")
+}
+
+// SetCaptureWindowEnabled turns a capture window on or off.
+func SetCaptureWindowEnabled(name string, enabled bool) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	res, err := db.Exec("UPDATE capture_windows SET enabled = ? WHERE name = ?", enabled, name)
+	if err != nil {
+		return fmt.Errorf("failed to update capture window %s: %w", name, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("capture window %s not found", name)
+	}
+	return nil
+}
+
+// DeleteCaptureWindow removes the capture window called name.
+func DeleteCaptureWindow(name string) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	if _, err := db.Exec("DELETE FROM capture_windows WHERE name = ?", name); err != nil {
+		return fmt.Errorf("failed to delete capture window %s: %w", name, err)
+	}
+	return nil
+}
+
+func queryCaptureWindows(query string, args ...interface{}) ([]models.CaptureWindow, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query capture windows: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []models.CaptureWindow
+	for rows.Next() {
+		var w models.CaptureWindow
+		if err := rows.Scan(&w.ID, &w.Name, &w.IntervalSec, &w.StartAnchor, &w.StartOffset, &w.EndAnchor, &w.EndOffset, &w.Weekdays, &w.Enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan capture window row: %w", err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
 // --- Timelapse tracker ---
 
-// GetTimelapseTracker returns the last snapshot path recorded for timelapseName,
-// or "" if no record exists.
-func GetTimelapseTracker(timelapseName string) (string, error) {
+// GetTimelapseTracker returns the last snapshot path recorded for
+// timelapseName's video in format, or "" if no record exists.
+func GetTimelapseTracker(timelapseName, format string) (string, error) {
 	var path string
 	err := db.QueryRow(
-		"SELECT last_snapshot_path FROM timelapse_trackers WHERE timelapse_name = ?",
-		timelapseName,
+		"SELECT last_snapshot_path FROM timelapse_trackers WHERE timelapse_name = ? AND format = ?",
+		timelapseName, format,
 	).Scan(&path)
 	if err == sql.ErrNoRows {
 		return "", nil
@@ -291,19 +1001,62 @@ func GetTimelapseTracker(timelapseName string) (string, error) {
 	return path, err
 }
 
-// SetTimelapseTracker upserts the last snapshot path for timelapseName.
-func SetTimelapseTracker(timelapseName, snapshotPath string) error {
+// SetTimelapseTracker upserts the last snapshot path for timelapseName's video
+// in format.
+func SetTimelapseTracker(timelapseName, format, snapshotPath string) error {
 	_, err := db.Exec(
-		`INSERT INTO timelapse_trackers (timelapse_name, last_snapshot_path, updated_at)
-		 VALUES (?, ?, CURRENT_TIMESTAMP)
-		 ON CONFLICT(timelapse_name) DO UPDATE SET
+		`INSERT INTO timelapse_trackers (timelapse_name, format, last_snapshot_path, updated_at)
+		 VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		 ON CONFLICT(timelapse_name, format) DO UPDATE SET
 		     last_snapshot_path = excluded.last_snapshot_path,
 		     updated_at = CURRENT_TIMESTAMP`,
-		timelapseName, snapshotPath,
+		timelapseName, format, snapshotPath,
 	)
 	return err
 }
 
+// GetTimelapseParams returns the encoding parameters recorded for
+// timelapseName's video in format, or "" if none are recorded.
+func GetTimelapseParams(timelapseName, format string) (string, error) {
+	var params string
+	err := db.QueryRow(
+		"SELECT params FROM timelapse_trackers WHERE timelapse_name = ? AND format = ?",
+		timelapseName, format,
+	).Scan(&params)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return params, err
+}
+
+// SetTimelapseParams upserts the encoding parameters timelapseName's video in
+// format was built with.
+func SetTimelapseParams(timelapseName, format, params string) error {
+	_, err := db.Exec(
+		`INSERT INTO timelapse_trackers (timelapse_name, format, last_snapshot_path, params, updated_at)
+		 VALUES (?, ?, '', ?, CURRENT_TIMESTAMP)
+		 ON CONFLICT(timelapse_name, format) DO UPDATE SET
+		     params = excluded.params,
+		     updated_at = CURRENT_TIMESTAMP`,
+		timelapseName, format, params,
+	)
+	return err
+}
+
+// DeleteTimelapseTrackers removes the tracker rows for timelapseName's videos
+// in formats.
+func DeleteTimelapseTrackers(timelapseName string, formats ...string) error {
+	for _, format := range formats {
+		if _, err := db.Exec(
+			"DELETE FROM timelapse_trackers WHERE timelapse_name = ? AND format = ?",
+			timelapseName, format,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // --- FFmpeg logs ---
 
 // AppendFFmpegLog inserts a log entry for the given date. timelapseName may be
@@ -2,11 +2,14 @@ package database
 
 import (
 	"database/sql"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"time-machine/pkg/config"
+	"time-machine/pkg/models"
 )
 
 func setupTestDB(t *testing.T) *sql.DB {
@@ -213,3 +216,383 @@ func TestShareLinks(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1, count)
 }
+
+func TestCameras(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	assert.NoError(t, AddCamera("cam1", ""))
+	assert.NoError(t, AddCamera("cam2", "Driveway"))
+	assert.NoError(t, AddCamera("cam1", "ignored")) // existing rows are kept
+	assert.NoError(t, SetCameraName("cam1", "Front Gate"))
+
+	cameras, err := GetCameras()
+	assert.NoError(t, err)
+	assert.Len(t, cameras, 2)
+	assert.Equal(t, "cam1", cameras[0].ID)
+	assert.Equal(t, "Front Gate", cameras[0].Name)
+	assert.True(t, cameras[0].Enabled)
+
+	assert.NoError(t, SetCameraEnabled("cam1", false))
+	enabled, err := GetEnabledCameras()
+	assert.NoError(t, err)
+	assert.Len(t, enabled, 1)
+	assert.Equal(t, "cam2", enabled[0].ID)
+
+	assert.Error(t, SetCameraEnabled("missing", true))
+
+	// Discovery adds unknown cameras disabled and refreshes details of known ones.
+	assert.NoError(t, UpsertDiscoveredCamera(models.Camera{ID: "cam3", Name: "Yard", Model: "camera", State: "CONNECTED"}))
+	assert.NoError(t, UpsertDiscoveredCamera(models.Camera{ID: "cam2", Name: "Drive", State: "DISCONNECTED"}))
+	cameras, err = GetCameras()
+	assert.NoError(t, err)
+	assert.Len(t, cameras, 3)
+	assert.Equal(t, "Drive", cameras[1].Name)
+	assert.Equal(t, "DISCONNECTED", cameras[1].State)
+	assert.True(t, cameras[1].Enabled)
+	assert.Equal(t, "cam3", cameras[2].ID)
+	assert.False(t, cameras[2].Enabled)
+
+	// Saving a source keeps the existing name when none is given and creates new cameras enabled.
+	assert.NoError(t, SaveCameraSource(models.Camera{ID: "cam2", SourceType: "rtsp", SourceURL: "rtsp://host/stream"}))
+	assert.NoError(t, SaveCameraSource(models.Camera{ID: "ipcam", Name: "Garden", SourceType: "http", SourceURL: "https://host/a.jpg", SourceAuth: "digest", SourceFingerprint: "ab:cd"}))
+	cam, err := GetCamera("cam2")
+	assert.NoError(t, err)
+	assert.Equal(t, "Drive", cam.Name)
+	assert.Equal(t, "rtsp", cam.SourceType)
+	cam, err = GetCamera("ipcam")
+	assert.NoError(t, err)
+	assert.True(t, cam.Enabled)
+	assert.Equal(t, "digest", cam.SourceAuth)
+	assert.Equal(t, "ab:cd", cam.SourceFingerprint)
+	cam, err = GetCamera("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, cam)
+
+	// Alarm webhooks name cameras by MAC, in any of Protect's spellings.
+	assert.NoError(t, UpsertDiscoveredCamera(models.Camera{ID: "cam3", Name: "Yard", MAC: "F4E2C6A1B2C3"}))
+	cam, err = GetCameraByMAC("f4:e2:c6:a1:b2:c3")
+	assert.NoError(t, err)
+	if assert.NotNil(t, cam) {
+		assert.Equal(t, "cam3", cam.ID)
+	}
+	cam, err = GetCameraByMAC("")
+	assert.NoError(t, err)
+	assert.Nil(t, cam)
+}
+
+func TestMigrateLegacyCameraLayout(t *testing.T) {
+	dataDir := t.TempDir()
+	config.AppConfig.DataDir = dataDir
+	config.AppConfig.SnapshotsDir = filepath.Join(dataDir, "snapshots")
+	config.AppConfig.GalleryDir = filepath.Join(dataDir, "gallery")
+	config.AppConfig.TargetCameraID = ""
+	config.AppConfig.CameraIDs = nil
+	InitDB()
+	defer db.Close()
+	defer func() { config.AppConfig.TargetCameraID = "" }()
+
+	oldSnap := filepath.Join(config.AppConfig.SnapshotsDir, "2024-01", "01", "12", "2024-01-01-12-00-00.jpg")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(oldSnap), 0755))
+	assert.NoError(t, os.WriteFile(oldSnap, []byte("x"), 0644))
+	assert.NoError(t, os.MkdirAll(config.AppConfig.GalleryDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(config.AppConfig.GalleryDir, "2024-01-01-12.jpg"), []byte("x"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dataDir, "timelapse_week_2024-01-01.webm"), []byte("x"), 0644))
+	assert.NoError(t, SetTimelapseTracker("week_2024-01-01", "webm", oldSnap))
+	_, err := CreateShareLink("/data/timelapse_week_2024-01-01.webm", time.Hour)
+	assert.NoError(t, err)
+
+	config.AppConfig.TargetCameraID = "cam1"
+	MigrateLegacyCameraLayout()
+
+	newSnap := filepath.Join(config.CameraSnapshotsDir("cam1"), "2024-01", "01", "12", "2024-01-01-12-00-00.jpg")
+	assert.FileExists(t, newSnap)
+	assert.NoFileExists(t, oldSnap)
+	assert.FileExists(t, filepath.Join(config.CameraGalleryDir("cam1"), "2024-01-01-12.jpg"))
+	assert.FileExists(t, filepath.Join(config.CameraDataDir("cam1"), "timelapse_week_2024-01-01.webm"))
+
+	tracked, err := GetTimelapseTracker("cam1/week_2024-01-01", "webm")
+	assert.NoError(t, err)
+	assert.Equal(t, newSnap, tracked)
+
+	var sharedPath string
+	assert.NoError(t, db.QueryRow("SELECT file_path FROM shared_links").Scan(&sharedPath))
+	assert.Equal(t, "/data/cameras/cam1/timelapse_week_2024-01-01.webm", sharedPath)
+}
+
+func TestMissedSnapshots(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	slot := time.Date(2024, 3, 1, 9, 15, 0, 0, time.UTC)
+	assert.NoError(t, RecordMissedSnapshot(models.MissedSnapshot{CameraID: "cam1", SlotTime: slot.Add(-time.Hour), Attempts: 4, Reason: "timeout"}))
+	assert.NoError(t, RecordMissedSnapshot(models.MissedSnapshot{CameraID: "cam1", SlotTime: slot, Attempts: 2, Reason: "status 500"}))
+	assert.NoError(t, RecordMissedSnapshot(models.MissedSnapshot{CameraID: "cam2", SlotTime: slot, Reason: "slot skipped"}))
+
+	missed, err := GetMissedSnapshots("cam1", slot.Add(-2*time.Hour))
+	assert.NoError(t, err)
+	if assert.Len(t, missed, 2) {
+		assert.True(t, missed[0].SlotTime.Equal(slot), "newest first")
+		assert.Equal(t, 2, missed[0].Attempts)
+		assert.Equal(t, "status 500", missed[0].Reason)
+	}
+
+	missed, err = GetMissedSnapshots("cam1", slot.Add(-30*time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, missed, 1)
+
+	assert.NoError(t, DeleteMissedSnapshotsBefore(slot))
+	missed, err = GetMissedSnapshots("cam1", time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, missed, 1)
+	missed, err = GetMissedSnapshots("cam2", time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, missed, 1)
+}
+
+func TestCameraHealth(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	upSince := base.Add(-24 * time.Hour)
+	assert.NoError(t, RecordCameraHealth(models.CameraHealth{CameraID: "cam1", CheckedAt: base, State: "CONNECTED", Connected: true, UpSince: upSince, Snapshot: "ok", Change: "monitoring started"}))
+	assert.NoError(t, RecordCameraHealth(models.CameraHealth{CameraID: "cam1", CheckedAt: base.Add(time.Hour), State: "DISCONNECTED", Change: "disconnected: DISCONNECTED"}))
+	assert.NoError(t, RecordCameraHealth(models.CameraHealth{CameraID: "cam2", CheckedAt: base, State: "CONNECTED", Connected: true}))
+
+	health, err := GetCameraHealth("cam1", base, base.Add(2*time.Hour))
+	assert.NoError(t, err)
+	if assert.Len(t, health, 2) {
+		assert.True(t, health[0].CheckedAt.Equal(base), "oldest first")
+		assert.True(t, health[0].Connected)
+		assert.True(t, health[0].UpSince.Equal(upSince))
+		assert.Equal(t, "ok", health[0].Snapshot)
+		assert.False(t, health[1].Connected)
+		assert.True(t, health[1].UpSince.IsZero(), "unknown upSince stays zero")
+	}
+
+	latest, err := GetLatestCameraHealth("cam1", base.Add(30*time.Minute))
+	assert.NoError(t, err)
+	if assert.NotNil(t, latest) {
+		assert.Equal(t, "CONNECTED", latest.State)
+	}
+	latest, err = GetLatestCameraHealth("cam1", base)
+	assert.NoError(t, err)
+	assert.Nil(t, latest)
+
+	assert.NoError(t, DeleteCameraHealthBefore(base.Add(time.Minute)))
+	health, err = GetCameraHealth("cam1", time.Time{}, base.Add(24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, health, 1)
+}
+
+func TestSnapshotIndex(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, path := range []string{"/s/b.jpg", "/s/a.jpg", "/s/c.jpg"} {
+		assert.NoError(t, UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: path, CapturedAt: base.Add(time.Duration(i) * time.Hour), Size: 5000, Hash: "ff00", Source: "UniFi Protect"}))
+	}
+	assert.NoError(t, UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: "/g/2024-03-01-09.jpg", CapturedAt: base, InGallery: true}))
+	assert.NoError(t, UpsertSnapshot(models.Snapshot{CameraID: "cam2", Path: "/s2/a.jpg", CapturedAt: base}))
+
+	snaps, err := GetSnapshots("cam1", false, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, snaps, 3) {
+		assert.Equal(t, "/s/b.jpg", snaps[0].Path, "ordered by capture time")
+		assert.True(t, snaps[0].CapturedAt.Equal(base))
+	}
+
+	snaps, err = GetSnapshots("cam1", false, base.Add(time.Hour), base.Add(2*time.Hour))
+	assert.NoError(t, err)
+	if assert.Len(t, snaps, 1) {
+		assert.Equal(t, "/s/a.jpg", snaps[0].Path)
+	}
+
+	gallery, err := GetSnapshots("cam1", true, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, gallery, 1)
+
+	// A reindex-style upsert without a hash keeps the capture-time hash and source.
+	assert.NoError(t, UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: "/s/b.jpg", CapturedAt: base, Size: 6000, Width: 640, Height: 480}))
+	snaps, _ = GetSnapshots("cam1", false, time.Time{}, base.Add(time.Minute))
+	if assert.Len(t, snaps, 1) {
+		assert.Equal(t, int64(6000), snaps[0].Size)
+		assert.Equal(t, 640, snaps[0].Width)
+		assert.Equal(t, "ff00", snaps[0].Hash)
+		assert.Equal(t, "UniFi Protect", snaps[0].Source)
+	}
+
+	count, latest, err := CountSnapshots("cam1", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.True(t, latest.Equal(base.Add(2*time.Hour)))
+
+	count, latest, err = CountSnapshots("cam3", false)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+	assert.True(t, latest.IsZero())
+
+	assert.NoError(t, DeleteSnapshotRecords("/s/a.jpg", "/s/c.jpg"))
+	paths, err := GetIndexedSnapshotPaths()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/s/b.jpg": true, "/g/2024-03-01-09.jpg": true, "/s2/a.jpg": true}, paths)
+}
+
+func TestEventSnapshots(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	assert.NoError(t, UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: "/s/a.jpg", CapturedAt: base}))
+	assert.NoError(t, UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: "/e/a.jpg", CapturedAt: base, Tags: []string{"motion"}}))
+	assert.NoError(t, UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: "/e/b.jpg", CapturedAt: base.Add(time.Hour), Tags: []string{"motion", "person"}}))
+	assert.NoError(t, UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: "/e/c.jpg", CapturedAt: base.Add(2 * time.Hour), Tags: []string{"personal"}}))
+
+	// Event frames are kept out of the regular snapshot queries.
+	snaps, err := GetSnapshots("cam1", false, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, snaps, 1)
+	count, _, err := CountSnapshots("cam1", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	events, err := GetEventSnapshots("cam1", "", time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+
+	events, err = GetEventSnapshots("cam1", "person", time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1, "tags match whole words only") {
+		assert.Equal(t, "/e/b.jpg", events[0].Path)
+		assert.Equal(t, []string{"motion", "person"}, events[0].Tags)
+	}
+
+	events, err = GetEventSnapshots("cam1", "motion", base.Add(time.Minute), time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestCaptureWindows(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	w := models.CaptureWindow{Name: "sunrise", IntervalSec: 10, StartAnchor: "sunrise", StartOffset: -30, EndAnchor: "sunrise", EndOffset: 30, Weekdays: 0x7f, Enabled: true}
+	assert.NoError(t, SaveCaptureWindow(w))
+	assert.NoError(t, SaveCaptureWindow(models.CaptureWindow{Name: "evening", IntervalSec: 60, StartAnchor: "clock", StartOffset: 18 * 60, EndAnchor: "clock", EndOffset: 19 * 60, Weekdays: 0x3e}))
+
+	windows, err := GetCaptureWindows()
+	assert.NoError(t, err)
+	assert.Len(t, windows, 2)
+	assert.Equal(t, "evening", windows[0].Name, "ordered by name")
+
+	enabled, err := GetEnabledCaptureWindows()
+	assert.NoError(t, err)
+	assert.Len(t, enabled, 1)
+	assert.Equal(t, -30, enabled[0].StartOffset)
+
+	// Saving under an existing name updates that window.
+	w.IntervalSec = 5
+	assert.NoError(t, SaveCaptureWindow(w))
+	got, err := GetCaptureWindow("sunrise")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, got.IntervalSec)
+
+	assert.NoError(t, SetCaptureWindowEnabled("sunrise", false))
+	enabled, _ = GetEnabledCaptureWindows()
+	assert.Empty(t, enabled)
+	assert.Error(t, SetCaptureWindowEnabled("missing", true))
+
+	assert.NoError(t, DeleteCaptureWindow("sunrise"))
+	got, err = GetCaptureWindow("sunrise")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestTimelapseParams(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	params, err := GetTimelapseParams("cam1/week_2026-10-12", "webm")
+	assert.NoError(t, err)
+	assert.Empty(t, params)
+
+	assert.NoError(t, SetTimelapseTracker("cam1/week_2026-10-12", "webm", "/snap.jpg"))
+	assert.NoError(t, SetTimelapseParams("cam1/week_2026-10-12", "webm", "libx264 crf=28"))
+	params, _ = GetTimelapseParams("cam1/week_2026-10-12", "webm")
+	assert.Equal(t, "libx264 crf=28", params)
+	tracked, _ := GetTimelapseTracker("cam1/week_2026-10-12", "webm")
+	assert.Equal(t, "/snap.jpg", tracked, "recording parameters leaves the tracked snapshot alone")
+
+	assert.NoError(t, SetTimelapseParams("cam1/month_2026-10", "mp4", "vp9"))
+	params, _ = GetTimelapseParams("cam1/month_2026-10", "mp4")
+	assert.Equal(t, "vp9", params)
+}
+
+func TestTimelapseTrackerFormats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	assert.NoError(t, SetTimelapseTracker("cam1/24_hour_2026-10-16", "hls", "/a.jpg"))
+	assert.NoError(t, SetTimelapseTracker("cam1/24_hour_2026-10-16", "mp4", "/b.jpg"))
+	hls, _ := GetTimelapseTracker("cam1/24_hour_2026-10-16", "hls")
+	mp4, _ := GetTimelapseTracker("cam1/24_hour_2026-10-16", "mp4")
+	assert.Equal(t, "/a.jpg", hls)
+	assert.Equal(t, "/b.jpg", mp4, "each format is tracked separately")
+
+	assert.NoError(t, DeleteTimelapseTrackers("cam1/24_hour_2026-10-16", "mp4", "webm"))
+	mp4, _ = GetTimelapseTracker("cam1/24_hour_2026-10-16", "mp4")
+	assert.Empty(t, mp4)
+	hls, _ = GetTimelapseTracker("cam1/24_hour_2026-10-16", "hls")
+	assert.Equal(t, "/a.jpg", hls)
+}
+
+func TestMigrateTimelapseTrackersToFormats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Recreate the trackers table as it was before migration 20, and undo the
+	// migrations after it.
+	_, err := db.Exec(`ALTER TABLE cameras DROP COLUMN source_fingerprint;
+		ALTER TABLE jobs DROP COLUMN priority;
+		ALTER TABLE jobs DROP COLUMN attempts;
+		ALTER TABLE jobs DROP COLUMN max_attempts;
+		ALTER TABLE jobs DROP COLUMN run_after;
+		ALTER TABLE jobs DROP COLUMN started_at;
+		ALTER TABLE jobs DROP COLUMN finished_at;
+		ALTER TABLE jobs DROP COLUMN duration_ms;
+		DROP TABLE timelapse_trackers;
+		CREATE TABLE timelapse_trackers (
+			"timelapse_name" TEXT NOT NULL PRIMARY KEY,
+			"last_snapshot_path" TEXT NOT NULL,
+			"updated_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+			"params" TEXT NOT NULL DEFAULT ''
+		);
+		INSERT INTO timelapse_trackers (timelapse_name, last_snapshot_path, params) VALUES ('cam1/week_2026-10-12', '/snap.jpg', 'h264');
+		INSERT OR REPLACE INTO settings (key, value) VALUES ('video.format', 'hls');
+		DELETE FROM schema_migrations WHERE version >= 20`)
+	assert.NoError(t, err)
+
+	RunMigrations()
+	tracked, _ := GetTimelapseTracker("cam1/week_2026-10-12", "hls")
+	params, _ := GetTimelapseParams("cam1/week_2026-10-12", "hls")
+	assert.Equal(t, "/snap.jpg", tracked, "existing trackers belong to the configured format")
+	assert.Equal(t, "h264", params)
+}
+
+func TestMigrateFailedJobsToDead(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO jobs (job_type, status) VALUES ('generate_timelapse', 'failed'), ('cleanup_logs', 'completed');
+		DELETE FROM schema_migrations WHERE version = 24`)
+	assert.NoError(t, err)
+
+	RunMigrations()
+	var failed, dead int
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM jobs WHERE status = 'failed'").Scan(&failed))
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM jobs WHERE status = 'dead'").Scan(&dead))
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, 1, dead, "jobs left failed by earlier versions are dead-lettered")
+}
@@ -1,20 +1,36 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"time-machine/pkg/cachedstats"
 	"time-machine/pkg/config"
 	"time-machine/pkg/database"
+	"time-machine/pkg/jobs"
 	"time-machine/pkg/models"
+	"time-machine/pkg/protect"
+	"time-machine/pkg/services/events"
+	"time-machine/pkg/services/health"
 	"time-machine/pkg/services/settings"
+	"time-machine/pkg/services/snapshot"
 	"time-machine/pkg/services/video"
 	"time-machine/pkg/stats"
 	"time-machine/pkg/util"
+	"time-machine/pkg/worker"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,10 +49,18 @@ func HandleLoginGet(c *gin.Context) {
 	c.HTML(http.StatusOK, "login.html", gin.H{})
 }
 
-// findTimelapseFile looks for a timelapse video in the preferred format, then falls back to WebM.
+// playbackFormats lists the output formats best suited to in-browser playback
+// first: adaptive HLS, then MP4 for its universal hardware decoding, then WebM.
+var playbackFormats = []string{"hls", "mp4", "webm"}
+
+// downloadFormats lists the single-file output formats offered for download.
+var downloadFormats = []string{"mp4", "webm"}
+
+// findTimelapseFile looks for a timelapse video in the preferred format, then in
+// playbackFormats order, so a timelapse written in several formats plays the best one.
 // Returns (diskPath, webPath, format) — all empty strings if nothing found.
 func findTimelapseFile(name, preferredFormat string) (string, string, string) {
-	for _, fmt := range []string{preferredFormat, "webm", "mp4"} {
+	for _, fmt := range append([]string{preferredFormat}, playbackFormats...) {
 		dp := video.DiskPath(name, fmt)
 		if util.FileExists(dp) {
 			return dp, video.TimelapseWebPath(name, fmt), fmt
@@ -45,12 +69,75 @@ func findTimelapseFile(name, preferredFormat string) (string, string, string) {
 	return "", "", ""
 }
 
+// timelapseThumbnails returns the web path of the timelapse's WebVTT seek
+// thumbnails track, or "" if it has none.
+func timelapseThumbnails(name string) string {
+	if !util.FileExists(video.ThumbnailsDiskPath(name)) {
+		return ""
+	}
+	return video.ThumbnailsWebPath(name)
+}
+
+// timelapsePreview returns the web path of the timelapse's animated preview,
+// WebP where there is one, or "" if it has none.
+func timelapsePreview(name string) string {
+	for _, kind := range video.PreviewKinds {
+		if util.FileExists(video.PreviewDiskPath(name, kind)) {
+			return video.PreviewWebPath(name, kind)
+		}
+	}
+	return ""
+}
+
+// timelapseDownloads returns the web paths of the timelapse's downloadable files
+// that exist, keyed by format; HLS playlists are not offered for download.
+func timelapseDownloads(name string) map[string]string {
+	downloads := map[string]string{}
+	for _, fmt := range downloadFormats {
+		if util.FileExists(video.DiskPath(name, fmt)) {
+			downloads[fmt] = video.TimelapseWebPath(name, fmt)
+		}
+	}
+	return downloads
+}
+
+// selectedCameraID returns the camera requested via the "camera" query parameter,
+// falling back to the first enabled camera when it is missing or unknown.
+func selectedCameraID(c *gin.Context) string {
+	active := util.ActiveCameraIDs()
+	requested := c.Query("camera")
+	for _, id := range active {
+		if id == requested {
+			return id
+		}
+	}
+	return active[0]
+}
+
+// cameraPicker lists the enabled cameras for the dashboard's camera selector.
+func cameraPicker() []gin.H {
+	cameras, err := database.GetEnabledCameras()
+	if err != nil {
+		return nil
+	}
+	picker := make([]gin.H, 0, len(cameras))
+	for _, cam := range cameras {
+		name := cam.Name
+		if name == "" {
+			name = cam.ID
+		}
+		picker = append(picker, gin.H{"ID": cam.ID, "Name": name})
+	}
+	return picker
+}
+
 func HandleDashboard(c *gin.Context) {
 	models.VideoStatusData.RLock()
 	defer models.VideoStatusData.RUnlock()
 
 	format := settings.Get("video.format", "webm")
-	dataDir := config.AppConfig.DataDir
+	cameraID := selectedCameraID(c)
+	dataDir := config.CameraDataDir(cameraID)
 
 	availableTimelapses := make(map[string][]gin.H)
 	timelapseOrder := []string{"Daily", "Weekly", "Monthly", "Yearly"}
@@ -63,7 +150,7 @@ func HandleDashboard(c *gin.Context) {
 	for i := 0; i < settings.GetInt("video.daily_days", 30); i++ {
 		targetDate := time.Now().AddDate(0, 0, -i)
 		dateStr := targetDate.Format("2006-01-02")
-		timelapseName := fmt.Sprintf("24_hour_%s", dateStr)
+		timelapseName := util.ScopedName(cameraID, fmt.Sprintf("24_hour_%s", dateStr))
 		_, webPath, usedFmt := findTimelapseFile(timelapseName, format)
 		if webPath != "" {
 			dailyVideos = append(dailyVideos, gin.H{
@@ -71,6 +158,9 @@ func HandleDashboard(c *gin.Context) {
 				"DateDisplay": util.FormatDate(targetDate),
 				"Path":        webPath,
 				"Format":      usedFmt,
+				"Downloads":   timelapseDownloads(timelapseName),
+				"Thumbnails":  timelapseThumbnails(timelapseName),
+				"Preview":     timelapsePreview(timelapseName),
 			})
 		}
 	}
@@ -85,10 +175,14 @@ func HandleDashboard(c *gin.Context) {
 	nameSet := collectTimelapseNames(dataDir)
 
 	for timelapseName := range nameSet {
-		_, webPath, usedFmt := findTimelapseFile(timelapseName, format)
+		scopedName := util.ScopedName(cameraID, timelapseName)
+		_, webPath, usedFmt := findTimelapseFile(scopedName, format)
 		if webPath == "" {
 			continue
 		}
+		downloads := timelapseDownloads(scopedName)
+		thumbnails := timelapseThumbnails(scopedName)
+		preview := timelapsePreview(scopedName)
 
 		switch {
 		case strings.HasPrefix(timelapseName, "week_"):
@@ -103,6 +197,9 @@ func HandleDashboard(c *gin.Context) {
 				"DateDisplay": displayDate,
 				"Path":        webPath,
 				"Format":      usedFmt,
+				"Downloads":   downloads,
+				"Thumbnails":  thumbnails,
+				"Preview":     preview,
 			})
 
 		case strings.HasPrefix(timelapseName, "month_"):
@@ -117,6 +214,9 @@ func HandleDashboard(c *gin.Context) {
 				"DateDisplay": displayDate,
 				"Path":        webPath,
 				"Format":      usedFmt,
+				"Downloads":   downloads,
+				"Thumbnails":  thumbnails,
+				"Preview":     preview,
 			})
 
 		case strings.HasPrefix(timelapseName, "year_"):
@@ -126,11 +226,56 @@ func HandleDashboard(c *gin.Context) {
 				"DateDisplay": yearStr,
 				"Path":        webPath,
 				"Format":      usedFmt,
+				"Downloads":   downloads,
+				"Thumbnails":  thumbnails,
+				"Preview":     preview,
+			})
+
+		case strings.HasPrefix(timelapseName, "window_"):
+			// window_<YYYY-MM-DD>_<window name>
+			rest := strings.TrimPrefix(timelapseName, "window_")
+			if len(rest) < 12 {
+				continue
+			}
+			displayDate := rest[11:] + " — " + rest[:10]
+			if day, err := time.Parse("2006-01-02", rest[:10]); err == nil {
+				displayDate = rest[11:] + " — " + util.FormatDate(day)
+			}
+			availableTimelapses["Window"] = append(availableTimelapses["Window"], gin.H{
+				"Date":        rest,
+				"DateDisplay": displayDate,
+				"Path":        webPath,
+				"Format":      usedFmt,
+				"Downloads":   downloads,
+				"Thumbnails":  thumbnails,
+				"Preview":     preview,
+			})
+
+		case strings.HasPrefix(timelapseName, "activity_"):
+			dateStr := strings.TrimPrefix(timelapseName, "activity_")
+			displayDate := dateStr
+			if day, err := time.Parse("2006-01-02", dateStr); err == nil {
+				displayDate = util.FormatDate(day)
+			}
+			availableTimelapses["Activity"] = append(availableTimelapses["Activity"], gin.H{
+				"Date":        dateStr,
+				"DateDisplay": displayDate,
+				"Path":        webPath,
+				"Format":      usedFmt,
+				"Downloads":   downloads,
+				"Thumbnails":  thumbnails,
+				"Preview":     preview,
 			})
 		}
 	}
+	// Capture-window and activity clips only get a card once there are some.
+	for _, typeName := range []string{"Window", "Activity"} {
+		if len(availableTimelapses[typeName]) > 0 {
+			timelapseOrder = append(timelapseOrder, typeName)
+		}
+	}
 
-	for _, typeName := range []string{"Weekly", "Monthly", "Yearly"} {
+	for _, typeName := range []string{"Weekly", "Monthly", "Yearly", "Window", "Activity"} {
 		sort.Slice(availableTimelapses[typeName], func(i, j int) bool {
 			return availableTimelapses[typeName][i]["Date"].(string) > availableTimelapses[typeName][j]["Date"].(string)
 		})
@@ -148,7 +293,7 @@ func HandleDashboard(c *gin.Context) {
 	}
 
 	user, _ := c.Get("user")
-	cachedData := cachedstats.Cache.GetData()
+	cachedData := cachedstats.Cache.GetCameraData(cameraID)
 
 	defaultDate := time.Now().Format("2006-01-02")
 	defaultDateDisplay := util.FormatDateForDisplay(defaultDate)
@@ -161,19 +306,23 @@ func HandleDashboard(c *gin.Context) {
 		"ImageStats":                cachedData,
 		"SystemInfo":                cachedData["system_info"],
 		"CameraStatus":              cachedData["camera_status"],
+		"CameraHealth":              cachedData["camera_health"],
 		"DefaultGalleryDate":        defaultDate,
 		"DefaultGalleryDateDisplay": defaultDateDisplay,
 		"DefaultGalleryImages":      cachedData["daily_gallery"],
 		"AvailableDates":            cachedData["available_dates"],
 		"User":                      user.(*models.User),
 		"VideoFormat":               format,
+		"Cameras":                   cameraPicker(),
+		"SelectedCamera":            cameraID,
+		"PosterPath":                util.CameraWebPrefix(cameraID) + "latest_snapshot.jpg",
 	}
 
 	c.HTML(http.StatusOK, "index.html", data)
 }
 
 // collectTimelapseNames returns a set of timelapse names found in any format on disk.
-// It covers weekly/monthly/yearly only (not daily, which is date-iterated).
+// It covers weekly/monthly/yearly, capture-window and activity clips, not daily (which is date-iterated).
 func collectTimelapseNames(dataDir string) map[string]bool {
 	names := make(map[string]bool)
 
@@ -188,7 +337,9 @@ func collectTimelapseNames(dataDir string) map[string]bool {
 			// Include weekly/monthly/yearly but not daily (handled by date-iteration)
 			if strings.HasPrefix(name, "week_") ||
 				strings.HasPrefix(name, "month_") ||
-				strings.HasPrefix(name, "year_") {
+				strings.HasPrefix(name, "year_") ||
+				strings.HasPrefix(name, "window_") ||
+				strings.HasPrefix(name, "activity_") {
 				names[name] = true
 			}
 		}
@@ -202,7 +353,9 @@ func collectTimelapseNames(dataDir string) map[string]bool {
 		name := strings.TrimPrefix(dir, "timelapse_")
 		if strings.HasPrefix(name, "week_") ||
 			strings.HasPrefix(name, "month_") ||
-			strings.HasPrefix(name, "year_") {
+			strings.HasPrefix(name, "year_") ||
+			strings.HasPrefix(name, "window_") ||
+			strings.HasPrefix(name, "activity_") {
 			names[name] = true
 		}
 	}
@@ -268,15 +421,62 @@ func HandleLogStream(c *gin.Context) {
 	c.String(http.StatusOK, "%s", content)
 }
 
+// HandleVideoStatus reports whether a timelapse is being generated and the
+// progress and ETA of the FFmpeg encode in flight.
+func HandleVideoStatus(c *gin.Context) {
+	models.VideoStatusData.RLock()
+	defer models.VideoStatusData.RUnlock()
+	c.JSON(http.StatusOK, videoStatusJSON())
+}
+
+// videoStatusJSON returns the video generation status, with the progress of the
+// encode in flight or a nil "progress" if there is none. The caller must hold
+// models.VideoStatusData's read lock.
+func videoStatusJSON() gin.H {
+	s := models.VideoStatusData
+	status := gin.H{
+		"is_running":           s.IsRunning,
+		"currently_generating": s.CurrentlyGenerating,
+		"current_file":         s.CurrentFile,
+		"error":                s.Error,
+		"last_run":             "N/A",
+		"progress":             nil,
+	}
+	if s.LastRun != nil {
+		status["last_run"] = util.FormatDateTime(*s.LastRun)
+	}
+	if s.CurrentFile != "" {
+		p := s.Progress
+		progress := gin.H{
+			"frame":        p.Frame,
+			"total_frames": p.TotalFrames,
+			"fps":          p.FPS,
+			"speed":        p.Speed,
+			"out_time_sec": math.Round(p.OutTime.Seconds()*10) / 10,
+			"percent":      math.Round(p.Percent*10) / 10,
+			"started_at":   util.FormatDateTime(p.StartedAt),
+			"eta_sec":      nil,
+			"eta":          "",
+		}
+		if p.ETA > 0 {
+			progress["eta_sec"] = int(math.Round(p.ETA.Seconds()))
+			progress["eta"] = p.ETA.Round(time.Second).String()
+		}
+		status["progress"] = progress
+	}
+	return status
+}
+
 func HandleSystemStatsJSON(c *gin.Context) {
 	c.JSON(http.StatusOK, stats.GetSystemInfo())
 }
 
 func HandleImageStats(c *gin.Context) {
-	c.JSON(http.StatusOK, cachedstats.Cache.GetData())
+	c.JSON(http.StatusOK, cachedstats.Cache.GetCameraData(selectedCameraID(c)))
 }
 
 func HandleDailyGallery(c *gin.Context) {
+	cameraID := selectedCameraID(c)
 	dateStr := c.Query("date")
 	if dateStr == "" {
 		dateStr = time.Now().Format("2006-01-02")
@@ -285,18 +485,112 @@ func HandleDailyGallery(c *gin.Context) {
 	if dateStr == time.Now().Format("2006-01-02") {
 		c.JSON(http.StatusOK, gin.H{
 			"date":   dateStr,
-			"images": cachedstats.Cache.GetData()["daily_gallery"],
+			"images": cachedstats.Cache.GetCameraData(cameraID)["daily_gallery"],
 		})
 		return
 	}
 
-	images := stats.GetDailyGallery(dateStr)
+	images := stats.GetDailyGallery(cameraID, dateStr)
 	c.JSON(http.StatusOK, gin.H{
 		"date":   dateStr,
 		"images": images,
 	})
 }
 
+// HandleEventGallery lists the selected camera's event frames for ?date=
+// (default today), optionally only those tagged ?tag=.
+func HandleEventGallery(c *gin.Context) {
+	cameraID := selectedCameraID(c)
+	dateStr := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	tag := ""
+	if tags := util.NormaliseEventTags([]string{c.Query("tag")}); len(tags) > 0 {
+		tag = tags[0]
+	}
+
+	frames, err := stats.GetEventGallery(cameraID, dateStr, tag)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"date": dateStr, "tag": tag, "images": frames})
+}
+
+// HandleProtectEvent receives motion and smart-detection webhooks, from a Protect
+// Alarm Manager "Webhook" action or any client posting {"camera", "types"}, and
+// takes a tagged snapshot for each event. Requests must carry events.webhook_token
+// as ?token= or an X-Webhook-Token header; the endpoint answers 404 while events
+// are disabled or no token is set.
+func HandleProtectEvent(c *gin.Context) {
+	expected := settings.Get("events.webhook_token", "")
+	if settings.Get("events.enabled", "false") != "true" || expected == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "event webhook is disabled"})
+		return
+	}
+	token := c.Query("token")
+	if token == "" {
+		token = c.GetHeader("X-Webhook-Token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid webhook token"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	received, err := events.ParseWebhook(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]events.Result, len(received))
+	for i, e := range received {
+		results[i] = events.Handle(e)
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// HandleMissedSlots lists the selected camera's capture slots that produced no
+// snapshot within the last ?hours= hours (default 24).
+func HandleMissedSlots(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be a positive integer"})
+		return
+	}
+	cameraID := selectedCameraID(c)
+	missed, err := database.GetMissedSnapshots(cameraID, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	slots := make([]gin.H, 0, len(missed))
+	for _, m := range missed {
+		slots = append(slots, gin.H{
+			"slot_time": m.SlotTime.Local().Format("2006-01-02 15:04:05"),
+			"attempts":  m.Attempts,
+			"reason":    m.Reason,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"camera": cameraID, "hours": hours, "missed": slots})
+}
+
+// HandleCameraHealth returns the uptime timeline and daily availability of the
+// selected camera for the last ?days= days (default 7), newest first.
+func HandleCameraHealth(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days <= 0 || days > 366 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be an integer from 1 to 366"})
+		return
+	}
+	cameraID := selectedCameraID(c)
+	c.JSON(http.StatusOK, gin.H{"camera": cameraID, "days": health.GetDays(cameraID, days)})
+}
+
 func HandleAdminPage(c *gin.Context) {
 	user, _ := c.Get("user")
 	users, err := database.GetAllUsers()
@@ -310,12 +604,23 @@ func HandleAdminPage(c *gin.Context) {
 	}
 
 	allSettings, _ := settings.GetAll()
+	cameras, _ := database.GetCameras()
+	windows, _ := database.GetCaptureWindows()
 
 	successMessage := c.Query("success")
 	data := gin.H{
-		"User":     user.(*models.User),
-		"Users":    users,
-		"Settings": allSettings,
+		"User":            user.(*models.User),
+		"Users":           users,
+		"Settings":        allSettings,
+		"Cameras":         adminCameraRows(cameras),
+		"CaptureWindows":  captureWindowRows(windows),
+		"EncoderProfiles": video.EncoderProfileNames(),
+	}
+	if active, err := jobs.ListActiveJobs(); err == nil {
+		data["Jobs"] = jobRows(active)
+	}
+	if recent, err := jobs.ListRecentJobs(jobHistoryRows); err == nil {
+		data["JobHistory"] = jobRows(recent)
 	}
 	if successMessage != "" {
 		data["SettingsSuccess"] = successMessage
@@ -324,6 +629,465 @@ func HandleAdminPage(c *gin.Context) {
 	c.HTML(http.StatusOK, "admin.html", data)
 }
 
+// adminCameraRows prepares registered cameras for the admin camera table.
+func adminCameraRows(cameras []models.Camera) []gin.H {
+	rows := make([]gin.H, 0, len(cameras))
+	for _, cam := range cameras {
+		rows = append(rows, gin.H{
+			"ID":       cam.ID,
+			"Name":     cam.Name,
+			"Model":    cam.Model,
+			"State":    cam.State,
+			"Features": featureFlagSummary(cam.FeatureFlags),
+			"Enabled":  cam.Enabled,
+			"Source":   cameraSourceSummary(cam),
+		})
+	}
+	return rows
+}
+
+// captureWindowRows prepares capture windows for the admin capture window table.
+func captureWindowRows(windows []models.CaptureWindow) []gin.H {
+	rows := make([]gin.H, 0, len(windows))
+	for _, w := range windows {
+		rows = append(rows, gin.H{
+			"Name":     w.Name,
+			"Interval": (time.Duration(w.IntervalSec) * time.Second).String(),
+			"Start":    windowEndSummary(w.StartAnchor, w.StartOffset),
+			"End":      windowEndSummary(w.EndAnchor, w.EndOffset),
+			"Weekdays": weekdaySummary(w.Weekdays),
+			"Enabled":  w.Enabled,
+		})
+	}
+	return rows
+}
+
+// windowEndSummary describes one end of a capture window, e.g. "06:30" or
+// "sunrise − 30 min".
+func windowEndSummary(anchor string, offsetMin int) string {
+	switch {
+	case anchor == "clock":
+		return fmt.Sprintf("%02d:%02d", offsetMin/60, offsetMin%60)
+	case offsetMin > 0:
+		return fmt.Sprintf("%s + %d min", anchor, offsetMin)
+	case offsetMin < 0:
+		return fmt.Sprintf("%s − %d min", anchor, -offsetMin)
+	default:
+		return anchor
+	}
+}
+
+// weekdaySummary lists the days in a capture window weekday mask.
+func weekdaySummary(mask int) string {
+	if mask&0x7f == 0x7f {
+		return "Every day"
+	}
+	var days []string
+	for d := time.Monday; ; d = (d + 1) % 7 {
+		if mask&(1<<uint(d)) != 0 {
+			days = append(days, d.String()[:3])
+		}
+		if d == time.Sunday {
+			break
+		}
+	}
+	return strings.Join(days, ", ")
+}
+
+// cameraSourceSummary describes where a camera's snapshots come from, without credentials.
+func cameraSourceSummary(cam models.Camera) string {
+	switch cam.SourceType {
+	case "", snapshot.SourceProtect:
+		return "UniFi Protect"
+	case snapshot.SourceFolder:
+		return "Folder " + cam.SourceURL
+	}
+	target := cam.SourceURL
+	if u, err := url.Parse(cam.SourceURL); err == nil {
+		target = u.Redacted()
+	}
+	return strings.ToUpper(cam.SourceType) + " " + target
+}
+
+// featureFlagSummary turns a Protect featureFlags JSON object into sorted,
+// human-readable entries: enabled boolean flags by name and non-empty lists
+// as "name: a, b". Disabled flags are omitted.
+func featureFlagSummary(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var flags map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &flags); err != nil {
+		return nil
+	}
+	var summary []string
+	for key, val := range flags {
+		switch v := val.(type) {
+		case bool:
+			if v {
+				summary = append(summary, key)
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				continue
+			}
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			summary = append(summary, key+": "+strings.Join(items, ", "))
+		}
+	}
+	sort.Strings(summary)
+	return summary
+}
+
+// HandleDiscoverCameras refreshes the camera list from the Protect controller.
+func HandleDiscoverCameras(c *gin.Context) {
+	user, _ := c.Get("user")
+	discovered, err := snapshot.DiscoverCameras()
+	if err != nil {
+		users, _ := database.GetAllUsers()
+		c.HTML(http.StatusBadGateway, "admin.html", gin.H{
+			"User":        user.(*models.User),
+			"Users":       users,
+			"message":     fmt.Sprintf("Camera discovery failed: %v", err),
+			"messageType": "error",
+		})
+		return
+	}
+	msg := fmt.Sprintf("Discovered %d camera(s). New cameras are disabled until capture is enabled.", len(discovered))
+	c.Redirect(http.StatusFound, "/admin?success="+url.QueryEscape(msg))
+}
+
+// HandleReindexSnapshots rebuilds the snapshot index from the files on disk in the
+// background, e.g. after images were copied in or removed by hand.
+func HandleReindexSnapshots(c *gin.Context) {
+	go func() {
+		if _, _, err := util.ReindexSnapshots(); err != nil {
+			log.Printf("Snapshot reindex failed: %v", err)
+		}
+	}()
+	msg := "Snapshot index rebuild started. Progress is shown in the log."
+	c.Redirect(http.StatusFound, "/admin?success="+url.QueryEscape(msg))
+}
+
+// jobHistoryRows is how many finished jobs the admin page and jobs API show.
+const jobHistoryRows = 50
+
+// HandleListJobs returns the pending and running jobs, and the most recently
+// finished ones, as JSON.
+func HandleListJobs(c *gin.Context) {
+	active, err := jobs.ListActiveJobs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recent, err := jobs.ListRecentJobs(jobHistoryRows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobRows(active), "history": jobRows(recent)})
+}
+
+// HandleCancelJob cancels the job in the :id path parameter, killing its
+// FFmpeg process if it is running. It answers 409 for a job that has already
+// finished or does not exist.
+func HandleCancelJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return
+	}
+	if err := worker.Cancel(id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, worker.ErrJobNotActive) || errors.Is(err, worker.ErrJobNotCancellable) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "status": "cancelled"})
+}
+
+// HandleAdminCancelJob cancels the job posted from the admin page's job list.
+func HandleAdminCancelJob(c *gin.Context) {
+	user, _ := c.Get("user")
+	id, err := strconv.ParseInt(c.PostForm("id"), 10, 64)
+	if err == nil {
+		err = worker.Cancel(id)
+	}
+	if err != nil {
+		users, _ := database.GetAllUsers()
+		c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+			"User":        user.(*models.User),
+			"Users":       users,
+			"message":     fmt.Sprintf("Error cancelling job: %v", err),
+			"messageType": "error",
+		})
+		return
+	}
+	msg := fmt.Sprintf("Job %d cancelled.", id)
+	c.Redirect(http.StatusFound, "/admin?success="+url.QueryEscape(msg))
+}
+
+// jobRows prepares jobs for the admin job lists and the jobs API, naming the
+// timelapse a generate_timelapse job builds. Times and durations a job does
+// not have yet are nil.
+func jobRows(list []models.Job) []gin.H {
+	rows := make([]gin.H, 0, len(list))
+	for _, job := range list {
+		var payload struct {
+			TimelapseName string `json:"timelapse_name"`
+		}
+		_ = json.Unmarshal([]byte(job.Payload), &payload)
+		row := gin.H{
+			"id":           job.ID,
+			"job_type":     job.JobType,
+			"timelapse":    payload.TimelapseName,
+			"status":       job.Status,
+			"cancellable":  job.Status == "pending" || job.Status == "processing" && worker.Cancellable(job.JobType),
+			"priority":     job.Priority,
+			"attempts":     job.Attempts,
+			"max_attempts": job.MaxAttempts,
+			"run_after":    nullTime(job.RunAfter),
+			"started_at":   nullTime(job.StartedAt),
+			"finished_at":  nullTime(job.FinishedAt),
+			"duration_ms":  nil,
+			"duration":     "",
+			"error":        job.Error.String,
+			"result":       job.Result.String,
+			"created_at":   job.CreatedAt,
+			"updated_at":   job.UpdatedAt,
+		}
+		if job.DurationMS.Valid {
+			d := time.Duration(job.DurationMS.Int64) * time.Millisecond
+			row["duration_ms"] = job.DurationMS.Int64
+			if d < time.Minute {
+				row["duration"] = d.Round(100 * time.Millisecond).String()
+			} else {
+				row["duration"] = d.Round(time.Second).String()
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// nullTime returns t's time, or nil if it is NULL.
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// HandleForgetProtectCertificate clears the pinned Protect controller
+// certificate, so the next connection pins whatever the controller presents.
+// Use it after replacing the controller's certificate on purpose.
+func HandleForgetProtectCertificate(c *gin.Context) {
+	user, _ := c.Get("user")
+	if err := settings.Set("protect.cert_fingerprint", ""); err != nil {
+		c.HTML(http.StatusInternalServerError, "admin.html", gin.H{
+			"User":        user.(*models.User),
+			"message":     fmt.Sprintf("Failed to forget the pinned certificate: %v", err),
+			"messageType": "error",
+		})
+		return
+	}
+	log.Println("Pinned Protect controller certificate cleared by an admin.")
+	msg := "Pinned certificate forgotten. The next connection to the controller pins the certificate it presents."
+	c.Redirect(http.StatusFound, "/admin?success="+url.QueryEscape(msg))
+}
+
+// HandleSetCameraEnabled turns capture on or off for a camera. The snapshot
+// scheduler, video jobs and dashboard re-read the camera list, so no restart is needed.
+func HandleSetCameraEnabled(c *gin.Context) {
+	user, _ := c.Get("user")
+	cameraID := c.PostForm("id")
+	enabled := c.PostForm("enabled") == "true"
+
+	if err := database.SetCameraEnabled(cameraID, enabled); err != nil {
+		users, _ := database.GetAllUsers()
+		c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+			"User":        user.(*models.User),
+			"Users":       users,
+			"message":     fmt.Sprintf("Error updating camera: %v", err),
+			"messageType": "error",
+		})
+		return
+	}
+
+	if enabled {
+		c.Redirect(http.StatusFound, "/admin?success=Capture+enabled+for+camera.")
+	} else {
+		c.Redirect(http.StatusFound, "/admin?success=Capture+disabled+for+camera.")
+	}
+}
+
+// HandleSaveCameraSource adds a camera or changes where an existing camera's
+// snapshots come from. A blank password keeps the stored one.
+func HandleSaveCameraSource(c *gin.Context) {
+	user, _ := c.Get("user")
+	cam := models.Camera{
+		ID:                strings.TrimSpace(c.PostForm("id")),
+		Name:              strings.TrimSpace(c.PostForm("name")),
+		SourceType:        c.PostForm("source_type"),
+		SourceURL:         strings.TrimSpace(c.PostForm("source_url")),
+		SourceUsername:    c.PostForm("source_username"),
+		SourcePassword:    c.PostForm("source_password"),
+		SourceAuth:        c.PostForm("source_auth"),
+		SourceFingerprint: strings.TrimSpace(c.PostForm("source_fingerprint")),
+	}
+
+	renderError := func(msg string) {
+		users, _ := database.GetAllUsers()
+		c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+			"User":        user.(*models.User),
+			"Users":       users,
+			"message":     msg,
+			"messageType": "error",
+		})
+	}
+
+	if !config.ValidCameraID(cam.ID) {
+		renderError("Camera ID may only contain letters, digits, '-' and '_'.")
+		return
+	}
+	if cam.SourcePassword == "" {
+		if existing, _ := database.GetCamera(cam.ID); existing != nil && existing.SourceType == cam.SourceType {
+			cam.SourcePassword = existing.SourcePassword
+		}
+	}
+	if _, err := snapshot.NewSnapshotSource(cam); err != nil {
+		renderError(fmt.Sprintf("Invalid snapshot source: %v", err))
+		return
+	}
+	if err := database.SaveCameraSource(cam); err != nil {
+		renderError(fmt.Sprintf("Error saving camera: %v", err))
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin?success=Camera+source+saved.")
+}
+
+// HandleSaveCaptureWindow creates a capture window, or updates the one with the
+// same name. Each end is a clock time (HH:MM) for the "clock" anchor, otherwise
+// an offset in minutes from the sun event.
+func HandleSaveCaptureWindow(c *gin.Context) {
+	user, _ := c.Get("user")
+	renderError := func(msg string) {
+		users, _ := database.GetAllUsers()
+		c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+			"User":        user.(*models.User),
+			"Users":       users,
+			"message":     msg,
+			"messageType": "error",
+		})
+	}
+
+	w := models.CaptureWindow{
+		Name:        strings.TrimSpace(c.PostForm("name")),
+		StartAnchor: c.PostForm("start_anchor"),
+		EndAnchor:   c.PostForm("end_anchor"),
+		Enabled:     true,
+	}
+	var err error
+	if w.IntervalSec, err = strconv.Atoi(c.PostForm("interval_sec")); err != nil {
+		renderError("Invalid capture window: interval must be a whole number of seconds.")
+		return
+	}
+	if w.StartOffset, err = parseWindowEnd(w.StartAnchor, c.PostForm("start")); err != nil {
+		renderError(fmt.Sprintf("Invalid capture window start: %v", err))
+		return
+	}
+	if w.EndOffset, err = parseWindowEnd(w.EndAnchor, c.PostForm("end")); err != nil {
+		renderError(fmt.Sprintf("Invalid capture window end: %v", err))
+		return
+	}
+	for _, d := range c.PostFormArray("weekdays") {
+		if n, err := strconv.Atoi(d); err == nil && n >= 0 && n < 7 {
+			w.Weekdays |= 1 << uint(n)
+		}
+	}
+	if err := util.ValidateCaptureWindow(w); err != nil {
+		renderError(fmt.Sprintf("Invalid capture window: %v", err))
+		return
+	}
+	if err := database.SaveCaptureWindow(w); err != nil {
+		renderError(fmt.Sprintf("Error saving capture window: %v", err))
+		return
+	}
+
+	msg := fmt.Sprintf("Capture window %q saved.", w.Name)
+	if w.StartAnchor != "clock" || w.EndAnchor != "clock" {
+		if _, _, ok := settings.SiteLocation(); !ok {
+			msg += " It will not run until the site latitude and longitude are set."
+		}
+	}
+	c.Redirect(http.StatusFound, "/admin?success="+url.QueryEscape(msg))
+}
+
+// parseWindowEnd reads one end of a capture window: HH:MM for the "clock" anchor,
+// stored as minutes after midnight, or signed minutes for a sun anchor.
+func parseWindowEnd(anchor, val string) (int, error) {
+	val = strings.TrimSpace(val)
+	if anchor == "clock" {
+		t, err := time.Parse("15:04", val)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a time of day (HH:MM)", val)
+		}
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	if val == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an offset in minutes", val)
+	}
+	return n, nil
+}
+
+// HandleSetCaptureWindowEnabled turns a capture window on or off.
+func HandleSetCaptureWindowEnabled(c *gin.Context) {
+	user, _ := c.Get("user")
+	enabled := c.PostForm("enabled") == "true"
+	if err := database.SetCaptureWindowEnabled(c.PostForm("name"), enabled); err != nil {
+		users, _ := database.GetAllUsers()
+		c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+			"User":        user.(*models.User),
+			"Users":       users,
+			"message":     fmt.Sprintf("Error updating capture window: %v", err),
+			"messageType": "error",
+		})
+		return
+	}
+	if enabled {
+		c.Redirect(http.StatusFound, "/admin?success=Capture+window+enabled.")
+	} else {
+		c.Redirect(http.StatusFound, "/admin?success=Capture+window+disabled.")
+	}
+}
+
+// HandleDeleteCaptureWindow removes a capture window. Clips already rendered for
+// it are kept until retention removes them.
+func HandleDeleteCaptureWindow(c *gin.Context) {
+	user, _ := c.Get("user")
+	if err := database.DeleteCaptureWindow(c.PostForm("name")); err != nil {
+		users, _ := database.GetAllUsers()
+		c.HTML(http.StatusInternalServerError, "admin.html", gin.H{
+			"User":        user.(*models.User),
+			"Users":       users,
+			"message":     fmt.Sprintf("Error deleting capture window: %v", err),
+			"messageType": "error",
+		})
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin?success=Capture+window+deleted.")
+}
+
 func HandleCreateUser(c *gin.Context) {
 	username := c.PostForm("username")
 	password := c.PostForm("password")
@@ -453,6 +1217,22 @@ func HandleShareLink(c *gin.Context) {
 
 	shareLink := fmt.Sprintf("%s/public/%s/%s", c.Request.Host, token, filepath.Base(absFilePath))
 	response := gin.H{"shareLink": shareLink}
+	// Chat apps will not inline a video link, so a timelapse's animated
+	// previews are offered through the same token, and the link shared is its
+	// page, which unfurls with them. The file stays available directly.
+	if name := video.TimelapseNameFromWebPath(filePath); name != "" {
+		previewLinks := map[string]string{}
+		for _, kind := range video.PreviewKinds {
+			if util.FileExists(video.PreviewDiskPath(name, kind)) {
+				previewLinks[kind] = fmt.Sprintf("%s/public/%s/preview.%s", c.Request.Host, token, kind)
+			}
+		}
+		if len(previewLinks) > 0 {
+			response["previewLinks"] = previewLinks
+			response["shareLink"] = fmt.Sprintf("%s/public/%s", c.Request.Host, token)
+			response["fileLink"] = shareLink
+		}
+	}
 	if expiry > 0 {
 		response["expiresAt"] = util.FormatDateTime(time.Now().Add(expiry))
 	} else {
@@ -462,6 +1242,9 @@ func HandleShareLink(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// HandlePublicLink serves the file behind a share token. A timelapse with an
+// animated preview gets a page playing it instead, whose Open Graph and Twitter
+// card tags make chat apps and social sites unfurl the link with the preview.
 func HandlePublicLink(c *gin.Context) {
 	token := c.Param("token")
 	filePath, err := database.GetSharedFilePath(token)
@@ -482,13 +1265,74 @@ func HandlePublicLink(c *gin.Context) {
 		return
 	}
 
+	if name := video.TimelapseNameFromWebPath(filePath); name != "" {
+		if previews := sharePreviews(c, token, name); len(previews) > 0 {
+			videoURL := fmt.Sprintf("%s/public/%s/%s", publicBaseURL(c), token, filepath.Base(absFilePath))
+			videoType := shareVideoType(absFilePath)
+			_, base := util.SplitScopedName(name)
+			c.HTML(http.StatusOK, "share.html", gin.H{
+				"Title":      strings.ReplaceAll(base, "_", " ") + " timelapse",
+				"PageURL":    fmt.Sprintf("%s/public/%s", publicBaseURL(c), token),
+				"VideoURL":   videoURL,
+				"VideoType":  videoType,
+				"Embeddable": videoType != "application/x-mpegURL", // unfurlers cannot play HLS
+				"Previews":   previews,
+			})
+			return
+		}
+	}
+
 	c.File(absFilePath)
 }
 
+// sharePreview is an animated preview listed on a share page.
+type sharePreview struct {
+	URL  string
+	Type string
+}
+
+// sharePreviews returns the absolute URLs, through token, of the timelapse
+// name's existing animated previews. GIF is listed first: unfurlers use the
+// first image, and not all of them show animated WebP.
+func sharePreviews(c *gin.Context, token, name string) []sharePreview {
+	var previews []sharePreview
+	for _, kind := range slices.Backward(video.PreviewKinds) {
+		if util.FileExists(video.PreviewDiskPath(name, kind)) {
+			previews = append(previews, sharePreview{
+				URL:  fmt.Sprintf("%s/public/%s/preview.%s", publicBaseURL(c), token, kind),
+				Type: "image/" + kind,
+			})
+		}
+	}
+	return previews
+}
+
+// shareVideoType returns the MIME type of a shared video file.
+func shareVideoType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u8":
+		return "application/x-mpegURL"
+	case ".mp4":
+		return "video/mp4"
+	}
+	return "video/webm"
+}
+
+// publicBaseURL returns the scheme and host the request was made to, honouring
+// X-Forwarded-Proto from a TLS-terminating reverse proxy.
+func publicBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
 // HandlePublicSubpath serves a file from a share token's base path.
 // For HLS tokens (stored path ends in .m3u8) it allows any .m3u8 or .ts file
 // within the same stream directory. For single-file tokens it only serves the
-// exact stored filename.
+// exact stored filename. Tokens for a timelapse also serve its animated
+// previews as preview.webp and preview.gif.
 func HandlePublicSubpath(c *gin.Context) {
 	token := c.Param("token")
 	// Gin's *filepath param always includes a leading "/"; strip it.
@@ -511,6 +1355,11 @@ func HandlePublicSubpath(c *gin.Context) {
 		return
 	}
 
+	if kind, ok := strings.CutPrefix(requestedFile, "preview."); ok && slices.Contains(video.PreviewKinds, kind) {
+		servePublicPreview(c, storedPath, kind)
+		return
+	}
+
 	var absTarget string
 	if strings.HasSuffix(strings.ToLower(absStored), ".m3u8") {
 		// HLS token: allow .m3u8 and .ts files within the stream directory only.
@@ -531,7 +1380,7 @@ func HandlePublicSubpath(c *gin.Context) {
 		}
 		if ext == ".m3u8" {
 			c.Header("Content-Type", "application/x-mpegURL")
-			c.Header("Cache-Control", "public, max-age=3600")
+			c.Header("Cache-Control", "no-cache")
 		} else {
 			c.Header("Content-Type", "video/MP2T")
 			c.Header("Cache-Control", "public, max-age=31536000, immutable")
@@ -559,19 +1408,62 @@ var knownSettingKeys = func() []string {
 
 // integerSettingKeys are keys that must parse as integers.
 var integerSettingKeys = map[string]bool{
-	"snapshot.interval_sec":      true,
-	"video.cron_interval_sec":    true,
-	"video.hls_segment_sec":      true,
-	"video.daily_days":           true,
-	"snapshot.retention_days":    true,
-	"gallery.retention_days":     true,
-	"share.link_expiry_hours":    true,
-	"video.daylight_start_hour":  true,
-	"video.daylight_end_hour":    true,
-	"video.daylight_target_hour": true,
-	"video.weekly_keep":          true,
-	"video.monthly_keep":         true,
-	"video.ffmpeg_threads":       true,
+	"snapshot.interval_sec":               true,
+	"snapshot.retry_max_backoff_sec":      true,
+	"snapshot.min_luma_stddev":            true,
+	"snapshot.frozen_after_min":           true,
+	"video.cron_interval_sec":             true,
+	"video.hls_segment_sec":               true,
+	"video.preview_max_kb":                true,
+	"video.daily_days":                    true,
+	"snapshot.retention_days":             true,
+	"gallery.retention_days":              true,
+	"share.link_expiry_hours":             true,
+	"video.daylight_start_hour":           true,
+	"video.daylight_end_hour":             true,
+	"video.daylight_target_hour":          true,
+	"video.daylight_start_offset_min":     true,
+	"video.daylight_end_offset_min":       true,
+	"video.weekly_keep":                   true,
+	"video.monthly_keep":                  true,
+	"video.ffmpeg_threads":                true,
+	"jobs.generate_timelapse_concurrency": true,
+	"jobs.cleanup_snapshots_concurrency":  true,
+	"jobs.cleanup_gallery_concurrency":    true,
+	"jobs.cleanup_videos_concurrency":     true,
+	"jobs.cleanup_logs_concurrency":       true,
+	"jobs.cleanup_jobs_concurrency":       true,
+	"jobs.max_attempts":                   true,
+	"jobs.retry_base_sec":                 true,
+	"jobs.history_days":                   true,
+	"video.overlay_font_size":             true,
+	"video.daily_fps":                     true,
+	"video.daily_target_sec":              true,
+	"video.daily_hold_sec":                true,
+	"video.window_fps":                    true,
+	"video.window_target_sec":             true,
+	"video.window_hold_sec":               true,
+	"video.activity_fps":                  true,
+	"video.activity_target_sec":           true,
+	"video.activity_hold_sec":             true,
+	"video.weekly_fps":                    true,
+	"video.weekly_target_sec":             true,
+	"video.weekly_hold_sec":               true,
+	"video.monthly_fps":                   true,
+	"video.monthly_target_sec":            true,
+	"video.monthly_hold_sec":              true,
+	"video.yearly_fps":                    true,
+	"video.yearly_target_sec":             true,
+	"video.yearly_hold_sec":               true,
+	"events.cooldown_sec":                 true,
+	"events.retention_days":               true,
+}
+
+// coordinateSettingLimits are keys holding a latitude or longitude in decimal
+// degrees, with the largest magnitude each accepts.
+var coordinateSettingLimits = map[string]float64{
+	"site.latitude":  90,
+	"site.longitude": 180,
 }
 
 // HandleDataFile serves files from DataDir with correct MIME types and cache headers.
@@ -585,13 +1477,21 @@ func HandleDataFile(c *gin.Context) {
 	}
 	switch {
 	case strings.HasSuffix(fp, ".ts"):
-		// HLS segments are write-once; cache for 1 year
+		// HLS segment names are never reused: appends and re-encodes write new
+		// segments rather than replacing published ones; cache for 1 year
 		c.Header("Content-Type", "video/MP2T")
 		c.Header("Cache-Control", "public, max-age=31536000, immutable")
 	case strings.HasSuffix(fp, ".m3u8"):
-		// VOD playlists don't change after generation; 1-hour TTL is safe
+		// Playlists are rewritten as new frames are appended
 		c.Header("Content-Type", "application/x-mpegURL")
-		c.Header("Cache-Control", "public, max-age=3600")
+		c.Header("Cache-Control", "no-cache")
+	case strings.HasSuffix(fp, ".vtt"), strings.HasSuffix(fp, ".sprite.jpg"),
+		strings.HasSuffix(fp, ".preview.webp"), strings.HasSuffix(fp, ".preview.gif"):
+		// Seek thumbnails and previews are rebuilt as a timelapse grows
+		if strings.HasSuffix(fp, ".vtt") {
+			c.Header("Content-Type", "text/vtt; charset=utf-8")
+		}
+		c.Header("Cache-Control", "no-cache")
 	case strings.HasSuffix(fp, ".jpg"), strings.HasSuffix(fp, ".jpeg"):
 		// Snapshots are immutable once captured
 		c.Header("Cache-Control", "public, max-age=86400")
@@ -618,6 +1518,46 @@ func HandleSaveSettings(c *gin.Context) {
 				return
 			}
 		}
+		if limit, ok := coordinateSettingLimits[key]; ok {
+			if deg, err := strconv.ParseFloat(val, 64); err != nil || math.Abs(deg) > limit {
+				c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+					"User":        user.(*models.User),
+					"message":     fmt.Sprintf("Invalid value for %s: must be decimal degrees between -%g and %g", key, limit, limit),
+					"messageType": "error",
+				})
+				return
+			}
+		}
+		if video.IsFormatsSetting(key) {
+			if err := video.ValidateFormatsSetting(key, val); err != nil {
+				c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+					"User":        user.(*models.User),
+					"message":     err.Error(),
+					"messageType": "error",
+				})
+				return
+			}
+		}
+		if video.IsEncoderSetting(key) {
+			if err := video.ValidateEncoderSetting(key, val); err != nil {
+				c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+					"User":        user.(*models.User),
+					"message":     err.Error(),
+					"messageType": "error",
+				})
+				return
+			}
+		}
+		if key == "protect.cert_fingerprint" {
+			if _, err := protect.ParseFingerprints(val); err != nil {
+				c.HTML(http.StatusBadRequest, "admin.html", gin.H{
+					"User":        user.(*models.User),
+					"message":     fmt.Sprintf("Invalid protect.cert_fingerprint: %v", err),
+					"messageType": "error",
+				})
+				return
+			}
+		}
 		if err := settings.Set(key, val); err != nil {
 			c.HTML(http.StatusInternalServerError, "admin.html", gin.H{
 				"User":        user.(*models.User),
@@ -634,3 +1574,26 @@ func HandleSaveSettings(c *gin.Context) {
 
 	c.Redirect(http.StatusFound, "/admin?success=Settings+saved.+Timelapse+regeneration+has+been+queued.")
 }
+
+// servePublicPreview serves the animated preview of kind for the timelapse
+// shared as storedPath.
+func servePublicPreview(c *gin.Context, storedPath, kind string) {
+	name := video.TimelapseNameFromWebPath(storedPath)
+	if name == "" {
+		c.String(http.StatusNotFound, "No preview for this link")
+		return
+	}
+	absPreview := filepath.Clean(video.PreviewDiskPath(name, kind))
+	if !strings.HasPrefix(absPreview, config.AppConfig.DataDir) {
+		c.String(http.StatusForbidden, "Access denied")
+		return
+	}
+	if !util.FileExists(absPreview) {
+		c.String(http.StatusNotFound, "No preview for this link")
+		return
+	}
+	c.Header("Content-Type", "image/"+kind)
+	// Previews are rebuilt as a timelapse grows
+	c.Header("Cache-Control", "no-cache")
+	c.File(absPreview)
+}
@@ -3,21 +3,26 @@ package handlers
 import (
 	"encoding/json"
 	"html/template"
+	"image"
+	"image/jpeg"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"time-machine/pkg/config"
 	"time-machine/pkg/database"
 	"time-machine/pkg/jobs"
 	"time-machine/pkg/models"
 	"time-machine/pkg/services/settings"
+	"time-machine/pkg/services/video"
 )
 
 func setupTestApp(t *testing.T) *gin.Engine {
@@ -57,6 +62,11 @@ func setupTestApp(t *testing.T) *gin.Engine {
 		}
 		os.WriteFile(filePath, []byte(content), 0644)
 	}
+	// The public share page is rendered from the real template so that its link
+	// preview tags can be checked.
+	sharePage, err := os.ReadFile(filepath.Join("..", "..", "web", "templates", "share.html"))
+	require.NoError(t, err)
+	os.WriteFile(filepath.Join(templateDir, "share.html"), sharePage, 0644)
 	r.LoadHTMLGlob(templateDir + "/*")
 
 	return r
@@ -120,6 +130,177 @@ func TestHandleImageStats(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestHandleMissedSlots(t *testing.T) {
+	r := setupTestApp(t)
+	r.GET("/api/missed-slots", HandleMissedSlots)
+
+	assert.NoError(t, database.AddCamera("cam1", ""))
+	assert.NoError(t, database.RecordMissedSnapshot(models.MissedSnapshot{CameraID: "cam1", SlotTime: time.Now().Add(-time.Hour), Attempts: 3, Reason: "timeout"}))
+	assert.NoError(t, database.RecordMissedSnapshot(models.MissedSnapshot{CameraID: "cam1", SlotTime: time.Now().Add(-48 * time.Hour), Reason: "slot skipped"}))
+
+	req, _ := http.NewRequest("GET", "/api/missed-slots?camera=cam1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Missed []map[string]interface{} `json:"missed"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if assert.Len(t, body.Missed, 1) {
+		assert.Equal(t, "timeout", body.Missed[0]["reason"])
+	}
+
+	req, _ = http.NewRequest("GET", "/api/missed-slots?camera=cam1&hours=0", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleCameraHealth(t *testing.T) {
+	r := setupTestApp(t)
+	r.GET("/api/camera-health", HandleCameraHealth)
+
+	assert.NoError(t, database.AddCamera("cam1", ""))
+	assert.NoError(t, database.RecordCameraHealth(models.CameraHealth{CameraID: "cam1", CheckedAt: time.Now().Add(-time.Minute), State: "CONNECTED", Connected: true}))
+
+	req, _ := http.NewRequest("GET", "/api/camera-health?camera=cam1&days=2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Camera string                   `json:"camera"`
+		Days   []map[string]interface{} `json:"days"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "cam1", body.Camera)
+	if assert.Len(t, body.Days, 2) {
+		assert.Equal(t, time.Now().Format("2006-01-02"), body.Days[0]["date"])
+		assert.Equal(t, 100.0, body.Days[0]["availability"])
+	}
+
+	req, _ = http.NewRequest("GET", "/api/camera-health?days=0", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleVideoStatus(t *testing.T) {
+	r := setupTestApp(t)
+	r.GET("/api/video-status", HandleVideoStatus)
+	t.Cleanup(func() {
+		models.VideoStatusData.IsRunning = false
+		models.VideoStatusData.CurrentlyGenerating = ""
+		models.VideoStatusData.CurrentFile = ""
+		models.VideoStatusData.Progress = models.EncodeProgress{}
+	})
+
+	get := func() map[string]interface{} {
+		req, _ := http.NewRequest("GET", "/api/video-status", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	body := get()
+	assert.Equal(t, false, body["is_running"])
+	assert.Nil(t, body["progress"], "no progress while nothing is encoding")
+
+	models.VideoStatusData.IsRunning = true
+	models.VideoStatusData.CurrentlyGenerating = "cam1/year_2026"
+	models.VideoStatusData.CurrentFile = "timelapse_year_2026.mp4"
+	models.VideoStatusData.Progress = models.EncodeProgress{
+		Frame: 150, TotalFrames: 600, FPS: 25, Speed: 0.83, Percent: 25, ETA: 18 * time.Second, StartedAt: time.Now(),
+	}
+	body = get()
+	assert.Equal(t, true, body["is_running"])
+	assert.Equal(t, "cam1/year_2026", body["currently_generating"])
+	assert.Equal(t, "timelapse_year_2026.mp4", body["current_file"])
+	progress, ok := body["progress"].(map[string]interface{})
+	if assert.True(t, ok) {
+		assert.Equal(t, 25.0, progress["percent"])
+		assert.Equal(t, 600.0, progress["total_frames"])
+		assert.Equal(t, 18.0, progress["eta_sec"])
+		assert.Equal(t, "18s", progress["eta"])
+	}
+}
+
+func TestHandleCancelJob(t *testing.T) {
+	r := setupTestApp(t)
+	r.GET("/api/jobs", HandleListJobs)
+	r.POST("/api/jobs/:id/cancel", HandleCancelJob)
+
+	id, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": "cam1/year_2026"}, jobs.PriorityNormal)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/jobs", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Jobs []map[string]interface{} `json:"jobs"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Jobs, 1)
+	assert.Equal(t, "cam1/year_2026", body.Jobs[0]["timelapse"])
+	assert.Equal(t, "pending", body.Jobs[0]["status"])
+
+	cancel := func(id string) int {
+		req, _ := http.NewRequest("POST", "/api/jobs/"+id+"/cancel", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, cancel(strconv.FormatInt(id, 10)))
+	status, _ := jobs.GetJobStatus(id)
+	assert.Equal(t, "cancelled", status)
+	assert.Equal(t, http.StatusConflict, cancel(strconv.FormatInt(id, 10)), "a job can only be cancelled once")
+	assert.Equal(t, http.StatusBadRequest, cancel("abc"))
+
+	req, _ = http.NewRequest("GET", "/api/jobs", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var after struct {
+		Jobs    []map[string]interface{} `json:"jobs"`
+		History []map[string]interface{} `json:"history"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &after))
+	assert.Empty(t, after.Jobs)
+	require.Len(t, after.History, 1, "cancelled jobs are kept in the history")
+	assert.Equal(t, "cancelled", after.History[0]["status"])
+	assert.Nil(t, after.History[0]["duration_ms"], "a job that never started has no run time")
+}
+
+func TestHandleReindexSnapshots(t *testing.T) {
+	r := setupTestApp(t)
+	r.POST("/admin/snapshots/reindex", HandleReindexSnapshots)
+
+	req, _ := http.NewRequest("POST", "/admin/snapshots/reindex", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "/admin?success=")
+}
+
+func TestHandleForgetProtectCertificate(t *testing.T) {
+	r := setupTestApp(t)
+	r.POST("/admin/protect/forget-certificate", HandleForgetProtectCertificate)
+	settings.Set("protect.cert_fingerprint", strings.Repeat("ab", 32))
+
+	req, _ := http.NewRequest("POST", "/admin/protect/forget-certificate", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "/admin?success=")
+	assert.Empty(t, settings.Get("protect.cert_fingerprint", ""))
+}
+
 func TestHandleDailyGallery(t *testing.T) {
 	r := setupTestApp(t)
 	r.GET("/gallery", HandleDailyGallery)
@@ -140,6 +321,65 @@ func TestHandleDailyGallery(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "2023-01-01")
 }
 
+func TestHandleProtectEvent(t *testing.T) {
+	r := setupTestApp(t)
+	r.POST("/api/events/protect", HandleProtectEvent)
+	r.GET("/api/events", HandleEventGallery)
+
+	post := func(query, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/events/protect"+query, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	alarm := `{"alarm": {"name": "Yard", "triggers": [
+		{"key": "motion", "device": "F4E2C6A1B2C3"},
+		{"key": "person", "device": "F4E2C6A1B2C3"}]}}`
+
+	assert.Equal(t, http.StatusNotFound, post("?token=secret", alarm).Code, "disabled by default")
+
+	settings.Set("events.enabled", "true")
+	settings.Set("events.webhook_token", "secret")
+	assert.Equal(t, http.StatusUnauthorized, post("?token=wrong", alarm).Code)
+	assert.Equal(t, http.StatusBadRequest, post("?token=secret", `{"camera": "yard"}`).Code)
+
+	// A folder-source camera stands in for Protect: its newest JPEG is the event frame.
+	sourceDir := t.TempDir()
+	img := image.NewGray(image.Rect(0, 0, 128, 96))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7919 % 251)
+	}
+	f, _ := os.Create(filepath.Join(sourceDir, "frame.jpg"))
+	jpeg.Encode(f, img, &jpeg.Options{Quality: 100})
+	f.Close()
+	assert.NoError(t, database.SaveCameraSource(models.Camera{ID: "yard", SourceType: "folder", SourceURL: sourceDir}))
+	assert.NoError(t, database.UpsertDiscoveredCamera(models.Camera{ID: "yard", MAC: "F4E2C6A1B2C3"}))
+
+	w := post("?token=secret", alarm)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Results, 1) {
+		assert.Equal(t, "captured", resp.Results[0]["status"], resp.Results[0]["reason"])
+		assert.Equal(t, "yard", resp.Results[0]["camera"])
+	}
+
+	req, _ := http.NewRequest("GET", "/api/events?camera=yard&tag=person", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var gallery struct {
+		Images []map[string]string `json:"images"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &gallery))
+	if assert.Len(t, gallery.Images, 1) {
+		assert.Equal(t, "motion,person", gallery.Images[0]["tags"])
+		assert.True(t, strings.HasPrefix(gallery.Images[0]["url"], "/data/cameras/yard/events/"))
+	}
+}
+
 func TestHandleLog(t *testing.T) {
 	r := setupTestApp(t)
 	database.AppendFFmpegLog("2023-01-01", "", "log content")
@@ -279,6 +519,140 @@ func TestHandleDashboard_VideoGrouping(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestFindTimelapseFile(t *testing.T) {
+	setupTestApp(t)
+	name := "cam1/week_2026-10-12"
+	os.MkdirAll(filepath.Join(config.CameraDataDir("cam1"), "hls", "timelapse_week_2026-10-12"), 0755)
+	os.WriteFile(video.DiskPath(name, "webm"), []byte("x"), 0644)
+	os.WriteFile(video.DiskPath(name, "mp4"), []byte("x"), 0644)
+
+	_, webPath, format := findTimelapseFile(name, "webm")
+	assert.Equal(t, "webm", format, "the configured format plays first")
+	assert.Equal(t, video.TimelapseWebPath(name, "webm"), webPath)
+
+	os.WriteFile(video.DiskPath(name, "hls"), []byte("#EXTM3U"), 0644)
+	assert.Equal(t, map[string]string{
+		"mp4":  video.TimelapseWebPath(name, "mp4"),
+		"webm": video.TimelapseWebPath(name, "webm"),
+	}, timelapseDownloads(name), "single-file formats are offered for download")
+
+	os.Remove(video.DiskPath(name, "webm"))
+	_, _, format = findTimelapseFile(name, "webm")
+	assert.Equal(t, "hls", format, "otherwise HLS is preferred for playback")
+	assert.Equal(t, map[string]string{"mp4": video.TimelapseWebPath(name, "mp4")}, timelapseDownloads(name))
+
+	_, _, format = findTimelapseFile("cam1/week_2026-10-05", "hls")
+	assert.Empty(t, format)
+
+	assert.Empty(t, timelapseThumbnails(name))
+	os.WriteFile(video.ThumbnailsDiskPath(name), []byte("WEBVTT\n"), 0644)
+	assert.Equal(t, video.ThumbnailsWebPath(name), timelapseThumbnails(name), "seek thumbnails are shared by every format")
+}
+
+func TestSelectedCameraID(t *testing.T) {
+	setupTestApp(t)
+	database.AddCamera("cam1", "")
+	database.AddCamera("cam2", "")
+
+	for query, want := range map[string]string{"": "cam1", "camera=cam2": "cam2", "camera=unknown": "cam1"} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/?"+query, nil)
+		assert.Equal(t, want, selectedCameraID(c), query)
+	}
+}
+
+func TestHandleSetCameraEnabled(t *testing.T) {
+	r := setupTestApp(t)
+	database.AddCamera("cam1", "")
+	r.POST("/admin/cameras/enabled", func(c *gin.Context) {
+		c.Set("user", &models.User{Username: "admin", IsAdmin: true})
+		HandleSetCameraEnabled(c)
+	})
+
+	form := strings.NewReader("id=cam1&enabled=false")
+	req, _ := http.NewRequest("POST", "/admin/cameras/enabled", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	enabled, _ := database.GetEnabledCameras()
+	assert.Empty(t, enabled)
+
+	form = strings.NewReader("id=missing&enabled=true")
+	req, _ = http.NewRequest("POST", "/admin/cameras/enabled", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleSaveCameraSource(t *testing.T) {
+	r := setupTestApp(t)
+	r.POST("/admin/cameras/source", func(c *gin.Context) {
+		c.Set("user", &models.User{Username: "admin", IsAdmin: true})
+		HandleSaveCameraSource(c)
+	})
+	post := func(body string) int {
+		req, _ := http.NewRequest("POST", "/admin/cameras/source", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusFound, post("id=ipcam&name=Garden&source_type=http&source_url=http://host/a.jpg&source_username=u&source_password=p"))
+	assert.Equal(t, http.StatusFound, post("id=ipcam&source_type=http&source_url=http://host/b.jpg&source_username=u"))
+	cam, _ := database.GetCamera("ipcam")
+	assert.Equal(t, "http://host/b.jpg", cam.SourceURL)
+	assert.Equal(t, "p", cam.SourcePassword, "blank password keeps the stored one")
+
+	assert.Equal(t, http.StatusBadRequest, post("id=../x&source_type=http&source_url=http://host/a.jpg"))
+	assert.Equal(t, http.StatusBadRequest, post("id=bad&source_type=rtsp&source_url=http://host/a.jpg"))
+}
+
+func TestHandleSaveCaptureWindow(t *testing.T) {
+	r := setupTestApp(t)
+	r.POST("/admin/capture-windows", func(c *gin.Context) {
+		c.Set("user", &models.User{Username: "admin", IsAdmin: true})
+		HandleSaveCaptureWindow(c)
+	})
+	post := func(body string) int {
+		req, _ := http.NewRequest("POST", "/admin/capture-windows", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusFound, post("name=sunrise&interval_sec=10&start_anchor=sunrise&start=-30&end_anchor=clock&end=07:15&weekdays=1&weekdays=5"))
+	w, _ := database.GetCaptureWindow("sunrise")
+	if assert.NotNil(t, w) {
+		assert.Equal(t, -30, w.StartOffset)
+		assert.Equal(t, 7*60+15, w.EndOffset, "clock times are stored as minutes after midnight")
+		assert.Equal(t, 1<<1|1<<5, w.Weekdays)
+		assert.True(t, w.Enabled)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post("name=Bad Name&interval_sec=10&start_anchor=clock&start=06:00&end_anchor=clock&end=07:00&weekdays=1"))
+	assert.Equal(t, http.StatusBadRequest, post("name=x&interval_sec=10&start_anchor=clock&start=6am&end_anchor=clock&end=07:00&weekdays=1"))
+	assert.Equal(t, http.StatusBadRequest, post("name=x&interval_sec=10&start_anchor=clock&start=06:00&end_anchor=clock&end=07:00"), "no weekdays")
+}
+
+func TestWindowSummaries(t *testing.T) {
+	assert.Equal(t, "06:30", windowEndSummary("clock", 390))
+	assert.Equal(t, "sunrise − 30 min", windowEndSummary("sunrise", -30))
+	assert.Equal(t, "sunset", windowEndSummary("sunset", 0))
+	assert.Equal(t, "Every day", weekdaySummary(0x7f))
+	assert.Equal(t, "Mon, Fri, Sun", weekdaySummary(1<<1|1<<5|1))
+}
+
+func TestFeatureFlagSummary(t *testing.T) {
+	raw := `{"hasHdr":true,"hasMic":false,"smartDetectTypes":["person","vehicle"],"videoModes":[]}`
+	assert.Equal(t, []string{"hasHdr", "smartDetectTypes: person, vehicle"}, featureFlagSummary(raw))
+	assert.Nil(t, featureFlagSummary(""))
+}
+
 func TestHandleAdminPageWithUsers(t *testing.T) {
 	r := setupTestApp(t)
 	database.CreateUser("user1", "pass1", false)
@@ -484,6 +858,7 @@ func TestHandlePublicSubpath_HLS(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Header().Get("Content-Type"), "mpegURL")
 	assert.Equal(t, "#EXTM3U", w.Body.String())
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"), "playlists change as frames are appended")
 
 	// Segment → 200 with correct Content-Type
 	req, _ = http.NewRequest("GET", "/public/"+token+"/segment_0.ts", nil)
@@ -492,6 +867,7 @@ func TestHandlePublicSubpath_HLS(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Header().Get("Content-Type"), "MP2T")
 	assert.Equal(t, "ts data", w.Body.String())
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
 
 	// Non-HLS extension → 403
 	req, _ = http.NewRequest("GET", "/public/"+token+"/secret.txt", nil)
@@ -530,6 +906,80 @@ func TestHandlePublicSubpath_ExpiredToken(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestHandlePublicSubpath_Preview(t *testing.T) {
+	r := setupPublicSubpathRouter(t)
+	r.POST("/share", HandleShareLink)
+
+	os.WriteFile(filepath.Join(config.AppConfig.DataDir, "timelapse_week_2026-10-12.mp4"), []byte("mp4 content"), 0644)
+	os.WriteFile(video.PreviewDiskPath("week_2026-10-12", "gif"), []byte("gif content"), 0644)
+
+	req, _ := http.NewRequest("POST", "/share", strings.NewReader("filePath=/data/timelapse_week_2026-10-12.mp4"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		ShareLink    string            `json:"shareLink"`
+		PreviewLinks map[string]string `json:"previewLinks"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.PreviewLinks, 1, "only existing previews are offered")
+	token := strings.Split(resp.ShareLink, "/")[2]
+	assert.True(t, strings.HasSuffix(resp.PreviewLinks["gif"], "/public/"+token+"/preview.gif"))
+
+	// Preview → 200 as an image
+	req, _ = http.NewRequest("GET", "/public/"+token+"/preview.gif", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/gif", w.Header().Get("Content-Type"))
+	assert.Equal(t, "gif content", w.Body.String())
+
+	// Missing or unknown preview kinds → 404 and 403
+	req, _ = http.NewRequest("GET", "/public/"+token+"/preview.webp", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	req, _ = http.NewRequest("GET", "/public/"+token+"/preview.png", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// HLS tokens serve the same timelapse's preview
+	hlsToken, _ := database.CreateShareLink("/data/hls/timelapse_week_2026-10-12/master.m3u8", time.Hour)
+	req, _ = http.NewRequest("GET", "/public/"+hlsToken+"/preview.gif", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	req, _ = http.NewRequest("GET", "/public/"+hlsToken, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `og:image`)
+	assert.NotContains(t, w.Body.String(), `og:video`, "unfurlers cannot play HLS")
+
+	// The shared link is the timelapse's page, which unfurls with the preview
+	assert.Equal(t, "/public/"+token, strings.TrimPrefix(resp.ShareLink, strings.Split(resp.ShareLink, "/")[0]))
+	req, _ = http.NewRequest("GET", "http://tm.example/public/"+token, nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	page := w.Body.String()
+	assert.Contains(t, page, `<meta property="og:image" content="https://tm.example/public/`+token+`/preview.gif">`)
+	assert.Contains(t, page, `<meta name="twitter:card" content="summary_large_image">`)
+	assert.Contains(t, page, `<meta property="og:video" content="https://tm.example/public/`+token+`/timelapse_week_2026-10-12.mp4">`)
+	assert.Contains(t, page, `<meta property="og:video:type" content="video/mp4">`)
+
+	// Files that are not timelapses have no preview
+	otherToken, _ := database.CreateShareLink("/data/test.mp4", time.Hour)
+	req, _ = http.NewRequest("GET", "/public/"+otherToken+"/preview.gif", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestHandlePublicSubpath_InvalidToken(t *testing.T) {
 	r := setupPublicSubpathRouter(t)
 
@@ -4,17 +4,55 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 	"time-machine/pkg/models"
+	"time-machine/pkg/services/settings"
 )
 
 var db *sql.DB
 
+// Job priorities: pending jobs run highest priority first, then oldest first.
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// Failed jobs are retried after retryBaseDelay (jobs.retry_base_sec), doubling
+// with each attempt up to maxRetryDelay, until they have run jobs.max_attempts
+// times.
+const (
+	defaultMaxAttempts = 3
+	defaultRetryBase   = 60 // seconds
+	maxRetryDelay      = 6 * time.Hour
+)
+
+// jobColumns are the columns scanned into a models.Job by scanJob.
+const jobColumns = "id, job_type, payload, status, priority, attempts, max_attempts, run_after, started_at, finished_at, duration_ms, error, result, created_at, updated_at"
+
+// runnable restricts a query to pending jobs whose retry backoff has passed.
+const runnable = "status = 'pending' AND (run_after IS NULL OR run_after <= datetime('now'))"
+
+// finishedStatuses are the statuses of jobs that will not run again.
+const finishedStatuses = "('completed', 'dead', 'cancelled')"
+
+// wake is signalled whenever a job is inserted, so the worker starts it
+// without waiting for its next poll.
+var wake = make(chan struct{}, 1)
+
 func InitJobs(database *sql.DB) {
 	db = database
 }
 
-// CreateJob creates a new job in the database, skipping if an identical job is already pending or processing.
-var CreateJob = func(jobType string, payload interface{}) (int64, error) {
+// Wake returns a channel that receives when new jobs have been queued. A burst
+// of inserts may be reported by a single receive.
+func Wake() <-chan struct{} {
+	return wake
+}
+
+// CreateJob creates a new job in the database with the given priority, skipping
+// if an identical job is already pending or processing.
+var CreateJob = func(jobType string, payload interface{}, priority int) (int64, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return 0, fmt.Errorf("failed to marshal job payload: %w", err)
@@ -33,7 +71,8 @@ var CreateJob = func(jobType string, payload interface{}) (int64, error) {
 		return 0, nil // Already queued or running — skip silently
 	}
 
-	res, err := db.Exec("INSERT INTO jobs (job_type, payload) VALUES (?, ?)", jobType, payloadStr)
+	maxAttempts := max(settings.GetInt("jobs.max_attempts", defaultMaxAttempts), 1)
+	res, err := db.Exec("INSERT INTO jobs (job_type, payload, priority, max_attempts) VALUES (?, ?, ?, ?)", jobType, payloadStr, priority, maxAttempts)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert job: %w", err)
 	}
@@ -43,44 +82,176 @@ var CreateJob = func(jobType string, payload interface{}) (int64, error) {
 		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
 	}
 
+	select {
+	case wake <- struct{}{}:
+	default: // a wake-up is already pending
+	}
 	return id, nil
 }
 
-// GetPendingJob retrieves the oldest pending job from the database.
-func GetPendingJob() (*models.Job, error) {
-	row := db.QueryRow("SELECT id, job_type, payload, status, error, created_at, updated_at FROM jobs WHERE status = 'pending' ORDER BY created_at ASC LIMIT 1")
+// GetPendingJobs returns every pending job that is due, in the order they
+// should run: the highest priority, then the oldest. Jobs waiting out a retry
+// backoff are left until it passes.
+func GetPendingJobs() ([]models.Job, error) {
+	return queryJobs("SELECT " + jobColumns + " FROM jobs WHERE " + runnable + " ORDER BY priority DESC, created_at ASC, id ASC")
+}
 
-	var job models.Job
-	err := row.Scan(&job.ID, &job.JobType, &job.Payload, &job.Status, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+// SetJobResult records a summary of the work a job did.
+func SetJobResult(id int64, result string) error {
+	_, err := db.Exec("UPDATE jobs SET result = ? WHERE id = ?", result, id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil // No pending jobs
+		return fmt.Errorf("failed to set job result: %w", err)
+	}
+	return nil
+}
+
+// ListActiveJobs returns the processing jobs, then the pending jobs in the
+// order they will run.
+func ListActiveJobs() ([]models.Job, error) {
+	return queryJobs("SELECT " + jobColumns + " FROM jobs WHERE status IN ('pending', 'processing') ORDER BY status = 'processing' DESC, priority DESC, created_at ASC, id ASC")
+}
+
+// ListRecentJobs returns up to limit finished jobs, most recent first.
+func ListRecentJobs(limit int) ([]models.Job, error) {
+	return queryJobs("SELECT "+jobColumns+" FROM jobs WHERE status IN "+finishedStatuses+" ORDER BY COALESCE(finished_at, updated_at) DESC, id DESC LIMIT ?", limit)
+}
+
+// StartJob marks a pending job as processing and counts the attempt. It
+// reports false, changing nothing, if the job is no longer pending, such as
+// when it was cancelled after being fetched.
+func StartJob(id int64) (bool, error) {
+	result, err := db.Exec("UPDATE jobs SET status = 'processing', attempts = attempts + 1, run_after = NULL, started_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), finished_at = NULL, duration_ms = NULL WHERE id = ? AND status = 'pending'", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to start job %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to start job %d: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+// FinishJob records that a job will not run again: status is "completed",
+// "cancelled" or, for a job that can never succeed, "dead". The time it took
+// since StartJob is kept with it, along with jobErr, if any.
+func FinishJob(id int64, status string, jobErr error) error {
+	_, err := db.Exec(`UPDATE jobs SET status = ?, error = ?, finished_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+		duration_ms = CAST(ROUND((julianday('now') - julianday(started_at)) * 86400000) AS INTEGER)
+		WHERE id = ?`, status, errorString(jobErr), id)
+	if err != nil {
+		return fmt.Errorf("failed to finish job %d: %w", id, err)
+	}
+	return nil
+}
+
+// FailJob records that an attempt at a job failed with jobErr. A job with
+// attempts left goes back to pending, to run again after RetryDelay; one on
+// its last attempt is dead-lettered. It returns the job's new status.
+func FailJob(id int64, jobErr error) (string, error) {
+	var attempts, maxAttempts int
+	err := db.QueryRow("SELECT attempts, max_attempts FROM jobs WHERE id = ?", id).Scan(&attempts, &maxAttempts)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read attempts of job %d: %w", id, err)
+	}
+	if attempts >= maxAttempts {
+		return "dead", FinishJob(id, "dead", jobErr)
+	}
+
+	delay := fmt.Sprintf("+%d seconds", int(RetryDelay(attempts).Seconds()))
+	_, err = db.Exec(`UPDATE jobs SET status = 'pending', error = ?, run_after = datetime('now', ?),
+		duration_ms = CAST(ROUND((julianday('now') - julianday(started_at)) * 86400000) AS INTEGER)
+		WHERE id = ?`, errorString(jobErr), delay, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to schedule retry of job %d: %w", id, err)
+	}
+	return "pending", nil
+}
+
+// RetryDelay returns how long to wait before retrying a job that has failed
+// attempts times: jobs.retry_base_sec, doubled for each attempt after the
+// first, up to maxRetryDelay.
+func RetryDelay(attempts int) time.Duration {
+	delay := time.Duration(max(settings.GetInt("jobs.retry_base_sec", defaultRetryBase), 1)) * time.Second
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// PruneJobs deletes finished jobs older than retentionDays and returns how
+// many were removed.
+func PruneJobs(retentionDays int) (int64, error) {
+	res, err := db.Exec("DELETE FROM jobs WHERE status IN "+finishedStatuses+" AND COALESCE(finished_at, updated_at) < datetime('now', ?)",
+		fmt.Sprintf("-%d days", retentionDays))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// errorString returns err's message for the error column, or NULL.
+func errorString(err error) sql.NullString {
+	if err == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: err.Error(), Valid: true}
+}
+
+// queryJobs runs a query selecting jobColumns and scans every row.
+func queryJobs(query string, args ...interface{}) ([]models.Job, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
 		}
-		return nil, fmt.Errorf("failed to get pending job: %w", err)
+		list = append(list, *job)
 	}
+	return list, rows.Err()
+}
 
+// scanJob scans a row of jobColumns.
+func scanJob(row interface{ Scan(...interface{}) error }) (*models.Job, error) {
+	var job models.Job
+	if err := row.Scan(&job.ID, &job.JobType, &job.Payload, &job.Status, &job.Priority, &job.Attempts, &job.MaxAttempts,
+		&job.RunAfter, &job.StartedAt, &job.FinishedAt, &job.DurationMS, &job.Error, &job.Result, &job.CreatedAt, &job.UpdatedAt); err != nil {
+		return nil, err
+	}
 	return &job, nil
 }
 
-// DeleteJob removes a job from the database.
-func DeleteJob(id int64) error {
-	_, err := db.Exec("DELETE FROM jobs WHERE id = ?", id)
+// GetJobStatus returns the status of a job, or "" if there is no such job.
+func GetJobStatus(id int64) (string, error) {
+	var status string
+	err := db.QueryRow("SELECT status FROM jobs WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to delete job %d: %w", id, err)
+		return "", fmt.Errorf("failed to get job status: %w", err)
 	}
-	return nil
+	return status, nil
 }
 
-// UpdateJobStatus updates the status and error of a job.
-func UpdateJobStatus(id int64, status string, jobErr error) error {
-	var errStr sql.NullString
-	if jobErr != nil {
-		errStr.String = jobErr.Error()
-		errStr.Valid = true
+// CancelPendingJob marks a job that has not started as cancelled, so the
+// worker never picks it up. It reports whether the job was pending.
+func CancelPendingJob(id int64) (bool, error) {
+	res, err := db.Exec("UPDATE jobs SET status = 'cancelled' WHERE id = ? AND status = 'pending'", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel job %d: %w", id, err)
 	}
-	_, err := db.Exec("UPDATE jobs SET status = ?, error = ? WHERE id = ?", status, errStr, id)
+	n, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to update job status: %w", err)
+		return false, fmt.Errorf("failed to cancel job %d: %w", id, err)
 	}
-	return nil
+	return n > 0, nil
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
@@ -20,7 +21,15 @@ func setupTestDB(t *testing.T) *sql.DB {
 		"job_type" TEXT NOT NULL,
 		"payload" TEXT,
 		"status" TEXT NOT NULL DEFAULT 'pending',
+		"priority" INTEGER NOT NULL DEFAULT 0,
+		"attempts" INTEGER NOT NULL DEFAULT 0,
+		"max_attempts" INTEGER NOT NULL DEFAULT 3,
+		"run_after" DATETIME,
+		"started_at" DATETIME,
+		"finished_at" DATETIME,
+		"duration_ms" INTEGER,
 		"error" TEXT,
+		"result" TEXT,
 		"created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
 		"updated_at" DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
@@ -36,7 +45,7 @@ func TestCreateJob(t *testing.T) {
 	defer db.Close()
 
 	payload := map[string]string{"file": "test.mp4"}
-	id, err := CreateJob("video_processing", payload)
+	id, err := CreateJob("video_processing", payload, PriorityNormal)
 	assert.NoError(t, err)
 	assert.Greater(t, id, int64(0))
 
@@ -54,70 +63,204 @@ func TestCreateJob(t *testing.T) {
 	assert.Equal(t, payload, returnedPayload)
 }
 
-func TestGetPendingJob(t *testing.T) {
+func TestGetPendingJobs(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
 	// Test when no pending jobs
-	job, err := GetPendingJob()
+	pending, err := GetPendingJobs()
 	assert.NoError(t, err)
-	assert.Nil(t, job)
+	assert.Empty(t, pending)
 
 	// Create a job
 	payload := map[string]string{"file": "test.mp4"}
-	id, err := CreateJob("video_processing", payload)
+	id, err := CreateJob("video_processing", payload, PriorityNormal)
 	assert.NoError(t, err)
 
 	// Test getting the pending job
-	job, err = GetPendingJob()
+	pending, err = GetPendingJobs()
 	assert.NoError(t, err)
-	assert.NotNil(t, job)
-	assert.Equal(t, id, job.ID)
-	assert.Equal(t, "video_processing", job.JobType)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, id, pending[0].ID)
+		assert.Equal(t, "video_processing", pending[0].JobType)
+	}
+
+	// Started jobs are no longer pending
+	startJob(t, id)
+	pending, err = GetPendingJobs()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
 }
 
-func TestDeleteJob(t *testing.T) {
+func TestSetJobResult(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	id, err := CreateJob("test_job", nil)
+	id, err := CreateJob("test_job", nil, PriorityNormal)
+	assert.NoError(t, err)
+	startJob(t, id)
+	assert.NoError(t, SetJobResult(id, "sampled 5000 of 8760 frames"))
+	assert.NoError(t, FinishJob(id, "completed", nil))
+
+	recent, err := ListRecentJobs(10)
 	assert.NoError(t, err)
+	if assert.Len(t, recent, 1) {
+		assert.True(t, recent[0].Result.Valid, "the result is kept with the finished job")
+		assert.Equal(t, "sampled 5000 of 8760 frames", recent[0].Result.String)
+	}
+}
+
+func TestCancelPendingJob(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
 
-	err = DeleteJob(id)
+	pending, err := CreateJob("cleanup_snapshots", nil, PriorityNormal)
+	assert.NoError(t, err)
+	running, err := CreateJob("cleanup_videos", nil, PriorityNormal)
 	assert.NoError(t, err)
+	startJob(t, running)
 
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM jobs WHERE id = ?", id).Scan(&count)
+	active, err := ListActiveJobs()
 	assert.NoError(t, err)
-	assert.Equal(t, 0, count)
+	assert.Len(t, active, 2)
+
+	cancelled, err := CancelPendingJob(pending)
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+	status, err := GetJobStatus(pending)
+	assert.NoError(t, err)
+	assert.Equal(t, "cancelled", status)
+	started, err := StartJob(pending)
+	assert.NoError(t, err)
+	assert.False(t, started, "a cancelled job cannot be started")
+	started, err = StartJob(running)
+	assert.NoError(t, err)
+	assert.False(t, started, "a running job cannot be started twice")
+
+	cancelled, err = CancelPendingJob(running)
+	assert.NoError(t, err)
+	assert.False(t, cancelled, "running jobs are cancelled through the worker")
+
+	active, err = ListActiveJobs()
+	assert.NoError(t, err)
+	if assert.Len(t, active, 1) {
+		assert.Equal(t, running, active[0].ID)
+	}
+
+	status, err = GetJobStatus(9999)
+	assert.NoError(t, err)
+	assert.Empty(t, status)
 }
 
-func TestUpdateJobStatus(t *testing.T) {
+func TestFailJob_RetriesThenDeadLetters(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	id, err := CreateJob("test_job", nil)
+	id, err := CreateJob("generate_timelapse", map[string]string{"timelapse_name": "year_2026"}, PriorityNormal)
 	assert.NoError(t, err)
 
-	// Test updating to "processing"
-	err = UpdateJobStatus(id, "processing", nil)
+	for attempt := 1; attempt < defaultMaxAttempts; attempt++ {
+		startJob(t, id)
+		status, err := FailJob(id, errors.New("encode failed"))
+		assert.NoError(t, err)
+		assert.Equal(t, "pending", status, "attempt %d is retried", attempt)
+
+		pending, err := GetPendingJobs()
+		assert.NoError(t, err)
+		assert.Empty(t, pending, "a failed job waits out its backoff")
+		jobs, err := ListActiveJobs()
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 1) {
+			assert.Equal(t, attempt, jobs[0].Attempts)
+			assert.True(t, jobs[0].RunAfter.Valid)
+			assert.Equal(t, "encode failed", jobs[0].Error.String)
+		}
+		// Let the backoff pass.
+		_, err = db.Exec("UPDATE jobs SET run_after = datetime('now', '-1 second') WHERE id = ?", id)
+		assert.NoError(t, err)
+		pending, err = GetPendingJobs()
+		assert.NoError(t, err)
+		if assert.Len(t, pending, 1) {
+			assert.Equal(t, id, pending[0].ID)
+		}
+	}
+
+	startJob(t, id)
+	status, err := FailJob(id, errors.New("encode failed again"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dead", status, "the last attempt dead-letters the job")
+
+	recent, err := ListRecentJobs(10)
+	assert.NoError(t, err)
+	if assert.Len(t, recent, 1) {
+		assert.Equal(t, "dead", recent[0].Status)
+		assert.Equal(t, defaultMaxAttempts, recent[0].Attempts)
+		assert.Equal(t, "encode failed again", recent[0].Error.String)
+		assert.True(t, recent[0].FinishedAt.Valid)
+		assert.True(t, recent[0].DurationMS.Valid)
+	}
+
+	id2, err := CreateJob("generate_timelapse", map[string]string{"timelapse_name": "year_2026"}, PriorityNormal)
+	assert.NoError(t, err)
+	assert.NotZero(t, id2, "a dead job does not block the next one")
+}
+
+func TestFinishJob(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	id, err := CreateJob("cleanup_logs", nil, PriorityNormal)
 	assert.NoError(t, err)
+	startJob(t, id)
+	_, err = db.Exec("UPDATE jobs SET started_at = strftime('%Y-%m-%d %H:%M:%f', 'now', '-2 seconds') WHERE id = ?", id)
+	assert.NoError(t, err)
+	assert.NoError(t, FinishJob(id, "completed", nil))
 
-	var status string
-	var errorStr sql.NullString
-	err = db.QueryRow("SELECT status, error FROM jobs WHERE id = ?", id).Scan(&status, &errorStr)
+	recent, err := ListRecentJobs(10)
 	assert.NoError(t, err)
-	assert.Equal(t, "processing", status)
-	assert.False(t, errorStr.Valid)
+	if assert.Len(t, recent, 1) {
+		assert.Equal(t, "completed", recent[0].Status, "finished jobs are kept")
+		assert.Equal(t, 1, recent[0].Attempts)
+		assert.False(t, recent[0].Error.Valid)
+		assert.InDelta(t, 2000, recent[0].DurationMS.Int64, 500)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Minute, RetryDelay(1))
+	assert.Equal(t, 2*time.Minute, RetryDelay(2))
+	assert.Equal(t, 8*time.Minute, RetryDelay(4))
+	assert.Equal(t, maxRetryDelay, RetryDelay(20))
+}
 
-	// Test updating to "failed" with an error
-	jobErr := errors.New("something went wrong")
-	err = UpdateJobStatus(id, "failed", jobErr)
+func TestPruneJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	old, _ := CreateJob("cleanup_logs", nil, PriorityNormal)
+	recent, _ := CreateJob("cleanup_videos", nil, PriorityNormal)
+	pending, _ := CreateJob("cleanup_snapshots", nil, PriorityNormal)
+	assert.NoError(t, FinishJob(old, "completed", nil))
+	assert.NoError(t, FinishJob(recent, "dead", errors.New("boom")))
+	_, err := db.Exec("UPDATE jobs SET finished_at = datetime('now', '-8 days') WHERE id = ?", old)
+	assert.NoError(t, err)
+	_, err = db.Exec("UPDATE jobs SET created_at = datetime('now', '-30 days') WHERE id = ?", pending)
 	assert.NoError(t, err)
 
-	err = db.QueryRow("SELECT status, error FROM jobs WHERE id = ?", id).Scan(&status, &errorStr)
+	n, err := PruneJobs(7)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	status, _ := GetJobStatus(old)
+	assert.Empty(t, status, "finished jobs past the retention period are removed")
+	status, _ = GetJobStatus(recent)
+	assert.Equal(t, "dead", status)
+	status, _ = GetJobStatus(pending)
+	assert.Equal(t, "pending", status, "jobs still to run are never pruned")
+}
+
+func startJob(t *testing.T, id int64) {
+	t.Helper()
+	started, err := StartJob(id)
 	assert.NoError(t, err)
-	assert.Equal(t, "failed", status)
-	assert.True(t, errorStr.Valid)
-	assert.Equal(t, "something went wrong", errorStr.String)
+	assert.True(t, started, "job %d should be pending", id)
 }
@@ -14,11 +14,27 @@ type VideoStatus struct {
 	Error               string
 	CurrentlyGenerating string
 	CurrentFile         string
+	Progress            EncodeProgress
+}
+
+// EncodeProgress is the progress of the FFmpeg encode in flight, as reported by
+// its -progress output. It is the zero value when nothing is being encoded.
+type EncodeProgress struct {
+	Frame       int
+	TotalFrames int           // frames the encode is known to produce; 0 if unknown
+	FPS         float64       // frames encoded per second
+	OutTime     time.Duration // length of video written so far
+	Speed       float64       // multiple of real time
+	Percent     float64
+	ETA         time.Duration // time left; 0 until it can be estimated
+	StartedAt   time.Time
+	UpdatedAt   time.Time
 }
 
 // TimelapseConfig represents the configuration for a timelapse.
 type TimelapseConfig struct {
 	Name         string
+	CameraID     string // owning camera; empty means the legacy single-camera layout
 	Duration     time.Duration
 	FramePattern string    // "all", "hourly", "daily", "N_hourly"
 	WindowStart  time.Time // fixed window start; zero means use Duration relative to targetTime
@@ -27,13 +43,100 @@ type TimelapseConfig struct {
 
 // Job represents a job in the database job queue.
 type Job struct {
-	ID        int64
-	JobType   string
-	Payload   string
-	Status    string
-	Error     sql.NullString
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          int64
+	JobType     string
+	Payload     string
+	Status      string
+	Priority    int          // higher runs first
+	Attempts    int          // times the job has been started
+	MaxAttempts int          // attempts before the job is dead-lettered
+	RunAfter    sql.NullTime // set while a failed job waits to be retried
+	StartedAt   sql.NullTime
+	FinishedAt  sql.NullTime
+	DurationMS  sql.NullInt64 // run time of the last attempt
+	Error       sql.NullString
+	Result      sql.NullString // summary of the work done, e.g. frames sampled
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Camera represents a UniFi Protect camera registered for capture.
+type Camera struct {
+	ID           string // Protect camera ID
+	Name         string
+	Model        string // Protect modelKey, filled in by discovery
+	State        string // Protect connection state at the last discovery (e.g. CONNECTED)
+	FeatureFlags string // raw JSON featureFlags object from the last discovery
+	Enabled      bool
+	CreatedAt    time.Time
+
+	// Snapshot source. SourceType is "protect" (default), "http", "rtsp" or "folder";
+	// SourceURL holds the JPEG/RTSP URL or the watched directory for "folder".
+	SourceType     string
+	SourceURL      string
+	SourceUsername string
+	SourcePassword string
+	SourceAuth     string // "basic" or "digest" for http sources
+	// SourceFingerprint pins an https source's certificate by SHA-256, for
+	// cameras with self-signed certificates. Empty means normal verification.
+	SourceFingerprint string
+
+	MAC string // Protect MAC address (upper-case hex, no separators), used to match alarm webhooks
+}
+
+// MissedSnapshot records a capture slot for which no snapshot could be taken,
+// so gaps in a timelapse can be traced to a cause.
+type MissedSnapshot struct {
+	CameraID string
+	SlotTime time.Time // UTC start of the capture slot
+	Attempts int       // capture attempts made before giving up; 0 if the slot was skipped
+	Reason   string
+}
+
+// CameraHealth is one recorded observation of a camera's status. Observations
+// are written when something changes and as a periodic heartbeat, so a gap
+// between rows longer than the heartbeat means nothing was watching.
+type CameraHealth struct {
+	CameraID  string
+	CheckedAt time.Time // UTC
+	State     string    // Protect state such as CONNECTED, or the status of other sources
+	Connected bool
+	UpSince   time.Time // when Protect says the camera last came up; zero if unknown
+	Snapshot  string    // outcome of the last capture: "ok", "failed" or "" before the first
+	Change    string    // what changed since the previous observation; empty for heartbeats
+}
+
+// Snapshot is an indexed image file: a raw capture in the snapshot tree, one of
+// the hourly gallery copies when InGallery is set, or an event frame when Tags
+// is non-empty.
+type Snapshot struct {
+	CameraID   string
+	Path       string
+	CapturedAt time.Time // UTC
+	Size       int64
+	Width      int
+	Height     int
+	Hash       string // perceptual hash (hex); empty for files indexed from disk
+	Source     string // description of the snapshot source that produced the frame
+	InGallery  bool
+	Tags       []string // event types that triggered the capture, e.g. "motion", "person"
+}
+
+// CaptureWindow is a named daily period during which snapshots are taken more
+// often than the base interval, e.g. every 10 seconds around sunrise. Each end is
+// an anchor plus an offset in minutes: for the "clock" anchor the offset counts
+// from midnight, for the sun anchors ("dawn", "sunrise", "noon", "sunset",
+// "dusk") it is relative to that event.
+type CaptureWindow struct {
+	ID          int64
+	Name        string
+	IntervalSec int
+	StartAnchor string
+	StartOffset int
+	EndAnchor   string
+	EndOffset   int
+	Weekdays    int // bitmask of days the window starts on, bit 0 = Sunday
+	Enabled     bool
 }
 
 // User represents a user account in the database.
@@ -49,4 +152,3 @@ var VideoStatusData = &VideoStatus{
 	CurrentlyGenerating: "",
 	CurrentFile:         "",
 }
-
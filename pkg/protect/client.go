@@ -0,0 +1,241 @@
+package protect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"time-machine/pkg/config"
+)
+
+// apiPrefix is the path of the Protect integration API on a UniFi OS console.
+const apiPrefix = "/proxy/protect/integration/v1"
+
+// Errors callers can test for with errors.Is.
+var (
+	// ErrNotConfigured means UFP_HOST or UFP_API_KEY is unset.
+	ErrNotConfigured = errors.New("UniFi Protect credentials missing from environment")
+	// ErrAuth means the controller rejected the API key.
+	ErrAuth = errors.New("UniFi Protect rejected the API key")
+	// ErrNotFound means the controller has no such camera.
+	ErrNotFound = errors.New("not found on the UniFi Protect controller")
+	// ErrOffline means the controller could not be reached, or it could not
+	// reach the camera.
+	ErrOffline = errors.New("UniFi Protect controller or camera offline")
+)
+
+// APIError is a response from the controller with an unexpected status code.
+// It matches ErrAuth, ErrNotFound or ErrOffline with errors.Is where the status
+// code implies one of them.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("UniFi API returned status code %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrOffline
+	}
+	return nil
+}
+
+// Camera is a camera record from the integration API. Only the fields the app
+// uses are decoded.
+type Camera struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	ModelKey     string        `json:"modelKey"`
+	MAC          string        `json:"mac"`
+	State        string        `json:"state"`
+	UpSince      int64         `json:"upSince"` // Unix milliseconds; 0 if not reported
+	FeatureFlags *FeatureFlags `json:"featureFlags"`
+}
+
+// Connected reports whether Protect considers the camera online.
+func (c Camera) Connected() bool {
+	return c.State == "CONNECTED"
+}
+
+// UpSinceTime returns when the camera last came online, or the zero time if
+// Protect did not say.
+func (c Camera) UpSinceTime() time.Time {
+	if c.UpSince <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(c.UpSince)
+}
+
+// FeatureFlags are a camera's capabilities. Flags the app does not use are kept
+// in Raw so they can be stored as reported.
+type FeatureFlags struct {
+	// SupportFullHdSnapshot is nil when the camera does not report the flag.
+	SupportFullHdSnapshot *bool           `json:"supportFullHdSnapshot"`
+	SmartDetectTypes      []string        `json:"smartDetectTypes"`
+	Raw                   json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the known flags and keeps the whole object in Raw.
+func (f *FeatureFlags) UnmarshalJSON(data []byte) error {
+	type plain FeatureFlags
+	if err := json.Unmarshal(data, (*plain)(f)); err != nil {
+		return err
+	}
+	f.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// SnapshotOptions select the image the snapshot endpoint returns.
+type SnapshotOptions struct {
+	// HighQuality asks for a full-resolution frame; only cameras reporting
+	// supportFullHdSnapshot honour it.
+	HighQuality bool
+}
+
+// Client calls the Protect integration API. Requests that fail with ErrOffline
+// are retried up to Retries times, doubling RetryDelay each time.
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	HTTP       *http.Client
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// NewClient returns a client for the controller at baseURL, using the shared
+// verified transport (see Transport).
+func NewClient(baseURL, apiKey string, timeout time.Duration) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTP:       HTTPClient(timeout),
+		Retries:    2,
+		RetryDelay: 500 * time.Millisecond,
+	}
+}
+
+// Default returns a client for UFP_HOST and UFP_API_KEY.
+func Default(timeout time.Duration) *Client {
+	return NewClient(config.AppConfig.UFPHost, config.AppConfig.UFPAPIKey, timeout)
+}
+
+// Cameras lists every camera adopted by the controller.
+func (c *Client) Cameras(ctx context.Context) ([]Camera, error) {
+	var cameras []Camera
+	if err := c.getJSON(ctx, "/cameras", &cameras); err != nil {
+		return nil, fmt.Errorf("camera list request failed: %w", err)
+	}
+	return cameras, nil
+}
+
+// Camera fetches one camera's record.
+func (c *Client) Camera(ctx context.Context, id string) (*Camera, error) {
+	if id == "" {
+		return nil, fmt.Errorf("camera: %w", ErrNotFound)
+	}
+	var cam Camera
+	if err := c.getJSON(ctx, "/cameras/"+url.PathEscape(id), &cam); err != nil {
+		return nil, fmt.Errorf("camera %s: %w", id, err)
+	}
+	return &cam, nil
+}
+
+// Snapshot fetches a JPEG frame from camera id. The caller closes the body.
+func (c *Client) Snapshot(ctx context.Context, id string, opts SnapshotOptions) (io.ReadCloser, error) {
+	path := "/cameras/" + url.PathEscape(id) + "/snapshot"
+	if opts.HighQuality {
+		path += "?highQuality=true"
+	}
+	resp, err := c.get(ctx, path, "image/jpeg")
+	if err != nil {
+		return nil, fmt.Errorf("snapshot API request failed: %w", err)
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.get(ctx, path, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode API response: %w", err)
+	}
+	return nil
+}
+
+// get performs a GET and returns the response if its status is 200, retrying
+// transient failures. The caller closes the body.
+func (c *Client) get(ctx context.Context, path, accept string) (*http.Response, error) {
+	if c.BaseURL == "" || c.APIKey == "" {
+		return nil, ErrNotConfigured
+	}
+
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(ctx, path, accept)
+		if err == nil || attempt >= c.Retries || !errors.Is(err, ErrOffline) || ctx.Err() != nil {
+			return resp, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) do(ctx context.Context, path, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+apiPrefix+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("X-Api-Key", c.APIKey)
+	req.Header.Set("Accept", accept)
+
+	client := c.HTTP
+	if client == nil {
+		client = HTTPClient(0)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil && isNetworkFailure(err) {
+			return nil, fmt.Errorf("%w: %v", ErrOffline, err)
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
+
+// isNetworkFailure reports whether err means the controller could not be
+// reached or dropped the connection, as opposed to a TLS verification failure,
+// which must not be retried or reported as an outage.
+func isNetworkFailure(err error) bool {
+	var opErr *net.OpError
+	var netErr net.Error
+	return errors.As(err, &opErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,141 @@
+package protect_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"time-machine/pkg/protect"
+	"time-machine/pkg/protect/protecttest"
+)
+
+// newClient returns a client for srv with retries that do not slow the tests.
+func newClient(srv *protecttest.Server, apiKey string) *protect.Client {
+	c := protect.NewClient(srv.URL, apiKey, 5*time.Second)
+	c.RetryDelay = time.Millisecond
+	return c
+}
+
+func TestClient_Cameras(t *testing.T) {
+	front := protecttest.Camera("cam1", "Front Door")
+	front.MAC = "F4:E2:C6:A1:B2:C3"
+	srv := protecttest.NewServer("key", front, protect.Camera{ID: "cam2", Name: "Garage", State: "DISCONNECTED"})
+	defer srv.Close()
+	c := newClient(srv, "key")
+
+	cameras, err := c.Cameras(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, cameras, 2) {
+		assert.Equal(t, "Front Door", cameras[0].Name)
+		assert.Equal(t, "F4:E2:C6:A1:B2:C3", cameras[0].MAC)
+		assert.True(t, cameras[0].Connected())
+		assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), cameras[0].UpSinceTime().UTC())
+		if assert.NotNil(t, cameras[0].FeatureFlags) {
+			assert.True(t, *cameras[0].FeatureFlags.SupportFullHdSnapshot)
+			assert.Equal(t, []string{"person", "vehicle"}, cameras[0].FeatureFlags.SmartDetectTypes)
+			assert.True(t, json.Valid(cameras[0].FeatureFlags.Raw))
+		}
+		assert.False(t, cameras[1].Connected())
+		assert.Nil(t, cameras[1].FeatureFlags)
+		assert.True(t, cameras[1].UpSinceTime().IsZero())
+	}
+
+	cam, err := c.Camera(context.Background(), "cam1")
+	assert.NoError(t, err)
+	assert.Equal(t, "UVC G5 Dome", cam.ModelKey)
+}
+
+func TestClient_Snapshot(t *testing.T) {
+	srv := protecttest.NewServer("key", protecttest.Camera("cam1", "Front Door"))
+	defer srv.Close()
+	srv.SetSnapshot("cam1", []byte("jpeg"))
+	c := newClient(srv, "key")
+
+	body, err := c.Snapshot(context.Background(), "cam1", protect.SnapshotOptions{HighQuality: true})
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "jpeg", string(data))
+
+	reqs := srv.Requests()
+	last := reqs[len(reqs)-1]
+	assert.Equal(t, "/proxy/protect/integration/v1/cameras/cam1/snapshot", last.URL.Path)
+	assert.Equal(t, "true", last.URL.Query().Get("highQuality"))
+	assert.Equal(t, "key", last.Header.Get("X-Api-Key"))
+}
+
+func TestClient_Errors(t *testing.T) {
+	srv := protecttest.NewServer("key", protecttest.Camera("cam1", "Front Door"))
+	defer srv.Close()
+	ctx := context.Background()
+
+	_, err := newClient(srv, "wrong").Cameras(ctx)
+	assert.ErrorIs(t, err, protect.ErrAuth)
+	var apiErr *protect.APIError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	}
+
+	_, err = newClient(srv, "key").Camera(ctx, "nope")
+	assert.ErrorIs(t, err, protect.ErrNotFound)
+
+	srv.SetState("cam1", "DISCONNECTED")
+	_, err = newClient(srv, "key").Snapshot(ctx, "cam1", protect.SnapshotOptions{})
+	assert.ErrorIs(t, err, protect.ErrOffline)
+
+	unreachable := protect.NewClient("http://127.0.0.1:1", "key", time.Second)
+	unreachable.Retries = 0
+	_, err = unreachable.Cameras(ctx)
+	assert.ErrorIs(t, err, protect.ErrOffline)
+
+	_, err = protect.NewClient("", "", time.Second).Cameras(ctx)
+	assert.ErrorIs(t, err, protect.ErrNotConfigured)
+}
+
+func TestClient_Retries(t *testing.T) {
+	srv := protecttest.NewServer("key", protecttest.Camera("cam1", "Front Door"))
+	defer srv.Close()
+	c := newClient(srv, "key")
+
+	srv.FailNext(http.StatusServiceUnavailable, http.StatusBadGateway)
+	_, err := c.Camera(context.Background(), "cam1")
+	assert.NoError(t, err, "transient failures are retried")
+	assert.Len(t, srv.Requests(), 3)
+
+	srv.FailNext(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	_, err = c.Camera(context.Background(), "cam1")
+	assert.ErrorIs(t, err, protect.ErrOffline, "gives up after Retries")
+	assert.Len(t, srv.Requests(), 6)
+
+	srv.FailNext(http.StatusUnauthorized)
+	_, err = c.Camera(context.Background(), "cam1")
+	assert.ErrorIs(t, err, protect.ErrAuth)
+	assert.Len(t, srv.Requests(), 7, "a rejected key is not retried")
+}
+
+func TestClient_Context(t *testing.T) {
+	srv := protecttest.NewServer("key", protecttest.Camera("cam1", "Front Door"))
+	defer srv.Close()
+	c := newClient(srv, "key")
+	c.RetryDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	srv.FailNext(http.StatusServiceUnavailable)
+	start := time.Now()
+	_, err := c.Camera(ctx, "cam1")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second, "the retry wait ends with the context")
+
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	_, err = c.Cameras(cancelled)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, errors.Is(err, protect.ErrOffline), "a cancelled request is not an outage")
+}
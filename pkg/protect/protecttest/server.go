@@ -0,0 +1,195 @@
+// Package protecttest provides an in-process fake of the UniFi Protect
+// integration API, so code that talks to Protect can be tested without a
+// controller or cameras.
+package protecttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"time-machine/pkg/protect"
+)
+
+const apiPrefix = "/proxy/protect/integration/v1/cameras"
+
+// Server is a fake Protect controller. Cameras that are not CONNECTED answer
+// snapshot requests with 503, as a controller does for an offline camera.
+type Server struct {
+	*httptest.Server
+	APIKey string
+
+	mu        sync.Mutex
+	cameras   []protect.Camera
+	snapshots map[string][]byte
+	failures  []int
+	requests  []*http.Request
+}
+
+// NewServer starts a fake controller that accepts apiKey and knows cameras.
+// Close it when done.
+func NewServer(apiKey string, cameras ...protect.Camera) *Server {
+	s := &Server{APIKey: apiKey, snapshots: make(map[string][]byte)}
+	for _, cam := range cameras {
+		s.SetCamera(cam)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Camera returns a connected, HQ-capable camera record with the given ID.
+func Camera(id, name string) protect.Camera {
+	hq := true
+	return protect.Camera{
+		ID:       id,
+		Name:     name,
+		ModelKey: "UVC G5 Dome",
+		State:    "CONNECTED",
+		UpSince:  1714521600000, // 2024-05-01 00:00 UTC
+		FeatureFlags: &protect.FeatureFlags{
+			SupportFullHdSnapshot: &hq,
+			SmartDetectTypes:      []string{"person", "vehicle"},
+		},
+	}
+}
+
+// SetCamera adds cam, or replaces the camera with the same ID.
+func (s *Server) SetCamera(cam protect.Camera) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cameras {
+		if s.cameras[i].ID == cam.ID {
+			s.cameras[i] = cam
+			return
+		}
+	}
+	s.cameras = append(s.cameras, cam)
+}
+
+// SetState changes a camera's state, e.g. to "DISCONNECTED".
+func (s *Server) SetState(id, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cameras {
+		if s.cameras[i].ID == id {
+			s.cameras[i].State = state
+		}
+	}
+}
+
+// SetSnapshot sets the image camera id returns. Without one, each camera
+// returns a noise JPEG that passes the capture-time checks.
+func (s *Server) SetSnapshot(id string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[id] = data
+}
+
+// FailNext makes the next len(statuses) requests fail with those status codes,
+// in order, before the server answers normally again.
+func (s *Server) FailNext(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statuses...)
+}
+
+// Requests returns the requests served so far, oldest first.
+func (s *Server) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+// NoiseJPEG returns a deterministic greyscale noise JPEG that is large and
+// varied enough to pass the snapshot content checks.
+func NoiseJPEG(seed uint64) []byte {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	img := image.NewGray(image.Rect(0, 0, 128, 96))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.IntN(256))
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100})
+	return buf.Bytes()
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	var fail int
+	if len(s.failures) > 0 {
+		fail, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	switch {
+	case fail != 0:
+		http.Error(w, http.StatusText(fail), fail)
+		return
+	case r.Header.Get("X-Api-Key") != s.APIKey:
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	case r.Method != http.MethodGet:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.Path, apiPrefix)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if rest == "" || rest == "/" {
+		s.mu.Lock()
+		cameras := append([]protect.Camera{}, s.cameras...)
+		s.mu.Unlock()
+		writeJSON(w, cameras)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	s.mu.Lock()
+	var cam *protect.Camera
+	for i := range s.cameras {
+		if s.cameras[i].ID == id {
+			c := s.cameras[i]
+			cam = &c
+		}
+	}
+	snapshot := s.snapshots[id]
+	s.mu.Unlock()
+
+	switch {
+	case cam == nil:
+		writeError(w, http.StatusNotFound, "Camera not found")
+	case action == "":
+		writeJSON(w, cam)
+	case action == "snapshot" && !cam.Connected():
+		writeError(w, http.StatusServiceUnavailable, "Camera is offline")
+	case action == "snapshot":
+		if snapshot == nil {
+			snapshot = NoiseJPEG(uint64(len(s.Requests())))
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(snapshot)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
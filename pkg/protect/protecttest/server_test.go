@@ -0,0 +1,45 @@
+package protecttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"time-machine/pkg/protect"
+)
+
+func get(t *testing.T, s *Server, path, apiKey string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("GET", s.URL+path, nil)
+	req.Header.Set("X-Api-Key", apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer("key", Camera("cam1", "Front Door"))
+	defer s.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, get(t, s, apiPrefix, "wrong").StatusCode)
+
+	resp := get(t, s, apiPrefix+"/cam1", "key")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var cam protect.Camera
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&cam))
+	assert.Equal(t, "Front Door", cam.Name)
+
+	assert.Equal(t, http.StatusNotFound, get(t, s, apiPrefix+"/cam2", "key").StatusCode)
+	assert.Equal(t, "image/jpeg", get(t, s, apiPrefix+"/cam1/snapshot", "key").Header.Get("Content-Type"))
+
+	s.SetState("cam1", "DISCONNECTED")
+	assert.Equal(t, http.StatusServiceUnavailable, get(t, s, apiPrefix+"/cam1/snapshot", "key").StatusCode)
+
+	s.FailNext(http.StatusBadGateway)
+	assert.Equal(t, http.StatusBadGateway, get(t, s, apiPrefix, "key").StatusCode)
+	assert.Equal(t, http.StatusOK, get(t, s, apiPrefix, "key").StatusCode)
+	assert.Len(t, s.Requests(), 7)
+}
@@ -0,0 +1,223 @@
+// Package protect talks to the UniFi Protect controller.
+package protect
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/services/settings"
+)
+
+// tlsOptions are the settings that shape the controller's TLS verification.
+// The shared transport is rebuilt whenever they change.
+type tlsOptions struct {
+	host         string // controller host name or IP, checked against CA-issued certificates
+	caFile       string
+	fingerprints string
+	insecure     bool
+}
+
+var (
+	transportMu   sync.Mutex
+	transport     *http.Transport
+	transportOpts tlsOptions
+
+	// pinMu serialises trust-on-first-use, so two first connections cannot pin
+	// different certificates.
+	pinMu sync.Mutex
+)
+
+func currentOptions() tlsOptions {
+	opts := tlsOptions{
+		caFile:       strings.TrimSpace(settings.Get("protect.ca_file", "")),
+		fingerprints: settings.Get("protect.cert_fingerprint", ""),
+		insecure:     settings.Get("protect.insecure_skip_verify", "false") == "true",
+	}
+	if u, err := url.Parse(config.AppConfig.UFPHost); err == nil {
+		opts.host = u.Hostname()
+	}
+	return opts
+}
+
+// Transport returns the shared transport for requests to the Protect
+// controller, so captures and status polls reuse connections.
+//
+// The controller's certificate is accepted when, in order:
+//   - protect.insecure_skip_verify is "true" (no verification at all);
+//   - protect.cert_fingerprint is set and lists the certificate's SHA-256
+//     fingerprint, and the chain verifies against protect.ca_file if that is set;
+//   - protect.ca_file is set and the chain verifies against it;
+//   - the chain verifies against the system roots;
+//   - nothing is pinned yet, in which case the fingerprint is pinned (trust on
+//     first use) and every later connection must present the same certificate.
+func Transport() *http.Transport {
+	opts := currentOptions()
+
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	if transport != nil && opts == transportOpts {
+		return transport
+	}
+
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		// Fail closed: every handshake reports the configuration error.
+		log.Printf("Error: Protect TLS configuration: %v", err)
+		tlsConfig = &tls.Config{
+			InsecureSkipVerify: true,
+			VerifyConnection:   func(tls.ConnectionState) error { return err },
+		}
+	}
+	if opts.insecure && (transport == nil || !transportOpts.insecure) {
+		log.Println("Warning: TLS verification of the Protect controller is disabled (protect.insecure_skip_verify); the API key is sent to whatever answers on UFP_HOST.")
+	}
+
+	if transport != nil {
+		transport.CloseIdleConnections()
+	}
+	transport = &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	transportOpts = opts
+	return transport
+}
+
+// HTTPClient returns a client using the shared transport with the given
+// per-request timeout.
+func HTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: Transport()}
+}
+
+func newTLSConfig(opts tlsOptions) (*tls.Config, error) {
+	if opts.insecure {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+
+	var pool *x509.CertPool
+	if opts.caFile != "" {
+		pem, err := os.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read protect.ca_file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("protect.ca_file %s has no PEM certificates", opts.caFile)
+		}
+	}
+	pins, err := ParseFingerprints(opts.fingerprints)
+	if err != nil {
+		return nil, fmt.Errorf("protect.cert_fingerprint: %w", err)
+	}
+
+	// Verification is done in VerifyConnection, because the standard checks
+	// cannot express "this exact self-signed certificate".
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return verifyPeer(cs, opts.host, pool, pins)
+		},
+	}, nil
+}
+
+func verifyPeer(cs tls.ConnectionState, host string, pool *x509.CertPool, pins []string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("Protect controller presented no certificate")
+	}
+	fingerprint := Fingerprint(cs.PeerCertificates[0])
+
+	if len(pins) > 0 {
+		if !slices.Contains(pins, fingerprint) {
+			return fmt.Errorf("Protect controller certificate %s does not match the pinned fingerprint; if the certificate was replaced on purpose, forget the pinned certificate in the admin settings", fingerprint)
+		}
+		if pool == nil {
+			return nil
+		}
+	}
+
+	chainErr := verifyChain(cs, host, pool)
+	if chainErr == nil || pool != nil {
+		return chainErr
+	}
+	return pinFirstUse(fingerprint)
+}
+
+// verifyChain checks the presented chain against pool, or the system roots
+// when pool is nil.
+func verifyChain(cs tls.ConnectionState, host string, pool *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		DNSName:       host,
+	})
+	if err != nil {
+		return fmt.Errorf("Protect controller certificate is not trusted: %w", err)
+	}
+	return nil
+}
+
+// pinFirstUse stores fingerprint as the controller's certificate unless one
+// has been pinned in the meantime, in which case it must match.
+func pinFirstUse(fingerprint string) error {
+	pinMu.Lock()
+	defer pinMu.Unlock()
+
+	stored, err := ParseFingerprints(settings.Get("protect.cert_fingerprint", ""))
+	if err != nil {
+		return fmt.Errorf("protect.cert_fingerprint: %w", err)
+	}
+	if len(stored) > 0 {
+		if slices.Contains(stored, fingerprint) {
+			return nil
+		}
+		return fmt.Errorf("Protect controller certificate %s does not match the pinned fingerprint", fingerprint)
+	}
+	if err := settings.Set("protect.cert_fingerprint", fingerprint); err != nil {
+		return fmt.Errorf("could not pin the Protect controller certificate: %w", err)
+	}
+	log.Printf("Pinned the Protect controller certificate on first use: SHA-256 %s", fingerprint)
+	return nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of cert as lower-case hex.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseFingerprints reads a comma-separated list of SHA-256 fingerprints. Hex
+// may be in either case and use colons, as browsers and openssl print it.
+func ParseFingerprints(s string) ([]string, error) {
+	var fingerprints []string
+	for _, part := range strings.Split(s, ",") {
+		fp := strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(part))
+		if fp == "" {
+			continue
+		}
+		if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid SHA-256 fingerprint %q", strings.TrimSpace(part))
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+	return fingerprints, nil
+}
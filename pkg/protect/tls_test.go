@@ -0,0 +1,109 @@
+package protect
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/services/settings"
+)
+
+// setupTest starts a TLS server standing in for the controller and points
+// UFP_HOST at it, with fresh settings.
+func setupTest(t *testing.T) *httptest.Server {
+	t.Helper()
+	config.AppConfig.DataDir = t.TempDir()
+	database.InitDB()
+	settings.Init()
+	t.Cleanup(func() { database.GetDB().Close() })
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+	origHost := config.AppConfig.UFPHost
+	config.AppConfig.UFPHost = srv.URL
+	t.Cleanup(func() { config.AppConfig.UFPHost = origHost })
+	return srv
+}
+
+func get(srv *httptest.Server) error {
+	resp, err := HTTPClient(0).Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestTransport_TrustOnFirstUse(t *testing.T) {
+	srv := setupTest(t)
+	fingerprint := Fingerprint(srv.Certificate())
+
+	assert.NoError(t, get(srv))
+	assert.Equal(t, fingerprint, settings.Get("protect.cert_fingerprint", ""), "first certificate is pinned")
+	assert.NoError(t, get(srv), "the pinned certificate is accepted again")
+
+	settings.Set("protect.cert_fingerprint", strings.Repeat("ab", 32))
+	err := get(srv)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "does not match the pinned fingerprint")
+	}
+	_, err = NewClient(srv.URL, "key", time.Second).Cameras(context.Background())
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrOffline, "a certificate mismatch is neither retried nor reported as an outage")
+}
+
+func TestTransport_PinnedWithColons(t *testing.T) {
+	srv := setupTest(t)
+	fingerprint := Fingerprint(srv.Certificate())
+
+	var colons []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		colons = append(colons, strings.ToUpper(fingerprint[i:i+2]))
+	}
+	settings.Set("protect.cert_fingerprint", strings.Repeat("cd", 32)+", "+strings.Join(colons, ":"))
+	assert.NoError(t, get(srv), "any of the listed fingerprints is accepted")
+}
+
+func TestTransport_CAFile(t *testing.T) {
+	srv := setupTest(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, pemBytes, 0644))
+	settings.Set("protect.ca_file", caFile)
+
+	assert.NoError(t, get(srv))
+	assert.Empty(t, settings.Get("protect.cert_fingerprint", ""), "CA-verified certificates are not pinned")
+
+	settings.Set("protect.ca_file", filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, get(srv), "an unreadable CA bundle fails closed")
+}
+
+func TestTransport_InsecureSkipVerify(t *testing.T) {
+	srv := setupTest(t)
+	settings.Set("protect.cert_fingerprint", strings.Repeat("ab", 32))
+	settings.Set("protect.insecure_skip_verify", "true")
+
+	assert.NoError(t, get(srv))
+}
+
+func TestParseFingerprints(t *testing.T) {
+	fps, err := ParseFingerprints("")
+	assert.NoError(t, err)
+	assert.Empty(t, fps)
+
+	_, err = ParseFingerprints("abcd")
+	assert.Error(t, err, "too short for SHA-256")
+	_, err = ParseFingerprints(strings.Repeat("zz", 32))
+	assert.Error(t, err, "not hex")
+}
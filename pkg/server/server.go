@@ -34,6 +34,9 @@ func SetupRouter() *gin.Engine {
 	r.GET("/public/:token", handlers.HandlePublicLink)
 	r.GET("/public/:token/*filepath", handlers.HandlePublicSubpath)
 
+	// Protect event webhook — authenticated by its own token, not a session
+	r.POST("/api/events/protect", handlers.HandleProtectEvent)
+
 	// Static files for CSS and JS
 	r.Static("/static", "./web/static")
 
@@ -54,6 +57,10 @@ func SetupRouter() *gin.Engine {
 		authorized.GET("/api/system-stats", handlers.HandleSystemStatsJSON)
 		authorized.GET("/api/images", handlers.HandleImageStats)
 		authorized.GET("/api/gallery", handlers.HandleDailyGallery)
+		authorized.GET("/api/events", handlers.HandleEventGallery)
+		authorized.GET("/api/missed-slots", handlers.HandleMissedSlots)
+		authorized.GET("/api/camera-health", handlers.HandleCameraHealth)
+		authorized.GET("/api/video-status", handlers.HandleVideoStatus)
 
 		// --- Admin-Only Route Group ---
 		adminRoutes := authorized.Group("/")
@@ -65,6 +72,17 @@ func SetupRouter() *gin.Engine {
 			adminRoutes.POST("/admin/users/delete", handlers.HandleDeleteUser)
 			adminRoutes.POST("/admin/users/password", handlers.HandleChangePassword)
 			adminRoutes.POST("/admin/settings", handlers.HandleSaveSettings)
+			adminRoutes.POST("/admin/cameras/discover", handlers.HandleDiscoverCameras)
+			adminRoutes.POST("/admin/cameras/enabled", handlers.HandleSetCameraEnabled)
+			adminRoutes.POST("/admin/cameras/source", handlers.HandleSaveCameraSource)
+			adminRoutes.POST("/admin/snapshots/reindex", handlers.HandleReindexSnapshots)
+			adminRoutes.POST("/admin/protect/forget-certificate", handlers.HandleForgetProtectCertificate)
+			adminRoutes.POST("/admin/capture-windows", handlers.HandleSaveCaptureWindow)
+			adminRoutes.POST("/admin/capture-windows/enabled", handlers.HandleSetCaptureWindowEnabled)
+			adminRoutes.POST("/admin/capture-windows/delete", handlers.HandleDeleteCaptureWindow)
+			adminRoutes.POST("/admin/jobs/cancel", handlers.HandleAdminCancelJob)
+			adminRoutes.GET("/api/jobs", handlers.HandleListJobs)
+			adminRoutes.POST("/api/jobs/:id/cancel", handlers.HandleCancelJob)
 			adminRoutes.POST("/share", handlers.HandleShareLink)
 		}
 		// Logout endpoint (authenticated)
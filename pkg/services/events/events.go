@@ -0,0 +1,179 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/services/snapshot"
+	"time-machine/pkg/util"
+)
+
+// Event is a motion or smart detection reported for one camera. Camera is the
+// camera's Protect ID or MAC address, as the sender knows it.
+type Event struct {
+	Camera string
+	Types  []string
+}
+
+// Result reports what became of one event.
+type Result struct {
+	Camera string   `json:"camera"`
+	Tags   []string `json:"tags"`
+	Status string   `json:"status"` // "captured", "ignored" or "failed"
+	Path   string   `json:"path,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+// Clock and capture hooks, replaced in tests.
+var (
+	now     = time.Now
+	capture = snapshot.CaptureEventSnapshot
+)
+
+// lastEvent holds when each camera last took an event frame, for the cooldown.
+var (
+	lastEventMu sync.Mutex
+	lastEvent   = make(map[string]time.Time)
+)
+
+// webhookPayload covers the two bodies the webhook accepts: the one a Protect
+// Alarm Manager "Webhook" action sends, and a plain {"camera": ..., "types": [...]}
+// for scripts and other NVRs.
+type webhookPayload struct {
+	Alarm *struct {
+		Name     string `json:"name"`
+		Triggers []struct {
+			Key    string `json:"key"`
+			Device string `json:"device"`
+		} `json:"triggers"`
+	} `json:"alarm"`
+	Camera string   `json:"camera"`
+	Types  []string `json:"types"`
+}
+
+// ParseWebhook decodes a webhook body into events. Alarm Manager triggers of the
+// same device are merged into one event, so a person walking past gives one frame
+// tagged "motion" and "person" rather than two.
+func ParseWebhook(body []byte) ([]Event, error) {
+	var p webhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("invalid event payload: %w", err)
+	}
+
+	if p.Alarm == nil {
+		if p.Camera == "" || len(p.Types) == 0 {
+			return nil, fmt.Errorf("event payload needs an alarm, or a camera and types")
+		}
+		return []Event{{Camera: p.Camera, Types: p.Types}}, nil
+	}
+
+	var events []Event
+	byDevice := make(map[string]int)
+	for _, trigger := range p.Alarm.Triggers {
+		if trigger.Device == "" || trigger.Key == "" {
+			continue
+		}
+		i, ok := byDevice[trigger.Device]
+		if !ok {
+			i = len(events)
+			byDevice[trigger.Device] = i
+			events = append(events, Event{Camera: trigger.Device})
+		}
+		events[i].Types = append(events[i].Types, trigger.Key)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("alarm %q has no camera triggers", p.Alarm.Name)
+	}
+	return events, nil
+}
+
+// Handle takes a tagged frame for e unless the camera is unknown or disabled,
+// none of the event types is in events.types, or the camera took an event frame
+// less than events.cooldown_sec ago.
+func Handle(e Event) Result {
+	res := Result{Camera: e.Camera, Tags: allowedTags(e.Types)}
+
+	cam, err := resolveCamera(e.Camera)
+	switch {
+	case err != nil:
+		res.Status, res.Reason = "failed", err.Error()
+		return res
+	case cam == nil:
+		res.Status, res.Reason = "ignored", "unknown camera"
+		return res
+	case !cam.Enabled:
+		res.Status, res.Reason = "ignored", "camera is disabled"
+		return res
+	case len(res.Tags) == 0:
+		res.Status, res.Reason = "ignored", "event type not enabled"
+		return res
+	}
+	res.Camera = cam.ID
+
+	if !claimCooldown(cam.ID) {
+		res.Status, res.Reason = "ignored", "cooldown"
+		return res
+	}
+
+	path, err := capture(cam.ID, res.Tags)
+	if err != nil {
+		log.Printf("Event snapshot error: camera %s (%s): %v", cam.ID, strings.Join(res.Tags, ","), err)
+		res.Status, res.Reason = "failed", err.Error()
+		return res
+	}
+	log.Printf("Event snapshot for camera %s (%s): %s", cam.ID, strings.Join(res.Tags, ","), path)
+	res.Status, res.Path = "captured", path
+	return res
+}
+
+// resolveCamera finds the camera an event refers to, by Protect ID or by MAC.
+func resolveCamera(ref string) (*models.Camera, error) {
+	if cam, err := database.GetCamera(ref); err != nil || cam != nil {
+		return cam, err
+	}
+	return database.GetCameraByMAC(ref)
+}
+
+// allowedTags normalises the event types and keeps those listed in events.types
+// (comma-separated); "all" allows every type.
+func allowedTags(types []string) []string {
+	tags := util.NormaliseEventTags(types)
+	setting := strings.TrimSpace(settings.Get("events.types", "all"))
+	if setting == "" || strings.EqualFold(setting, "all") {
+		return tags
+	}
+	allowed := util.NormaliseEventTags(strings.Split(setting, ","))
+	var kept []string
+	for _, tag := range tags {
+		for _, a := range allowed {
+			if tag == a {
+				kept = append(kept, tag)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// claimCooldown reports whether cameraID may take an event frame now, and if so
+// starts its cooldown. The cooldown starts before the capture so that a burst of
+// webhooks for one detection does not fetch several frames in parallel.
+func claimCooldown(cameraID string) bool {
+	cooldown := time.Duration(settings.GetInt("events.cooldown_sec", 30)) * time.Second
+	t := now()
+
+	lastEventMu.Lock()
+	defer lastEventMu.Unlock()
+	if last, ok := lastEvent[cameraID]; ok && t.Sub(last) < cooldown {
+		return false
+	}
+	lastEvent[cameraID] = t
+	return true
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/services/settings"
+)
+
+// setupTest registers cam1 (enabled, with a MAC) and cam2 (disabled), and
+// replaces the capture and clock hooks. It returns the captures made.
+func setupTest(t *testing.T) *[]string {
+	t.Helper()
+	config.AppConfig.DataDir = t.TempDir()
+	database.InitDB()
+	settings.Init()
+	t.Cleanup(func() { database.GetDB().Close() })
+
+	assert.NoError(t, database.UpsertDiscoveredCamera(models.Camera{ID: "cam1", MAC: "F4E2C6A1B2C3"}))
+	assert.NoError(t, database.SetCameraEnabled("cam1", true))
+	assert.NoError(t, database.AddCamera("cam2", ""))
+	assert.NoError(t, database.SetCameraEnabled("cam2", false))
+
+	var captured []string
+	origCapture, origNow := capture, now
+	capture = func(cameraID string, tags []string) (string, error) {
+		captured = append(captured, cameraID)
+		return "/events/" + cameraID + ".jpg", nil
+	}
+	clock := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	lastEvent = make(map[string]time.Time)
+	t.Cleanup(func() { capture, now = origCapture, origNow })
+	return &captured
+}
+
+func TestParseWebhook_AlarmManager(t *testing.T) {
+	body := `{
+		"alarm": {
+			"name": "Driveway person",
+			"triggers": [
+				{"key": "motion", "device": "F4E2C6A1B2C3", "eventId": "e1"},
+				{"key": "person", "device": "F4E2C6A1B2C3", "eventId": "e2"},
+				{"key": "vehicle", "device": "AABBCCDDEEFF", "eventId": "e3"}
+			]
+		},
+		"timestamp": 1714557600000
+	}`
+	events, err := ParseWebhook([]byte(body))
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{
+		{Camera: "F4E2C6A1B2C3", Types: []string{"motion", "person"}},
+		{Camera: "AABBCCDDEEFF", Types: []string{"vehicle"}},
+	}, events)
+
+	_, err = ParseWebhook([]byte(`{"alarm": {"name": "test", "triggers": []}}`))
+	assert.Error(t, err)
+}
+
+func TestParseWebhook_Generic(t *testing.T) {
+	events, err := ParseWebhook([]byte(`{"camera": "cam1", "types": ["motion"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{{Camera: "cam1", Types: []string{"motion"}}}, events)
+
+	_, err = ParseWebhook([]byte(`{"camera": "cam1"}`))
+	assert.Error(t, err)
+	_, err = ParseWebhook([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestHandle(t *testing.T) {
+	captured := setupTest(t)
+
+	// Alarm Manager identifies cameras by MAC.
+	res := Handle(Event{Camera: "f4:e2:c6:a1:b2:c3", Types: []string{"person", "motion"}})
+	assert.Equal(t, "captured", res.Status)
+	assert.Equal(t, "cam1", res.Camera)
+	assert.Equal(t, []string{"motion", "person"}, res.Tags)
+	assert.Equal(t, "/events/cam1.jpg", res.Path)
+
+	assert.Equal(t, "ignored", Handle(Event{Camera: "cam2", Types: []string{"motion"}}).Status, "disabled camera")
+	assert.Equal(t, "ignored", Handle(Event{Camera: "nope", Types: []string{"motion"}}).Status, "unknown camera")
+	assert.Equal(t, []string{"cam1"}, *captured)
+}
+
+func TestHandle_Cooldown(t *testing.T) {
+	captured := setupTest(t)
+	settings.Set("events.cooldown_sec", "30")
+
+	clock := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	assert.Equal(t, "captured", Handle(Event{Camera: "cam1", Types: []string{"motion"}}).Status)
+
+	clock = clock.Add(10 * time.Second)
+	res := Handle(Event{Camera: "cam1", Types: []string{"person"}})
+	assert.Equal(t, "ignored", res.Status)
+	assert.Equal(t, "cooldown", res.Reason)
+
+	clock = clock.Add(30 * time.Second)
+	assert.Equal(t, "captured", Handle(Event{Camera: "cam1", Types: []string{"person"}}).Status)
+	assert.Len(t, *captured, 2)
+}
+
+func TestHandle_TypeFilter(t *testing.T) {
+	captured := setupTest(t)
+	settings.Set("events.types", "person, vehicle")
+
+	res := Handle(Event{Camera: "cam1", Types: []string{"motion"}})
+	assert.Equal(t, "ignored", res.Status)
+	assert.Empty(t, *captured)
+
+	res = Handle(Event{Camera: "cam1", Types: []string{"motion", "person"}})
+	assert.Equal(t, "captured", res.Status)
+	assert.Equal(t, []string{"person"}, res.Tags, "types that are not enabled are not tagged")
+}
@@ -0,0 +1,261 @@
+package health
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/services/snapshot"
+)
+
+// heartbeat is how often an unchanged camera is recorded. A gap of more than
+// maxGap between observations is shown as unknown rather than carried forward,
+// since nothing was watching (the app was down or the poller stalled).
+const (
+	heartbeat = 5 * time.Minute
+	maxGap    = 2 * heartbeat
+)
+
+// Clock hook, replaced in tests.
+var now = time.Now
+
+// last holds each camera's previous observation and when a row was last written
+// for it, so unchanged polls only reach the database once per heartbeat.
+var (
+	lastMu      sync.Mutex
+	last        = make(map[string]models.CameraHealth)
+	lastWritten = make(map[string]time.Time)
+)
+
+// Segment is a stretch of a day during which a camera's health did not change.
+type Segment struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Status  string    `json:"status"` // "up", "degraded" (connected, captures failing), "down" or "unknown"
+	State   string    `json:"state,omitempty"`
+	Percent float64   `json:"percent"` // share of the day, for drawing the timeline
+}
+
+// Change is a recorded change in a camera's health.
+type Change struct {
+	Time   time.Time `json:"time"`
+	Change string    `json:"change"`
+}
+
+// Day summarises one local calendar day of a camera's health.
+type Day struct {
+	Date         string    `json:"date"`
+	Availability float64   `json:"availability"` // percent of the observed time the camera was connected
+	Observed     float64   `json:"observed"`     // percent of the day (so far, for today) with observations
+	Restarts     int       `json:"restarts"`
+	Segments     []Segment `json:"segments"`
+	Changes      []Change  `json:"changes"`
+}
+
+// Observe records cameraID's status as returned by
+// snapshot.GetFormattedCameraStatus, together with the outcome of its last
+// capture. A row is written when the state, connection, upSince or capture
+// outcome changes, and otherwise once per heartbeat.
+var Observe = func(cameraID string, status map[string]string) {
+	h := observation(cameraID, status, now())
+
+	lastMu.Lock()
+	prev, seen := last[cameraID]
+	written := lastWritten[cameraID]
+	lastMu.Unlock()
+
+	var prevPtr *models.CameraHealth
+	if seen {
+		prevPtr = &prev
+	} else if stored, err := database.GetLatestCameraHealth(cameraID, h.CheckedAt); err == nil {
+		// First poll since startup: compare against what was stored before.
+		prevPtr = stored
+	}
+
+	h.Change = describeChange(prevPtr, h)
+	if h.Change == "" && h.CheckedAt.Sub(written) < heartbeat {
+		lastMu.Lock()
+		last[cameraID] = h
+		lastMu.Unlock()
+		return
+	}
+	if err := database.RecordCameraHealth(h); err != nil {
+		log.Printf("Warning: could not record health of camera %s: %v", cameraID, err)
+		return
+	}
+	if h.Change != "" {
+		log.Printf("Camera %s health: %s", cameraID, h.Change)
+	}
+
+	lastMu.Lock()
+	last[cameraID] = h
+	lastWritten[cameraID] = h.CheckedAt
+	lastMu.Unlock()
+}
+
+// observation converts a formatted camera status into a health record.
+func observation(cameraID string, status map[string]string, t time.Time) models.CameraHealth {
+	h := models.CameraHealth{
+		CameraID:  cameraID,
+		CheckedAt: t.UTC(),
+		State:     status["Status"],
+		Connected: status["Connected"] == "true",
+		Snapshot:  snapshot.LastCaptureResult(cameraID),
+	}
+	// UpSince is formatted in local time by GetFormattedCameraStatus.
+	if upSince, err := time.ParseInLocation("2006-01-02 15:04:05", status["UpSince"], time.Local); err == nil {
+		h.UpSince = upSince.UTC()
+	}
+	return h
+}
+
+// describeChange lists what differs between prev and cur, or returns "" if
+// nothing worth recording has changed.
+func describeChange(prev *models.CameraHealth, cur models.CameraHealth) string {
+	if prev == nil {
+		return "monitoring started"
+	}
+
+	var changes []string
+	if cur.CheckedAt.Sub(prev.CheckedAt) > maxGap {
+		changes = append(changes, "monitoring resumed")
+	}
+	switch {
+	case cur.Connected && !prev.Connected:
+		changes = append(changes, "connected")
+	case !cur.Connected && prev.Connected:
+		changes = append(changes, "disconnected: "+cur.State)
+	case cur.State != prev.State:
+		changes = append(changes, "state "+cur.State)
+	}
+	if !cur.UpSince.IsZero() && !prev.UpSince.IsZero() && cur.UpSince.After(prev.UpSince) {
+		changes = append(changes, "camera restarted at "+cur.UpSince.Local().Format("15:04:05"))
+	}
+	switch {
+	case cur.Snapshot == "failed" && prev.Snapshot != "failed":
+		changes = append(changes, "snapshots failing")
+	case cur.Snapshot == "ok" && prev.Snapshot == "failed":
+		changes = append(changes, "snapshots recovered")
+	}
+	return strings.Join(changes, "; ")
+}
+
+// statusOf classifies an observation for the timeline.
+func statusOf(h models.CameraHealth) string {
+	switch {
+	case !h.Connected:
+		return "down"
+	case h.Snapshot == "failed":
+		return "degraded"
+	default:
+		return "up"
+	}
+}
+
+// GetDays returns the health of cameraID for the last days local calendar
+// days, newest first.
+var GetDays = func(cameraID string, days int) []Day {
+	t := now()
+	today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	result := make([]Day, 0, days)
+	for i := 0; i < days; i++ {
+		day, err := GetDay(cameraID, today.AddDate(0, 0, -i))
+		if err != nil {
+			log.Printf("Warning: could not load health of camera %s: %v", cameraID, err)
+			break
+		}
+		result = append(result, day)
+	}
+	return result
+}
+
+// GetDay builds the timeline and availability of cameraID for the local day
+// starting at dayStart. Today's timeline stops at the current time.
+func GetDay(cameraID string, dayStart time.Time) (Day, error) {
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	end := dayEnd
+	if t := now(); t.Before(end) {
+		end = t
+	}
+	day := Day{Date: dayStart.Format("2006-01-02"), Segments: []Segment{}, Changes: []Change{}}
+	if !end.After(dayStart) {
+		return day, nil
+	}
+
+	rows, err := database.GetCameraHealth(cameraID, dayStart, end)
+	if err != nil {
+		return day, err
+	}
+	// The observation in force at midnight was written the day before.
+	prev, err := database.GetLatestCameraHealth(cameraID, dayStart)
+	if err != nil {
+		return day, err
+	}
+	if prev != nil {
+		rows = append([]models.CameraHealth{*prev}, rows...)
+	}
+
+	dayLength := dayEnd.Sub(dayStart)
+	var observed, connected time.Duration
+	addSegment := func(start, stop time.Time, status, state string) {
+		if !stop.After(start) {
+			return
+		}
+		if n := len(day.Segments); n > 0 && day.Segments[n-1].Status == status && day.Segments[n-1].State == state {
+			day.Segments[n-1].End = stop
+		} else {
+			day.Segments = append(day.Segments, Segment{Start: start, End: stop, Status: status, State: state})
+		}
+		if status != "unknown" {
+			observed += stop.Sub(start)
+		}
+		if status == "up" || status == "degraded" {
+			connected += stop.Sub(start)
+		}
+	}
+
+	cursor := dayStart
+	for i, h := range rows {
+		start := h.CheckedAt.In(time.Local)
+		if start.Before(dayStart) {
+			start = dayStart
+		} else {
+			if h.Change != "" {
+				day.Changes = append(day.Changes, Change{Time: start, Change: h.Change})
+			}
+			if strings.Contains(h.Change, "camera restarted") {
+				day.Restarts++
+			}
+		}
+		stop := h.CheckedAt.Add(maxGap).In(time.Local)
+		if i+1 < len(rows) && rows[i+1].CheckedAt.Before(stop) {
+			stop = rows[i+1].CheckedAt.In(time.Local)
+		}
+		if stop.After(end) {
+			stop = end
+		}
+		if !stop.After(cursor) {
+			continue
+		}
+		addSegment(cursor, start, "unknown", "")
+		if start.Before(cursor) {
+			start = cursor
+		}
+		addSegment(start, stop, statusOf(h), h.State)
+		cursor = stop
+	}
+	addSegment(cursor, end, "unknown", "")
+
+	for i := range day.Segments {
+		s := &day.Segments[i]
+		s.Percent = float64(s.End.Sub(s.Start)) / float64(dayLength) * 100
+	}
+	day.Observed = float64(observed) / float64(end.Sub(dayStart)) * 100
+	if observed > 0 {
+		day.Availability = float64(connected) / float64(observed) * 100
+	}
+	return day, nil
+}
@@ -0,0 +1,148 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/services/snapshot"
+)
+
+// setupTest opens a fresh database, clears the in-memory history and replaces
+// the clock and capture-outcome hooks. It returns pointers to both.
+func setupTest(t *testing.T) (*time.Time, *string) {
+	t.Helper()
+	config.AppConfig.DataDir = t.TempDir()
+	database.InitDB()
+	t.Cleanup(func() { database.GetDB().Close() })
+
+	last = make(map[string]models.CameraHealth)
+	lastWritten = make(map[string]time.Time)
+
+	clock := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	capture := "ok"
+	origNow, origResult := now, snapshot.LastCaptureResult
+	now = func() time.Time { return clock }
+	snapshot.LastCaptureResult = func(string) string { return capture }
+	t.Cleanup(func() { now, snapshot.LastCaptureResult = origNow, origResult })
+	return &clock, &capture
+}
+
+func connected(upSince string) map[string]string {
+	return map[string]string{"Status": "CONNECTED", "Connected": "true", "UpSince": upSince}
+}
+
+func TestObserve(t *testing.T) {
+	clock, capture := setupTest(t)
+	start := *clock
+
+	Observe("cam1", connected("2024-04-30 08:00:00"))
+	*clock = clock.Add(30 * time.Second)
+	Observe("cam1", connected("2024-04-30 08:00:00")) // unchanged: not written
+	*clock = clock.Add(30 * time.Second)
+	Observe("cam1", map[string]string{"Status": "DISCONNECTED", "Connected": "false", "UpSince": "N/A"})
+	*clock = clock.Add(30 * time.Second)
+	Observe("cam1", connected("2024-05-01 10:01:00"))
+	*clock = clock.Add(30 * time.Second)
+	*capture = "failed"
+	Observe("cam1", connected("2024-05-01 10:01:00"))
+	*clock = clock.Add(heartbeat)
+	Observe("cam1", connected("2024-05-01 10:01:00")) // heartbeat
+
+	rows, err := database.GetCameraHealth("cam1", start, clock.Add(time.Second))
+	assert.NoError(t, err)
+	var changes []string
+	for _, h := range rows {
+		changes = append(changes, h.Change)
+	}
+	assert.Equal(t, []string{
+		"monitoring started",
+		"disconnected: DISCONNECTED",
+		"connected",
+		"snapshots failing",
+		"",
+	}, changes)
+	if assert.Len(t, rows, 5) {
+		assert.Equal(t, "failed", rows[4].Snapshot)
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	prev := models.CameraHealth{CheckedAt: base, State: "CONNECTED", Connected: true, UpSince: base.Add(-time.Hour), Snapshot: "failed"}
+
+	cur := prev
+	cur.CheckedAt = base.Add(30 * time.Second)
+	assert.Equal(t, "", describeChange(&prev, cur))
+
+	cur.UpSince = base
+	cur.Snapshot = "ok"
+	assert.Equal(t, "camera restarted at "+base.Local().Format("15:04:05")+"; snapshots recovered", describeChange(&prev, cur))
+
+	cur = prev
+	cur.CheckedAt = base.Add(time.Hour)
+	assert.Equal(t, "monitoring resumed", describeChange(&prev, cur))
+}
+
+func TestGetDay(t *testing.T) {
+	clock, _ := setupTest(t)
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	*clock = day.Add(18 * time.Hour)
+
+	record := func(at time.Duration, ok bool, snap, change string) {
+		state := "DISCONNECTED"
+		if ok {
+			state = "CONNECTED"
+		}
+		assert.NoError(t, database.RecordCameraHealth(models.CameraHealth{
+			CameraID: "cam1", CheckedAt: day.Add(at), State: state, Connected: ok, Snapshot: snap, Change: change,
+		}))
+	}
+	heartbeats := func(from, to time.Duration, ok bool, snap string) {
+		for at := from; at < to; at += heartbeat {
+			record(at, ok, snap, "")
+		}
+	}
+	// Connected since before midnight until 06:00, then down for an hour, up
+	// with failing captures until 08:00, then nothing (the app was stopped)
+	// until noon.
+	record(-2*time.Minute, true, "ok", "")
+	heartbeats(3*time.Minute, 6*time.Hour, true, "ok")
+	record(6*time.Hour, false, "ok", "disconnected: DISCONNECTED")
+	heartbeats(6*time.Hour+heartbeat, 7*time.Hour, false, "ok")
+	record(7*time.Hour, true, "failed", "connected; camera restarted at 07:00:00; snapshots failing")
+	heartbeats(7*time.Hour+heartbeat, 8*time.Hour, true, "failed")
+	record(12*time.Hour, true, "ok", "monitoring resumed; snapshots recovered")
+	heartbeats(12*time.Hour+heartbeat, 18*time.Hour, true, "ok")
+
+	d, err := GetDay("cam1", day)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-05-01", d.Date)
+
+	var statuses []string
+	for _, s := range d.Segments {
+		statuses = append(statuses, s.Status)
+	}
+	assert.Equal(t, []string{"up", "down", "degraded", "unknown", "up"}, statuses)
+	assert.True(t, d.Segments[2].End.Equal(day.Add(8*time.Hour+5*time.Minute)), "the last row counts until maxGap has passed")
+	assert.Equal(t, 1, d.Restarts)
+	assert.Len(t, d.Changes, 3)
+
+	// Observed 14h05m of the 18 hours so far, disconnected for one hour of that.
+	assert.InDelta(t, float64(14*60+5)/float64(18*60)*100, d.Observed, 0.01)
+	assert.InDelta(t, float64(13*60+5)/float64(14*60+5)*100, d.Availability, 0.01)
+
+	var total float64
+	for _, s := range d.Segments {
+		total += s.Percent
+	}
+	assert.InDelta(t, 75, total, 0.01, "today's timeline stops at the current time")
+
+	empty, err := GetDay("cam1", day.AddDate(0, 0, -2))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, empty.Observed)
+}
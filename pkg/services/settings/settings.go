@@ -20,6 +20,9 @@ type SeedEntry struct {
 // KnownSettings lists every operational setting, its optional env-var source, and its default.
 var KnownSettings = []SeedEntry{
 	{"snapshot.interval_sec", "TIMELAPSE_INTERVAL", "3600"},
+	{"snapshot.retry_max_backoff_sec", "", "60"},
+	{"snapshot.min_luma_stddev", "", "3"},
+	{"snapshot.frozen_after_min", "", "120"},
 	{"video.cron_interval_sec", "VIDEO_CRON_INTERVAL", "300"},
 	{"video.format", "VIDEO_FORMAT", "webm"},
 	{"video.quality", "VIDEO_QUALITY", "medium"},
@@ -27,6 +30,14 @@ var KnownSettings = []SeedEntry{
 	{"video.encoder_preset", "", "fast"},
 	{"video.hls_segment_sec", "", "4"},
 	{"video.hls_qualities", "", "source,720p"},
+	{"video.mp4_fragmented", "VIDEO_MP4_FRAGMENTED", "false"},
+	{"video.thumbnails", "VIDEO_THUMBNAILS", "true"},
+	{"video.previews", "VIDEO_PREVIEWS", "true"},
+	{"video.preview_max_kb", "VIDEO_PREVIEW_MAX_KB", "1024"},
+	{"video.encoder_profiles", "", ""},
+	{"video.encoder_webm", "VIDEO_ENCODER_WEBM", "auto"},
+	{"video.encoder_mp4", "VIDEO_ENCODER_MP4", "auto"},
+	{"video.encoder_hls", "VIDEO_ENCODER_HLS", "auto"},
 	{"video.daily_days", "DAYS_OF_24_HOUR_SNAPSHOTS", "30"},
 	{"snapshot.retention_days", "SNAPSHOT_RETENTION_DAYS", "30"},
 	{"gallery.retention_days", "GALLERY_RETENTION_DAYS", "365"},
@@ -36,10 +47,69 @@ var KnownSettings = []SeedEntry{
 	{"video.daylight_start_hour", "DAYLIGHT_START_HOUR", "7"},
 	{"video.daylight_end_hour", "DAYLIGHT_END_HOUR", "19"},
 	{"video.daylight_target_hour", "DAYLIGHT_TARGET_HOUR", "12"},
+	{"video.daylight_mode", "DAYLIGHT_MODE", "fixed"},
+	{"video.daylight_start_offset_min", "", "0"},
+	{"video.daylight_end_offset_min", "", "0"},
+	{"video.daylight_target", "", "hour"},
+	{"site.latitude", "SITE_LATITUDE", ""},
+	{"site.longitude", "SITE_LONGITUDE", ""},
 	{"video.weekly_keep", "WEEKLY_LAPSES_TO_KEEP", "4"},
 	{"video.monthly_keep", "MONTHLY_LAPSES_TO_KEEP", "3"},
 	{"snapshot.hq_params", "HQSNAP", "auto"},
 	{"video.ffmpeg_threads", "FFMPEG_THREADS", "0"},
+	{"jobs.generate_timelapse_concurrency", "TIMELAPSE_CONCURRENCY", "1"},
+	{"jobs.cleanup_snapshots_concurrency", "", "1"},
+	{"jobs.cleanup_gallery_concurrency", "", "1"},
+	{"jobs.cleanup_videos_concurrency", "", "1"},
+	{"jobs.cleanup_logs_concurrency", "", "1"},
+	{"jobs.cleanup_jobs_concurrency", "", "1"},
+	{"jobs.max_attempts", "JOB_MAX_ATTEMPTS", "3"},
+	{"jobs.retry_base_sec", "", "60"},
+	{"jobs.history_days", "JOB_HISTORY_DAYS", "7"},
+	{"events.enabled", "EVENTS_ENABLED", "false"},
+	{"events.webhook_token", "EVENTS_WEBHOOK_TOKEN", ""},
+	{"events.types", "EVENTS_TYPES", "all"},
+	{"events.cooldown_sec", "", "30"},
+	{"events.retention_days", "EVENTS_RETENTION_DAYS", "30"},
+	{"video.activity_timelapse", "ACTIVITY_TIMELAPSE", "false"},
+	{"video.overlay_types", "VIDEO_OVERLAY_TYPES", "none"},
+	{"video.overlay_caption", "VIDEO_OVERLAY_CAPTION", ""},
+	{"video.overlay_position", "", "bottom-right"},
+	{"video.overlay_font_size", "", "0"},
+	{"video.overlay_box", "", "true"},
+	{"video.daily_fps", "", "30"},
+	{"video.daily_target_sec", "", "0"},
+	{"video.daily_hold_sec", "", "0"},
+	{"video.window_fps", "", "30"},
+	{"video.window_target_sec", "", "0"},
+	{"video.window_hold_sec", "", "0"},
+	{"video.activity_fps", "", "30"},
+	{"video.activity_target_sec", "", "0"},
+	{"video.activity_hold_sec", "", "0"},
+	{"video.weekly_fps", "", "30"},
+	{"video.weekly_target_sec", "", "0"},
+	{"video.weekly_hold_sec", "", "0"},
+	{"video.monthly_fps", "", "30"},
+	{"video.monthly_target_sec", "", "0"},
+	{"video.monthly_hold_sec", "", "0"},
+	{"video.yearly_fps", "", "30"},
+	{"video.yearly_target_sec", "", "0"},
+	{"video.yearly_hold_sec", "", "0"},
+	{"video.daily_encoder", "", "default"},
+	{"video.window_encoder", "", "default"},
+	{"video.activity_encoder", "", "default"},
+	{"video.weekly_encoder", "", "default"},
+	{"video.monthly_encoder", "", "default"},
+	{"video.yearly_encoder", "", "default"},
+	{"video.daily_formats", "VIDEO_DAILY_FORMATS", "default"},
+	{"video.window_formats", "", "default"},
+	{"video.activity_formats", "", "default"},
+	{"video.weekly_formats", "VIDEO_WEEKLY_FORMATS", "default"},
+	{"video.monthly_formats", "VIDEO_MONTHLY_FORMATS", "default"},
+	{"video.yearly_formats", "VIDEO_YEARLY_FORMATS", "default"},
+	{"protect.ca_file", "UFP_CA_FILE", ""},
+	{"protect.cert_fingerprint", "UFP_CERT_FINGERPRINT", ""},
+	{"protect.insecure_skip_verify", "UFP_INSECURE_SKIP_VERIFY", "false"},
 }
 
 var (
@@ -137,3 +207,14 @@ func GetCRFForQuality(quality string) string {
 		return "28"
 	}
 }
+
+// SiteLocation returns the configured site.latitude and site.longitude in
+// decimal degrees. ok is false when either is unset or out of range.
+func SiteLocation() (lat, lon float64, ok bool) {
+	lat, errLat := strconv.ParseFloat(strings.TrimSpace(Get("site.latitude", "")), 64)
+	lon, errLon := strconv.ParseFloat(strings.TrimSpace(Get("site.longitude", "")), 64)
+	if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
@@ -0,0 +1,65 @@
+package snapshot
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/protect"
+	"time-machine/pkg/services/settings"
+)
+
+// discoveryTimeout bounds a camera list request to the controller, retries included.
+const discoveryTimeout = 30 * time.Second
+
+// DiscoverCameras lists every camera adopted by the Protect controller and records
+// its name, model, state, MAC address and feature flags in the cameras table.
+// Cameras seen for the first time are added disabled. The reported
+// supportFullHdSnapshot flag is persisted so a camera enabled later picks up its
+// HQ capability without a restart.
+func DiscoverCameras() ([]models.Camera, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	listed, err := protect.Default(10 * time.Second).Cameras(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovered []models.Camera
+	for _, rec := range listed {
+		if !config.ValidCameraID(rec.ID) {
+			log.Printf("WARNING: skipping camera with unusable ID %q from Protect", rec.ID)
+			continue
+		}
+		cam := models.Camera{
+			ID:    rec.ID,
+			Name:  rec.Name,
+			Model: rec.ModelKey,
+			State: rec.State,
+			MAC:   database.NormaliseMAC(rec.MAC),
+		}
+
+		if flags := rec.FeatureFlags; flags != nil {
+			cam.FeatureFlags = string(flags.Raw)
+			if flags.SupportFullHdSnapshot != nil {
+				supported := *flags.SupportFullHdSnapshot
+				setHQCapable(rec.ID, supported)
+				if err := settings.Set(hqCapableSettingKey(rec.ID), strconv.FormatBool(supported)); err != nil {
+					log.Printf("WARNING: could not persist HQ capability for camera %s: %v", rec.ID, err)
+				}
+			}
+		}
+
+		if err := database.UpsertDiscoveredCamera(cam); err != nil {
+			return discovered, err
+		}
+		discovered = append(discovered, cam)
+	}
+
+	log.Printf("✅ Discovered %d camera(s) on the Protect controller", len(discovered))
+	return discovered, nil
+}
@@ -0,0 +1,77 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/services/settings"
+)
+
+func TestDiscoverCameras(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/proxy/protect/integration/v1/cameras", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("X-Api-Key"))
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{
+				"id":       "cam1",
+				"name":     "Front Gate",
+				"modelKey": "camera",
+				"state":    "CONNECTED",
+				"mac":      "f4:e2:c6:a1:b2:c3",
+				"featureFlags": map[string]interface{}{
+					"supportFullHdSnapshot": true,
+					"smartDetectTypes":      []string{"person"},
+				},
+			},
+			{"id": "cam2", "name": "Driveway", "state": "DISCONNECTED"},
+			{"id": "../bad", "name": "Invalid"},
+		})
+	}))
+	defer srv.Close()
+	setupTestDB(t)
+
+	config.AppConfig.UFPHost = srv.URL
+	config.AppConfig.UFPAPIKey = "test-key"
+	assert.NoError(t, database.AddCamera("cam2", ""))
+
+	discovered, err := DiscoverCameras()
+	assert.NoError(t, err)
+	assert.Len(t, discovered, 2)
+
+	cameras, err := database.GetCameras()
+	assert.NoError(t, err)
+	byID := make(map[string]bool)
+	for _, cam := range cameras {
+		byID[cam.ID] = cam.Enabled
+		if cam.ID == "cam1" {
+			assert.Equal(t, "Front Gate", cam.Name)
+			assert.Equal(t, "CONNECTED", cam.State)
+			assert.Equal(t, "F4E2C6A1B2C3", cam.MAC)
+			assert.JSONEq(t, `{"supportFullHdSnapshot":true,"smartDetectTypes":["person"]}`, cam.FeatureFlags)
+		}
+	}
+	assert.False(t, byID["cam1"], "newly discovered cameras start disabled")
+	assert.True(t, byID["cam2"], "configured cameras keep their enabled flag")
+
+	assert.True(t, GetHQCapable("cam1"))
+	assert.Equal(t, "true", settings.Get("camera.cam1.hq_capable", ""))
+}
+
+func TestDiscoverCameras_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	setupTestDB(t)
+
+	config.AppConfig.UFPHost = srv.URL
+	config.AppConfig.UFPAPIKey = "bad-key"
+
+	_, err := DiscoverCameras()
+	assert.Error(t, err)
+}
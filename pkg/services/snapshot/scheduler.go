@@ -0,0 +1,190 @@
+package snapshot
+
+import (
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/protect"
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
+)
+
+// retryBaseDelay is the wait before the first retry of a failed capture slot.
+// Each further retry doubles it, capped at snapshot.retry_max_backoff_sec.
+const retryBaseDelay = 2 * time.Second
+
+// consecutiveFailureWarnThreshold is the number of back-to-back missed slots
+// that triggers a loud log warning about potential NVR/camera connectivity issues.
+const consecutiveFailureWarnThreshold = 3
+
+// Clock and capture hooks, replaced in tests so retries can be exercised without
+// waiting in real time.
+var (
+	now     = time.Now
+	sleep   = time.Sleep
+	capture = CaptureSnapshot
+)
+
+// slotInterval returns the configured capture interval, never less than one second.
+func slotInterval() time.Duration {
+	interval := time.Duration(settings.GetInt("snapshot.interval_sec", 3600)) * time.Second
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// slotStart returns the start of the capture slot containing t. Slots are aligned
+// to local midnight, so an interval of 900s lands on :00, :15, :30 and :45 and one
+// of 3600s lands on the hour. Intervals that do not divide a day evenly restart at
+// midnight, leaving a shorter final slot.
+func slotStart(t time.Time, interval time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return midnight.Add(t.Sub(midnight) / interval * interval)
+}
+
+// nextSlot returns the first slot boundary strictly after t.
+func nextSlot(t time.Time, interval time.Duration) time.Time {
+	next := slotStart(t, interval).Add(interval)
+	nextMidnight := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	if next.After(nextMidnight) {
+		return nextMidnight
+	}
+	return next
+}
+
+// nextCapture returns the first capture time strictly after t: the next base
+// slot or, when sooner, the next slot of a capture window running at the time.
+// Window slots are aligned to midnight like base slots, so a 10-second window
+// captures on :00, :10, :20 and so on. Windows only add captures; base slots
+// inside a window still happen.
+func nextCapture(t time.Time, base time.Duration, windows []models.CaptureWindow) time.Time {
+	next := nextSlot(t, base)
+	for _, w := range windows {
+		interval := time.Duration(w.IntervalSec) * time.Second
+		if interval < time.Second {
+			continue
+		}
+		// Yesterday's window may run past midnight into today.
+		for d := -1; d <= 1; d++ {
+			start, end, ok := util.CaptureWindowRange(w, time.Date(t.Year(), t.Month(), t.Day()+d, 12, 0, 0, 0, t.Location()))
+			if !ok || !end.After(t) || !start.Before(next) {
+				continue
+			}
+			from := t
+			if from.Before(start) {
+				from = start.Add(-time.Nanosecond)
+			}
+			if s := nextSlot(from, interval); s.Before(end) && s.Before(next) {
+				next = s
+			}
+		}
+	}
+	return next
+}
+
+// jitter spreads d by ±50% so cameras behind one NVR don't retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int64N(int64(d)+1))
+}
+
+// StartSnapshotScheduler captures one snapshot from every enabled camera at each
+// wall-clock slot boundary, and more often during enabled capture windows. A
+// failed capture is retried with exponential backoff and jitter until the slot
+// runs out; slots that still produce no snapshot, or base slots that are skipped
+// entirely, are recorded in the missed_snapshots table.
+// The camera list, interval and capture windows are re-read every slot so admin
+// changes apply without a restart.
+func StartSnapshotScheduler() {
+	var failuresMu sync.Mutex
+	consecutiveFailures := make(map[string]int)
+
+	for {
+		interval := slotInterval()
+		windows, err := database.GetEnabledCaptureWindows()
+		if err != nil {
+			log.Printf("WARNING: could not load capture windows: %v", err)
+		}
+		slot := nextCapture(now(), interval, windows)
+		deadline := nextCapture(slot, interval, windows)
+		sleep(slot.Sub(now()))
+
+		var wg sync.WaitGroup
+		for _, cameraID := range util.ActiveCameraIDs() {
+			wg.Add(1)
+			go func(cameraID string) {
+				defer wg.Done()
+				_, err := captureSlot(cameraID, slot, deadline)
+
+				failuresMu.Lock()
+				defer failuresMu.Unlock()
+				if err == nil {
+					consecutiveFailures[cameraID] = 0
+					return
+				}
+				consecutiveFailures[cameraID]++
+				if n := consecutiveFailures[cameraID]; n >= consecutiveFailureWarnThreshold {
+					log.Printf("WARNING: %d consecutive missed snapshot slots for camera %s — NVR may be unreachable or returning invalid data; check connectivity", n, cameraID)
+				}
+			}(cameraID)
+		}
+		wg.Wait()
+
+		recordSkippedSlots(slot, interval, now())
+	}
+}
+
+// captureSlot takes the snapshot for one camera and slot, retrying failures with
+// exponential backoff and jitter while a retry can still finish before deadline.
+// It returns the number of attempts made and the last error if the slot was missed.
+func captureSlot(cameraID string, slot, deadline time.Time) (int, error) {
+	maxDelay := time.Duration(settings.GetInt("snapshot.retry_max_backoff_sec", 60)) * time.Second
+	delay := retryBaseDelay
+
+	for attempt := 1; ; attempt++ {
+		_, err := capture(cameraID)
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("✅ Snapshot for camera %s slot %s succeeded on attempt %d", cameraID, slot.Format("15:04:05"), attempt)
+			}
+			return attempt, nil
+		}
+
+		// A frozen feed will still be frozen, and a rejected API key still
+		// rejected, seconds from now; give up on the slot.
+		wait := jitter(delay)
+		if errors.Is(err, ErrFrozenFeed) || errors.Is(err, protect.ErrAuth) || now().Add(wait).Add(snapshotTimeout).After(deadline) {
+			log.Printf("WARNING: Missed snapshot slot %s for camera %s after %d attempt(s): %v", slot.Format("2006-01-02 15:04:05"), cameraID, attempt, err)
+			recordMissed(models.MissedSnapshot{CameraID: cameraID, SlotTime: slot, Attempts: attempt, Reason: err.Error()})
+			return attempt, err
+		}
+		log.Printf("Snapshot for camera %s slot %s failed (attempt %d): %v — retrying in %s", cameraID, slot.Format("15:04:05"), attempt, err, wait.Round(time.Millisecond))
+		sleep(wait)
+		if delay *= 2; maxDelay > 0 && delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// recordSkippedSlots records every slot boundary after slot that passed before
+// current without a capture attempt, e.g. because the host was suspended or the
+// previous slot's retries overran.
+func recordSkippedSlots(slot time.Time, interval time.Duration, current time.Time) {
+	for s := nextSlot(slot, interval); !s.After(current); s = nextSlot(s, interval) {
+		for _, cameraID := range util.ActiveCameraIDs() {
+			log.Printf("WARNING: Skipped snapshot slot %s for camera %s", s.Format("2006-01-02 15:04:05"), cameraID)
+			recordMissed(models.MissedSnapshot{CameraID: cameraID, SlotTime: s, Reason: "slot skipped: scheduler was not running"})
+		}
+	}
+}
+
+func recordMissed(m models.MissedSnapshot) {
+	if err := database.RecordMissedSnapshot(m); err != nil {
+		log.Printf("WARNING: could not record missed snapshot slot: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/protect"
+	"time-machine/pkg/services/settings"
+)
+
+func TestSlotAlignment(t *testing.T) {
+	loc := time.FixedZone("AEST", 10*3600)
+	ts := time.Date(2024, 5, 1, 10, 7, 42, 0, loc)
+
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, loc), slotStart(ts, 15*time.Minute))
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 15, 0, 0, loc), nextSlot(ts, 15*time.Minute))
+	assert.Equal(t, time.Date(2024, 5, 1, 11, 0, 0, 0, loc), nextSlot(ts, time.Hour))
+
+	// A boundary is not its own next slot.
+	boundary := time.Date(2024, 5, 1, 10, 15, 0, 0, loc)
+	assert.Equal(t, boundary, slotStart(boundary, 15*time.Minute))
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 30, 0, 0, loc), nextSlot(boundary, 15*time.Minute))
+
+	// 7h does not divide a day: the 21:00 slot is cut short at midnight.
+	late := time.Date(2024, 5, 1, 22, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2024, 5, 1, 21, 0, 0, 0, loc), slotStart(late, 7*time.Hour))
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, loc), nextSlot(late, 7*time.Hour))
+}
+
+func TestNextCapture_Windows(t *testing.T) {
+	loc := time.FixedZone("AEST", 10*3600)
+	burst := models.CaptureWindow{Name: "morning", IntervalSec: 10, StartAnchor: "clock", StartOffset: 6 * 60, EndAnchor: "clock", EndOffset: 6*60 + 30, Weekdays: 0x7f}
+	windows := []models.CaptureWindow{burst}
+	at := func(h, m, s int) time.Time { return time.Date(2024, 5, 1, h, m, s, 0, loc) }
+
+	assert.Equal(t, at(5, 0, 0), nextCapture(at(4, 10, 0), time.Hour, windows), "base slot before the window")
+	assert.Equal(t, at(6, 0, 0), nextCapture(at(5, 10, 0), time.Hour, windows), "window opens on a base slot")
+	assert.Equal(t, at(6, 0, 10), nextCapture(at(6, 0, 0), time.Hour, windows))
+	assert.Equal(t, at(6, 12, 40), nextCapture(at(6, 12, 33), time.Hour, windows))
+	assert.Equal(t, at(7, 0, 0), nextCapture(at(6, 29, 55), time.Hour, windows), "the window's end is exclusive")
+
+	// A window that starts at 23:50 still applies after midnight.
+	late := models.CaptureWindow{IntervalSec: 60, StartAnchor: "clock", StartOffset: 23*60 + 50, EndAnchor: "clock", EndOffset: 10, Weekdays: 0x7f}
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 6, 0, 0, loc), nextCapture(time.Date(2024, 5, 2, 0, 5, 30, 0, loc), time.Hour, []models.CaptureWindow{late}))
+
+	// 2024-05-01 is a Wednesday.
+	burst.Weekdays = 1 << uint(time.Sunday)
+	assert.Equal(t, at(7, 0, 0), nextCapture(at(6, 10, 0), time.Hour, []models.CaptureWindow{burst}), "window not on this weekday")
+}
+
+func TestJitterBounds(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		d := jitter(4 * time.Second)
+		assert.GreaterOrEqual(t, d, 2*time.Second)
+		assert.LessOrEqual(t, d, 6*time.Second)
+	}
+}
+
+// fakeClock drives now and sleep so captureSlot's retries run instantly.
+type fakeClock struct {
+	t      time.Time
+	sleeps []time.Duration
+}
+
+func useFakeClock(t *testing.T, start time.Time) *fakeClock {
+	clock := &fakeClock{t: start}
+	origNow, origSleep, origCapture := now, sleep, capture
+	now = func() time.Time { return clock.t }
+	sleep = func(d time.Duration) {
+		clock.sleeps = append(clock.sleeps, d)
+		clock.t = clock.t.Add(d)
+	}
+	t.Cleanup(func() { now, sleep, capture = origNow, origSleep, origCapture })
+	return clock
+}
+
+func setupSchedulerTest(t *testing.T) {
+	config.AppConfig.DataDir = t.TempDir()
+	config.AppConfig.CameraIDs = []string{"cam1"}
+	database.InitDB()
+	database.SeedConfiguredCameras()
+	settings.Init()
+	t.Cleanup(func() {
+		database.GetDB().Close()
+		config.AppConfig.CameraIDs = nil
+	})
+}
+
+func TestCaptureSlot_RetriesUntilSuccess(t *testing.T) {
+	setupSchedulerTest(t)
+	slot := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	clock := useFakeClock(t, slot)
+
+	calls := 0
+	capture = func(cameraID string) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", errors.New("NVR busy")
+		}
+		return "/tmp/snap.jpg", nil
+	}
+
+	attempts, err := captureSlot("cam1", slot, slot.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	if assert.Len(t, clock.sleeps, 2) {
+		assert.GreaterOrEqual(t, clock.sleeps[0], retryBaseDelay/2)
+		assert.LessOrEqual(t, clock.sleeps[0], retryBaseDelay*3/2)
+		assert.GreaterOrEqual(t, clock.sleeps[1], retryBaseDelay)
+		assert.LessOrEqual(t, clock.sleeps[1], retryBaseDelay*3)
+	}
+
+	missed, err := database.GetMissedSnapshots("cam1", time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, missed)
+}
+
+func TestCaptureSlot_RecordsMissedSlotAtDeadline(t *testing.T) {
+	setupSchedulerTest(t)
+	settings.Set("snapshot.retry_max_backoff_sec", "10")
+	slot := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	clock := useFakeClock(t, slot)
+	capture = func(cameraID string) (string, error) { return "", errors.New("connection refused") }
+
+	deadline := slot.Add(5 * time.Minute)
+	attempts, err := captureSlot("cam1", slot, deadline)
+	assert.EqualError(t, err, "connection refused")
+	assert.Greater(t, attempts, 1)
+	assert.False(t, clock.t.Add(snapshotTimeout).After(deadline), "no attempt may start that could overrun the slot")
+	for _, d := range clock.sleeps {
+		assert.LessOrEqual(t, d, 15*time.Second, "backoff is capped by snapshot.retry_max_backoff_sec (plus jitter)")
+	}
+
+	missed, err := database.GetMissedSnapshots("cam1", time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, missed, 1) {
+		assert.True(t, missed[0].SlotTime.Equal(slot))
+		assert.Equal(t, attempts, missed[0].Attempts)
+		assert.Equal(t, "connection refused", missed[0].Reason)
+	}
+}
+
+func TestCaptureSlot_FrozenFeedIsNotRetried(t *testing.T) {
+	setupSchedulerTest(t)
+	slot := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	clock := useFakeClock(t, slot)
+	capture = func(cameraID string) (string, error) {
+		return "", fmt.Errorf("snapshot rejected: %w: frame unchanged for 2h0m0s", ErrFrozenFeed)
+	}
+
+	attempts, err := captureSlot("cam1", slot, slot.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrFrozenFeed)
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, clock.sleeps)
+}
+
+func TestCaptureSlot_RejectedKeyIsNotRetried(t *testing.T) {
+	setupSchedulerTest(t)
+	slot := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	clock := useFakeClock(t, slot)
+	capture = func(cameraID string) (string, error) {
+		return "", fmt.Errorf("snapshot API request failed: %w", &protect.APIError{StatusCode: 401})
+	}
+
+	attempts, err := captureSlot("cam1", slot, slot.Add(time.Hour))
+	assert.ErrorIs(t, err, protect.ErrAuth)
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, clock.sleeps)
+}
+
+func TestRecordSkippedSlots(t *testing.T) {
+	setupSchedulerTest(t)
+	slot := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	// The host slept from 10:00 until 10:50: the 10:15, 10:30 and 10:45 slots were skipped.
+	recordSkippedSlots(slot, 15*time.Minute, slot.Add(50*time.Minute))
+
+	missed, err := database.GetMissedSnapshots("cam1", time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, missed, 3) {
+		assert.True(t, missed[0].SlotTime.Equal(slot.Add(45*time.Minute)))
+		assert.True(t, missed[2].SlotTime.Equal(slot.Add(15*time.Minute)))
+		assert.Equal(t, 0, missed[0].Attempts)
+	}
+
+	recordSkippedSlots(slot, 15*time.Minute, slot.Add(10*time.Minute))
+	missed, _ = database.GetMissedSnapshots("cam1", time.Time{})
+	assert.Len(t, missed, 3, "nothing is skipped while the scheduler keeps up")
+}
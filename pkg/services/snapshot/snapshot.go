@@ -1,19 +1,22 @@
 package snapshot
 
 import (
-	"crypto/tls"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/protect"
 	"time-machine/pkg/services/settings"
 	"time-machine/pkg/util"
 )
@@ -23,105 +26,144 @@ import (
 // or near-empty body. Snapshots below this threshold are discarded on capture.
 const minSnapshotBytes int64 = 2048
 
-// consecutiveFailureWarnThreshold is the number of back-to-back snapshot failures
-// that triggers a loud log warning about potential NVR/camera connectivity issues.
-const consecutiveFailureWarnThreshold = 3
+// maxSnapshotBytes caps how much of a snapshot response is read. A camera JPEG
+// is a few MiB at most; a larger body, say from a misconfigured URL source, is
+// rejected rather than read into memory.
+const maxSnapshotBytes int64 = 32 << 20
 
-// hqCapable is the camera's auto-detected HQ snapshot capability, set at startup.
-// It is only written once during InitSnapshotSettings and is safe to read concurrently.
-var hqCapable bool
+// hqCapable holds each camera's auto-detected HQ snapshot capability, keyed by
+// camera ID. It is populated during InitSnapshotSettings.
+var (
+	hqMu      sync.RWMutex
+	hqCapable = make(map[string]bool)
+)
+
+func setHQCapable(cameraID string, capable bool) {
+	hqMu.Lock()
+	hqCapable[cameraID] = capable
+	hqMu.Unlock()
+}
+
+// hqCapableSettingKey is the settings key used to persist a camera's detected
+// HQ capability as a fallback for startups where the camera is unreachable.
+func hqCapableSettingKey(cameraID string) string {
+	if cameraID == "" {
+		return "camera.hq_capable"
+	}
+	return fmt.Sprintf("camera.%s.hq_capable", cameraID)
+}
 
-// InitSnapshotSettings probes camera capabilities and seeds the initial HQ snapshot mode.
-// The effective mode is re-evaluated dynamically at each snapshot, so admin changes to
-// snapshot.hq_params take effect on the next capture without a restart.
+// InitSnapshotSettings probes camera capabilities and seeds the initial HQ snapshot mode
+// for every enabled camera. The effective mode is re-evaluated dynamically at each snapshot,
+// so admin changes to snapshot.hq_params take effect on the next capture without a restart.
 func InitSnapshotSettings() {
 	hqSetting := strings.ToLower(settings.Get("snapshot.hq_params", "auto"))
 
 	log.Println("╔══ Snapshot Quality Configuration ════════════════════════")
 	log.Printf("║  snapshot.hq_params (HQSNAP): %q", hqSetting)
 
-	switch hqSetting {
-	case "true":
-		hqCapable = true
-		log.Println("║  Mode: FORCED ON — high-quality snapshots enabled regardless of camera capability")
-	case "false":
-		hqCapable = false
-		log.Println("║  Mode: FORCED OFF — standard quality snapshots (HQSNAP=false)")
-	default: // "auto" or unrecognised
-		log.Println("║  Mode: AUTO — probing camera for HQ snapshot support...")
-		detectAndPersistHQCapability()
+	for _, cameraID := range util.ActiveCameraIDs() {
+		if !isProtectCamera(cameraID) {
+			log.Printf("║  Camera %s: non-Protect source, HQ detection skipped", cameraID)
+			continue
+		}
+		if cameraID != "" {
+			log.Printf("║  Camera %s", cameraID)
+		}
+		switch hqSetting {
+		case "true":
+			setHQCapable(cameraID, true)
+			log.Println("║  Mode: FORCED ON — high-quality snapshots enabled regardless of camera capability")
+		case "false":
+			setHQCapable(cameraID, false)
+			log.Println("║  Mode: FORCED OFF — standard quality snapshots (HQSNAP=false)")
+		default: // "auto" or unrecognised
+			log.Println("║  Mode: AUTO — probing camera for HQ snapshot support...")
+			detectAndPersistHQCapability(cameraID)
+		}
+		log.Printf("║  Effective snapshot quality: %s", GetEffectiveSnapshotQuality(cameraID))
 	}
-
-	log.Printf("║  Effective snapshot quality: %s", GetEffectiveSnapshotQuality())
 	log.Println("╚══════════════════════════════════════════════════════════")
 }
 
 // detectAndPersistHQCapability queries the camera API for supportFullHdSnapshot and
 // stores the result in the settings DB so future startups have a fallback value.
-func detectAndPersistHQCapability() {
-	status := GetCameraStatus()
+func detectAndPersistHQCapability(cameraID string) {
+	cam, err := GetCameraStatus(cameraID)
+	settingKey := hqCapableSettingKey(cameraID)
 
-	if errMsg, ok := status["error"]; ok {
+	if err != nil {
 		// Fall back to the last-known persisted value so a brief offline camera
 		// doesn't permanently disable HQ on the next restart.
-		storedCapable := strings.ToLower(settings.Get("camera.hq_capable", "false"))
-		hqCapable = storedCapable == "true"
-		log.Printf("║  WARNING: Camera probe failed (%v)", errMsg)
-		log.Printf("║           Using last-known stored capability: hq_capable=%v", hqCapable)
+		storedCapable := strings.ToLower(settings.Get(settingKey, "false"))
+		setHQCapable(cameraID, storedCapable == "true")
+		log.Printf("║  WARNING: Camera probe failed (%v)", err)
+		log.Printf("║           Using last-known stored capability: hq_capable=%v", storedCapable == "true")
 		return
 	}
 
-	flags, ok := status["featureFlags"].(map[string]interface{})
-	if !ok {
-		log.Println("║  WARNING: featureFlags missing from camera API response — defaulting to standard quality")
-		hqCapable = false
-	} else if supported, ok := flags["supportFullHdSnapshot"].(bool); ok {
-		hqCapable = supported
-		if supported {
-			log.Println("║  Camera: supportFullHdSnapshot = true  — HQ snapshots AVAILABLE for this model")
-		} else {
-			log.Println("║  Camera: supportFullHdSnapshot = false — HQ snapshots NOT supported by this model")
+	if cam.Name != "" && cameraID != "" {
+		if err := database.SetCameraName(cameraID, cam.Name); err != nil {
+			log.Printf("║  WARNING: could not store name for camera %s: %v", cameraID, err)
 		}
-	} else {
+	}
+
+	var capable bool
+	switch {
+	case cam.FeatureFlags == nil:
+		log.Println("║  WARNING: featureFlags missing from camera API response — defaulting to standard quality")
+	case cam.FeatureFlags.SupportFullHdSnapshot == nil:
 		log.Println("║  WARNING: supportFullHdSnapshot flag absent in featureFlags — defaulting to standard quality")
-		hqCapable = false
+	case *cam.FeatureFlags.SupportFullHdSnapshot:
+		capable = true
+		log.Println("║  Camera: supportFullHdSnapshot = true  — HQ snapshots AVAILABLE for this model")
+	default:
+		log.Println("║  Camera: supportFullHdSnapshot = false — HQ snapshots NOT supported by this model")
 	}
+	setHQCapable(cameraID, capable)
 
 	// Persist detected value as a fallback for future startups when the camera may be offline.
-	if err := settings.Set("camera.hq_capable", strconv.FormatBool(hqCapable)); err != nil {
-		log.Printf("║  WARNING: could not persist camera.hq_capable to DB: %v", err)
+	if err := settings.Set(settingKey, strconv.FormatBool(capable)); err != nil {
+		log.Printf("║  WARNING: could not persist %s to DB: %v", settingKey, err)
 	}
 }
 
-// isHighQualityEnabled returns whether the next snapshot should use the HQ endpoint.
+// isHighQualityEnabled returns whether the next snapshot from cameraID should use the HQ endpoint.
 // It reads snapshot.hq_params from the DB on every call so admin changes are hot-reloadable
 // without a service restart.
-func isHighQualityEnabled() bool {
+func isHighQualityEnabled(cameraID string) bool {
 	switch strings.ToLower(settings.Get("snapshot.hq_params", "auto")) {
 	case "true":
 		return true
 	case "false":
 		return false
 	default: // "auto"
-		return hqCapable
+		return GetHQCapable(cameraID)
 	}
 }
 
-// GetHQCapable returns the auto-detected camera HQ capability (set at startup).
-func GetHQCapable() bool {
-	return hqCapable
+// GetHQCapable returns the auto-detected HQ capability of cameraID (set at startup
+// or by discovery). Cameras not probed since startup fall back to the persisted value.
+func GetHQCapable(cameraID string) bool {
+	hqMu.RLock()
+	capable, ok := hqCapable[cameraID]
+	hqMu.RUnlock()
+	if !ok {
+		return settings.Get(hqCapableSettingKey(cameraID), "false") == "true"
+	}
+	return capable
 }
 
 // GetEffectiveSnapshotQuality returns a human-readable description of the snapshot
 // quality that will be used for the next capture, including how the mode was selected.
-func GetEffectiveSnapshotQuality() string {
+func GetEffectiveSnapshotQuality(cameraID string) string {
 	switch strings.ToLower(settings.Get("snapshot.hq_params", "auto")) {
 	case "true":
 		return "High Quality (forced on)"
 	case "false":
 		return "Standard (forced off)"
 	default: // "auto"
-		if hqCapable {
+		if GetHQCapable(cameraID) {
 			return "High Quality (auto-detected)"
 		}
 		return "Standard (auto-detected)"
@@ -130,212 +172,280 @@ func GetEffectiveSnapshotQuality() string {
 
 // --- CORE LOGIC (Scheduler and API calls) ---
 
-func StartSnapshotScheduler() {
-	var consecutiveFailures int
-	for {
-		if TakeSnapshot() {
-			consecutiveFailures = 0
-		} else {
-			consecutiveFailures++
-			if consecutiveFailures >= consecutiveFailureWarnThreshold {
-				log.Printf("WARNING: %d consecutive snapshot failures — NVR may be unreachable or returning invalid data; check connectivity", consecutiveFailures)
-			}
-		}
-		time.Sleep(time.Duration(settings.GetInt("snapshot.interval_sec", 3600)) * time.Second)
-	}
-}
+// lastCapture remembers whether each camera's most recent capture succeeded, for
+// the status card of cameras that have no Protect status API.
+var (
+	lastCaptureMu sync.Mutex
+	lastCapture   = make(map[string]bool)
+)
 
-func TakeSnapshot() bool {
-	if config.AppConfig.UFPHost == "" || config.AppConfig.UFPAPIKey == "" || config.AppConfig.TargetCameraID == "" {
-		log.Println("Snapshot Error: UniFi Protect credentials missing.")
+// TakeSnapshot captures a single frame from cameraID and reports whether it was
+// saved. Failures are logged; use CaptureSnapshot when the reason is needed.
+func TakeSnapshot(cameraID string) bool {
+	if _, err := CaptureSnapshot(cameraID); err != nil {
+		log.Printf("Snapshot Error: camera %s: %v", cameraID, err)
 		return false
 	}
+	return true
+}
 
-	apiURL := fmt.Sprintf("%s/proxy/protect/integration/v1/cameras/%s/snapshot", config.AppConfig.UFPHost, config.AppConfig.TargetCameraID)
-	if isHighQualityEnabled() {
-		apiURL += "?highQuality=true"
-	}
+// CaptureSnapshot captures a single frame from cameraID's snapshot source into that
+// camera's snapshot tree, copies the first frame of each hour to its gallery and
+// refreshes its latest_snapshot.jpg. It returns the saved path, or an error
+// describing why the capture was rejected.
+func CaptureSnapshot(cameraID string) (string, error) {
+	path, err := captureSnapshot(cameraID, nil)
+	lastCaptureMu.Lock()
+	lastCapture[cameraID] = err == nil
+	lastCaptureMu.Unlock()
+	return path, err
+}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// CaptureEventSnapshot captures a frame from cameraID in response to a Protect
+// event and indexes it with tags (see util.NormaliseEventTags). Event frames are
+// saved under the camera's events tree and never copied to the gallery, so they
+// do not show up in the scheduled timelapses.
+func CaptureEventSnapshot(cameraID string, tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", fmt.Errorf("event snapshot needs at least one tag")
+	}
+	path, err := captureSnapshot(cameraID, tags)
+	lastCaptureMu.Lock()
+	lastCapture[cameraID] = err == nil
+	lastCaptureMu.Unlock()
+	return path, err
+}
+
+// LastCaptureResult reports the outcome of cameraID's most recent capture: "ok",
+// "failed", or "" if none has been attempted since startup.
+var LastCaptureResult = func(cameraID string) string {
+	lastCaptureMu.Lock()
+	ok, attempted := lastCapture[cameraID]
+	lastCaptureMu.Unlock()
+	switch {
+	case !attempted:
+		return ""
+	case ok:
+		return "ok"
+	default:
+		return "failed"
 	}
-	client := &http.Client{
-		Timeout:   10 * time.Second,
-		Transport: tr,
+}
+
+func captureSnapshot(cameraID string, tags []string) (string, error) {
+	if cameraID == "" {
+		return "", fmt.Errorf("no camera configured")
 	}
 
-	req, err := http.NewRequest("GET", apiURL, nil)
+	src, err := sourceFor(cameraID)
 	if err != nil {
-		log.Printf("Error creating snapshot request: %v", err)
-		return false
+		return "", err
 	}
-	req.Header.Set("X-Api-Key", config.AppConfig.UFPAPIKey)
 
-	resp, err := client.Do(req)
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	body, err := src.Fetch(ctx)
 	if err != nil {
-		log.Printf("Snapshot API request failed: %v", err)
-		return false
+		return "", err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("UniFi API returned status code %d: %s", resp.StatusCode, string(bodyBytes))
-		return false
+	data, err := io.ReadAll(io.LimitReader(body, maxSnapshotBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("reading snapshot from %s: %w", src.Describe(), err)
+	}
+	if int64(len(data)) > maxSnapshotBytes {
+		return "", fmt.Errorf("snapshot from %s discarded: larger than %d MiB", src.Describe(), maxSnapshotBytes>>20)
 	}
 
 	now := time.Now()
+	fileName := util.EventFileName(now, tags)
+
+	// Reject snapshots that are too small to be a real camera JPEG, can't be fully
+	// decoded, or show no real picture. An NVR that is up but whose camera is offline
+	// can return HTTP 200 with an empty body, a grey placeholder or a stale frame,
+	// all of which would produce corrupt or misleading video frames.
+	var rejectErr error
+	var frame frameStats
+	if int64(len(data)) < minSnapshotBytes {
+		rejectErr = fmt.Errorf("snapshot discarded: %d bytes is below minimum threshold (%d) — source may be returning empty/placeholder data",
+			len(data), minSnapshotBytes)
+	} else if frame, err = validateFrame(cameraID, data, now); err != nil {
+		rejectErr = fmt.Errorf("snapshot rejected: %w", err)
+	}
+	if rejectErr != nil {
+		if len(data) > 0 {
+			if path, err := util.QuarantineData(cameraID, fileName, data, rejectErr.Error()); err != nil {
+				log.Printf("Error quarantining rejected snapshot: %v", err)
+			} else {
+				log.Printf("Rejected snapshot from %s kept in %s", src.Describe(), path)
+			}
+		}
+		return "", rejectErr
+	}
 
-	// Path: snapshots/YYYY-MM/DD/HH/
-	snapshotDir := filepath.Join(config.AppConfig.SnapshotsDir, now.Format("2006-01"), now.Format("02"), now.Format("15"))
+	// Path: cameras/<id>/snapshots/YYYY-MM/DD/HH/, or cameras/<id>/events/YYYY-MM/DD/ for event frames
+	snapshotDir := filepath.Join(config.CameraSnapshotsDir(cameraID), now.Format("2006-01"), now.Format("02"), now.Format("15"))
+	if len(tags) > 0 {
+		snapshotDir = filepath.Join(config.CameraEventsDir(cameraID), now.Format("2006-01"), now.Format("02"))
+	}
 	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
-		log.Printf("Error creating snapshot directory %s: %v", snapshotDir, err)
-		return false
+		return "", fmt.Errorf("creating snapshot directory %s: %w", snapshotDir, err)
 	}
 
-	fileName := now.Format("2006-01-02-15-04-05") + ".jpg"
 	snapshotPath := filepath.Join(snapshotDir, fileName)
-	out, err := os.Create(snapshotPath)
-	if err != nil {
-		log.Printf("Error creating file %s: %v", snapshotPath, err)
-		return false
-	}
-
-	_, copyErr := io.Copy(out, resp.Body)
-	out.Close() // close before stat so the OS flushes metadata
-
-	if copyErr != nil {
-		log.Printf("Error saving snapshot to file %s: %v", snapshotPath, copyErr)
+	if err := os.WriteFile(snapshotPath, data, 0644); err != nil {
 		os.Remove(snapshotPath)
-		return false
+		return "", fmt.Errorf("saving snapshot to file %s: %w", snapshotPath, err)
 	}
 
-	// Reject snapshots that are too small to be a real camera JPEG.
-	// An NVR that is up but whose camera is offline can return HTTP 200
-	// with an empty or near-empty body that would produce corrupt video frames.
-	info, statErr := os.Stat(snapshotPath)
-	if statErr != nil {
-		log.Printf("Snapshot %s: stat failed after write: %v", snapshotPath, statErr)
-		os.Remove(snapshotPath)
-		return false
+	log.Printf("Snapshot saved from %s: %s", src.Describe(), snapshotPath)
+	record := models.Snapshot{
+		CameraID:   cameraID,
+		Path:       snapshotPath,
+		CapturedAt: now,
+		Size:       int64(len(data)),
+		Width:      frame.width,
+		Height:     frame.height,
+		Hash:       fmt.Sprintf("%016x", frame.hash),
+		Source:     src.Describe(),
+		Tags:       tags,
 	}
-	if info.Size() < minSnapshotBytes {
-		log.Printf("Snapshot %s discarded: %d bytes is below minimum threshold (%d) — NVR may be returning empty/placeholder data",
-			snapshotPath, info.Size(), minSnapshotBytes)
-		os.Remove(snapshotPath)
-		return false
+	if err := database.UpsertSnapshot(record); err != nil {
+		log.Printf("Error indexing snapshot: %v", err)
+	}
+	if len(tags) > 0 {
+		return snapshotPath, nil
 	}
-
-	log.Printf("Snapshot saved: %s", snapshotPath)
 
 	// Save the first snapshot of the hour to the gallery.
 	galleryFileName := now.Format("2006-01-02-15") + ".jpg"
-	galleryPath := filepath.Join(config.AppConfig.GalleryDir, galleryFileName)
+	galleryPath := filepath.Join(config.CameraGalleryDir(cameraID), galleryFileName)
 
 	if !util.FileExists(galleryPath) {
+		if err := os.MkdirAll(filepath.Dir(galleryPath), 0755); err != nil {
+			log.Printf("Error creating gallery directory %s: %v", filepath.Dir(galleryPath), err)
+		}
 		if err := util.CopyFile(snapshotPath, galleryPath); err != nil {
 			log.Printf("Error copying snapshot to gallery %s: %v", galleryPath, err)
 		} else {
 			log.Printf("Saved new gallery image: %s", galleryPath)
+			record.Path, record.InGallery = galleryPath, true
+			if err := database.UpsertSnapshot(record); err != nil {
+				log.Printf("Error indexing gallery image: %v", err)
+			}
 		}
 	}
 
 	// Update the latest_snapshot.jpg for the video player poster.
-	latestPath := filepath.Join(config.AppConfig.DataDir, "latest_snapshot.jpg")
+	latestPath := filepath.Join(config.CameraDataDir(cameraID), "latest_snapshot.jpg")
 	if err := util.CopyFile(snapshotPath, latestPath); err != nil {
 		log.Printf("Error copying snapshot to latest_snapshot.jpg: %v", err)
 	}
-	return true
+	return snapshotPath, nil
 }
 
-func GetCameraStatus() map[string]interface{} {
-	if config.AppConfig.UFPHost == "" || config.AppConfig.UFPAPIKey == "" || config.AppConfig.TargetCameraID == "" {
-		return map[string]interface{}{"error": "UniFi Protect credentials missing from environment."}
-	}
+// statusTimeout bounds a status request to the controller, retries included.
+const statusTimeout = 10 * time.Second
 
-	apiURL := fmt.Sprintf("%s/proxy/protect/integration/v1/cameras/%s", config.AppConfig.UFPHost, config.AppConfig.TargetCameraID)
+// GetCameraStatus fetches cameraID's record from the Protect controller.
+func GetCameraStatus(cameraID string) (*protect.Camera, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+	return protect.Default(5*time.Second).Camera(ctx, cameraID)
+}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{
-		Timeout:   5 * time.Second,
-		Transport: tr,
+// statusError turns a status request failure into the short text shown as the
+// camera's status, so the dashboard and health history are not cluttered with
+// transport details.
+func statusError(err error) string {
+	switch {
+	case errors.Is(err, protect.ErrNotConfigured):
+		return "API ERROR: credentials missing"
+	case errors.Is(err, protect.ErrAuth):
+		return "API ERROR: API key rejected"
+	case errors.Is(err, protect.ErrNotFound):
+		return "API ERROR: camera not found"
+	case errors.Is(err, protect.ErrOffline):
+		return "API ERROR: controller unreachable"
+	default:
+		return fmt.Sprintf("API ERROR: %v", err)
 	}
+}
 
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		log.Printf("Error creating camera status request: %v", err)
-		return map[string]interface{}{"error": fmt.Sprintf("Request creation error: %v", err)}
+// GetFormattedCameraStatus returns display-ready status fields for cameraID.
+var GetFormattedCameraStatus = func(cameraID string) map[string]string {
+	if cam, _ := database.GetCamera(cameraID); cam != nil && cam.SourceType != "" && cam.SourceType != SourceProtect {
+		return externalCameraStatus(*cam)
 	}
 
-	req.Header.Set("X-Api-Key", config.AppConfig.UFPAPIKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
+	cam, err := GetCameraStatus(cameraID)
 	if err != nil {
-		log.Printf("Camera Status API request failed: %v", err)
-		return map[string]interface{}{"error": fmt.Sprintf("API request failed: %v", err)}
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("UniFi API returned status code %d: %s", resp.StatusCode, string(bodyBytes))
-		return map[string]interface{}{"error": fmt.Sprintf("API returned status code %d", resp.StatusCode)}
+		log.Printf("Camera status request for %s failed: %v", cameraID, err)
+		return map[string]string{"ID": cameraID, "Status": statusError(err)}
 	}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		log.Printf("Error decoding camera status JSON: %v", err)
-		return map[string]interface{}{"error": "Failed to decode API response."}
+	status := cam.State
+	if status == "" {
+		status = "Unknown"
 	}
-
-	return result
-}
-
-var GetFormattedCameraStatus = func() map[string]string {
-	rawStatus := GetCameraStatus()
-
-	if rawStatus == nil {
-		return map[string]string{"Status": "ERROR: Connection Failed"}
-	}
-	if errMsg, ok := rawStatus["error"]; ok {
-		return map[string]string{"Status": fmt.Sprintf("API ERROR: %s", errMsg)}
-	}
-
-	status := "Unknown"
-	if state, ok := rawStatus["state"].(string); ok {
-		status = state
-	}
-
 	uptimeStr := "N/A"
-	if uptimeFloat, ok := rawStatus["upSince"].(float64); ok {
-		upSince := time.Unix(int64(uptimeFloat/1000), 0)
+	if upSince := cam.UpSinceTime(); !upSince.IsZero() {
 		uptimeStr = upSince.Format("2006-01-02 15:04:05")
 	}
-
 	model := "N/A"
-	if modelStr, ok := rawStatus["modelKey"].(string); ok {
-		model = strings.ReplaceAll(modelStr, "UVC G", "G")
+	if cam.ModelKey != "" {
+		model = strings.ReplaceAll(cam.ModelKey, "UVC G", "G")
 	}
-
 	name := "N/A"
-	if nameStr, ok := rawStatus["name"].(string); ok {
-		name = nameStr
+	if cam.Name != "" {
+		name = cam.Name
 	}
 
-	hqEnabled := isHighQualityEnabled()
+	hqEnabled := isHighQualityEnabled(cameraID)
 	return map[string]string{
+		"ID":              cameraID,
 		"Name":            name,
 		"Model":           model,
 		"Status":          status,
 		"UpSince":         uptimeStr,
-		"Connected":       strconv.FormatBool(status == "CONNECTED"),
-		"HQCapable":       strconv.FormatBool(hqCapable),
+		"Connected":       strconv.FormatBool(cam.Connected()),
+		"HQCapable":       strconv.FormatBool(GetHQCapable(cameraID)),
 		"HQSetting":       strings.ToLower(settings.Get("snapshot.hq_params", "auto")),
 		"HQEnabled":       strconv.FormatBool(hqEnabled),
-		"SnapshotQuality": GetEffectiveSnapshotQuality(),
+		"SnapshotQuality": GetEffectiveSnapshotQuality(cameraID),
+	}
+}
+
+// externalCameraStatus describes a non-Protect camera. There is no status API to
+// query, so the connection state reflects the outcome of the last capture.
+func externalCameraStatus(cam models.Camera) map[string]string {
+	name := cam.Name
+	if name == "" {
+		name = cam.ID
+	}
+
+	lastCaptureMu.Lock()
+	ok, attempted := lastCapture[cam.ID]
+	lastCaptureMu.Unlock()
+	status := "WAITING FOR FIRST CAPTURE"
+	if attempted && ok {
+		status = "CAPTURING"
+	} else if attempted {
+		status = "CAPTURE FAILED"
+	}
+
+	return map[string]string{
+		"ID":              cam.ID,
+		"Name":            name,
+		"Model":           strings.ToUpper(cam.SourceType) + " source",
+		"Status":          status,
+		"UpSince":         "N/A",
+		"Connected":       strconv.FormatBool(attempted && ok),
+		"HQCapable":       "false",
+		"HQSetting":       strings.ToLower(settings.Get("snapshot.hq_params", "auto")),
+		"HQEnabled":       "false",
+		"SnapshotQuality": "Source default",
 	}
 }
 
@@ -3,6 +3,9 @@ package snapshot
 import (
 	"bytes"
 	"encoding/json"
+	"image"
+	"image/jpeg"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -14,13 +17,27 @@ import (
 	"github.com/stretchr/testify/assert"
 	"time-machine/pkg/config"
 	"time-machine/pkg/database"
+	"time-machine/pkg/protect"
+	"time-machine/pkg/protect/protecttest"
 	"time-machine/pkg/services/settings"
 )
 
-// fakeJPEGBody returns a byte slice of at least minSnapshotBytes that looks like
-// camera data. Real content doesn't matter for unit tests — only the size does.
+// fakeJPEGBody returns a real, noisy JPEG of at least minSnapshotBytes that passes
+// the capture-time content checks. It is deterministic so tests can compare bodies.
 func fakeJPEGBody() []byte {
-	return bytes.Repeat([]byte("X"), int(minSnapshotBytes)+100)
+	return noiseJPEG(1, 128, 96, 0, 255)
+}
+
+// noiseJPEG encodes a w x h greyscale image of random values in [lo, hi].
+func noiseJPEG(seed uint64, w, h, lo, hi int) []byte {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(lo + rng.IntN(hi-lo+1))
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100})
+	return buf.Bytes()
 }
 
 var mockServer *httptest.Server
@@ -64,26 +81,32 @@ func TestInitSnapshotSettings(t *testing.T) {
 	config.AppConfig.UFPHost = mockServer.URL
 	config.AppConfig.UFPAPIKey = "test-key"
 	config.AppConfig.TargetCameraID = "test-cam"
+	assert.NoError(t, database.AddCamera("test-cam", ""))
 
 	// "auto" — mock server returns supportFullHdSnapshot=true, so HQ should be detected
 	settings.Set("snapshot.hq_params", "auto")
 	InitSnapshotSettings()
-	assert.True(t, GetHQCapable(), "auto mode should detect HQ capability from mock camera")
-	assert.True(t, isHighQualityEnabled())
+	assert.True(t, GetHQCapable("test-cam"), "auto mode should detect HQ capability from mock camera")
+	assert.True(t, isHighQualityEnabled("test-cam"))
 
-	// Persist check: camera.hq_capable should be stored in the DB
-	stored := settings.Get("camera.hq_capable", "")
+	// Persist check: the per-camera hq_capable key should be stored in the DB
+	stored := settings.Get("camera.test-cam.hq_capable", "")
 	assert.Equal(t, "true", stored, "detected HQ capability should be persisted in DB")
 
+	// The camera name reported by Protect is recorded against the camera row
+	cameras, err := database.GetCameras()
+	assert.NoError(t, err)
+	assert.Equal(t, "Test Camera", cameras[0].Name)
+
 	// "true" — forced on regardless of camera
 	settings.Set("snapshot.hq_params", "true")
 	InitSnapshotSettings()
-	assert.True(t, isHighQualityEnabled())
+	assert.True(t, isHighQualityEnabled("test-cam"))
 
 	// "false" — forced off regardless of camera
 	settings.Set("snapshot.hq_params", "false")
 	InitSnapshotSettings()
-	assert.False(t, isHighQualityEnabled())
+	assert.False(t, isHighQualityEnabled("test-cam"))
 }
 
 func TestTakeSnapshot(t *testing.T) {
@@ -102,22 +125,41 @@ func TestTakeSnapshot(t *testing.T) {
 
 	// Force HQ on so the snapshot URL uses ?highQuality=true
 	settings.Set("snapshot.hq_params", "true")
-	hqCapable = true
-	ok := TakeSnapshot()
+	setHQCapable("test-cam", true)
+	ok := TakeSnapshot("test-cam")
 	assert.True(t, ok, "TakeSnapshot should return true when NVR returns a valid-sized body")
 
 	now := time.Now()
-	snapshotDir := filepath.Join(config.AppConfig.SnapshotsDir, now.Format("2006-01"), now.Format("02"), now.Format("15"))
+	snapshotDir := filepath.Join(config.CameraSnapshotsDir("test-cam"), now.Format("2006-01"), now.Format("02"), now.Format("15"))
 	assert.DirExists(t, snapshotDir)
 
 	galleryFileName := now.Format("2006-01-02-15") + ".jpg"
-	galleryPath := filepath.Join(config.AppConfig.GalleryDir, galleryFileName)
+	galleryPath := filepath.Join(config.CameraGalleryDir("test-cam"), galleryFileName)
 	assert.FileExists(t, galleryPath)
 
-	latestPath := filepath.Join(config.AppConfig.DataDir, "latest_snapshot.jpg")
+	latestPath := filepath.Join(config.CameraDataDir("test-cam"), "latest_snapshot.jpg")
 	assert.FileExists(t, latestPath)
 }
 
+func TestTakeSnapshot_CamerasAreIsolated(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	setupSnapshotDirs(t)
+	config.AppConfig.UFPHost = mockServer.URL
+	config.AppConfig.UFPAPIKey = "test-key"
+
+	assert.True(t, TakeSnapshot("cam-a"))
+	assert.True(t, TakeSnapshot("cam-b"))
+
+	for _, id := range []string{"cam-a", "cam-b"} {
+		snaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir(id), "*/*/*/*.jpg"))
+		assert.Len(t, snaps, 1, "camera %s should have its own snapshot", id)
+	}
+	rootSnaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir("cam"), "*/*/*/*.jpg"))
+	assert.Empty(t, rootSnaps, "nothing should be written to the legacy root layout")
+}
+
 func setupSnapshotDirs(t *testing.T) {
 	t.Helper()
 	tempDir := t.TempDir()
@@ -141,11 +183,11 @@ func TestTakeSnapshot_EmptyBodyDiscarded(t *testing.T) {
 	config.AppConfig.UFPAPIKey = "key"
 	config.AppConfig.TargetCameraID = "cam"
 
-	ok := TakeSnapshot()
+	ok := TakeSnapshot("cam")
 	assert.False(t, ok, "empty response body should be rejected")
 
 	// No snapshot file should remain on disk.
-	snaps, _ := filepath.Glob(filepath.Join(config.AppConfig.SnapshotsDir, "*/*/*/*.jpg"))
+	snaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir("cam"), "*/*/*/*.jpg"))
 	assert.Empty(t, snaps, "no snapshot file should be left after an empty-body rejection")
 }
 
@@ -163,10 +205,30 @@ func TestTakeSnapshot_TinyBodyDiscarded(t *testing.T) {
 	config.AppConfig.UFPAPIKey = "key"
 	config.AppConfig.TargetCameraID = "cam"
 
-	ok := TakeSnapshot()
+	ok := TakeSnapshot("cam")
 	assert.False(t, ok, "below-threshold body should be rejected")
 
-	snaps, _ := filepath.Glob(filepath.Join(config.AppConfig.SnapshotsDir, "*/*/*/*.jpg"))
+	snaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir("cam"), "*/*/*/*.jpg"))
+	assert.Empty(t, snaps, "no snapshot file should be left after a size rejection")
+}
+
+func TestTakeSnapshot_OversizedBodyDiscarded(t *testing.T) {
+	// A source returning more than any camera JPEG is not read in full.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(bytes.Repeat([]byte("x"), int(maxSnapshotBytes)+1))
+	}))
+	defer srv.Close()
+
+	setupSnapshotDirs(t)
+	config.AppConfig.UFPHost = srv.URL
+	config.AppConfig.UFPAPIKey = "key"
+	config.AppConfig.TargetCameraID = "cam"
+
+	_, err := captureSnapshot("cam", nil)
+	assert.ErrorContains(t, err, "larger than 32 MiB")
+
+	snaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir("cam"), "*/*/*/*.jpg"))
 	assert.Empty(t, snaps, "no snapshot file should be left after a size rejection")
 }
 
@@ -182,10 +244,10 @@ func TestTakeSnapshot_NonOKStatusRejected(t *testing.T) {
 	config.AppConfig.UFPAPIKey = "key"
 	config.AppConfig.TargetCameraID = "cam"
 
-	ok := TakeSnapshot()
+	ok := TakeSnapshot("cam")
 	assert.False(t, ok, "non-200 status should be rejected")
 
-	snaps, _ := filepath.Glob(filepath.Join(config.AppConfig.SnapshotsDir, "*/*/*/*.jpg"))
+	snaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir("cam"), "*/*/*/*.jpg"))
 	assert.Empty(t, snaps, "no snapshot file should be created for a non-200 response")
 }
 
@@ -203,10 +265,10 @@ func TestTakeSnapshot_ValidBodyAccepted(t *testing.T) {
 	config.AppConfig.UFPAPIKey = "key"
 	config.AppConfig.TargetCameraID = "cam"
 
-	ok := TakeSnapshot()
+	ok := TakeSnapshot("cam")
 	assert.True(t, ok, "valid-sized body should be accepted")
 
-	snaps, _ := filepath.Glob(filepath.Join(config.AppConfig.SnapshotsDir, "*/*/*/*.jpg"))
+	snaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir("cam"), "*/*/*/*.jpg"))
 	assert.Len(t, snaps, 1, "exactly one snapshot file should be saved")
 
 	info, err := os.Stat(snaps[0])
@@ -214,6 +276,37 @@ func TestTakeSnapshot_ValidBodyAccepted(t *testing.T) {
 	assert.GreaterOrEqual(t, info.Size(), minSnapshotBytes, "saved snapshot must meet minimum size")
 }
 
+func TestCaptureEventSnapshot(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	setupSnapshotDirs(t)
+	database.InitDB()
+	settings.Init()
+	config.AppConfig.UFPHost = mockServer.URL
+	config.AppConfig.UFPAPIKey = "test-key"
+
+	_, err := CaptureEventSnapshot("cam", nil)
+	assert.Error(t, err, "event frames need a tag")
+
+	path, err := CaptureEventSnapshot("cam", []string{"motion", "person"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(path, config.CameraEventsDir("cam")+string(filepath.Separator)))
+	assert.True(t, strings.HasSuffix(path, "_motion_person.jpg"))
+
+	// Event frames are indexed with their tags and stay out of the snapshot tree and gallery.
+	events, err := database.GetEventSnapshots("cam", "person", time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, path, events[0].Path)
+		assert.NotEmpty(t, events[0].Hash)
+	}
+	snaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir("cam"), "*/*/*/*.jpg"))
+	assert.Empty(t, snaps)
+	gallery, _ := filepath.Glob(filepath.Join(config.CameraGalleryDir("cam"), "*.jpg"))
+	assert.Empty(t, gallery)
+}
+
 func TestGetCameraStatus(t *testing.T) {
 	setupMockServer()
 	defer teardownMockServer()
@@ -222,10 +315,12 @@ func TestGetCameraStatus(t *testing.T) {
 	config.AppConfig.UFPAPIKey = "test-key"
 	config.AppConfig.TargetCameraID = "test-cam"
 
-	status := GetCameraStatus()
-	assert.NotNil(t, status)
-	assert.NotContains(t, status, "error")
-	assert.Equal(t, "CONNECTED", status["state"])
+	status, err := GetCameraStatus("test-cam")
+	assert.NoError(t, err)
+	if assert.NotNil(t, status) {
+		assert.Equal(t, "CONNECTED", status.State)
+		assert.True(t, *status.FeatureFlags.SupportFullHdSnapshot)
+	}
 }
 
 func TestGetFormattedCameraStatus(t *testing.T) {
@@ -239,10 +334,11 @@ func TestGetFormattedCameraStatus(t *testing.T) {
 
 	// Seed HQ setting and simulate an HQ-capable camera detected at startup
 	settings.Set("snapshot.hq_params", "auto")
-	hqCapable = true
+	setHQCapable("test-cam", true)
 
-	formattedStatus := GetFormattedCameraStatus()
+	formattedStatus := GetFormattedCameraStatus("test-cam")
 	assert.NotNil(t, formattedStatus)
+	assert.Equal(t, "test-cam", formattedStatus["ID"])
 	assert.Equal(t, "CONNECTED", formattedStatus["Status"])
 	assert.Equal(t, "Test Camera", formattedStatus["Name"])
 	assert.Equal(t, "G5 Dome", formattedStatus["Model"])
@@ -258,43 +354,43 @@ func TestGetFormattedCameraStatus(t *testing.T) {
 func TestIsHighQualityEnabled(t *testing.T) {
 	setupTestDB(t)
 
-	hqCapable = true
+	setHQCapable("cam", true)
 
 	settings.Set("snapshot.hq_params", "true")
-	assert.True(t, isHighQualityEnabled(), "forced true should enable HQ")
+	assert.True(t, isHighQualityEnabled("cam"), "forced true should enable HQ")
 
 	settings.Set("snapshot.hq_params", "false")
-	assert.False(t, isHighQualityEnabled(), "forced false should disable HQ")
+	assert.False(t, isHighQualityEnabled("cam"), "forced false should disable HQ")
 
 	settings.Set("snapshot.hq_params", "auto")
-	assert.True(t, isHighQualityEnabled(), "auto with hqCapable=true should enable HQ")
+	assert.True(t, isHighQualityEnabled("cam"), "auto with hqCapable=true should enable HQ")
 
-	hqCapable = false
-	assert.False(t, isHighQualityEnabled(), "auto with hqCapable=false should disable HQ")
+	setHQCapable("cam", false)
+	assert.False(t, isHighQualityEnabled("cam"), "auto with hqCapable=false should disable HQ")
 }
 
 func TestGetEffectiveSnapshotQuality(t *testing.T) {
 	setupTestDB(t)
 
-	hqCapable = true
+	setHQCapable("cam", true)
 
 	settings.Set("snapshot.hq_params", "true")
-	q := GetEffectiveSnapshotQuality()
+	q := GetEffectiveSnapshotQuality("cam")
 	assert.Contains(t, q, "High Quality")
 	assert.Contains(t, q, "forced")
 
 	settings.Set("snapshot.hq_params", "false")
-	q = GetEffectiveSnapshotQuality()
+	q = GetEffectiveSnapshotQuality("cam")
 	assert.Contains(t, q, "Standard")
 	assert.Contains(t, q, "forced")
 
 	settings.Set("snapshot.hq_params", "auto")
-	q = GetEffectiveSnapshotQuality()
+	q = GetEffectiveSnapshotQuality("cam")
 	assert.Contains(t, q, "High Quality")
 	assert.Contains(t, q, "auto")
 
-	hqCapable = false
-	q = GetEffectiveSnapshotQuality()
+	setHQCapable("cam", false)
+	q = GetEffectiveSnapshotQuality("cam")
 	assert.Contains(t, q, "Standard")
 	assert.Contains(t, q, "auto")
 }
@@ -303,16 +399,57 @@ func TestDetectAndPersistHQCapability_FallbackOnError(t *testing.T) {
 	setupTestDB(t)
 
 	// Pre-seed a stored capability value
-	settings.Set("camera.hq_capable", "true")
+	settings.Set("camera.test-cam.hq_capable", "true")
 
 	// Point to an unreachable host to force an error
 	config.AppConfig.UFPHost = "http://127.0.0.1:1"
 	config.AppConfig.UFPAPIKey = "test-key"
 	config.AppConfig.TargetCameraID = "test-cam"
 
-	hqCapable = false // reset
-	detectAndPersistHQCapability()
+	setHQCapable("test-cam", false) // reset
+	detectAndPersistHQCapability("test-cam")
 
 	// Should fall back to the stored value
-	assert.True(t, hqCapable, "should use last-known stored value when camera probe fails")
+	assert.True(t, GetHQCapable("test-cam"), "should use last-known stored value when camera probe fails")
+}
+
+// TestProtectEndToEnd runs HQ detection, capture and the status display against
+// the fake controller.
+func TestProtectEndToEnd(t *testing.T) {
+	srv := protecttest.NewServer("test-key", protecttest.Camera("cam1", "Front Door"))
+	defer srv.Close()
+	setupSnapshotDirs(t)
+	database.InitDB()
+	settings.Init()
+	config.AppConfig.UFPHost = srv.URL
+	config.AppConfig.UFPAPIKey = "test-key"
+	assert.NoError(t, database.AddCamera("cam1", ""))
+
+	settings.Set("snapshot.hq_params", "auto")
+	InitSnapshotSettings()
+	assert.True(t, GetHQCapable("cam1"))
+	cam, _ := database.GetCamera("cam1")
+	assert.Equal(t, "Front Door", cam.Name)
+
+	_, err := CaptureSnapshot("cam1")
+	assert.NoError(t, err)
+	reqs := srv.Requests()
+	assert.Equal(t, "true", reqs[len(reqs)-1].URL.Query().Get("highQuality"), "HQ-capable cameras are captured in high quality")
+
+	status := GetFormattedCameraStatus("cam1")
+	assert.Equal(t, "Front Door", status["Name"])
+	assert.Equal(t, "G5 Dome", status["Model"])
+	assert.Equal(t, "CONNECTED", status["Status"])
+	assert.Equal(t, "true", status["Connected"])
+	assert.Equal(t, time.UnixMilli(1714521600000).Format("2006-01-02 15:04:05"), status["UpSince"])
+
+	srv.SetState("cam1", "DISCONNECTED")
+	status = GetFormattedCameraStatus("cam1")
+	assert.Equal(t, "DISCONNECTED", status["Status"])
+	assert.Equal(t, "false", status["Connected"])
+	_, err = CaptureSnapshot("cam1")
+	assert.ErrorIs(t, err, protect.ErrOffline)
+
+	config.AppConfig.UFPAPIKey = "wrong-key"
+	assert.Equal(t, "API ERROR: API key rejected", GetFormattedCameraStatus("cam1")["Status"])
 }
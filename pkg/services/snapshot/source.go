@@ -0,0 +1,117 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+	"time-machine/pkg/protect"
+)
+
+// Snapshot source types stored in cameras.source_type.
+const (
+	SourceProtect = "protect"
+	SourceHTTP    = "http"
+	SourceRTSP    = "rtsp"
+	SourceFolder  = "folder"
+)
+
+// snapshotTimeout bounds a single capture attempt across all source types.
+const snapshotTimeout = 30 * time.Second
+
+// ErrNoNewFrame is returned by sources that have nothing new to capture, such as
+// a watched folder with no image newer than the previous capture.
+var ErrNoNewFrame = errors.New("no new frame available")
+
+// SnapshotSource produces a single JPEG frame for a camera. Sources only fetch
+// the image; CaptureSnapshot validates and stores it and refreshes the gallery and
+// latest_snapshot.jpg identically for every source.
+type SnapshotSource interface {
+	// Fetch returns the JPEG data of a fresh frame. The caller closes it.
+	Fetch(ctx context.Context) (io.ReadCloser, error)
+	// Describe returns a short, credential-free description for log messages.
+	Describe() string
+}
+
+// NewSnapshotSource builds and validates the source configured for cam.
+func NewSnapshotSource(cam models.Camera) (SnapshotSource, error) {
+	switch cam.SourceType {
+	case "", SourceProtect:
+		return &protectSource{cameraID: cam.ID}, nil
+	case SourceHTTP:
+		return newHTTPSource(cam)
+	case SourceRTSP:
+		return newRTSPSource(cam)
+	case SourceFolder:
+		return newFolderSource(cam)
+	default:
+		return nil, fmt.Errorf("unknown snapshot source type %q", cam.SourceType)
+	}
+}
+
+// isProtectCamera reports whether cameraID captures from UniFi Protect. Cameras
+// that are not registered are treated as Protect cameras (TARGET_CAMERA_ID).
+func isProtectCamera(cameraID string) bool {
+	cam, err := database.GetCamera(cameraID)
+	if err != nil || cam == nil {
+		return true
+	}
+	return cam.SourceType == "" || cam.SourceType == SourceProtect
+}
+
+type cachedSource struct {
+	key [6]string
+	src SnapshotSource
+}
+
+var (
+	sourcesMu sync.Mutex
+	sources   = make(map[string]cachedSource)
+)
+
+// sourceKey captures the fields that define a camera's source configuration.
+func sourceKey(cam models.Camera) [6]string {
+	return [6]string{cam.SourceType, cam.SourceURL, cam.SourceUsername, cam.SourcePassword, cam.SourceAuth, cam.SourceFingerprint}
+}
+
+// sourceFor returns the snapshot source for cameraID. The instance is reused while
+// the camera's source configuration is unchanged so stateful sources (the watched
+// folder) remember what they have already captured.
+func sourceFor(cameraID string) (SnapshotSource, error) {
+	cam := models.Camera{ID: cameraID}
+	if stored, err := database.GetCamera(cameraID); err == nil && stored != nil {
+		cam = *stored
+	}
+	key := sourceKey(cam)
+
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if cached, ok := sources[cameraID]; ok && cached.key == key {
+		return cached.src, nil
+	}
+	src, err := NewSnapshotSource(cam)
+	if err != nil {
+		return nil, err
+	}
+	sources[cameraID] = cachedSource{key: key, src: src}
+	return src, nil
+}
+
+// protectSource captures from the UniFi Protect integration API snapshot endpoint.
+type protectSource struct {
+	cameraID string
+}
+
+func (s *protectSource) Describe() string {
+	return "UniFi Protect"
+}
+
+func (s *protectSource) Fetch(ctx context.Context) (io.ReadCloser, error) {
+	opts := protect.SnapshotOptions{HighQuality: isHighQualityEnabled(s.cameraID)}
+	return protect.Default(10*time.Second).Snapshot(ctx, s.cameraID, opts)
+}
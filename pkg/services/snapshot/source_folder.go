@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"time-machine/pkg/models"
+)
+
+// folderSource watches a local directory that another tool (an FTP upload
+// target, a camera's SD-card sync, ...) drops JPEGs into. Each capture takes the
+// newest image that is newer than the one captured before it.
+type folderSource struct {
+	dir string
+
+	mu       sync.Mutex
+	lastSeen time.Time
+}
+
+func newFolderSource(cam models.Camera) (*folderSource, error) {
+	dir := cam.SourceURL
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("folder source needs an absolute directory path, got %q", dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("folder source directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("folder source %s is not a directory", dir)
+	}
+	return &folderSource{dir: filepath.Clean(dir)}, nil
+}
+
+func (s *folderSource) Describe() string {
+	return "folder " + s.dir
+}
+
+func (s *folderSource) Fetch(ctx context.Context) (io.ReadCloser, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", s.dir, err)
+	}
+
+	var newestPath string
+	var newestTime time.Time
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".jpg" && ext != ".jpeg") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(newestTime) {
+			newestPath, newestTime = filepath.Join(s.dir, entry.Name()), info.ModTime()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if newestPath == "" || !newestTime.After(s.lastSeen) {
+		return nil, ErrNoNewFrame
+	}
+
+	f, err := os.Open(newestPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", newestPath, err)
+	}
+	s.lastSeen = newestTime
+	return f, nil
+}
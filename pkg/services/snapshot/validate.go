@@ -0,0 +1,190 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"time-machine/pkg/services/settings"
+)
+
+// ErrFrozenFeed is returned when a camera keeps delivering the same frame, as
+// Protect does when a camera's stream stalls but the NVR still serves its last frame.
+// Retrying within the same slot will not help.
+var ErrFrozenFeed = errors.New("frozen feed")
+
+// hashSize is the side of the greyscale thumbnail the perceptual hash is taken
+// from; the hash keeps the lowest 8x8 DCT frequencies of it.
+const hashSize = 32
+
+// samplesPerCell bounds how many pixels are read per thumbnail cell, so a 4K frame
+// costs no more to check than a small one.
+const samplesPerCell = 8
+
+// frameStats summarises a decoded frame for validation.
+type frameStats struct {
+	width  int
+	height int
+	mean   float64 // mean luma, 0-255
+	stddev float64 // luma standard deviation
+	hash   uint64  // DCT perceptual hash
+}
+
+// lastFrame identifies a camera's most recent distinct frame, by perceptual hash
+// and by SHA-256 of its bytes, and records when it was first seen.
+type lastFrame struct {
+	hash  uint64
+	sum   [sha256.Size]byte
+	since time.Time
+}
+
+var (
+	lastFramesMu sync.Mutex
+	lastFrames   = make(map[string]lastFrame)
+)
+
+// validateFrame checks that data is a complete JPEG with real picture content and
+// that cameraID's feed is not frozen. The returned error is the rejection reason.
+func validateFrame(cameraID string, data []byte, at time.Time) (frameStats, error) {
+	stats, err := inspectFrame(data)
+	if err != nil {
+		return stats, err
+	}
+
+	if minStddev := settings.GetInt("snapshot.min_luma_stddev", 3); stats.stddev < float64(minStddev) {
+		return stats, fmt.Errorf("near-uniform image (mean luma %.0f, stddev %.1f) — camera may be offline or returning a placeholder", stats.mean, stats.stddev)
+	}
+
+	frozenAfter := time.Duration(settings.GetInt("snapshot.frozen_after_min", 120)) * time.Minute
+	if frozenFor := trackFrame(cameraID, stats.hash, sha256.Sum256(data), at); frozenAfter > 0 && frozenFor >= frozenAfter {
+		return stats, fmt.Errorf("%w: frame unchanged for %s", ErrFrozenFeed, frozenFor.Round(time.Minute))
+	}
+	return stats, nil
+}
+
+// trackFrame records cameraID's latest frame and returns how long it has been
+// unchanged. Both hashes must match: a still scene keeps its perceptual hash, but
+// a live camera's sensor noise still changes the bytes of every frame.
+func trackFrame(cameraID string, hash uint64, sum [sha256.Size]byte, at time.Time) time.Duration {
+	lastFramesMu.Lock()
+	defer lastFramesMu.Unlock()
+	prev, ok := lastFrames[cameraID]
+	if ok && hash == prev.hash && sum == prev.sum {
+		return at.Sub(prev.since)
+	}
+	lastFrames[cameraID] = lastFrame{hash: hash, sum: sum, since: at}
+	return 0
+}
+
+// inspectFrame fully decodes a JPEG, rejecting truncated or corrupt data, and
+// measures its brightness spread and perceptual hash.
+func inspectFrame(data []byte) (frameStats, error) {
+	// Cameras sometimes pad the body with zeros after the end-of-image marker.
+	if !bytes.HasSuffix(bytes.TrimRight(data, "\x00"), []byte{0xFF, 0xD9}) {
+		return frameStats{}, fmt.Errorf("truncated JPEG: missing end-of-image marker")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return frameStats{}, fmt.Errorf("undecodable JPEG: %w", err)
+	}
+
+	b := img.Bounds()
+	if b.Dx() < hashSize || b.Dy() < hashSize {
+		return frameStats{}, fmt.Errorf("image too small (%dx%d)", b.Dx(), b.Dy())
+	}
+
+	var thumb [hashSize][hashSize]float64
+	var sum, sumSq float64
+	var n int
+	for ty := 0; ty < hashSize; ty++ {
+		y0, y1 := b.Min.Y+ty*b.Dy()/hashSize, b.Min.Y+(ty+1)*b.Dy()/hashSize
+		for tx := 0; tx < hashSize; tx++ {
+			x0, x1 := b.Min.X+tx*b.Dx()/hashSize, b.Min.X+(tx+1)*b.Dx()/hashSize
+			var cellSum float64
+			var cellN int
+			for y := y0; y < y1; y += max(1, (y1-y0)/samplesPerCell) {
+				for x := x0; x < x1; x += max(1, (x1-x0)/samplesPerCell) {
+					l := luma(img, x, y)
+					cellSum += l
+					sumSq += l * l
+					cellN++
+				}
+			}
+			thumb[ty][tx] = cellSum / float64(cellN)
+			sum += cellSum
+			n += cellN
+		}
+	}
+
+	mean := sum / float64(n)
+	return frameStats{
+		width:  b.Dx(),
+		height: b.Dy(),
+		mean:   mean,
+		stddev: math.Sqrt(math.Max(0, sumSq/float64(n)-mean*mean)),
+		hash:   perceptualHash(&thumb),
+	}, nil
+}
+
+// luma returns the brightness of a pixel, reading the Y plane directly for the
+// YCbCr images the JPEG decoder normally produces.
+func luma(img image.Image, x, y int) float64 {
+	switch im := img.(type) {
+	case *image.YCbCr:
+		return float64(im.Y[im.YOffset(x, y)])
+	case *image.Gray:
+		return float64(im.GrayAt(x, y).Y)
+	default:
+		return float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+	}
+}
+
+// perceptualHash computes a 64-bit pHash: the DCT of the thumbnail is taken and
+// each of the lowest 8x8 frequencies (bar the DC term) sets a bit when it is above
+// their median. Re-encoding and sensor noise rarely change it.
+func perceptualHash(thumb *[hashSize][hashSize]float64) uint64 {
+	var cosTable [8][hashSize]float64
+	for u := 0; u < 8; u++ {
+		for x := 0; x < hashSize; x++ {
+			cosTable[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * hashSize))
+		}
+	}
+
+	// Separable 2D DCT, keeping only the 8 lowest frequencies in each direction.
+	var rows [hashSize][8]float64
+	for y := 0; y < hashSize; y++ {
+		for u := 0; u < 8; u++ {
+			for x := 0; x < hashSize; x++ {
+				rows[y][u] += thumb[y][x] * cosTable[u][x]
+			}
+		}
+	}
+	var coeffs [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			for y := 0; y < hashSize; y++ {
+				coeffs[v*8+u] += rows[y][u] * cosTable[v][y]
+			}
+		}
+	}
+
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coeffs {
+		if i > 0 && c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/services/settings"
+)
+
+// sceneJPEG encodes a smooth gradient scene; shift moves a bright block so two
+// scenes differ in structure rather than noise.
+func sceneJPEG(t *testing.T, shift, quality int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			v := uint8((x + y) * 255 / 560)
+			if x >= 40+shift && x < 140+shift && y >= 60 && y < 160 {
+				v = 250
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}))
+	return buf.Bytes()
+}
+
+func setupValidateTest(t *testing.T) {
+	config.AppConfig.DataDir = t.TempDir()
+	database.InitDB()
+	settings.Init()
+	t.Cleanup(func() { database.GetDB().Close() })
+
+	lastFramesMu.Lock()
+	lastFrames = make(map[string]lastFrame)
+	lastFramesMu.Unlock()
+}
+
+func TestInspectFrame_RejectsBrokenJPEGs(t *testing.T) {
+	valid := fakeJPEGBody()
+
+	_, err := inspectFrame(valid[:len(valid)/2])
+	assert.ErrorContains(t, err, "truncated JPEG")
+
+	garbage := append(bytes.Repeat([]byte("X"), 4096), 0xFF, 0xD9)
+	_, err = inspectFrame(garbage)
+	assert.ErrorContains(t, err, "undecodable JPEG")
+
+	_, err = inspectFrame(append(append([]byte{}, valid...), 0, 0, 0))
+	assert.NoError(t, err, "zero padding after the end-of-image marker is tolerated")
+}
+
+func TestInspectFrame_PerceptualHash(t *testing.T) {
+	a, err := inspectFrame(sceneJPEG(t, 0, 95))
+	assert.NoError(t, err)
+	reencoded, err := inspectFrame(sceneJPEG(t, 0, 60))
+	assert.NoError(t, err)
+	moved, err := inspectFrame(sceneJPEG(t, 150, 95))
+	assert.NoError(t, err)
+
+	assert.Equal(t, a.hash, reencoded.hash, "re-encoding the same picture keeps the hash")
+	assert.NotEqual(t, a.hash, moved.hash)
+}
+
+func TestValidateFrame_UniformImage(t *testing.T) {
+	setupValidateTest(t)
+	grey := noiseJPEG(2, 320, 240, 127, 129)
+
+	_, err := validateFrame("cam", grey, time.Now())
+	assert.ErrorContains(t, err, "near-uniform image")
+
+	settings.Set("snapshot.min_luma_stddev", "0")
+	stats, err := validateFrame("cam", grey, time.Now())
+	assert.NoError(t, err, "a threshold of 0 accepts uniform images")
+	assert.Equal(t, 320, stats.width)
+	assert.Equal(t, 240, stats.height)
+}
+
+func TestValidateFrame_FrozenFeed(t *testing.T) {
+	setupValidateTest(t)
+	settings.Set("snapshot.frozen_after_min", "60")
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	frame := sceneJPEG(t, 0, 90)
+	check := func(cameraID string, data []byte, at time.Time) error {
+		_, err := validateFrame(cameraID, data, at)
+		return err
+	}
+
+	assert.NoError(t, check("cam", frame, start))
+	assert.NoError(t, check("cam", frame, start.Add(45*time.Minute)))
+	assert.NoError(t, check("other", frame, start.Add(60*time.Minute)), "cameras are tracked separately")
+	assert.ErrorIs(t, check("cam", frame, start.Add(60*time.Minute)), ErrFrozenFeed)
+
+	// A changed picture resets the clock.
+	assert.NoError(t, check("cam", sceneJPEG(t, 150, 90), start.Add(75*time.Minute)))
+	assert.NoError(t, check("cam", frame, start.Add(80*time.Minute)))
+
+	settings.Set("snapshot.frozen_after_min", "0")
+	assert.NoError(t, check("cam", frame, start.Add(24*time.Hour)), "0 disables frozen-feed detection")
+}
+
+func TestValidateFrame_StillSceneIsNotFrozen(t *testing.T) {
+	setupValidateTest(t)
+	settings.Set("snapshot.frozen_after_min", "60")
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	// The same picture encoded differently, as a live camera watching a still
+	// scene delivers it: the perceptual hash matches but the bytes do not.
+	frames := [][]byte{sceneJPEG(t, 0, 90), sceneJPEG(t, 0, 85), sceneJPEG(t, 0, 80)}
+	for i, frame := range frames {
+		stats, err := validateFrame("cam", frame, start.Add(time.Duration(i)*time.Hour))
+		assert.NoError(t, err, "frame %d", i)
+		assert.Equal(t, lastFrames["cam"].hash, stats.hash, "frame %d shows the same picture", i)
+	}
+}
+
+func TestTakeSnapshot_RejectedFrameQuarantined(t *testing.T) {
+	setupValidateTest(t)
+	grey := noiseJPEG(3, 320, 240, 127, 129)
+	assert.Greater(t, int64(len(grey)), minSnapshotBytes, "placeholder must pass the size guard")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(grey)
+	}))
+	defer srv.Close()
+
+	config.AppConfig.SnapshotsDir = filepath.Join(config.AppConfig.DataDir, "snapshots")
+	config.AppConfig.GalleryDir = filepath.Join(config.AppConfig.DataDir, "gallery")
+	config.AppConfig.UFPHost = srv.URL
+	config.AppConfig.UFPAPIKey = "key"
+
+	_, err := CaptureSnapshot("cam")
+	assert.ErrorContains(t, err, "near-uniform image")
+
+	snaps, _ := filepath.Glob(filepath.Join(config.CameraSnapshotsDir("cam"), "*/*/*/*.jpg"))
+	assert.Empty(t, snaps, "rejected frames must not reach the snapshot tree")
+
+	quarantined, _ := filepath.Glob(filepath.Join(config.CameraQuarantineDir("cam"), "*.jpg"))
+	if assert.Len(t, quarantined, 1) {
+		data, _ := os.ReadFile(quarantined[0])
+		assert.Equal(t, grey, data)
+		reason, err := os.ReadFile(quarantined[0][:len(quarantined[0])-len(".jpg")] + ".reason.txt")
+		assert.NoError(t, err)
+		assert.Contains(t, string(reason), "near-uniform image")
+	}
+}
+
+func TestCaptureSnapshot_IndexesSnapshotAndGallery(t *testing.T) {
+	setupValidateTest(t)
+	frame := sceneJPEG(t, 0, 90)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame)
+	}))
+	defer srv.Close()
+
+	config.AppConfig.SnapshotsDir = filepath.Join(config.AppConfig.DataDir, "snapshots")
+	config.AppConfig.GalleryDir = filepath.Join(config.AppConfig.DataDir, "gallery")
+	config.AppConfig.UFPHost = srv.URL
+	config.AppConfig.UFPAPIKey = "key"
+
+	path, err := CaptureSnapshot("cam")
+	assert.NoError(t, err)
+
+	snaps, err := database.GetSnapshots("cam", false, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, snaps, 1) {
+		assert.Equal(t, path, snaps[0].Path)
+		assert.Equal(t, int64(len(frame)), snaps[0].Size)
+		assert.Equal(t, 320, snaps[0].Width)
+		assert.Equal(t, 240, snaps[0].Height)
+		assert.Len(t, snaps[0].Hash, 16)
+		assert.Equal(t, "UniFi Protect", snaps[0].Source)
+	}
+
+	gallery, err := database.GetSnapshots("cam", true, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, gallery, 1) {
+		assert.Equal(t, config.CameraGalleryDir("cam"), filepath.Dir(gallery[0].Path))
+		assert.Equal(t, snaps[0].Hash, gallery[0].Hash)
+	}
+}
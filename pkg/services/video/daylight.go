@@ -0,0 +1,96 @@
+package video
+
+import (
+	"log"
+	"time"
+
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/solar"
+)
+
+// sunFor returns the sun events of the day containing the file time t. File
+// times are local wall-clock times labelled UTC (see parseFileTime), so t is
+// re-read as local time first.
+func sunFor(t time.Time, lat, lon float64) solar.Day {
+	return solar.For(time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.Local), lat, lon)
+}
+
+// fileClock converts a real instant to the wall-clock-labelled-UTC form that
+// parseFileTime returns, so the two can be compared.
+func fileClock(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// daylightFilter returns a predicate reporting whether a file time falls in
+// daylight, or nil when daylight filtering is disabled. video.daylight_mode
+// selects fixed hours ("fixed"), sunrise to sunset ("sun") or civil dawn to dusk
+// ("civil"); the solar modes shift each day's start and end by
+// video.daylight_start_offset_min and video.daylight_end_offset_min, and fall
+// back to fixed hours while no site location is set.
+func daylightFilter() func(time.Time) bool {
+	mode := settings.Get("video.daylight_mode", "fixed")
+	if mode == "sun" || mode == "civil" {
+		if lat, lon, ok := settings.SiteLocation(); ok {
+			startOffset := time.Duration(settings.GetInt("video.daylight_start_offset_min", 0)) * time.Minute
+			endOffset := time.Duration(settings.GetInt("video.daylight_end_offset_min", 0)) * time.Minute
+			return func(t time.Time) bool {
+				day := sunFor(t, lat, lon)
+				span := day.Daylight
+				if mode == "civil" {
+					span = day.Civil
+				}
+				if !span.AllDay && !span.None {
+					span.Start = fileClock(span.Start.Add(startOffset))
+					span.End = fileClock(span.End.Add(endOffset))
+				}
+				return span.Contains(t)
+			}
+		}
+		log.Printf("WARNING: video.daylight_mode is %q but site.latitude/site.longitude are not set; using fixed daylight hours", mode)
+	}
+
+	startHour := settings.GetInt("video.daylight_start_hour", 7)
+	endHour := settings.GetInt("video.daylight_end_hour", 19)
+	if startHour <= 0 && endHour >= 24 {
+		return nil
+	}
+	return func(t time.Time) bool {
+		return t.Hour() >= startHour && t.Hour() < endHour
+	}
+}
+
+// pickDailyFrame returns the representative frame from one day's files: the one
+// closest to solar noon when video.daylight_target is "solar_noon" and a site
+// location is set, otherwise the one closest to video.daylight_target_hour.
+func pickDailyFrame(files []string) string {
+	if settings.Get("video.daylight_target", "hour") == "solar_noon" {
+		if lat, lon, ok := settings.SiteLocation(); ok {
+			if t, err := parseFileTime(files[0]); err == nil {
+				return pickClosestToTime(files, fileClock(sunFor(t, lat, lon).Noon))
+			}
+		}
+	}
+	return pickClosestToHour(files, settings.GetInt("video.daylight_target_hour", 12))
+}
+
+// pickClosestToTime returns the file from files captured closest to target.
+func pickClosestToTime(files []string, target time.Time) string {
+	best := files[0]
+	var bestDiff time.Duration = -1
+	for _, f := range files {
+		t, err := parseFileTime(f)
+		if err != nil {
+			continue
+		}
+		diff := t.Sub(target)
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			bestDiff = diff
+			best = f
+		}
+	}
+	return best
+}
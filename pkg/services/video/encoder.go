@@ -0,0 +1,365 @@
+package video
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"time-machine/pkg/services/settings"
+)
+
+// EncoderProfile is a named set of video encoder settings. Zero values defer to
+// the global settings: CRF to video.quality, MaxBitrate to video.max_bitrate,
+// Preset (for x264 and x265) to video.encoder_preset.
+type EncoderProfile struct {
+	Name       string
+	Codec      string // FFmpeg encoder name, e.g. libx265
+	Preset     string // speed preset; -cpu-used for libvpx-vp9 and libaom-av1
+	CRF        int
+	MaxBitrate string // -maxrate, e.g. "4M"
+	BufSize    string // -bufsize; defaults to twice MaxBitrate
+	PixFmt     string // defaults to yuv420p
+	GOP        int    // keyframe interval in frames; 0 leaves it to the encoder
+}
+
+// encoderFormats lists the output formats each supported encoder can be written
+// to. HLS segments are MPEG-TS, which carries only H.264 and H.265.
+var encoderFormats = map[string][]string{
+	"libx264":    {"mp4", "hls"},
+	"libx265":    {"mp4", "hls"},
+	"libvpx-vp9": {"webm", "mp4"},
+	"libsvtav1":  {"webm", "mp4"},
+	"libaom-av1": {"webm", "mp4"},
+}
+
+// builtinProfiles are always available for selection, subject to FFmpeg
+// reporting their encoder.
+var builtinProfiles = []EncoderProfile{
+	{Name: "h264", Codec: "libx264"},
+	{Name: "h265", Codec: "libx265"},
+	{Name: "vp9", Codec: "libvpx-vp9"},
+	{Name: "av1-svt", Codec: "libsvtav1", Preset: "10"},
+	{Name: "av1-aom", Codec: "libaom-av1"},
+}
+
+// encoderTypeDefault is the per-type selection that defers to the format's
+// profile; encoderAuto picks the best encoder FFmpeg reports for the format.
+const (
+	encoderTypeDefault = "default"
+	encoderAuto        = "auto"
+)
+
+// supports reports whether the profile's codec can be written to format.
+func (p EncoderProfile) supports(format string) bool {
+	for _, f := range encoderFormats[p.Codec] {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// resolved returns the profile with every setting it defers filled in.
+func (p EncoderProfile) resolved() EncoderProfile {
+	if p.Preset == "" && (p.Codec == "libx264" || p.Codec == "libx265") {
+		p.Preset = settings.Get("video.encoder_preset", "fast")
+	}
+	if p.CRF <= 0 {
+		p.CRF = qualityCRF()
+	}
+	if p.MaxBitrate == "" {
+		p.MaxBitrate = settings.Get("video.max_bitrate", "2M")
+	}
+	if p.BufSize == "" {
+		p.BufSize = computeBufSize(p.MaxBitrate)
+	}
+	if p.PixFmt == "" {
+		p.PixFmt = "yuv420p"
+	}
+	return p
+}
+
+// args returns the FFmpeg output options selecting and tuning the encoder.
+func (p EncoderProfile) args() []string {
+	args := []string{"-c:v", p.Codec}
+	if p.Preset != "" {
+		flag := "-preset"
+		if p.Codec == "libvpx-vp9" || p.Codec == "libaom-av1" {
+			flag = "-cpu-used"
+		}
+		args = append(args, flag, p.Preset)
+	}
+	args = append(args, "-crf", strconv.Itoa(p.CRF), "-maxrate", p.MaxBitrate, "-bufsize", p.BufSize)
+	if p.GOP > 0 {
+		args = append(args, "-g", strconv.Itoa(p.GOP))
+	}
+	return args
+}
+
+// scaleFilter returns the colour conversion filter that ends every encoder's
+// filter chain, converting to the profile's pixel format.
+func (p EncoderProfile) scaleFilter() string {
+	return "scale=out_color_matrix=bt709:out_range=tv,format=" + p.PixFmt
+}
+
+// key identifies the resolved encoder settings, so a video built with other
+// settings can be recognised.
+func (p EncoderProfile) key() string {
+	return fmt.Sprintf("%s preset=%s crf=%d maxrate=%s bufsize=%s pix_fmt=%s gop=%d",
+		p.Codec, p.Preset, p.CRF, p.MaxBitrate, p.BufSize, p.PixFmt, p.GOP)
+}
+
+// qualityCRF returns the CRF for the video.quality setting.
+func qualityCRF() int {
+	crf, err := strconv.Atoi(settings.GetCRFForQuality(settings.Get("video.quality", "medium")))
+	if err != nil {
+		return 28
+	}
+	return crf
+}
+
+// encoderFor returns the resolved encoder profile for the timelapse name in
+// format: the type's video.<type>_encoder if it can write the format, otherwise
+// the format's video.encoder_<format>. A selection that is unknown, cannot
+// write the format or whose encoder FFmpeg does not report falls back to auto.
+func encoderFor(name, format string) EncoderProfile {
+	var choices []string
+	if kind := timelapseType(name); kind != "" {
+		if c := settings.Get("video."+kind+"_encoder", encoderTypeDefault); c != encoderTypeDefault {
+			choices = append(choices, c)
+		}
+	}
+	choices = append(choices, settings.Get("video.encoder_"+format, encoderAuto))
+
+	for _, choice := range choices {
+		p, err := selectProfile(choice, format)
+		if err == nil {
+			return p.resolved()
+		}
+		log.Printf("Encoder profile %q not used for %s (%s): %v", choice, name, format, err)
+	}
+	return autoProfile(format).resolved()
+}
+
+// selectProfile returns the profile named choice if it can write format with an
+// encoder FFmpeg reports.
+func selectProfile(choice, format string) (EncoderProfile, error) {
+	if choice == encoderAuto {
+		return autoProfile(format), nil
+	}
+	p, ok := lookupProfile(choice)
+	if !ok {
+		return EncoderProfile{}, fmt.Errorf("no encoder profile named %q", choice)
+	}
+	if !p.supports(format) {
+		return EncoderProfile{}, fmt.Errorf("%s cannot be written to %s", p.Codec, format)
+	}
+	if !encoderAvailable(p.Codec) {
+		return EncoderProfile{}, fmt.Errorf("ffmpeg does not report the %s encoder", p.Codec)
+	}
+	return p, nil
+}
+
+// autoProfile returns the default profile for format: the detected preferred
+// AV1/VP9 encoder for WebM and H.264 for MP4 and HLS.
+func autoProfile(format string) EncoderProfile {
+	if format == "webm" {
+		detectFFmpegCapabilities()
+		for _, p := range builtinProfiles {
+			if p.Codec == PreferredVideoCodec {
+				return p
+			}
+		}
+		return EncoderProfile{Name: encoderAuto, Codec: "libvpx-vp9"}
+	}
+	return builtinProfiles[0]
+}
+
+// lookupProfile returns the built-in or custom profile named name. Custom
+// profiles that fail to parse are skipped.
+func lookupProfile(name string) (EncoderProfile, bool) {
+	for _, p := range builtinProfiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	custom, err := parseEncoderProfiles(settings.Get("video.encoder_profiles", ""))
+	if err != nil {
+		log.Printf("Warning: video.encoder_profiles: %v", err)
+	}
+	for _, p := range custom {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return EncoderProfile{}, false
+}
+
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// parseEncoderProfiles parses custom profiles, one per line, in the form
+//
+//	name: codec=libx265 preset=slow crf=24 maxrate=8M bufsize=16M pix_fmt=yuv420p10le gop=120
+//
+// Only codec is required. Blank lines and lines starting with # are ignored.
+// Lines that fail to parse are skipped and the first error is returned.
+func parseEncoderProfiles(raw string) ([]EncoderProfile, error) {
+	var profiles []EncoderProfile
+	var firstErr error
+	seen := map[string]bool{}
+	for i, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseEncoderProfile(line)
+		if err == nil && seen[p.Name] {
+			err = fmt.Errorf("profile %q is defined twice", p.Name)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("line %d: %w", i+1, err)
+			}
+			continue
+		}
+		seen[p.Name] = true
+		profiles = append(profiles, p)
+	}
+	return profiles, firstErr
+}
+
+// parseEncoderProfile parses one line of parseEncoderProfiles.
+func parseEncoderProfile(line string) (EncoderProfile, error) {
+	name, opts, ok := strings.Cut(line, ":")
+	name = strings.TrimSpace(name)
+	if !ok || !profileNamePattern.MatchString(name) {
+		return EncoderProfile{}, fmt.Errorf("expected \"name: codec=...\" with a lower-case name, got %q", line)
+	}
+	if name == encoderAuto || name == encoderTypeDefault {
+		return EncoderProfile{}, fmt.Errorf("%q is reserved", name)
+	}
+	for _, b := range builtinProfiles {
+		if b.Name == name {
+			return EncoderProfile{}, fmt.Errorf("%q is a built-in profile", name)
+		}
+	}
+
+	p := EncoderProfile{Name: name}
+	for _, opt := range strings.Fields(opts) {
+		k, v, ok := strings.Cut(opt, "=")
+		if !ok || v == "" {
+			return EncoderProfile{}, fmt.Errorf("profile %s: expected key=value, got %q", name, opt)
+		}
+		var err error
+		switch k {
+		case "codec":
+			p.Codec = v
+		case "preset":
+			p.Preset = v
+		case "crf":
+			p.CRF, err = strconv.Atoi(v)
+			if err == nil && (p.CRF < 1 || p.CRF > 63) {
+				err = fmt.Errorf("out of range")
+			}
+		case "maxrate":
+			p.MaxBitrate = v
+		case "bufsize":
+			p.BufSize = v
+		case "pix_fmt":
+			p.PixFmt = v
+		case "gop":
+			p.GOP, err = strconv.Atoi(v)
+			if err == nil && p.GOP < 0 {
+				err = fmt.Errorf("out of range")
+			}
+		default:
+			return EncoderProfile{}, fmt.Errorf("profile %s: unknown option %q", name, k)
+		}
+		if err != nil {
+			return EncoderProfile{}, fmt.Errorf("profile %s: invalid %s %q", name, k, v)
+		}
+	}
+	if _, ok := encoderFormats[p.Codec]; !ok {
+		return EncoderProfile{}, fmt.Errorf("profile %s: codec must be one of %s", name, strings.Join(supportedCodecs(), ", "))
+	}
+	return p, nil
+}
+
+// supportedCodecs returns the encoders profiles may use, sorted.
+func supportedCodecs() []string {
+	var codecs []string
+	for c := range encoderFormats {
+		codecs = append(codecs, c)
+	}
+	sort.Strings(codecs)
+	return codecs
+}
+
+// IsEncoderSetting reports whether key is validated by ValidateEncoderSetting.
+func IsEncoderSetting(key string) bool {
+	switch key {
+	case "video.encoder_profiles", "video.encoder_webm", "video.encoder_mp4", "video.encoder_hls":
+		return true
+	}
+	for _, t := range timelapseTypes {
+		if key == "video."+t.name+"_encoder" {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEncoderSetting checks an encoder setting before it is saved: custom
+// profiles must parse and use an encoder FFmpeg reports, and a selection must
+// name such a profile that (for a format selection) can write that format.
+func ValidateEncoderSetting(key, val string) error {
+	if key == "video.encoder_profiles" {
+		profiles, err := parseEncoderProfiles(val)
+		if err != nil {
+			return err
+		}
+		for _, p := range profiles {
+			if !encoderAvailable(p.Codec) {
+				return fmt.Errorf("profile %s: ffmpeg does not report the %s encoder", p.Name, p.Codec)
+			}
+		}
+		return nil
+	}
+
+	if format, ok := strings.CutPrefix(key, "video.encoder_"); ok {
+		if _, err := selectProfile(val, format); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		return nil
+	}
+
+	// Per-type selections apply to whichever format is configured.
+	if val == encoderTypeDefault {
+		return nil
+	}
+	p, ok := lookupProfile(val)
+	if !ok {
+		return fmt.Errorf("%s: no encoder profile named %q", key, val)
+	}
+	if !encoderAvailable(p.Codec) {
+		return fmt.Errorf("%s: ffmpeg does not report the %s encoder", key, p.Codec)
+	}
+	return nil
+}
+
+// EncoderProfileNames returns the names of the built-in and valid custom
+// profiles, for selection in the admin page.
+func EncoderProfileNames() []string {
+	var names []string
+	for _, p := range builtinProfiles {
+		names = append(names, p.Name)
+	}
+	custom, _ := parseEncoderProfiles(settings.Get("video.encoder_profiles", ""))
+	for _, p := range custom {
+		names = append(names, p.Name)
+	}
+	return names
+}
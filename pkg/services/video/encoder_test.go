@@ -0,0 +1,184 @@
+package video
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
+)
+
+// stubEncoders makes ffmpeg appear to report only the named encoders, with
+// libsvtav1 preferred for WebM when present.
+func stubEncoders(t *testing.T, names ...string) {
+	t.Helper()
+	detectFFmpegCapabilities()
+	origAvailable, origPreferred := availableEncoders, PreferredVideoCodec
+	t.Cleanup(func() { availableEncoders, PreferredVideoCodec = origAvailable, origPreferred })
+
+	availableEncoders = map[string]bool{}
+	PreferredVideoCodec = "libvpx-vp9"
+	for _, n := range names {
+		availableEncoders[n] = true
+		if n == "libsvtav1" {
+			PreferredVideoCodec = n
+		}
+	}
+}
+
+func TestParseEncoderList(t *testing.T) {
+	out := `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC (codec h264)
+ V....D libsvtav1            SVT-AV1(Scalable Video Technology for AV1) encoder (codec av1)
+ A....D aac                  AAC (Advanced Audio Coding)
+`
+	assert.Equal(t, map[string]bool{"libx264": true, "libsvtav1": true}, parseEncoderList(out))
+}
+
+func TestEncoderProfile_Args(t *testing.T) {
+	setupHLSTest(t)
+	settings.Set("video.quality", "high")
+	settings.Set("video.max_bitrate", "3M")
+	settings.Set("video.encoder_preset", "slow")
+
+	p := EncoderProfile{Codec: "libx265"}.resolved()
+	assert.Equal(t, []string{"-c:v", "libx265", "-preset", "slow", "-crf", "20", "-maxrate", "3M", "-bufsize", "6M"}, p.args())
+	assert.Equal(t, "scale=out_color_matrix=bt709:out_range=tv,format=yuv420p", p.scaleFilter())
+
+	p = EncoderProfile{Codec: "libaom-av1", Preset: "6", CRF: 30, MaxBitrate: "8M", BufSize: "8M", PixFmt: "yuv420p10le", GOP: 120}.resolved()
+	assert.Equal(t, []string{"-c:v", "libaom-av1", "-cpu-used", "6", "-crf", "30", "-maxrate", "8M", "-bufsize", "8M", "-g", "120"}, p.args())
+	assert.Contains(t, p.scaleFilter(), "format=yuv420p10le")
+
+	assert.Equal(t, []string{"-c:v", "libsvtav1", "-preset", "10", "-crf", "20", "-maxrate", "3M", "-bufsize", "6M"},
+		builtinProfiles[3].resolved().args(), "SVT-AV1 keeps its historical preset")
+}
+
+func TestEncoderFor(t *testing.T) {
+	setupHLSTest(t)
+	stubEncoders(t, "libx264", "libx265", "libsvtav1", "libvpx-vp9")
+
+	assert.Equal(t, "libsvtav1", encoderFor("24_hour_2026-10-16", "webm").Codec, "auto prefers AV1 for WebM")
+	assert.Equal(t, "libx264", encoderFor("24_hour_2026-10-16", "mp4").Codec)
+	assert.Equal(t, "libx264", encoderFor("24_hour_2026-10-16", "hls").Codec)
+
+	settings.Set("video.encoder_webm", "vp9")
+	settings.Set("video.encoder_mp4", "h265")
+	assert.Equal(t, "libvpx-vp9", encoderFor("24_hour_2026-10-16", "webm").Codec)
+	assert.Equal(t, "libx265", encoderFor("24_hour_2026-10-16", "mp4").Codec)
+
+	settings.Set("video.yearly_encoder", "av1-svt")
+	assert.Equal(t, "libsvtav1", encoderFor("cam1/year_2026", "mp4").Codec, "the type's profile overrides the format's")
+	assert.Equal(t, "libx264", encoderFor("cam1/year_2026", "hls").Codec, "AV1 cannot be written to HLS, so the format's (auto) profile is used")
+
+	settings.Set("video.encoder_hls", "av1-aom")
+	assert.Equal(t, "libx264", encoderFor("week_2026-10-12", "hls").Codec, "unusable selections fall back to auto")
+
+	settings.Set("video.encoder_mp4", "missing")
+	assert.Equal(t, "libx264", encoderFor("week_2026-10-12", "mp4").Codec)
+}
+
+func TestParseEncoderProfiles(t *testing.T) {
+	profiles, err := parseEncoderProfiles(`
+# archive copies
+archive: codec=libx265 preset=slow crf=24 maxrate=8M bufsize=12M pix_fmt=yuv420p10le gop=120
+small-vp9: codec=libvpx-vp9 crf=40
+`)
+	require.NoError(t, err)
+	assert.Equal(t, []EncoderProfile{
+		{Name: "archive", Codec: "libx265", Preset: "slow", CRF: 24, MaxBitrate: "8M", BufSize: "12M", PixFmt: "yuv420p10le", GOP: 120},
+		{Name: "small-vp9", Codec: "libvpx-vp9", CRF: 40},
+	}, profiles)
+
+	for _, bad := range []string{
+		"Archive: codec=libx265",
+		"archive codec=libx265",
+		"h264: codec=libx264",
+		"auto: codec=libx264",
+		"archive: preset=slow",
+		"archive: codec=mpeg2video",
+		"archive: codec=libx265 crf=99",
+		"archive: codec=libx265 gop=many",
+		"archive: codec=libx265 tune=film",
+		"archive: codec=libx265\narchive: codec=libx264",
+	} {
+		_, err := parseEncoderProfiles(bad)
+		assert.Error(t, err, bad)
+	}
+
+	profiles, err = parseEncoderProfiles("good: codec=libx264\nbad: codec=nope")
+	assert.Error(t, err)
+	assert.Len(t, profiles, 1, "valid lines are kept")
+}
+
+func TestValidateEncoderSetting(t *testing.T) {
+	setupHLSTest(t)
+	stubEncoders(t, "libx264", "libvpx-vp9")
+
+	assert.True(t, IsEncoderSetting("video.encoder_hls"))
+	assert.True(t, IsEncoderSetting("video.monthly_encoder"))
+	assert.False(t, IsEncoderSetting("video.encoder_preset"))
+
+	assert.NoError(t, ValidateEncoderSetting("video.encoder_webm", "auto"))
+	assert.NoError(t, ValidateEncoderSetting("video.encoder_webm", "vp9"))
+	assert.Error(t, ValidateEncoderSetting("video.encoder_webm", "h264"), "H.264 cannot be written to WebM")
+	assert.Error(t, ValidateEncoderSetting("video.encoder_mp4", "h265"), "ffmpeg does not report libx265")
+	assert.Error(t, ValidateEncoderSetting("video.encoder_mp4", "missing"))
+
+	assert.Error(t, ValidateEncoderSetting("video.encoder_profiles", "archive: codec=libx265"))
+	require.NoError(t, ValidateEncoderSetting("video.encoder_profiles", "fast-vp9: codec=libvpx-vp9 preset=8"))
+	settings.Set("video.encoder_profiles", "fast-vp9: codec=libvpx-vp9 preset=8")
+
+	assert.NoError(t, ValidateEncoderSetting("video.daily_encoder", "default"))
+	assert.NoError(t, ValidateEncoderSetting("video.daily_encoder", "fast-vp9"))
+	assert.Error(t, ValidateEncoderSetting("video.daily_encoder", "av1-svt"))
+	assert.Equal(t, []string{"h264", "h265", "vp9", "av1-svt", "av1-aom", "fast-vp9"}, EncoderProfileNames())
+}
+
+func TestGenerateSingleTimelapse_EncoderChangeRegenerates(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	stubEncoders(t, "libsvtav1", "libvpx-vp9")
+
+	origRegen, origSeg, origConcat := regenerateFullTimelapse, createVideoSegment, concatenateVideos
+	defer func() {
+		regenerateFullTimelapse, createVideoSegment, concatenateVideos = origRegen, origSeg, origConcat
+	}()
+	var regenerated []string
+	regenerateFullTimelapse = func(_ context.Context, _ string, _ []string, outputPath string, _ bool, opts renderOptions) error {
+		regenerated = append(regenerated, opts.Encoder.Codec)
+		return os.WriteFile(outputPath, []byte("video"), 0644)
+	}
+	createVideoSegment = func(_ context.Context, _, _ string, _ renderOptions) error { return nil }
+	concatenateVideos = func(_ context.Context, _, _, outputVideoPath string) error {
+		return os.WriteFile(outputVideoPath, []byte("appended video"), 0644)
+	}
+
+	day := time.Now().AddDate(0, 0, -1)
+	tm := time.Date(day.Year(), day.Month(), day.Day(), 10, 0, 0, 0, time.Local)
+	dir := filepath.Join(config.CameraSnapshotsDir("cam1"), tm.Format("2006-01"), tm.Format("02"), tm.Format("15"))
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tm.Format("2006-01-02-15-04-05")+".jpg"), validSnapshotData(), 0644))
+	util.ReindexSnapshots()
+	name := "cam1/24_hour_" + day.Format("2006-01-02")
+
+	_, err := GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"libsvtav1"}, regenerated, "unchanged settings with no new frames do nothing")
+
+	settings.Set("video.daily_encoder", "vp9")
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"libsvtav1", "libvpx-vp9"}, regenerated, "a new profile re-encodes the whole video")
+}
@@ -0,0 +1,89 @@
+package video
+
+import (
+	"fmt"
+	"strings"
+
+	"time-machine/pkg/services/settings"
+)
+
+// outputFormats are the formats a timelapse can be written in.
+var outputFormats = []string{"webm", "mp4", "hls"}
+
+// formatTypeDefault is the per-type format selection standing for
+// video.format.
+const formatTypeDefault = "default"
+
+// formatsFor returns the formats the (optionally camera-scoped) timelapse name
+// is written in: its type's video.<type>_formats list, where "default" stands
+// for video.format. An invalid list falls back to video.format.
+func formatsFor(name string) []string {
+	def := settings.Get("video.format", "webm")
+	if !isOutputFormat(def) {
+		def = "webm"
+	}
+	kind := timelapseType(name)
+	if kind == "" {
+		return []string{def}
+	}
+	formats, err := parseFormats(settings.Get("video."+kind+"_formats", formatTypeDefault), def)
+	if err != nil || len(formats) == 0 {
+		return []string{def}
+	}
+	return formats
+}
+
+// parseFormats parses a comma-separated list of output formats, dropping
+// repeats. "default" is replaced by def.
+func parseFormats(val, def string) ([]string, error) {
+	var formats []string
+	seen := map[string]bool{}
+	for _, f := range strings.Split(val, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		switch {
+		case f == "":
+			continue
+		case f == formatTypeDefault:
+			f = def
+		case !isOutputFormat(f):
+			return nil, fmt.Errorf("unknown output format %q (use webm, mp4, hls or default)", f)
+		}
+		if !seen[f] {
+			seen[f] = true
+			formats = append(formats, f)
+		}
+	}
+	return formats, nil
+}
+
+func isOutputFormat(f string) bool {
+	for _, o := range outputFormats {
+		if f == o {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFormatsSetting reports whether key is a per-type format list validated by
+// ValidateFormatsSetting.
+func IsFormatsSetting(key string) bool {
+	for _, t := range timelapseTypes {
+		if key == "video."+t.name+"_formats" {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFormatsSetting checks a per-type format list before it is saved.
+func ValidateFormatsSetting(key, val string) error {
+	formats, err := parseFormats(val, "webm")
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if len(formats) == 0 {
+		return fmt.Errorf("%s: at least one output format is needed", key)
+	}
+	return nil
+}
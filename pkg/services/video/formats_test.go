@@ -0,0 +1,97 @@
+package video
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
+)
+
+func TestFormatsFor(t *testing.T) {
+	setupHLSTest(t)
+	settings.Set("video.format", "mp4")
+
+	assert.Equal(t, []string{"mp4"}, formatsFor("cam1/24_hour_2026-10-16"), "types default to video.format")
+	assert.Equal(t, []string{"mp4"}, formatsFor("unknown"))
+
+	settings.Set("video.daily_formats", " HLS, mp4 ,hls")
+	assert.Equal(t, []string{"hls", "mp4"}, formatsFor("cam1/24_hour_2026-10-16"))
+	settings.Set("video.weekly_formats", "webm,default")
+	assert.Equal(t, []string{"webm", "mp4"}, formatsFor("week_2026-10-12"))
+	settings.Set("video.monthly_formats", "gif")
+	assert.Equal(t, []string{"mp4"}, formatsFor("month_2026-10"), "invalid lists fall back to video.format")
+}
+
+func TestValidateFormatsSetting(t *testing.T) {
+	assert.True(t, IsFormatsSetting("video.yearly_formats"))
+	assert.False(t, IsFormatsSetting("video.format"))
+
+	assert.NoError(t, ValidateFormatsSetting("video.daily_formats", "default"))
+	assert.NoError(t, ValidateFormatsSetting("video.daily_formats", "hls, mp4"))
+	assert.Error(t, ValidateFormatsSetting("video.daily_formats", "hls,mkv"))
+	assert.Error(t, ValidateFormatsSetting("video.daily_formats", " , "))
+}
+
+func TestGenerateSingleTimelapse_SeveralFormats(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	hls := &fakeHLSEncoder{framesPerSeg: 4}
+	mp4 := &fakeMP4Encoder{}
+	origHLS, origMP4, origRegen := encodeHLS, encodeMP4, regenerateFullTimelapse
+	t.Cleanup(func() { encodeHLS, encodeMP4, regenerateFullTimelapse = origHLS, origMP4, origRegen })
+	encodeHLS, encodeMP4 = hls.encode, mp4.encode
+	var webm int
+	regenerateFullTimelapse = func(_ context.Context, _ string, _ []string, outputPath string, _ bool, _ renderOptions) error {
+		webm++
+		return os.WriteFile(outputPath, []byte("webm"), 0644)
+	}
+
+	day := time.Now().AddDate(0, 0, -1)
+	addFrame := func(hour int) {
+		tm := time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.Local)
+		dir := filepath.Join(config.CameraSnapshotsDir("cam1"), tm.Format("2006-01"), tm.Format("02"), tm.Format("15"))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tm.Format("2006-01-02-15-04-05")+".jpg"), validSnapshotData(), 0644))
+		util.ReindexSnapshots()
+	}
+	name := "cam1/24_hour_" + day.Format("2006-01-02")
+	for hour := 0; hour < 6; hour++ {
+		addFrame(hour)
+	}
+
+	_, err := GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.Equal(t, 1, webm)
+	assert.FileExists(t, DiskPath(name, "webm"))
+
+	settings.Set("video.daily_formats", "hls,mp4")
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.Len(t, hls.calls, 1)
+	assert.Equal(t, []int{6}, mp4.frames)
+	assert.FileExists(t, DiskPath(name, "hls"))
+	assert.FileExists(t, DiskPath(name, "mp4"))
+	assert.NoFileExists(t, DiskPath(name, "webm"), "formats no longer selected are removed")
+	tracked, _ := database.GetTimelapseTracker(name, "webm")
+	assert.Empty(t, tracked)
+
+	addFrame(6)
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	require.Len(t, hls.calls, 2)
+	assert.Equal(t, "2", argAfter(hls.calls[1], "-start_number"), "HLS appends the new frame")
+	assert.Equal(t, []int{6, 7}, mp4.frames, "the fast-start MP4 is rebuilt alongside")
+	for _, format := range []string{"hls", "mp4"} {
+		tracked, _ := database.GetTimelapseTracker(name, format)
+		assert.Contains(t, tracked, day.Format("2006-01-02")+"-06-00-00", format)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"time-machine/pkg/config"
 	"time-machine/pkg/database"
 	"time-machine/pkg/services/settings"
 )
@@ -39,10 +39,7 @@ func hlsMaxBitrate(bw int) string {
 
 // parseHLSQualities converts a comma-separated quality string (e.g. "source,720p") into HLSQuality entries.
 func parseHLSQualities(raw string) []HLSQuality {
-	baseCRF := 23
-	if n, err := strconv.Atoi(settings.GetCRFForQuality(settings.Get("video.quality", "medium"))); err == nil {
-		baseCRF = n
-	}
+	baseCRF := qualityCRF()
 
 	heightFor := map[string]int{"source": 0, "1080p": 1080, "720p": 720, "480p": 480}
 	// Bandwidth estimates (bps) used in the master playlist and to derive per-level maxrate caps.
@@ -120,11 +117,26 @@ func probeVideoDimensions(filePath string) (int, int) {
 	return w, h
 }
 
+// hlsLayout is the quality levels and segment length of an HLS timelapse.
+type hlsLayout struct {
+	Qualities  []HLSQuality
+	SegmentSec int
+}
+
+// hlsLayoutFor returns the configured HLS layout.
+func hlsLayoutFor() hlsLayout {
+	return hlsLayout{
+		Qualities:  parseHLSQualities(settings.Get("video.hls_qualities", "source,720p")),
+		SegmentSec: settings.GetInt("video.hls_segment_sec", 4),
+	}
+}
+
 // generateHLS encodes all quality levels in one FFmpeg pass using filter_complex.
-// Segments land in {DataDir}/hls/timelapse_{name}/{label}/ and a master.m3u8 is written.
-func generateHLS(name, concatListPath string, qualities []HLSQuality) error {
-	dataDir := config.AppConfig.DataDir
-	hlsDir := filepath.Join(dataDir, "hls", "timelapse_"+name)
+// Segments land in {CameraDataDir}/hls/timelapse_{name}/{label}/ and a master.m3u8 is written.
+// Any overlay in opts is drawn once, before the stream is split into quality levels.
+func generateHLS(ctx context.Context, name, concatListPath string, opts renderOptions) error {
+	hlsDir := hlsOutputDir(name)
+	qualities := opts.HLS.Qualities
 
 	if err := os.MkdirAll(hlsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create HLS dir: %w", err)
@@ -135,9 +147,42 @@ func generateHLS(name, concatListPath string, qualities []HLSQuality) error {
 		}
 	}
 
-	segSec := settings.GetInt("video.hls_segment_sec", 4)
-	preset := settings.Get("video.encoder_preset", "fast")
+	// Segments are numbered on from any already published, so that a cached
+	// segment is never replaced by different content under the same name.
+	start := nextHLSSegmentNumber(hlsDir, qualities)
+	if err := encodeHLS(ctx, name, hlsEncodeArgs(concatListPath, hlsDir, opts, start, 0)); err != nil {
+		os.RemoveAll(hlsDir)
+		return err
+	}
+
+	// Segments of the previous encode are not in the new playlists.
+	for _, q := range qualities {
+		if segs, err := readHLSPlaylist(filepath.Join(hlsDir, q.Label, "index.m3u8")); err == nil {
+			pruneHLSSegments(filepath.Join(hlsDir, q.Label), segs)
+		}
+	}
 
+	// Probe the source frame resolution so the master playlist carries an accurate
+	// RESOLUTION tag for the pass-through level. This lets VHS and the quality
+	// selector correctly identify and label the 4K (or other) source rendition.
+	var sourceW, sourceH int
+	if firstSnap := firstFileInConcatList(concatListPath); firstSnap != "" {
+		sourceW, sourceH = probeVideoDimensions(firstSnap)
+	}
+
+	if err := writeMasterPlaylist(hlsDir, qualities, sourceW, sourceH); err != nil {
+		return err
+	}
+	log.Printf("Generated HLS: %s", hlsDir)
+	return nil
+}
+
+// hlsEncodeArgs returns the FFmpeg arguments encoding the concat list into
+// segments and a media playlist for each quality level under outDir. Segments
+// are numbered from startNumber and their timestamps start at tsOffset seconds,
+// so an encode can continue an existing stream.
+func hlsEncodeArgs(concatListPath, outDir string, opts renderOptions, startNumber int, tsOffset float64) []string {
+	qualities := opts.HLS.Qualities
 	args := []string{
 		"-hide_banner", "-loglevel", "error",
 		"-f", "concat", "-safe", "0", "-i", concatListPath,
@@ -146,7 +191,7 @@ func generateHLS(name, concatListPath string, qualities []HLSQuality) error {
 
 	if len(qualities) > 1 {
 		// Build filter_complex: split into N, then scale each non-source stream
-		splitExpr := fmt.Sprintf("[0:v]split=%d", len(qualities))
+		splitExpr := fmt.Sprintf("[0:v]%s", withOverlay(opts.Overlay, "", fmt.Sprintf("split=%d", len(qualities))))
 		for i := range qualities {
 			splitExpr += fmt.Sprintf("[v%d]", i)
 		}
@@ -160,6 +205,8 @@ func generateHLS(name, concatListPath string, qualities []HLSQuality) error {
 			}
 		}
 		args = append(args, "-filter_complex", strings.Join(scaleParts, "; "))
+	} else if opts.Overlay != nil {
+		args = append(args, "-vf", opts.Overlay.filter(""))
 	}
 
 	for i, q := range qualities {
@@ -167,51 +214,256 @@ func generateHLS(name, concatListPath string, qualities []HLSQuality) error {
 		if len(qualities) > 1 {
 			mapVal = fmt.Sprintf("[s%d]", i)
 		}
-		segFile := filepath.Join(hlsDir, q.Label, "seg_%04d.ts")
-		playlist := filepath.Join(hlsDir, q.Label, "index.m3u8")
+		segFile := filepath.Join(outDir, q.Label, "seg_%04d.ts")
+		playlist := filepath.Join(outDir, q.Label, "index.m3u8")
+		args = append(args, "-map", mapVal, "-pix_fmt", opts.Encoder.PixFmt)
+		args = append(args, hlsLevelEncoder(opts.Encoder, q).args()...)
+		args = append(args, "-sc_threshold", "0")
+		if tsOffset > 0 {
+			args = append(args, "-output_ts_offset", strconv.FormatFloat(tsOffset, 'f', 6, 64))
+		}
+		if startNumber > 0 {
+			args = append(args, "-start_number", strconv.Itoa(startNumber))
+		}
 		args = append(args,
-			"-map", mapVal,
-			"-c:v", "libx264",
-			"-preset", preset,
-			"-crf", fmt.Sprintf("%d", q.CRF),
-			"-g", "48", "-sc_threshold", "0",
-			"-maxrate", q.MaxBitrate, "-bufsize", q.BufSize,
-			"-hls_time", fmt.Sprintf("%d", segSec),
+			"-hls_time", fmt.Sprintf("%d", opts.HLS.SegmentSec),
 			"-hls_playlist_type", "vod",
 			"-hls_segment_filename", segFile,
 			playlist,
 		)
 	}
+	return args
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+// encodeHLS runs FFmpeg with the given arguments, recording any error output
+// in the FFmpeg log for name. Its progress is measured against the frames of
+// the concat list it reads.
+var encodeHLS = func(ctx context.Context, name string, args []string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Hour)
 	defer cancel()
 
+	var frames int
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-i" {
+			frames = concatListFrames(args[i+1])
+		}
+	}
 	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
-		os.RemoveAll(hlsDir)
+	if err := runFFmpeg(cmd, name, "hls", hlsOutputDir(name), frames); err != nil {
 		today := time.Now().Format("2006-01-02")
 		_ = database.AppendFFmpegLog(today, name, fmt.Sprintf("--- HLS Error for %s: %s ---\n%s\n", name, time.Now(), stderr.String()))
 		return fmt.Errorf("ffmpeg HLS encode failed for %s: %w", name, err)
 	}
+	return nil
+}
 
-	// Probe the source frame resolution so the master playlist carries an accurate
-	// RESOLUTION tag for the pass-through level. This lets VHS and the quality
-	// selector correctly identify and label the 4K (or other) source rendition.
-	var sourceW, sourceH int
-	if firstSnap := firstFileInConcatList(concatListPath); firstSnap != "" {
-		sourceW, sourceH = probeVideoDimensions(firstSnap)
+// appendHLS brings an existing HLS timelapse up to date with snapshots without
+// re-encoding it. The last segment of each quality level, which is usually
+// short, is encoded again together with the new frames as further segments, and
+// the media playlists are rewritten to list them in its place. The new segments
+// take new names, so a published segment never changes; the replaced one is
+// left for players still holding the old playlist. The frames before the last
+// segment are worked out from its start time, so frames must be shown for a
+// fixed time; if they are not, or the playlists do not match each other, an
+// error is returned and the caller regenerates in full.
+func appendHLS(ctx context.Context, name string, snapshots []string, opts renderOptions) error {
+	if !opts.Timing.appendable() || len(opts.HLS.Qualities) == 0 {
+		return fmt.Errorf("frame timing or layout does not allow appending")
 	}
+	hlsDir := hlsOutputDir(name)
+	frames := validSnapshots(snapshots)
+	frameDur, _ := strconv.ParseFloat(formatSeconds(opts.Timing.frameDuration(len(frames))), 64)
 
-	if err := writeMasterPlaylist(hlsDir, qualities, sourceW, sourceH); err != nil {
+	playlists := make([][]hlsSegment, len(opts.HLS.Qualities))
+	for i, q := range opts.HLS.Qualities {
+		segs, err := readHLSPlaylist(filepath.Join(hlsDir, q.Label, "index.m3u8"))
+		if err != nil {
+			return err
+		}
+		if len(segs) == 0 {
+			return fmt.Errorf("%s playlist has no segments", q.Label)
+		}
+		prev := -1
+		for j, seg := range segs {
+			n, ok := hlsSegmentNumber(seg.URI)
+			if !ok || n <= prev {
+				return fmt.Errorf("%s playlist lists %s as segment %d", q.Label, seg.URI, j)
+			}
+			prev = n
+		}
+		if i > 0 && len(segs) != len(playlists[0]) {
+			return fmt.Errorf("%s playlist has %d segments but %s has %d", q.Label, len(segs), opts.HLS.Qualities[0].Label, len(playlists[0]))
+		}
+		playlists[i] = segs
+	}
+
+	last := len(playlists[0]) - 1
+	var offset float64
+	for _, seg := range playlists[0][:last] {
+		offset += seg.Duration
+	}
+	encoded := int(math.Round(offset / frameDur))
+	if encoded >= len(frames) {
+		return fmt.Errorf("playlist covers %d frames but there are %d", encoded, len(frames))
+	}
+
+	workDir := filepath.Join(hlsDir, ".append")
+	os.RemoveAll(workDir)
+	defer os.RemoveAll(workDir)
+	for _, q := range opts.HLS.Qualities {
+		if err := os.MkdirAll(filepath.Join(workDir, q.Label), 0755); err != nil {
+			return fmt.Errorf("failed to create HLS work dir: %w", err)
+		}
+	}
+	concatListPath := filepath.Join(workDir, "concat.txt")
+	if err := writeConcatList(concatListPath, frames[encoded:], opts); err != nil {
+		return fmt.Errorf("failed to create concat list: %w", err)
+	}
+	log.Printf("Appending %d frame(s) to HLS %s from segment %d.", len(frames)-encoded, name, last)
+	if err := encodeHLS(ctx, name, hlsEncodeArgs(concatListPath, workDir, opts, nextHLSSegmentNumber(hlsDir, opts.HLS.Qualities), offset)); err != nil {
 		return err
 	}
-	log.Printf("Generated HLS: %s", hlsDir)
+
+	for i, q := range opts.HLS.Qualities {
+		newSegs, err := readHLSPlaylist(filepath.Join(workDir, q.Label, "index.m3u8"))
+		if err != nil {
+			return err
+		}
+		for _, seg := range newSegs {
+			if err := os.Rename(filepath.Join(workDir, q.Label, seg.URI), filepath.Join(hlsDir, q.Label, seg.URI)); err != nil {
+				return fmt.Errorf("failed to move HLS segment %s: %w", seg.URI, err)
+			}
+		}
+		segs := append(playlists[i][:last:last], newSegs...)
+		if err := writeHLSPlaylist(filepath.Join(hlsDir, q.Label, "index.m3u8"), segs); err != nil {
+			return err
+		}
+	}
+	log.Printf("Appended to HLS: %s", hlsDir)
 	return nil
 }
 
+// hlsSegment is one entry of an HLS media playlist.
+type hlsSegment struct {
+	Duration float64 // seconds
+	URI      string
+}
+
+// hlsSegmentName returns the file name FFmpeg gives segment n.
+func hlsSegmentName(n int) string {
+	return fmt.Sprintf("seg_%04d.ts", n)
+}
+
+// hlsSegmentNumber returns the number of the segment file name, as given by
+// hlsSegmentName.
+func hlsSegmentNumber(name string) (int, bool) {
+	digits, ok := strings.CutPrefix(name, "seg_")
+	if !ok {
+		return 0, false
+	}
+	digits, ok = strings.CutSuffix(digits, ".ts")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil && n >= 0
+}
+
+// nextHLSSegmentNumber returns the number after the highest segment of any of
+// the quality levels under hlsDir, or 0 if there are none. Encodes number their
+// segments from it so that segment names are never reused.
+func nextHLSSegmentNumber(hlsDir string, qualities []HLSQuality) int {
+	next := 0
+	for _, q := range qualities {
+		files, _ := filepath.Glob(filepath.Join(hlsDir, q.Label, "seg_*.ts"))
+		for _, f := range files {
+			if n, ok := hlsSegmentNumber(filepath.Base(f)); ok {
+				next = max(next, n+1)
+			}
+		}
+	}
+	return next
+}
+
+// readHLSPlaylist returns the segments listed in a media playlist.
+func readHLSPlaylist(path string) ([]hlsSegment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var segs []hlsSegment
+	duration := -1.0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			v, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			if duration, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("%s: invalid segment duration %q", path, line)
+			}
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			if duration < 0 {
+				return nil, fmt.Errorf("%s: segment %s has no duration", path, line)
+			}
+			segs = append(segs, hlsSegment{Duration: duration, URI: line})
+			duration = -1
+		}
+	}
+	return segs, nil
+}
+
+// writeHLSPlaylist writes a complete VOD media playlist listing segs. It is
+// written to a temporary file and renamed so players never read part of it.
+func writeHLSPlaylist(path string, segs []hlsSegment) error {
+	target := 1
+	for _, seg := range segs {
+		target = max(target, int(math.Ceil(seg.Duration)))
+	}
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&sb, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n", target)
+	for _, seg := range segs {
+		fmt.Fprintf(&sb, "#EXTINF:%f,\n%s\n", seg.Duration, seg.URI)
+	}
+	sb.WriteString("#EXT-X-ENDLIST\n")
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// pruneHLSSegments removes the segments in dir that are not in keep.
+func pruneHLSSegments(dir string, keep []hlsSegment) {
+	listed := make(map[string]bool, len(keep))
+	for _, seg := range keep {
+		listed[seg.URI] = true
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "seg_*.ts"))
+	for _, f := range files {
+		if !listed[filepath.Base(f)] {
+			os.Remove(f)
+		}
+	}
+}
+
+// hlsLevelEncoder returns the encoder settings for one quality level: the
+// level's CRF offset applied to the profile's CRF, the level's bitrate cap, and
+// a 48-frame GOP unless the profile sets one, so segments cut on keyframes.
+func hlsLevelEncoder(p EncoderProfile, q HLSQuality) EncoderProfile {
+	p.CRF += q.CRF - qualityCRF()
+	p.MaxBitrate, p.BufSize = q.MaxBitrate, q.BufSize
+	if p.GOP == 0 {
+		p.GOP = 48
+	}
+	return p
+}
+
 // writeMasterPlaylist writes an HLS master.m3u8 referencing each quality level.
 // sourceW/sourceH are the probed pixel dimensions of the source frames; they are
 // written as the RESOLUTION tag for any pass-through (Height==0) quality level.
@@ -237,47 +489,3 @@ func writeMasterPlaylist(hlsDir string, qualities []HLSQuality, sourceW, sourceH
 	}
 	return os.WriteFile(filepath.Join(hlsDir, "master.m3u8"), []byte(sb.String()), 0644)
 }
-
-// generateMP4 encodes a single H.264 MP4 with fast-start from the concat list.
-func generateMP4(name, concatListPath string) error {
-	dataDir := config.AppConfig.DataDir
-	outputPath := filepath.Join(dataDir, fmt.Sprintf("timelapse_%s.mp4", name))
-	tempPath := outputPath + ".tmp.mp4"
-
-	preset := settings.Get("video.encoder_preset", "fast")
-	crf := settings.GetCRFForQuality(settings.Get("video.quality", "medium"))
-	maxBitrate := settings.Get("video.max_bitrate", "2M")
-	bufSize := computeBufSize(maxBitrate)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "ffmpeg",
-		"-hide_banner", "-loglevel", "error",
-		"-f", "concat", "-safe", "0", "-i", concatListPath,
-		"-vf", "scale=out_color_matrix=bt709:out_range=tv,format=yuv420p",
-		"-c:v", "libx264",
-		"-preset", preset,
-		"-crf", crf,
-		"-maxrate", maxBitrate, "-bufsize", bufSize,
-		"-movflags", "+faststart",
-		"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
-		"-an", "-y", tempPath,
-	)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		os.Remove(tempPath)
-		today := time.Now().Format("2006-01-02")
-		_ = database.AppendFFmpegLog(today, name, fmt.Sprintf("--- MP4 Error for %s: %s ---\n%s\n", name, time.Now(), stderr.String()))
-		return fmt.Errorf("ffmpeg MP4 encode failed for %s: %w", name, err)
-	}
-
-	os.Remove(outputPath)
-	if err := os.Rename(tempPath, outputPath); err != nil {
-		return fmt.Errorf("failed to rename MP4 temp file: %w", err)
-	}
-	log.Printf("Generated MP4: %s", outputPath)
-	return nil
-}
@@ -1,14 +1,18 @@
 package video
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"time-machine/pkg/config"
 	"time-machine/pkg/database"
 	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -116,3 +120,184 @@ func TestWriteMasterPlaylist_WithSourceResolution(t *testing.T) {
 		}
 	}
 }
+
+func TestReadWriteHLSPlaylist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.m3u8")
+	require.NoError(t, os.WriteFile(path, []byte("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:5\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:4.795200,\nseg_0000.ts\n#EXTINF:1.198800,\nseg_0001.ts\n#EXT-X-ENDLIST\n"), 0644))
+
+	segs, err := readHLSPlaylist(path)
+	require.NoError(t, err)
+	assert.Equal(t, []hlsSegment{{4.7952, "seg_0000.ts"}, {1.1988, "seg_0001.ts"}}, segs)
+
+	segs = append(segs, hlsSegment{6.2, "seg_0002.ts"})
+	require.NoError(t, writeHLSPlaylist(path, segs))
+	data, _ := os.ReadFile(path)
+	assert.Contains(t, string(data), "#EXT-X-TARGETDURATION:7\n", "the target duration covers the longest segment")
+	assert.True(t, strings.HasSuffix(string(data), "#EXTINF:6.200000,\nseg_0002.ts\n#EXT-X-ENDLIST\n"))
+	reread, err := readHLSPlaylist(path)
+	require.NoError(t, err)
+	assert.Equal(t, segs, reread)
+
+	require.NoError(t, os.WriteFile(path, []byte("#EXTM3U\nseg_0000.ts\n"), 0644))
+	_, err = readHLSPlaylist(path)
+	assert.Error(t, err, "segments need a duration")
+}
+
+// fakeHLSEncoder stands in for FFmpeg: it splits the concat list's frames into
+// segments of framesPerSeg frames for every quality level in the arguments,
+// numbering them from -start_number, and records each call's arguments and
+// first frame.
+type fakeHLSEncoder struct {
+	framesPerSeg int
+	calls        [][]string
+	firstFrames  []string
+}
+
+func (f *fakeHLSEncoder) encode(_ context.Context, _ string, args []string) error {
+	f.calls = append(f.calls, args)
+	f.firstFrames = append(f.firstFrames, firstFileInConcatList(argAfter(args, "-i")))
+	var frameDurs []string
+	start := 0
+	for i, a := range args {
+		switch a {
+		case "-i":
+			data, err := os.ReadFile(args[i+1])
+			if err != nil {
+				return err
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				if d, ok := strings.CutPrefix(line, "duration "); ok {
+					frameDurs = append(frameDurs, d)
+				}
+			}
+		case "-start_number":
+			fmt.Sscanf(args[i+1], "%d", &start)
+		case "-hls_segment_filename":
+			dir := filepath.Dir(args[i+1])
+			var segs []hlsSegment
+			for n := 0; n*f.framesPerSeg < len(frameDurs); n++ {
+				var dur float64
+				for _, d := range frameDurs[n*f.framesPerSeg : min((n+1)*f.framesPerSeg, len(frameDurs))] {
+					var v float64
+					fmt.Sscanf(d, "%g", &v)
+					dur += v
+				}
+				name := hlsSegmentName(start + n)
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+					return err
+				}
+				segs = append(segs, hlsSegment{dur, name})
+			}
+			if err := writeHLSPlaylist(args[i+2], segs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// argAfter returns the value following the first occurrence of flag in args.
+func argAfter(args []string, flag string) string {
+	for i, a := range args {
+		if a == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestAppendHLS(t *testing.T) {
+	dir := setupHLSTest(t)
+	fake := &fakeHLSEncoder{framesPerSeg: 3}
+	origEncode := encodeHLS
+	encodeHLS = fake.encode
+	t.Cleanup(func() { encodeHLS = origEncode })
+
+	var frames []string
+	for i := 0; i < 10; i++ {
+		f := filepath.Join(dir, fmt.Sprintf("2026-10-16-%02d-00-00.jpg", i))
+		require.NoError(t, os.WriteFile(f, validSnapshotData(), 0644))
+		frames = append(frames, f)
+	}
+	opts := renderOptions{Timing: frameTiming{FPS: 30}, HLS: hlsLayout{Qualities: parseHLSQualities("source,720p"), SegmentSec: 4}}
+	name := "cam1/24_hour_2026-10-16"
+	require.NoError(t, os.MkdirAll(config.CameraDataDir("cam1"), 0755))
+
+	concatPath, err := buildConcatList(name, frames[:7], opts)
+	require.NoError(t, err)
+	require.NoError(t, generateHLS(t.Context(), name, concatPath, opts))
+	segs, _ := readHLSPlaylist(filepath.Join(hlsOutputDir(name), "720p", "index.m3u8"))
+	require.Len(t, segs, 3, "7 frames make segments of 3, 3 and 1 frames")
+
+	require.NoError(t, appendHLS(t.Context(), name, frames, opts))
+	args := fake.calls[1]
+	assert.Equal(t, "3", argAfter(args, "-start_number"), "the short last segment is encoded again under a new name")
+	assert.Equal(t, "0.199800", argAfter(args, "-output_ts_offset"), "timestamps continue from the kept segments")
+	assert.Equal(t, filepath.ToSlash(frames[6]), fake.firstFrames[1])
+
+	for _, q := range []string{"source", "720p"} {
+		segs, err := readHLSPlaylist(filepath.Join(hlsOutputDir(name), q, "index.m3u8"))
+		require.NoError(t, err)
+		if assert.Len(t, segs, 4) {
+			assert.Equal(t, []string{"seg_0000.ts", "seg_0001.ts", "seg_0003.ts", "seg_0004.ts"},
+				[]string{segs[0].URI, segs[1].URI, segs[2].URI, segs[3].URI})
+			assert.InDelta(t, 0.0333, segs[3].Duration, 1e-9, "frame 10 on its own")
+		}
+		assert.FileExists(t, filepath.Join(hlsOutputDir(name), q, "seg_0004.ts"))
+		old, _ := os.ReadFile(filepath.Join(hlsOutputDir(name), q, "seg_0002.ts"))
+		assert.Equal(t, "seg_0002.ts", string(old), "the published last segment is left unchanged")
+	}
+	assert.NoDirExists(t, filepath.Join(hlsOutputDir(name), ".append"))
+
+	opts.Timing.TargetSec = 20
+	assert.Error(t, appendHLS(t.Context(), name, frames, opts), "re-timed frames cannot be appended")
+	opts.Timing.TargetSec = 0
+	opts.HLS.Qualities = parseHLSQualities("source,480p")
+	assert.Error(t, appendHLS(t.Context(), name, frames, opts), "a level with no playlist cannot be appended to")
+}
+
+func TestGenerateSingleTimelapse_HLSAppends(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	fake := &fakeHLSEncoder{framesPerSeg: 4}
+	origEncode := encodeHLS
+	encodeHLS = fake.encode
+	t.Cleanup(func() { encodeHLS = origEncode })
+	settings.Set("video.format", "hls")
+
+	day := time.Now().AddDate(0, 0, -1)
+	addFrame := func(hour int) {
+		tm := time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.Local)
+		dir := filepath.Join(config.CameraSnapshotsDir("cam1"), tm.Format("2006-01"), tm.Format("02"), tm.Format("15"))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tm.Format("2006-01-02-15-04-05")+".jpg"), validSnapshotData(), 0644))
+		util.ReindexSnapshots()
+	}
+	name := "cam1/24_hour_" + day.Format("2006-01-02")
+	for hour := 0; hour < 6; hour++ {
+		addFrame(hour)
+	}
+
+	_, err := GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	require.Len(t, fake.calls, 1)
+	assert.Empty(t, argAfter(fake.calls[0], "-start_number"), "the first encode is in full")
+
+	addFrame(6)
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	require.Len(t, fake.calls, 2)
+	assert.Equal(t, "2", argAfter(fake.calls[1], "-start_number"), "a new frame is appended")
+
+	settings.Set("video.hls_qualities", "source")
+	addFrame(7)
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	require.Len(t, fake.calls, 3)
+	assert.Empty(t, argAfter(fake.calls[2], "-output_ts_offset"), "new quality levels are encoded in full")
+	assert.Equal(t, "3", argAfter(fake.calls[2], "-start_number"), "without reusing segment names")
+	files, _ := filepath.Glob(filepath.Join(hlsOutputDir(name), "source", "seg_*.ts"))
+	segs, err := readHLSPlaylist(filepath.Join(hlsOutputDir(name), "source", "index.m3u8"))
+	require.NoError(t, err)
+	assert.Len(t, files, len(segs), "segments of the previous encode are removed")
+}
@@ -0,0 +1,127 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"time-machine/pkg/database"
+	"time-machine/pkg/util"
+)
+
+// fragmentedMovflags writes the MP4 as a moov box followed by one fragment
+// per keyframe. Like +faststart the moov comes first, so playback can start
+// before the file has downloaded, and new fragments can be joined on by stream
+// copy without re-encoding the existing ones.
+const fragmentedMovflags = "+frag_keyframe+empty_moov+default_base_moof"
+
+// generateMP4 encodes a single fast-start (or, with opts.Fragmented,
+// fragmented) MP4 from the concat list with the encoder profile in opts. Any
+// overlay in opts is burnt into every frame.
+func generateMP4(ctx context.Context, name, concatListPath string, opts renderOptions) error {
+	outputPath := DiskPath(name, "mp4")
+	tempPath := outputPath + ".tmp.mp4"
+
+	if err := encodeMP4(ctx, name, concatListPath, tempPath, concatListFrames(concatListPath), opts); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	os.Remove(outputPath)
+	if err := os.Rename(tempPath, outputPath); err != nil {
+		return fmt.Errorf("failed to rename MP4 temp file: %w", err)
+	}
+	log.Printf("Generated MP4: %s", outputPath)
+	return nil
+}
+
+// encodeMP4 encodes the concat list into an MP4 at outputPath. A fragmented
+// MP4 stops after frames frames, leaving out the repeated last entry of the
+// concat list, so that appended fragments do not show it twice.
+var encodeMP4 = func(ctx context.Context, name, concatListPath, outputPath string, frames int, opts renderOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Hour)
+	defer cancel()
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", "concat", "-safe", "0", "-i", concatListPath,
+		"-vf", withOverlay(opts.Overlay, "", opts.Encoder.scaleFilter()),
+	}
+	args = append(args, opts.Encoder.args()...)
+	if opts.Encoder.Codec == "libx265" {
+		args = append(args, "-tag:v", "hvc1") // lets Apple players recognise HEVC
+	}
+	if opts.Fragmented {
+		args = append(args, "-frames:v", fmt.Sprintf("%d", frames), "-movflags", fragmentedMovflags)
+	} else {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args,
+		"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
+		"-an", "-y", outputPath,
+	)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := runFFmpeg(cmd, name, "mp4", outputPath, frames); err != nil {
+		today := time.Now().Format("2006-01-02")
+		_ = database.AppendFFmpegLog(today, name, fmt.Sprintf("--- MP4 Error for %s: %s ---\n%s\n", name, time.Now(), stderr.String()))
+		return fmt.Errorf("ffmpeg MP4 encode failed for %s: %w", name, err)
+	}
+	return nil
+}
+
+// appendMP4 adds newFrames to the end of an existing fragmented MP4: they are
+// encoded on their own as a short fragmented MP4, which is then joined to the
+// video by stream copy, so the frames already in it are not re-encoded.
+func appendMP4(ctx context.Context, name string, newFrames []string, opts renderOptions) error {
+	if !opts.Fragmented || !opts.Timing.appendable() {
+		return fmt.Errorf("only fragmented MP4s at a fixed frame rate can be appended to")
+	}
+	frames := validSnapshots(newFrames)
+	if len(frames) == 0 {
+		return nil
+	}
+
+	outputPath := DiskPath(name, "mp4")
+	dir := filepath.Dir(outputPath)
+	_, base := util.SplitScopedName(name)
+	listPath := filepath.Join(dir, fmt.Sprintf("mp4_append_%s.txt", base))
+	segmentPath := filepath.Join(dir, fmt.Sprintf("temp_segment_%s.mp4", base))
+	joinedPath := filepath.Join(dir, fmt.Sprintf("temp_concat_video_%s.mp4", base))
+	defer os.Remove(listPath)
+	defer os.Remove(segmentPath)
+
+	if err := writeConcatList(listPath, frames, opts); err != nil {
+		return fmt.Errorf("failed to create concat list: %w", err)
+	}
+	if err := encodeMP4(ctx, name, listPath, segmentPath, len(frames), opts); err != nil {
+		return err
+	}
+	if err := concatenateVideos(ctx, outputPath, segmentPath, joinedPath); err != nil {
+		os.Remove(joinedPath)
+		return err
+	}
+	if err := os.Rename(joinedPath, outputPath); err != nil {
+		return fmt.Errorf("error renaming new video %s to %s: %w", joinedPath, outputPath, err)
+	}
+	log.Printf("Appended %d frame(s) to MP4: %s", len(frames), outputPath)
+	return nil
+}
+
+// concatListFrames returns the number of frames in an ffconcat list written by
+// writeConcatList: one per duration line.
+func concatListFrames(concatListPath string) int {
+	data, err := os.ReadFile(concatListPath)
+	if err != nil {
+		return 0
+	}
+	return strings.Count(string(data), "\nduration ")
+}
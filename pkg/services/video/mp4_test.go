@@ -0,0 +1,135 @@
+package video
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
+)
+
+// fakeMP4Encoder stands in for encodeMP4, recording the frame count and
+// fragmentation of each encode.
+type fakeMP4Encoder struct {
+	frames     []int
+	fragmented []bool
+}
+
+func (f *fakeMP4Encoder) encode(_ context.Context, _, _, outputPath string, frames int, opts renderOptions) error {
+	f.frames = append(f.frames, frames)
+	f.fragmented = append(f.fragmented, opts.Fragmented)
+	return os.WriteFile(outputPath, []byte("mp4"), 0644)
+}
+
+func TestConcatListFrames(t *testing.T) {
+	dir := t.TempDir()
+	listPath := filepath.Join(dir, "list.txt")
+	files := []string{filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg"), filepath.Join(dir, "c.jpg")}
+
+	require.NoError(t, writeConcatList(listPath, files, renderOptions{Timing: frameTiming{FPS: 30}}))
+	assert.Equal(t, 3, concatListFrames(listPath), "the repeated last entry is not a frame")
+	assert.Equal(t, 0, concatListFrames(filepath.Join(dir, "missing.txt")))
+}
+
+func TestAppendMP4(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	fake := &fakeMP4Encoder{}
+	origEncode, origConcat := encodeMP4, concatenateVideos
+	t.Cleanup(func() { encodeMP4, concatenateVideos = origEncode, origConcat })
+	encodeMP4 = fake.encode
+	var joined []string
+	concatenateVideos = func(_ context.Context, existingVideoPath, newSegmentPath, outputVideoPath string) error {
+		joined = []string{existingVideoPath, newSegmentPath}
+		return os.WriteFile(outputVideoPath, []byte("joined"), 0644)
+	}
+
+	name := "cam1/24_hour_2026-10-16"
+	require.NoError(t, os.MkdirAll(config.CameraDataDir("cam1"), 0755))
+	outputPath := DiskPath(name, "mp4")
+	require.NoError(t, os.WriteFile(outputPath, []byte("existing"), 0644))
+	dir := t.TempDir()
+	var frames []string
+	for i := 0; i < 2; i++ {
+		frame := filepath.Join(dir, time.Date(2026, 10, 16, 10+i, 0, 0, 0, time.UTC).Format("2006-01-02-15-04-05")+".jpg")
+		require.NoError(t, os.WriteFile(frame, validSnapshotData(), 0644))
+		frames = append(frames, frame)
+	}
+
+	opts := renderOptions{Timing: frameTiming{FPS: 30}}
+	assert.Error(t, appendMP4(t.Context(), name, frames, opts), "fast-start MP4s cannot be appended to")
+	opts.Fragmented = true
+	opts.Timing.TargetSec = 60
+	assert.Error(t, appendMP4(t.Context(), name, frames, opts), "a target duration re-times existing frames")
+
+	opts.Timing.TargetSec = 0
+	require.NoError(t, appendMP4(t.Context(), name, frames, opts))
+	assert.Equal(t, []int{2}, fake.frames)
+	assert.Equal(t, []bool{true}, fake.fragmented)
+	if assert.Len(t, joined, 2) {
+		assert.Equal(t, outputPath, joined[0])
+		assert.NoFileExists(t, joined[1], "the temporary fragment is removed")
+	}
+	data, _ := os.ReadFile(outputPath)
+	assert.Equal(t, "joined", string(data))
+}
+
+func TestGenerateSingleTimelapse_FragmentedMP4Appends(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	fake := &fakeMP4Encoder{}
+	origEncode, origConcat := encodeMP4, concatenateVideos
+	t.Cleanup(func() { encodeMP4, concatenateVideos = origEncode, origConcat })
+	encodeMP4 = fake.encode
+	concatenateVideos = func(_ context.Context, _, _, outputVideoPath string) error {
+		return os.WriteFile(outputVideoPath, []byte("joined"), 0644)
+	}
+	settings.Set("video.format", "mp4")
+
+	day := time.Now().AddDate(0, 0, -1)
+	addFrame := func(hour int) {
+		tm := time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.Local)
+		dir := filepath.Join(config.CameraSnapshotsDir("cam1"), tm.Format("2006-01"), tm.Format("02"), tm.Format("15"))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tm.Format("2006-01-02-15-04-05")+".jpg"), validSnapshotData(), 0644))
+		util.ReindexSnapshots()
+	}
+	name := "cam1/24_hour_" + day.Format("2006-01-02")
+	for hour := 0; hour < 4; hour++ {
+		addFrame(hour)
+	}
+
+	_, err := GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	addFrame(4)
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 5}, fake.frames, "fast-start MP4s are re-encoded in full")
+
+	settings.Set("video.mp4_fragmented", "true")
+	addFrame(5)
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 5, 6}, fake.frames, "switching to fragmented output re-encodes once")
+	assert.Equal(t, []bool{false, false, true}, fake.fragmented)
+
+	addFrame(6)
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 5, 6, 1}, fake.frames, "only the new frame is encoded")
+
+	// Sampling to the frame budget can change frames already in the video.
+	settings.Set("video.max_batch_frames", "4")
+	addFrame(7)
+	result, err := GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	require.Less(t, result.Frames, result.Available)
+	assert.Equal(t, []int{4, 5, 6, 1, result.Frames}, fake.frames, "a sampled timelapse is re-encoded in full")
+}
@@ -0,0 +1,135 @@
+package video
+
+import (
+	"fmt"
+	"strings"
+
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
+)
+
+// overlayMetaKey is the packet metadata key that carries each frame's overlay
+// text from the concat list to drawtext.
+const overlayMetaKey = "tm_overlay"
+
+// overlayFontFile is the font drawtext uses when it is installed; otherwise
+// fontconfig's default sans-serif font is used.
+var overlayFontFile = "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf"
+
+// frameOverlay is the burn-in text drawn on each frame of a timelapse: the
+// frame's capture time, optionally preceded by a caption.
+type frameOverlay struct {
+	Caption  string
+	Position string // top-left, top-center, top-right, bottom-left, bottom-center or bottom-right
+	FontSize int    // pixels; 0 scales with the frame height
+	Box      bool   // draw a translucent box behind the text
+}
+
+// overlayFor returns the overlay for the (optionally camera-scoped) timelapse
+// name, or nil when its type is not listed in video.overlay_types
+// (comma-separated type names, "all" or "none").
+func overlayFor(name string) *frameOverlay {
+	kind := timelapseType(name)
+	if kind == "" {
+		return nil
+	}
+
+	enabled := false
+	for _, t := range strings.Split(settings.Get("video.overlay_types", "none"), ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "all" || t == kind {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return nil
+	}
+
+	return &frameOverlay{
+		Caption:  strings.TrimSpace(settings.Get("video.overlay_caption", "")),
+		Position: settings.Get("video.overlay_position", "bottom-right"),
+		FontSize: settings.GetInt("video.overlay_font_size", 0),
+		Box:      settings.Get("video.overlay_box", "true") == "true",
+	}
+}
+
+// text returns the overlay text for a snapshot: its capture time, parsed from
+// the filename, in the configured date and time formats. Files whose names
+// carry no time show only the caption.
+func (o *frameOverlay) text(snapshot string) string {
+	t, err := parseFileTime(snapshot)
+	if err != nil {
+		return o.Caption
+	}
+	if o.Caption == "" {
+		return util.FormatDateTime(t)
+	}
+	return o.Caption + " - " + util.FormatDateTime(t)
+}
+
+// filter returns the drawtext filter for the overlay. The text comes from each
+// frame's concat metadata, or when textFile is set from that file, a bare
+// filename relative to FFmpeg's working directory.
+func (o *frameOverlay) filter(textFile string) string {
+	margin := "(h/40)"
+	x := map[string]string{
+		"left":   margin,
+		"center": "(w-tw)/2",
+		"right":  "w-tw-" + margin,
+	}
+	vertical, horizontal, _ := strings.Cut(o.Position, "-")
+	y := "h-th-" + margin
+	if vertical == "top" {
+		y = margin
+	}
+	xExpr, ok := x[horizontal]
+	if !ok {
+		xExpr = x["right"]
+	}
+
+	fontSize := "(h/30)"
+	border := 8
+	if o.FontSize > 0 {
+		fontSize = fmt.Sprintf("%d", o.FontSize)
+		border = o.FontSize/3 + 1
+	}
+
+	var opts []string
+	if textFile == "" {
+		opts = append(opts, fmt.Sprintf(`text='%%{metadata\:%s}'`, overlayMetaKey))
+	} else {
+		opts = append(opts, "textfile="+textFile, "expansion=none")
+	}
+	if util.FileExists(overlayFontFile) {
+		opts = append(opts, "fontfile="+overlayFontFile)
+	}
+	opts = append(opts, "fontcolor=white", "fontsize="+fontSize, "x="+xExpr, "y="+y)
+	if o.Box {
+		opts = append(opts, "box=1", "boxcolor=black@0.5", fmt.Sprintf("boxborderw=%d", border))
+	} else {
+		opts = append(opts, "shadowcolor=black@0.8", "shadowx=2", "shadowy=2")
+	}
+	return "drawtext=" + strings.Join(opts, ":")
+}
+
+// withOverlay prefixes videoFilter with the overlay's drawtext filter, drawing
+// the text at source resolution before any scaling. A nil overlay leaves
+// videoFilter unchanged.
+func withOverlay(o *frameOverlay, textFile, videoFilter string) string {
+	if o == nil {
+		return videoFilter
+	}
+	if videoFilter == "" {
+		return o.filter(textFile)
+	}
+	return o.filter(textFile) + "," + videoFilter
+}
+
+// concatQuote quotes s as a single ffconcat token. Inside single quotes
+// everything is literal, so an embedded quote closes the string, is escaped and
+// reopens it.
+func concatQuote(s string) string {
+	s = strings.NewReplacer("\n", " ", "\r", " ").Replace(s)
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,102 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"time-machine/pkg/services/settings"
+)
+
+func TestOverlayFor(t *testing.T) {
+	setupHLSTest(t)
+
+	assert.Nil(t, overlayFor("week_2026-10-12"), "overlay is off by default")
+
+	settings.Set("video.overlay_types", "weekly, Monthly")
+	settings.Set("video.overlay_caption", "  Front Garden ")
+	settings.Set("video.overlay_position", "top-left")
+	settings.Set("video.overlay_font_size", "36")
+	settings.Set("video.overlay_box", "false")
+
+	o := overlayFor("cam1/week_2026-10-12")
+	if assert.NotNil(t, o) {
+		assert.Equal(t, &frameOverlay{Caption: "Front Garden", Position: "top-left", FontSize: 36, Box: false}, o)
+	}
+	assert.NotNil(t, overlayFor("month_2026-10"))
+	assert.Nil(t, overlayFor("24_hour_2026-10-16"), "daily timelapses are not listed")
+	assert.Nil(t, overlayFor("unknown"))
+
+	settings.Set("video.overlay_types", "all")
+	assert.NotNil(t, overlayFor("window_2026-10-16_sunset"))
+	assert.NotNil(t, overlayFor("activity_2026-10-16"))
+}
+
+func TestFrameOverlay_Text(t *testing.T) {
+	setupHLSTest(t)
+	settings.Set("ui.date_format", "DD/MM/YYYY")
+	settings.Set("ui.time_format", "24h")
+
+	o := &frameOverlay{}
+	assert.Equal(t, "16/10/2026 14:05", o.text("/data/snapshots/2026-10-16-14-05-09.jpg"))
+	assert.Equal(t, "16/10/2026 12:00", o.text("2026-10-16-12_person.jpg"), "gallery names and tags are understood")
+
+	o.Caption = "Front Garden"
+	assert.Equal(t, "Front Garden - 16/10/2026 14:05", o.text("2026-10-16-14-05-09.jpg"))
+	assert.Equal(t, "Front Garden", o.text("frame.jpg"), "files without a time show only the caption")
+}
+
+func TestFrameOverlay_Filter(t *testing.T) {
+	origFont := overlayFontFile
+	overlayFontFile = filepath.Join(t.TempDir(), "missing.ttf")
+	t.Cleanup(func() { overlayFontFile = origFont })
+
+	f := (&frameOverlay{Position: "bottom-right", Box: true}).filter("")
+	assert.True(t, strings.HasPrefix(f, `drawtext=text='%{metadata\:tm_overlay}':`), f)
+	assert.Contains(t, f, "fontsize=(h/30)")
+	assert.Contains(t, f, "x=w-tw-(h/40):y=h-th-(h/40)")
+	assert.Contains(t, f, "box=1")
+	assert.NotContains(t, f, "fontfile=")
+	assert.NotContains(t, f, ",", "the filter must not split the filter chain")
+
+	f = (&frameOverlay{Position: "top-center", FontSize: 24}).filter("overlay_1.txt")
+	assert.Contains(t, f, "textfile=overlay_1.txt:expansion=none")
+	assert.Contains(t, f, "fontsize=24")
+	assert.Contains(t, f, "x=(w-tw)/2:y=(h/40)")
+	assert.Contains(t, f, "shadowx=2")
+
+	assert.Equal(t, "scale=1", withOverlay(nil, "", "scale=1"))
+	assert.True(t, strings.HasSuffix(withOverlay(&frameOverlay{}, "", "scale=1"), ",scale=1"))
+}
+
+func TestWriteConcatList_Overlay(t *testing.T) {
+	setupHLSTest(t)
+	settings.Set("ui.date_format", "YYYY-MM-DD")
+	settings.Set("ui.time_format", "24h")
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "2026-10-16-09-00-00.jpg"), filepath.Join(dir, "2026-10-16-10-00-00.jpg")}
+	listPath := filepath.Join(dir, "list.txt")
+
+	require.NoError(t, writeConcatList(listPath, files, renderOptions{}))
+	data, _ := os.ReadFile(listPath)
+	assert.NotContains(t, string(data), "file_packet_meta")
+
+	require.NoError(t, writeConcatList(listPath, files, renderOptions{Overlay: &frameOverlay{Caption: "Bob's yard"}}))
+	data, _ = os.ReadFile(listPath)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, []string{
+		"ffconcat version 1.0",
+		"file '" + filepath.ToSlash(files[0]) + "'",
+		"duration 0.0333",
+		`file_packet_meta tm_overlay 'Bob'\''s yard - 2026-10-16 09:00'`,
+		"file '" + filepath.ToSlash(files[1]) + "'",
+		"duration 0.0333",
+		`file_packet_meta tm_overlay 'Bob'\''s yard - 2026-10-16 10:00'`,
+		"file '" + filepath.ToSlash(files[1]) + "'",
+		`file_packet_meta tm_overlay 'Bob'\''s yard - 2026-10-16 10:00'`,
+	}, lines)
+}
@@ -0,0 +1,247 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
+)
+
+// Animated previews are a short loop of up to maxPreviewFrames frames at
+// previewFPS, encoded at the first of previewWidths that fits the size cap.
+const (
+	maxPreviewFrames = 40
+	previewFPS       = 10
+	// previewTracker is the timelapse_trackers format the previews are
+	// registered under, next to the timelapse's video formats.
+	previewTracker = "preview"
+	// defaultPreviewMaxKB is the default video.preview_max_kb.
+	defaultPreviewMaxKB = 1024
+)
+
+var previewWidths = []int{480, 320, 240}
+
+// PreviewKinds are the animated preview image types, best first: WebP for its
+// size, then GIF for the chat apps and clients that cannot show animated WebP.
+var PreviewKinds = []string{"webp", "gif"}
+
+// PreviewDiskPath returns the path of the timelapse's animated preview of kind
+// ("webp" or "gif"). One preview serves every format.
+func PreviewDiskPath(name, kind string) string {
+	cameraID, base := util.SplitScopedName(name)
+	return filepath.Join(config.CameraDataDir(cameraID), fmt.Sprintf("timelapse_%s.preview.%s", base, kind))
+}
+
+// PreviewWebPath returns the URL path (/data/...) for the timelapse's animated
+// preview of kind.
+func PreviewWebPath(name, kind string) string {
+	cameraID, base := util.SplitScopedName(name)
+	return fmt.Sprintf("%stimelapse_%s.preview.%s", util.CameraWebPrefix(cameraID), base, kind)
+}
+
+// TimelapseNameFromWebPath returns the (camera-scoped) timelapse name of the
+// video at webPath — a /data/... path as returned by TimelapseWebPath — or ""
+// if webPath is not a timelapse video.
+func TimelapseNameFromWebPath(webPath string) string {
+	rel := strings.TrimPrefix(filepath.ToSlash(webPath), "/")
+	rel = strings.TrimPrefix(rel, "data/")
+	cameraID := ""
+	if rest, ok := strings.CutPrefix(rel, "cameras/"); ok {
+		id, file, found := strings.Cut(rest, "/")
+		if !found || id == "" || id == "." || id == ".." {
+			return ""
+		}
+		cameraID, rel = id, file
+	}
+
+	var base string
+	if rest, ok := strings.CutPrefix(rel, "hls/"); ok {
+		dir, file, _ := strings.Cut(rest, "/")
+		if file != "master.m3u8" {
+			return ""
+		}
+		base = dir
+	} else {
+		ext := filepath.Ext(rel)
+		if ext != ".webm" && ext != ".mp4" {
+			return ""
+		}
+		base = strings.TrimSuffix(rel, ext)
+	}
+	base, ok := strings.CutPrefix(base, "timelapse_")
+	if !ok || base == "" || strings.Contains(base, "/") || strings.Contains(base, "..") {
+		return ""
+	}
+	return util.ScopedName(cameraID, base)
+}
+
+// generatePreviews writes the timelapse's animated WebP and GIF previews from
+// snapshots. Each is encoded at the largest of previewWidths that fits
+// video.preview_max_kb; a kind that cannot be encoded or does not fit is left
+// out. The previews are registered in the timelapse's trackers and left alone
+// when the frames and size cap are those they were last built from.
+func generatePreviews(ctx context.Context, name string, snapshots []string) error {
+	frames := validSnapshots(snapshots)
+	if len(frames) == 0 {
+		return nil
+	}
+	maxKB := settings.GetInt("video.preview_max_kb", defaultPreviewMaxKB)
+	if maxKB < 1 {
+		maxKB = defaultPreviewMaxKB
+	}
+	signature := previewSignature(frames, maxKB)
+	if recorded, _ := readRenderParams(name, previewTracker); recorded == signature && hasPreview(name) {
+		return nil
+	}
+
+	picks := previewFrames(len(frames))
+	files := make([]string, len(picks))
+	for i, k := range picks {
+		files[i] = frames[k]
+	}
+
+	_, base := util.SplitScopedName(name)
+	dir := filepath.Dir(PreviewDiskPath(name, PreviewKinds[0]))
+	listPath := filepath.Join(dir, fmt.Sprintf("preview_concat_%s.txt", base))
+	defer os.Remove(listPath)
+	if err := writeConcatList(listPath, files, renderOptions{Timing: frameTiming{FPS: previewFPS}}); err != nil {
+		return fmt.Errorf("failed to create concat list: %w", err)
+	}
+
+	var built []string
+	var lastErr error
+	for _, kind := range PreviewKinds {
+		width, err := encodePreviewWithin(ctx, name, listPath, kind, int64(maxKB)*1024)
+		if err != nil {
+			lastErr = err
+			log.Printf("No %s preview for %s: %v", kind, name, err)
+			os.Remove(PreviewDiskPath(name, kind))
+			continue
+		}
+		built = append(built, fmt.Sprintf("%s %dpx", kind, width))
+	}
+	if len(built) == 0 {
+		return lastErr
+	}
+
+	if err := writeRenderParams(name, previewTracker, signature); err != nil {
+		return fmt.Errorf("failed to register previews: %w", err)
+	}
+	log.Printf("Generated %d-frame preview(s) for %s: %s.", len(files), name, strings.Join(built, ", "))
+	return nil
+}
+
+// encodePreviewWithin encodes the preview of kind at each of previewWidths in
+// turn until one is no larger than maxBytes, and returns its width.
+func encodePreviewWithin(ctx context.Context, name, listPath, kind string, maxBytes int64) (int, error) {
+	outputPath := PreviewDiskPath(name, kind)
+	tempPath := outputPath + ".tmp." + kind
+	defer os.Remove(tempPath)
+	var size int64
+	for _, width := range previewWidths {
+		if err := encodePreview(ctx, name, listPath, tempPath, kind, width); err != nil {
+			return 0, err
+		}
+		info, err := os.Stat(tempPath)
+		if err != nil {
+			return 0, err
+		}
+		size = info.Size()
+		if size <= maxBytes {
+			if err := os.Rename(tempPath, outputPath); err != nil {
+				return 0, fmt.Errorf("failed to rename preview temp file: %w", err)
+			}
+			return width, nil
+		}
+	}
+	return 0, fmt.Errorf("%d KB at %dpx is over the %d KB cap", size/1024, previewWidths[len(previewWidths)-1], maxBytes/1024)
+}
+
+// hasPreview reports whether any of the timelapse's previews exist.
+func hasPreview(name string) bool {
+	for _, kind := range PreviewKinds {
+		if util.FileExists(PreviewDiskPath(name, kind)) {
+			return true
+		}
+	}
+	return false
+}
+
+// removePreviews deletes the timelapse's previews and their tracker row.
+func removePreviews(name string) {
+	for _, kind := range PreviewKinds {
+		path := PreviewDiskPath(name, kind)
+		if err := os.Remove(path); err == nil {
+			log.Printf("Removed %s", path)
+		}
+	}
+	if err := database.DeleteTimelapseTrackers(name, previewTracker); err != nil {
+		log.Printf("ERROR removing preview tracker for %s: %v", name, err)
+	}
+}
+
+// encodePreview encodes the concat list as a looping animated image of kind
+// ("webp" or "gif") width pixels wide. GIFs get a palette generated from the
+// clip itself so the colours hold up.
+var encodePreview = func(ctx context.Context, name, concatListPath, outputPath, kind string, width int) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	scale := fmt.Sprintf("fps=%d,scale=%d:-2:flags=lanczos", previewFPS, width)
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", "concat", "-safe", "0", "-i", concatListPath,
+	}
+	if kind == "gif" {
+		args = append(args,
+			"-filter_complex", scale+",split[a][b];[a]palettegen=max_colors=128:stats_mode=diff[p];[b][p]paletteuse=dither=bayer:bayer_scale=4",
+			"-f", "gif")
+	} else {
+		args = append(args,
+			"-vf", scale,
+			"-c:v", "libwebp_anim", "-quality", "60", "-compression_level", "4",
+			"-f", "webp")
+	}
+	args = append(args, "-loop", "0", "-an", "-y", outputPath)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		today := time.Now().Format("2006-01-02")
+		_ = database.AppendFFmpegLog(today, name, fmt.Sprintf("--- Preview (%s) Error for %s: %s ---\n%s\n", kind, name, time.Now(), stderr.String()))
+		return fmt.Errorf("ffmpeg %s preview encode failed for %s: %w", kind, name, err)
+	}
+	return nil
+}
+
+// previewFrames returns the indexes of the frames, out of frames, shown in the
+// preview: every frame, or maxPreviewFrames spread evenly from first to last.
+func previewFrames(frames int) []int {
+	n := min(frames, maxPreviewFrames)
+	picks := make([]int, n)
+	if n == 1 {
+		return picks
+	}
+	for j := range picks {
+		picks[j] = j * (frames - 1) / (n - 1)
+	}
+	return picks
+}
+
+// previewSignature identifies the frames and size cap previews are built from.
+func previewSignature(frames []string, maxKB int) string {
+	return fmt.Sprintf("frames=%d first=%s last=%s max_kb=%d widths=%v",
+		len(frames), filepath.Base(frames[0]), filepath.Base(frames[len(frames)-1]), maxKB, previewWidths)
+}
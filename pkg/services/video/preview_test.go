@@ -0,0 +1,131 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/services/settings"
+)
+
+func TestPreviewPaths(t *testing.T) {
+	config.AppConfig.DataDir = "/data"
+	assert.Equal(t, "/data/cameras/cam1/timelapse_year_2026.preview.webp", PreviewDiskPath("cam1/year_2026", "webp"))
+	assert.Equal(t, "/data/timelapse_week_2026-10-12.preview.gif", PreviewWebPath("week_2026-10-12", "gif"))
+}
+
+func TestTimelapseNameFromWebPath(t *testing.T) {
+	for _, name := range []string{"cam1/24_hour_2026-10-16", "week_2026-10-12", "cam1/window_2026-10-16_Sunrise"} {
+		for _, format := range outputFormats {
+			assert.Equal(t, name, TimelapseNameFromWebPath(TimelapseWebPath(name, format)), format)
+		}
+	}
+	assert.Equal(t, "year_2026", TimelapseNameFromWebPath("timelapse_year_2026.mp4"), "legacy share paths lack /data/")
+
+	for _, path := range []string{
+		"/data/test.mp4",
+		"/data/timelapse_year_2026.preview.gif",
+		"/data/cameras/cam1/latest_snapshot.jpg",
+		"/data/hls/timelapse_daily/720p/playlist.m3u8",
+		"/data/cameras/../timelapse_year_2026.mp4",
+	} {
+		assert.Empty(t, TimelapseNameFromWebPath(path), path)
+	}
+}
+
+func TestPreviewFrames(t *testing.T) {
+	assert.Equal(t, []int{0, 1, 2}, previewFrames(3))
+	assert.Equal(t, []int{0}, previewFrames(1))
+
+	picks := previewFrames(500)
+	require.Len(t, picks, maxPreviewFrames)
+	assert.Equal(t, 0, picks[0])
+	assert.Equal(t, 499, picks[maxPreviewFrames-1], "previews run to the last frame")
+}
+
+func TestGeneratePreviews(t *testing.T) {
+	setupHLSTest(t)
+	origEncode := encodePreview
+	t.Cleanup(func() { encodePreview = origEncode })
+	type encode struct {
+		kind  string
+		width int
+	}
+	var encodes []encode
+	sizes := map[string]func(width int) int{
+		"webp": func(int) int { return 900 * 1024 },
+		"gif":  func(width int) int { return width * 4 * 1024 },
+	}
+	encodePreview = func(_ context.Context, _, concatListPath, outputPath, kind string, width int) error {
+		assert.Equal(t, 3, concatListFrames(concatListPath))
+		encodes = append(encodes, encode{kind, width})
+		return os.WriteFile(outputPath, make([]byte, sizes[kind](width)), 0644)
+	}
+
+	name := "cam1/24_hour_2026-10-16"
+	require.NoError(t, os.MkdirAll(config.CameraDataDir("cam1"), 0755))
+	dir := t.TempDir()
+	var frames []string
+	for i := 0; i < 3; i++ {
+		frame := filepath.Join(dir, fmt.Sprintf("2026-10-16-%02d-00-00.jpg", i))
+		require.NoError(t, os.WriteFile(frame, validSnapshotData(), 0644))
+		frames = append(frames, frame)
+	}
+
+	require.NoError(t, generatePreviews(t.Context(), name, frames))
+	assert.Equal(t, []encode{{"webp", 480}, {"gif", 480}, {"gif", 320}, {"gif", 240}}, encodes,
+		"a preview over the cap is re-encoded smaller")
+	assert.FileExists(t, PreviewDiskPath(name, "webp"))
+	info, err := os.Stat(PreviewDiskPath(name, "gif"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 240*4*1024, info.Size())
+	params, _ := database.GetTimelapseParams(name, previewTracker)
+	assert.NotEmpty(t, params, "previews are registered with the timelapse's trackers")
+
+	require.NoError(t, generatePreviews(t.Context(), name, frames))
+	assert.Len(t, encodes, 4, "unchanged frames keep their previews")
+
+	settings.Set("video.preview_max_kb", "950")
+	encodes = nil
+	require.NoError(t, generatePreviews(t.Context(), name, frames))
+	assert.Len(t, encodes, 1+3, "a new cap re-encodes both")
+	assert.FileExists(t, PreviewDiskPath(name, "webp"))
+	assert.NoFileExists(t, PreviewDiskPath(name, "gif"), "a kind that never fits is left out")
+
+	removePreviews(name)
+	assert.NoFileExists(t, PreviewDiskPath(name, "webp"))
+	params, _ = database.GetTimelapseParams(name, previewTracker)
+	assert.Empty(t, params)
+}
+
+func TestGeneratePreviews_EncodeFails(t *testing.T) {
+	setupHLSTest(t)
+	origEncode := encodePreview
+	t.Cleanup(func() { encodePreview = origEncode })
+	encodePreview = func(_ context.Context, _, _, outputPath, kind string, _ int) error {
+		if kind == "webp" {
+			return errors.New("Unknown encoder 'libwebp_anim'")
+		}
+		return os.WriteFile(outputPath, []byte("gif"), 0644)
+	}
+
+	name := "week_2026-10-12"
+	frame := filepath.Join(t.TempDir(), "2026-10-12-12-00-00.jpg")
+	require.NoError(t, os.WriteFile(frame, validSnapshotData(), 0644))
+
+	require.NoError(t, generatePreviews(t.Context(), name, []string{frame}), "the GIF stands in for a WebP that cannot be encoded")
+	assert.FileExists(t, PreviewDiskPath(name, "gif"))
+	assert.NoFileExists(t, PreviewDiskPath(name, "webp"))
+
+	encodePreview = func(_ context.Context, _, _, _, _ string, _ int) error { return errors.New("ffmpeg missing") }
+	removePreviews(name)
+	assert.ErrorContains(t, generatePreviews(t.Context(), name, []string{frame}), "ffmpeg missing")
+}
@@ -0,0 +1,147 @@
+package video
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"time-machine/pkg/models"
+)
+
+// ffmpegProgress is one block of FFmpeg's -progress output.
+type ffmpegProgress struct {
+	Frame   int
+	FPS     float64
+	OutTime time.Duration
+	Speed   float64
+	Done    bool
+}
+
+// currentEncode identifies the encode published in models.VideoStatusData, as
+// returned by encodeKey. It is guarded by models.VideoStatusData.
+var currentEncode string
+
+// encodeKey identifies the encode of the (camera-scoped) timelapse name in
+// format. Output file names repeat across cameras, so they cannot be used.
+func encodeKey(name, format string) string {
+	return name + ":" + format
+}
+
+// runFFmpeg runs the FFmpeg cmd encoding the (camera-scoped) timelapse name in
+// format, with its -progress output piped back, and publishes the progress of
+// its totalFrames frames towards output as the current encode in
+// models.VideoStatusData until it exits. When several encodes run at once, the
+// one published is the latest to start, or after it exits the next to report
+// progress. cmd.Stdout must not be set.
+func runFFmpeg(cmd *exec.Cmd, name, format, output string, totalFrames int) error {
+	cmd.Args = append([]string{cmd.Args[0], "-progress", "pipe:1", "-nostats"}, cmd.Args[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	key := encodeKey(name, format)
+	startedAt := startEncode(key, output, totalFrames)
+	defer finishEncode(key)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	parseProgress(stdout, func(p ffmpegProgress) { updateEncode(key, output, totalFrames, startedAt, p) })
+	return cmd.Wait()
+}
+
+// parseProgress reads FFmpeg -progress output from r, calling fn at the end of
+// each block of key=value lines.
+func parseProgress(r io.Reader, fn func(ffmpegProgress)) {
+	var p ffmpegProgress
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "frame":
+			p.Frame, _ = strconv.Atoi(val)
+		case "fps":
+			p.FPS, _ = strconv.ParseFloat(val, 64)
+		case "out_time_us":
+			// Before the first frame is written this is "N/A".
+			if us, err := strconv.ParseInt(val, 10, 64); err == nil && us >= 0 {
+				p.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "speed":
+			p.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(val), "x"), 64)
+		case "progress":
+			p.Done = val == "end"
+			fn(p)
+		}
+	}
+}
+
+// estimate returns the percentage of totalFrames that p has encoded and the
+// time left, from the encode's frame rate or, before FFmpeg reports one, the
+// average rate since it started elapsed ago. Both are 0 if totalFrames is
+// unknown; the time left is also 0 until a frame has been encoded.
+func estimate(p ffmpegProgress, totalFrames int, elapsed time.Duration) (float64, time.Duration) {
+	if p.Done {
+		return 100, 0
+	}
+	if totalFrames <= 0 {
+		return 0, 0
+	}
+	frame := min(p.Frame, totalFrames)
+	percent := float64(frame) * 100 / float64(totalFrames)
+	left := float64(totalFrames - frame)
+	switch {
+	case p.FPS > 0:
+		return percent, time.Duration(left / p.FPS * float64(time.Second))
+	case frame > 0:
+		return percent, time.Duration(left / float64(frame) * float64(elapsed))
+	}
+	return percent, 0
+}
+
+// startEncode records the encode key, of output with totalFrames frames, as
+// the one being shown, and returns when it started.
+func startEncode(key, output string, totalFrames int) time.Time {
+	now := time.Now()
+	models.VideoStatusData.Lock()
+	defer models.VideoStatusData.Unlock()
+	currentEncode = key
+	models.VideoStatusData.CurrentFile = filepath.Base(output)
+	models.VideoStatusData.Progress = models.EncodeProgress{TotalFrames: totalFrames, StartedAt: now, UpdatedAt: now}
+	return now
+}
+
+// updateEncode publishes p as the progress of the encode key of output, started
+// at startedAt, unless another encode is being shown.
+func updateEncode(key, output string, totalFrames int, startedAt time.Time, p ffmpegProgress) {
+	models.VideoStatusData.Lock()
+	defer models.VideoStatusData.Unlock()
+	if currentEncode != "" && currentEncode != key {
+		return
+	}
+	currentEncode = key
+	models.VideoStatusData.CurrentFile = filepath.Base(output)
+	prog := &models.VideoStatusData.Progress
+	prog.TotalFrames, prog.StartedAt, prog.UpdatedAt = totalFrames, startedAt, time.Now()
+	prog.Frame, prog.FPS, prog.OutTime, prog.Speed = p.Frame, p.FPS, p.OutTime, p.Speed
+	prog.Percent, prog.ETA = estimate(p, totalFrames, prog.UpdatedAt.Sub(startedAt))
+}
+
+// finishEncode clears the encode key if it is the one being shown.
+func finishEncode(key string) {
+	models.VideoStatusData.Lock()
+	defer models.VideoStatusData.Unlock()
+	if currentEncode != key {
+		return
+	}
+	currentEncode = ""
+	models.VideoStatusData.CurrentFile = ""
+	models.VideoStatusData.Progress = models.EncodeProgress{}
+}
@@ -0,0 +1,127 @@
+package video
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"time-machine/pkg/models"
+)
+
+const sampleProgress = `frame=0
+fps=0.00
+out_time_us=N/A
+speed=N/A
+progress=continue
+frame=120
+fps=48.00
+stream_0_0_q=28.0
+out_time_us=4000000
+out_time=00:00:04.000000
+speed=1.6x
+progress=continue
+frame=300
+fps=50.50
+out_time_us=10000000
+speed=1.68x
+progress=end
+`
+
+func TestParseProgress(t *testing.T) {
+	var blocks []ffmpegProgress
+	parseProgress(strings.NewReader(sampleProgress), func(p ffmpegProgress) { blocks = append(blocks, p) })
+
+	require.Len(t, blocks, 3)
+	assert.Equal(t, ffmpegProgress{}, blocks[0], "N/A values before the first frame are ignored")
+	assert.Equal(t, ffmpegProgress{Frame: 120, FPS: 48, OutTime: 4 * time.Second, Speed: 1.6}, blocks[1])
+	assert.True(t, blocks[2].Done)
+	assert.Equal(t, 300, blocks[2].Frame)
+}
+
+func TestEstimate(t *testing.T) {
+	percent, eta := estimate(ffmpegProgress{Frame: 120, FPS: 48}, 600, time.Minute)
+	assert.Equal(t, 20.0, percent)
+	assert.Equal(t, 10*time.Second, eta, "480 frames left at 48 fps")
+
+	percent, eta = estimate(ffmpegProgress{Frame: 150}, 600, 30*time.Second)
+	assert.Equal(t, 25.0, percent)
+	assert.Equal(t, 90*time.Second, eta, "without a frame rate the average since the start is used")
+
+	percent, eta = estimate(ffmpegProgress{Frame: 700, FPS: 10}, 600, time.Minute)
+	assert.Equal(t, 100.0, percent, "frames past the known count are capped")
+	assert.Zero(t, eta)
+
+	percent, eta = estimate(ffmpegProgress{Frame: 50, FPS: 10}, 0, time.Minute)
+	assert.Zero(t, percent, "unknown frame counts give no estimate")
+	assert.Zero(t, eta)
+
+	percent, _ = estimate(ffmpegProgress{Frame: 10, Done: true}, 600, time.Minute)
+	assert.Equal(t, 100.0, percent)
+}
+
+func TestRunFFmpeg(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args.txt")
+	progressFile := filepath.Join(dir, "progress.txt")
+	require.NoError(t, os.WriteFile(progressFile, []byte(sampleProgress), 0644))
+	script := filepath.Join(dir, "ffmpeg")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\ncat "+progressFile+"\n"), 0755))
+
+	cmd := exec.Command(script, "-i", "list.txt", "out.mp4")
+	require.NoError(t, runFFmpeg(cmd, "year_2026", "mp4", "/data/timelapse_year_2026.mp4", 600))
+	args, _ := os.ReadFile(argsFile)
+	assert.Equal(t, "-progress pipe:1 -nostats -i list.txt out.mp4\n", string(args))
+	models.VideoStatusData.RLock()
+	assert.Empty(t, models.VideoStatusData.CurrentFile, "the encode is cleared once FFmpeg exits")
+	assert.Equal(t, models.EncodeProgress{}, models.VideoStatusData.Progress)
+	models.VideoStatusData.RUnlock()
+
+	year, daily := encodeKey("year_2026", "mp4"), encodeKey("24_hour_2026-10-16", "mp4")
+	yearFile, dailyFile := "/data/timelapse_year_2026.mp4", "/data/timelapse_24_hour_2026-10-16.mp4"
+	yearStarted := startEncode(year, yearFile, 600)
+	updateEncode(year, yearFile, 600, yearStarted, ffmpegProgress{Frame: 300, FPS: 50})
+	models.VideoStatusData.RLock()
+	assert.Equal(t, "timelapse_year_2026.mp4", models.VideoStatusData.CurrentFile)
+	assert.Equal(t, 50.0, models.VideoStatusData.Progress.Percent)
+	assert.Equal(t, 6*time.Second, models.VideoStatusData.Progress.ETA)
+	models.VideoStatusData.RUnlock()
+
+	dailyStarted := startEncode(daily, dailyFile, 100)
+	updateEncode(year, yearFile, 600, yearStarted, ffmpegProgress{Frame: 360, FPS: 50})
+	models.VideoStatusData.RLock()
+	assert.Equal(t, "timelapse_24_hour_2026-10-16.mp4", models.VideoStatusData.CurrentFile, "the latest encode to start is shown")
+	assert.Zero(t, models.VideoStatusData.Progress.Frame)
+	models.VideoStatusData.RUnlock()
+
+	finishEncode(year)
+	updateEncode(daily, dailyFile, 100, dailyStarted, ffmpegProgress{Frame: 25, FPS: 25})
+	finishEncode(daily)
+	updateEncode(year, yearFile, 600, yearStarted, ffmpegProgress{Frame: 420, FPS: 60})
+	models.VideoStatusData.RLock()
+	assert.Equal(t, "timelapse_year_2026.mp4", models.VideoStatusData.CurrentFile, "an encode still running is shown again")
+	assert.Equal(t, 70.0, models.VideoStatusData.Progress.Percent)
+	assert.Equal(t, yearStarted, models.VideoStatusData.Progress.StartedAt)
+	models.VideoStatusData.RUnlock()
+	finishEncode(year)
+
+	// Cameras share output file names, so encodes are told apart by timelapse.
+	cam1, cam2 := encodeKey("cam1/24_hour_2026-10-16", "mp4"), encodeKey("cam2/24_hour_2026-10-16", "mp4")
+	cam1Started := startEncode(cam1, "/data/cameras/cam1/timelapse_24_hour_2026-10-16.mp4", 100)
+	startEncode(cam2, "/data/cameras/cam2/timelapse_24_hour_2026-10-16.mp4", 200)
+	updateEncode(cam1, "/data/cameras/cam1/timelapse_24_hour_2026-10-16.mp4", 100, cam1Started, ffmpegProgress{Frame: 90, FPS: 10})
+	models.VideoStatusData.RLock()
+	assert.Equal(t, 200, models.VideoStatusData.Progress.TotalFrames, "another camera's encode of the same file does not overwrite it")
+	models.VideoStatusData.RUnlock()
+	finishEncode(cam1)
+	models.VideoStatusData.RLock()
+	assert.Equal(t, "timelapse_24_hour_2026-10-16.mp4", models.VideoStatusData.CurrentFile, "nor does it clear it")
+	assert.Equal(t, 200, models.VideoStatusData.Progress.TotalFrames)
+	models.VideoStatusData.RUnlock()
+	finishEncode(cam2)
+}
@@ -0,0 +1,175 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
+)
+
+// timelapseTypes maps timelapse name prefixes to the type names used in
+// per-type settings such as video.overlay_types and video.<type>_fps.
+var timelapseTypes = []struct{ prefix, name string }{
+	{"24_hour_", "daily"},
+	{"window_", "window"},
+	{"activity_", "activity"},
+	{"week_", "weekly"},
+	{"month_", "monthly"},
+	{"year_", "yearly"},
+}
+
+// timelapseType returns the type name of the (optionally camera-scoped)
+// timelapse name, or "" if it is not one of timelapseTypes.
+func timelapseType(name string) string {
+	_, base := util.SplitScopedName(name)
+	for _, t := range timelapseTypes {
+		if strings.HasPrefix(base, t.prefix) {
+			return t.name
+		}
+	}
+	return ""
+}
+
+// renderOptions are the per-timelapse settings applied to every encoded frame,
+// resolved once per generation so all encoder paths agree.
+type renderOptions struct {
+	Timing  frameTiming
+	Overlay *frameOverlay
+	Encoder EncoderProfile
+	HLS     hlsLayout // HLS output only
+	// Fragmented writes MP4 output as a fragmented MP4 that new frames can be
+	// appended to.
+	Fragmented bool
+}
+
+// renderOptionsFor returns the render options for the timelapse name in format.
+func renderOptionsFor(name, format string) renderOptions {
+	o := renderOptions{
+		Timing:  timingFor(name),
+		Overlay: overlayFor(name),
+		Encoder: encoderFor(name, format),
+	}
+	switch format {
+	case "hls":
+		o.HLS = hlsLayoutFor()
+	case "mp4":
+		o.Fragmented = settings.Get("video.mp4_fragmented", "false") == "true"
+	}
+	return o
+}
+
+// params describes the options that frames already in a video were encoded
+// with; frames encoded with different params cannot be appended to it.
+func (o renderOptions) params() string {
+	s := fmt.Sprintf("%s fps=%d", o.Encoder.key(), o.Timing.FPS)
+	if o.Overlay != nil {
+		s += fmt.Sprintf(" overlay=%+v", *o.Overlay)
+	}
+	if len(o.HLS.Qualities) > 0 {
+		s += fmt.Sprintf(" hls=%+v", o.HLS)
+	}
+	if o.Fragmented {
+		s += " fragmented"
+	}
+	return s
+}
+
+// Bounds on the time each frame is shown.
+const (
+	maxFPS           = 60
+	defaultFPS       = 30
+	maxFrameDuration = 10.0 // seconds
+)
+
+// frameTiming sets how long each frame of a timelapse is shown: at a fixed
+// frame rate, or stretched or squeezed so the clip lasts TargetSec. The last
+// frame is then held for HoldSec more.
+type frameTiming struct {
+	FPS       int
+	TargetSec int // 0 uses FPS
+	HoldSec   int
+}
+
+// timingFor returns the frame timing for the timelapse name from
+// video.<type>_fps, video.<type>_target_sec and video.<type>_hold_sec.
+// Timelapses of no known type play at 30 fps.
+func timingFor(name string) frameTiming {
+	kind := timelapseType(name)
+	if kind == "" {
+		return frameTiming{FPS: defaultFPS}
+	}
+	t := frameTiming{
+		FPS:       settings.GetInt("video."+kind+"_fps", defaultFPS),
+		TargetSec: settings.GetInt("video."+kind+"_target_sec", 0),
+		HoldSec:   settings.GetInt("video."+kind+"_hold_sec", 0),
+	}
+	if t.FPS < 1 || t.FPS > maxFPS {
+		t.FPS = defaultFPS
+	}
+	if t.TargetSec < 0 {
+		t.TargetSec = 0
+	}
+	if t.HoldSec < 0 {
+		t.HoldSec = 0
+	}
+	return t
+}
+
+// frameDuration returns how long, in seconds, each of frames frames is shown.
+func (t frameTiming) frameDuration(frames int) float64 {
+	if t.TargetSec > 0 && frames > 0 {
+		d := float64(t.TargetSec) / float64(frames)
+		return min(max(d, 1.0/maxFPS), maxFrameDuration)
+	}
+	fps := t.FPS
+	if fps < 1 {
+		fps = defaultFPS
+	}
+	return 1 / float64(fps)
+}
+
+// appendable reports whether new frames can be appended to an existing video
+// without changing the frames already in it: a target duration re-times every
+// frame and a held last frame would end up mid-clip.
+func (t frameTiming) appendable() bool {
+	return t.TargetSec == 0 && t.HoldSec == 0
+}
+
+// writeConcatList writes an ffconcat list showing each file for the options'
+// frame duration, holding the last one for the hold time. With an overlay, each
+// file's text is attached as packet metadata.
+func writeConcatList(path string, files []string, opts renderOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	frameDur := opts.Timing.frameDuration(len(files))
+	meta := func(file string) {
+		if opts.Overlay != nil {
+			fmt.Fprintf(f, "file_packet_meta %s %s\n", overlayMetaKey, concatQuote(opts.Overlay.text(file)))
+		}
+	}
+	fmt.Fprintln(f, "ffconcat version 1.0")
+	for i, file := range files {
+		dur := frameDur
+		if i == len(files)-1 {
+			dur += float64(opts.Timing.HoldSec)
+		}
+		fmt.Fprintf(f, "file '%s'\nduration %s\n", filepath.ToSlash(file), formatSeconds(dur))
+		meta(file)
+	}
+	// ffconcat requires the last entry to be repeated without a duration to avoid a missing final frame.
+	last := files[len(files)-1]
+	fmt.Fprintf(f, "file '%s'\n", filepath.ToSlash(last))
+	meta(last)
+	return f.Close()
+}
+
+// formatSeconds formats a duration in seconds for FFmpeg, to the precision of
+// the historical "0.0333" (30 fps) frame duration.
+func formatSeconds(sec float64) string {
+	return fmt.Sprintf("%.4f", sec)
+}
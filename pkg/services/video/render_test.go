@@ -0,0 +1,160 @@
+package video
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
+)
+
+func TestTimelapseType(t *testing.T) {
+	assert.Equal(t, "daily", timelapseType("24_hour_2026-10-16"))
+	assert.Equal(t, "window", timelapseType("cam1/window_2026-10-16_sunrise"))
+	assert.Equal(t, "yearly", timelapseType("cam1/year_2026"))
+	assert.Equal(t, "", timelapseType("something_else"))
+}
+
+func TestTimingFor(t *testing.T) {
+	setupHLSTest(t)
+
+	assert.Equal(t, frameTiming{FPS: 30}, timingFor("24_hour_2026-10-16"), "defaults keep 30 fps")
+	assert.Equal(t, frameTiming{FPS: 30}, timingFor("unknown"))
+
+	settings.Set("video.yearly_fps", "12")
+	settings.Set("video.yearly_target_sec", "40")
+	settings.Set("video.yearly_hold_sec", "3")
+	assert.Equal(t, frameTiming{FPS: 12, TargetSec: 40, HoldSec: 3}, timingFor("cam1/year_2026"))
+
+	settings.Set("video.weekly_fps", "500")
+	settings.Set("video.weekly_hold_sec", "-1")
+	assert.Equal(t, frameTiming{FPS: 30}, timingFor("week_2026-10-12"), "out-of-range values fall back")
+}
+
+func TestFrameTiming_FrameDuration(t *testing.T) {
+	assert.InDelta(t, 1.0/30, frameTiming{FPS: 30}.frameDuration(1000), 1e-9)
+	assert.InDelta(t, 1.0/30, frameTiming{}.frameDuration(10), 1e-9, "zero value plays at 30 fps")
+	assert.InDelta(t, 0.5, frameTiming{FPS: 30, TargetSec: 12}.frameDuration(24), 1e-9, "24 frames over 12 s")
+	assert.InDelta(t, 1.0/60, frameTiming{TargetSec: 10}.frameDuration(100000), 1e-9, "capped at 60 fps")
+	assert.InDelta(t, 10, frameTiming{TargetSec: 600}.frameDuration(2), 1e-9, "frames last at most 10 s")
+
+	assert.True(t, frameTiming{FPS: 24}.appendable())
+	assert.False(t, frameTiming{FPS: 24, TargetSec: 20}.appendable())
+	assert.False(t, frameTiming{FPS: 24, HoldSec: 2}.appendable())
+}
+
+func TestWriteConcatList_Timing(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg")}
+	listPath := filepath.Join(dir, "list.txt")
+
+	require.NoError(t, writeConcatList(listPath, files, renderOptions{Timing: frameTiming{FPS: 30}}))
+	data, _ := os.ReadFile(listPath)
+	assert.Equal(t, 2, strings.Count(string(data), "duration 0.0333\n"), "30 fps matches the historical frame duration")
+
+	require.NoError(t, writeConcatList(listPath, files, renderOptions{Timing: frameTiming{TargetSec: 4, HoldSec: 3}}))
+	data, _ = os.ReadFile(listPath)
+	assert.Contains(t, string(data), "a.jpg'\nduration 2.0000\n")
+	assert.Contains(t, string(data), "b.jpg'\nduration 5.0000\n", "the last frame is held")
+}
+
+func TestGenerateSingleTimelapse_TargetDurationRegenerates(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	origRegen, origSeg, origConcat := regenerateFullTimelapse, createVideoSegment, concatenateVideos
+	origRead, origWrite := readLastAppendedSnapshot, writeLastAppendedSnapshot
+	defer func() {
+		regenerateFullTimelapse, createVideoSegment, concatenateVideos = origRegen, origSeg, origConcat
+		readLastAppendedSnapshot, writeLastAppendedSnapshot = origRead, origWrite
+	}()
+
+	day := time.Now().AddDate(0, 0, -1)
+	var snaps []string
+	for _, hour := range []int{10, 11} {
+		tm := time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.Local)
+		dir := filepath.Join(config.CameraSnapshotsDir("cam1"), tm.Format("2006-01"), tm.Format("02"), tm.Format("15"))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		snap := filepath.Join(dir, tm.Format("2006-01-02-15-04-05")+".jpg")
+		require.NoError(t, os.WriteFile(snap, validSnapshotData(), 0644))
+		snaps = append(snaps, snap)
+	}
+	util.ReindexSnapshots()
+
+	name := "cam1/24_hour_" + day.Format("2006-01-02")
+	require.NoError(t, os.WriteFile(DiskPath(name, "webm"), []byte("existing video"), 0644))
+	readLastAppendedSnapshot = func(_, _ string) (string, error) { return snaps[0], nil }
+	writeLastAppendedSnapshot = func(_, _, _ string) error { return nil }
+
+	var regenerated, appended bool
+	var gotOpts renderOptions
+	regenerateFullTimelapse = func(_ context.Context, _ string, _ []string, _ string, _ bool, opts renderOptions) error {
+		regenerated = true
+		gotOpts = opts
+		return nil
+	}
+	createVideoSegment = func(_ context.Context, _, _ string, _ renderOptions) error {
+		appended = true
+		return nil
+	}
+	concatenateVideos = func(_ context.Context, _, _, outputVideoPath string) error {
+		return os.WriteFile(outputVideoPath, []byte("appended video"), 0644)
+	}
+
+	settings.Set("video.daily_target_sec", "20")
+	_, err := GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.True(t, regenerated, "a target duration re-times every frame, so the video is rebuilt")
+	assert.False(t, appended)
+	assert.Equal(t, 20, gotOpts.Timing.TargetSec)
+
+	regenerated = false
+	settings.Set("video.daily_target_sec", "0")
+	_, err = GenerateSingleTimelapse(t.Context(), name)
+	require.NoError(t, err)
+	assert.False(t, regenerated)
+	assert.True(t, appended, "at a fixed frame rate new frames are appended")
+}
+
+func TestGenerateSingleTimelapse_FrameBudget(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	origRegen, origRead, origWrite := regenerateFullTimelapse, readLastAppendedSnapshot, writeLastAppendedSnapshot
+	defer func() {
+		regenerateFullTimelapse, readLastAppendedSnapshot, writeLastAppendedSnapshot = origRegen, origRead, origWrite
+	}()
+	readLastAppendedSnapshot = func(_, _ string) (string, error) { return "", nil }
+	writeLastAppendedSnapshot = func(_, _, _ string) error { return nil }
+	var frames []string
+	regenerateFullTimelapse = func(_ context.Context, _ string, snapshotFiles []string, _ string, _ bool, _ renderOptions) error {
+		frames = snapshotFiles
+		return nil
+	}
+
+	day := time.Now().AddDate(0, 0, -1)
+	for hour := 0; hour < 24; hour++ {
+		tm := time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.Local)
+		dir := filepath.Join(config.CameraSnapshotsDir("cam1"), tm.Format("2006-01"), tm.Format("02"), tm.Format("15"))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tm.Format("2006-01-02-15-04-05")+".jpg"), validSnapshotData(), 0644))
+	}
+	util.ReindexSnapshots()
+	settings.Set("video.max_batch_frames", "6")
+
+	result, err := GenerateSingleTimelapse(t.Context(), "cam1/24_hour_"+day.Format("2006-01-02"))
+	require.NoError(t, err)
+	assert.Equal(t, Result{Frames: 6, Available: 24}, result)
+	if assert.Len(t, frames, 6) {
+		assert.Contains(t, frames[0], day.Format("2006-01-02")+"-00-00-00", "the start of the day is kept")
+		assert.Contains(t, frames[5], day.Format("2006-01-02")+"-20-00-00")
+	}
+}
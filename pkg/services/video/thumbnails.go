@@ -0,0 +1,219 @@
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // registers the JPEG decoder for image.DecodeConfig
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/util"
+)
+
+// Seek-preview sprite layout: up to maxThumbnails thumbnails, thumbWidth pixels
+// wide, in rows of thumbColumns.
+const (
+	thumbWidth    = 160
+	thumbColumns  = 10
+	maxThumbnails = 100
+)
+
+// SpriteDiskPath returns the path of the seek-preview sprite sheet for the
+// (optionally camera-scoped) timelapse name. It is shared by every format.
+func SpriteDiskPath(name string) string {
+	cameraID, base := util.SplitScopedName(name)
+	return filepath.Join(config.CameraDataDir(cameraID), fmt.Sprintf("timelapse_%s.sprite.jpg", base))
+}
+
+// ThumbnailsDiskPath returns the path of the WebVTT thumbnails track mapping
+// the timelapse's time ranges to regions of its sprite sheet.
+func ThumbnailsDiskPath(name string) string {
+	cameraID, base := util.SplitScopedName(name)
+	return filepath.Join(config.CameraDataDir(cameraID), fmt.Sprintf("timelapse_%s.vtt", base))
+}
+
+// SpriteWebPath returns the URL path (/data/...) for the timelapse's sprite sheet.
+func SpriteWebPath(name string) string {
+	cameraID, base := util.SplitScopedName(name)
+	return fmt.Sprintf("%stimelapse_%s.sprite.jpg", util.CameraWebPrefix(cameraID), base)
+}
+
+// ThumbnailsWebPath returns the URL path (/data/...) for the timelapse's
+// WebVTT thumbnails track.
+func ThumbnailsWebPath(name string) string {
+	cameraID, base := util.SplitScopedName(name)
+	return fmt.Sprintf("%stimelapse_%s.vtt", util.CameraWebPrefix(cameraID), base)
+}
+
+// generateThumbnails writes the sprite sheet and WebVTT thumbnails track for
+// the timelapse built from snapshots at timing. The thumbnails are taken from
+// the source frames, so one set serves every format. They are left alone when
+// the frames and timing are those they were last built from.
+func generateThumbnails(ctx context.Context, name string, snapshots []string, timing frameTiming) error {
+	frames := validSnapshots(snapshots)
+	if len(frames) == 0 {
+		return nil
+	}
+	vttPath := ThumbnailsDiskPath(name)
+	signature := thumbnailsSignature(frames, timing)
+	if thumbnailsSignatureOf(vttPath) == signature && util.FileExists(SpriteDiskPath(name)) {
+		return nil
+	}
+
+	picks := thumbnailFrames(len(frames))
+	files := make([]string, len(picks))
+	for i, k := range picks {
+		files[i] = frames[k]
+	}
+	width, height := thumbnailSize(frames[0])
+
+	_, base := util.SplitScopedName(name)
+	dir := filepath.Dir(vttPath)
+	listPath := filepath.Join(dir, fmt.Sprintf("sprite_concat_%s.txt", base))
+	defer os.Remove(listPath)
+	if err := writeConcatList(listPath, files, renderOptions{}); err != nil {
+		return fmt.Errorf("failed to create concat list: %w", err)
+	}
+	spriteTemp := SpriteDiskPath(name) + ".tmp.jpg"
+	if err := encodeSprite(ctx, name, listPath, spriteTemp, len(files), width, height); err != nil {
+		os.Remove(spriteTemp)
+		return err
+	}
+	if err := os.Rename(spriteTemp, SpriteDiskPath(name)); err != nil {
+		return fmt.Errorf("failed to rename sprite temp file: %w", err)
+	}
+
+	vtt := thumbnailsTrack(SpriteWebPath(name), signature, picks, len(frames), timing, width, height)
+	if err := os.WriteFile(vttPath+".tmp", []byte(vtt), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(vttPath+".tmp", vttPath); err != nil {
+		return fmt.Errorf("failed to rename thumbnails track temp file: %w", err)
+	}
+	log.Printf("Generated %d seek thumbnail(s) for %s.", len(files), name)
+	return nil
+}
+
+// removeThumbnails deletes the timelapse's sprite sheet and thumbnails track.
+func removeThumbnails(name string) {
+	for _, path := range []string{SpriteDiskPath(name), ThumbnailsDiskPath(name)} {
+		if err := os.Remove(path); err == nil {
+			log.Printf("Removed %s", path)
+		}
+	}
+}
+
+// encodeSprite tiles the concat list's tiles frames, scaled to width×height,
+// into a single JPEG sprite sheet thumbColumns wide.
+var encodeSprite = func(ctx context.Context, name, concatListPath, outputPath string, tiles, width, height int) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	rows := (tiles + thumbColumns - 1) / thumbColumns
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error",
+		"-f", "concat", "-safe", "0", "-i", concatListPath,
+		"-vf", fmt.Sprintf("scale=%d:%d,tile=%dx%d:nb_frames=%d", width, height, thumbColumns, rows, tiles),
+		"-frames:v", "1", "-q:v", "5",
+		"-y", outputPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		today := time.Now().Format("2006-01-02")
+		_ = database.AppendFFmpegLog(today, name, fmt.Sprintf("--- Sprite Error for %s: %s ---\n%s\n", name, time.Now(), stderr.String()))
+		return fmt.Errorf("ffmpeg sprite encode failed for %s: %w", name, err)
+	}
+	return nil
+}
+
+// thumbnailFrames returns the indexes of the frames, out of frames, shown as
+// thumbnails: every frame, or maxThumbnails spread evenly from the first.
+func thumbnailFrames(frames int) []int {
+	n := min(frames, maxThumbnails)
+	picks := make([]int, n)
+	for j := range picks {
+		picks[j] = j * frames / n
+	}
+	return picks
+}
+
+// thumbnailSize returns the thumbnail size for frames shaped like the JPEG at
+// path: thumbWidth wide with an even height, or 16:9 if it cannot be read.
+func thumbnailSize(path string) (int, int) {
+	height := thumbWidth * 9 / 16
+	f, err := os.Open(path)
+	if err != nil {
+		return thumbWidth, height
+	}
+	defer f.Close()
+	if cfg, _, err := image.DecodeConfig(f); err == nil && cfg.Width > 0 {
+		height = int(math.Round(float64(thumbWidth*cfg.Height)/float64(cfg.Width)/2)) * 2
+	}
+	return thumbWidth, max(height, 2)
+}
+
+// thumbnailsTrack returns the WebVTT track whose cue for each thumbnail covers
+// the video from its frame to the next thumbnail's, pointing at its region of
+// the sprite at spriteURL.
+func thumbnailsTrack(spriteURL, signature string, picks []int, frames int, timing frameTiming, width, height int) string {
+	// Frames start on the concat list's rounded durations.
+	frameDur := math.Round(timing.frameDuration(frames)*1e4) / 1e4
+	total := float64(frames)*frameDur + float64(timing.HoldSec)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "WEBVTT\n\nNOTE %s\n", signature)
+	for j, k := range picks {
+		start := float64(k) * frameDur
+		end := total
+		if j+1 < len(picks) {
+			end = float64(picks[j+1]) * frameDur
+		}
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), spriteURL,
+			(j%thumbColumns)*width, (j/thumbColumns)*height, width, height)
+	}
+	return b.String()
+}
+
+// vttTimestamp formats sec as a WebVTT timestamp, e.g. 00:01:02.500.
+func vttTimestamp(sec float64) string {
+	ms := int64(math.Round(sec * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// thumbnailsSignature identifies the frames and timing thumbnails are built
+// from; it is kept in the track's NOTE block.
+func thumbnailsSignature(frames []string, timing frameTiming) string {
+	return fmt.Sprintf("frames=%d first=%s last=%s fps=%d target=%d hold=%d width=%d",
+		len(frames), filepath.Base(frames[0]), filepath.Base(frames[len(frames)-1]),
+		timing.FPS, timing.TargetSec, timing.HoldSec, thumbWidth)
+}
+
+// thumbnailsSignatureOf returns the signature recorded in the thumbnails track
+// at path, or "" if there is none.
+func thumbnailsSignatureOf(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < 4 && scanner.Scan(); i++ {
+		if sig, ok := strings.CutPrefix(scanner.Text(), "NOTE "); ok {
+			return sig
+		}
+	}
+	return ""
+}
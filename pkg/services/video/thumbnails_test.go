@@ -0,0 +1,120 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"time-machine/pkg/config"
+)
+
+func TestThumbnailPaths(t *testing.T) {
+	config.AppConfig.DataDir = "/data"
+	assert.Equal(t, "/data/cameras/cam1/timelapse_year_2026.sprite.jpg", SpriteDiskPath("cam1/year_2026"))
+	assert.Equal(t, "/data/cameras/cam1/timelapse_year_2026.vtt", ThumbnailsDiskPath("cam1/year_2026"))
+	assert.Equal(t, "/data/cameras/cam1/timelapse_year_2026.sprite.jpg", SpriteWebPath("cam1/year_2026"))
+	assert.Equal(t, "/data/timelapse_week_2026-10-12.vtt", ThumbnailsWebPath("week_2026-10-12"))
+}
+
+func TestThumbnailFrames(t *testing.T) {
+	assert.Equal(t, []int{0, 1, 2}, thumbnailFrames(3), "short timelapses show every frame")
+
+	picks := thumbnailFrames(250)
+	require.Len(t, picks, maxThumbnails)
+	assert.Equal(t, 0, picks[0])
+	assert.Equal(t, 2, picks[1])
+	assert.Equal(t, 247, picks[99])
+}
+
+func TestThumbnailSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frame.jpg")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, image.NewGray(image.Rect(0, 0, 640, 480)), nil))
+	f.Close()
+
+	w, h := thumbnailSize(path)
+	assert.Equal(t, []int{160, 120}, []int{w, h})
+	w, h = thumbnailSize(filepath.Join(t.TempDir(), "missing.jpg"))
+	assert.Equal(t, []int{160, 90}, []int{w, h}, "unreadable frames are taken as 16:9")
+}
+
+func TestThumbnailsTrack(t *testing.T) {
+	assert.Equal(t, "01:02:03.500", vttTimestamp(3723.5))
+
+	vtt := thumbnailsTrack("/data/s.jpg", "sig", []int{0, 2}, 4, frameTiming{FPS: 30, HoldSec: 2}, 160, 90)
+	assert.Equal(t, "WEBVTT\n\nNOTE sig\n"+
+		"\n00:00:00.000 --> 00:00:00.067\n/data/s.jpg#xywh=0,0,160,90\n"+
+		"\n00:00:00.067 --> 00:00:02.133\n/data/s.jpg#xywh=160,0,160,90\n", vtt,
+		"the last thumbnail runs to the end of the held last frame")
+
+	picks := thumbnailFrames(250)
+	vtt = thumbnailsTrack("/data/s.jpg", "sig", picks, 250, frameTiming{FPS: 30}, 160, 120)
+	assert.Contains(t, vtt, "/data/s.jpg#xywh=1440,1080,160,120", "thumbnails are laid out in rows of ten")
+}
+
+func TestGenerateThumbnails(t *testing.T) {
+	setupHLSTest(t)
+	origEncode := encodeSprite
+	t.Cleanup(func() { encodeSprite = origEncode })
+	var tiles []int
+	encodeSprite = func(_ context.Context, _, concatListPath, outputPath string, n, _, _ int) error {
+		assert.Equal(t, n, concatListFrames(concatListPath))
+		tiles = append(tiles, n)
+		return os.WriteFile(outputPath, []byte("sprite"), 0644)
+	}
+
+	name := "cam1/24_hour_2026-10-16"
+	require.NoError(t, os.MkdirAll(config.CameraDataDir("cam1"), 0755))
+	dir := t.TempDir()
+	var frames []string
+	for i := 0; i < 3; i++ {
+		frame := filepath.Join(dir, fmt.Sprintf("2026-10-16-%02d-00-00.jpg", i))
+		require.NoError(t, os.WriteFile(frame, validSnapshotData(), 0644))
+		frames = append(frames, frame)
+	}
+
+	timing := frameTiming{FPS: 30}
+	require.NoError(t, generateThumbnails(t.Context(), name, frames, timing))
+	assert.FileExists(t, SpriteDiskPath(name))
+	data, err := os.ReadFile(ThumbnailsDiskPath(name))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "WEBVTT\n"))
+	assert.Equal(t, 3, strings.Count(string(data), SpriteWebPath(name)+"#xywh="))
+
+	require.NoError(t, generateThumbnails(t.Context(), name, frames, timing))
+	assert.Equal(t, []int{3}, tiles, "unchanged frames keep their thumbnails")
+
+	require.NoError(t, generateThumbnails(t.Context(), name, frames, frameTiming{FPS: 12}))
+	assert.Equal(t, []int{3, 3}, tiles, "a new frame rate re-times the track")
+
+	removeThumbnails(name)
+	assert.NoFileExists(t, SpriteDiskPath(name))
+	assert.NoFileExists(t, ThumbnailsDiskPath(name))
+}
+
+func TestCleanOldVideos_YearlyCountsTimelapses(t *testing.T) {
+	tempDir, cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, year := range []string{"2024", "2025", "2026"} {
+		for _, suffix := range []string{".webm", ".mp4", ".sprite.jpg", ".vtt"} {
+			os.WriteFile(filepath.Join(tempDir, "timelapse_year_"+year+suffix), []byte("x"), 0644)
+		}
+	}
+
+	CleanOldVideos()
+
+	remaining, _ := filepath.Glob(filepath.Join(tempDir, "timelapse_year_*"))
+	assert.Len(t, remaining, 8, "every file of the two newest yearly timelapses is kept")
+	assert.NoFileExists(t, filepath.Join(tempDir, "timelapse_year_2024.vtt"))
+	assert.FileExists(t, filepath.Join(tempDir, "timelapse_year_2025.sprite.jpg"))
+}
@@ -3,12 +3,15 @@ package video
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -28,6 +31,9 @@ import (
 var (
 	PreferredVideoCodec    string
 	onceDetectCapabilities sync.Once
+	// availableEncoders holds the video encoders ffmpeg reports, or nil if they
+	// could not be listed.
+	availableEncoders map[string]bool
 )
 
 // minValidSnapshotBytes is the minimum file size accepted as a valid JPEG snapshot.
@@ -35,8 +41,8 @@ var (
 const minValidSnapshotBytes int64 = 2048
 
 // defaultMaxBatchFrames caps the number of frames fed to a single FFmpeg invocation.
-// A large batch of corrupt-but-non-zero files can cause FFmpeg to OOM; this is the
-// safety net after the per-frame size filter.
+// A very large batch can cause FFmpeg to OOM, so decimateFrames samples longer
+// timelapses down to this budget.
 const defaultMaxBatchFrames = 5000
 
 // getFFmpegThreads returns the configured FFmpeg thread count.
@@ -59,7 +65,6 @@ func detectFFmpegCapabilities() {
 	onceDetectCapabilities.Do(func() {
 		log.Println("Detecting FFmpeg capabilities...")
 
-		// Check for libaom-av1
 		cmd := exec.Command("ffmpeg", "-hide_banner", "-encoders")
 		output, err := cmd.Output()
 		if err != nil {
@@ -67,12 +72,13 @@ func detectFFmpegCapabilities() {
 			PreferredVideoCodec = "libvpx-vp9"
 			return
 		}
+		availableEncoders = parseEncoderList(string(output))
 
 		// Check for libsvtav1, then libaom-av1
-		if strings.Contains(string(output), "libsvtav1") {
+		if availableEncoders["libsvtav1"] {
 			PreferredVideoCodec = "libsvtav1"
 			log.Println("Detected libsvtav1 encoder. Will use SVT-AV1 for timelapses.")
-		} else if strings.Contains(string(output), "libaom-av1") {
+		} else if availableEncoders["libaom-av1"] {
 			PreferredVideoCodec = "libaom-av1"
 			log.Println("Detected libaom-av1 encoder. Will use AOM-AV1 for timelapses.")
 		} else {
@@ -82,6 +88,32 @@ func detectFFmpegCapabilities() {
 	})
 }
 
+// parseEncoderList returns the video encoders in the output of ffmpeg -encoders:
+// the lines after the legend whose flags start with V.
+func parseEncoderList(output string) map[string]bool {
+	encoders := map[string]bool{}
+	listing := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 1 && strings.HasPrefix(fields[0], "---") {
+			listing = true
+			continue
+		}
+		if listing && len(fields) >= 2 && strings.HasPrefix(fields[0], "V") {
+			encoders[fields[1]] = true
+		}
+	}
+	return encoders
+}
+
+// encoderAvailable reports whether ffmpeg reports the encoder. When the
+// encoders could not be listed every encoder is assumed to be available, and
+// FFmpeg reports any that are not when it runs.
+func encoderAvailable(codec string) bool {
+	detectFFmpegCapabilities()
+	return availableEncoders == nil || availableEncoders[codec]
+}
+
 // computeBufSize doubles the numeric portion of a bitrate string (e.g. "2M" → "4M").
 func computeBufSize(maxBitrate string) string {
 	if len(maxBitrate) < 2 {
@@ -95,63 +127,72 @@ func computeBufSize(maxBitrate string) string {
 	return fmt.Sprintf("%d%s", n*2, suffix)
 }
 
-var createVideoSegment = func(imagePath, segmentPath string) error {
+// createVideoSegment encodes a single snapshot as a one-frame WebM segment for
+// appending to an existing timelapse, shown for the options' fixed frame rate
+// and with any overlay burnt in.
+var createVideoSegment = func(ctx context.Context, imagePath, segmentPath string, opts renderOptions) error {
 	// 1. Input Validation
 	info, err := os.Stat(imagePath)
 	if err != nil || info.Size() < minValidSnapshotBytes {
 		return fmt.Errorf("invalid snapshot file (below minimum size %d bytes): %s", minValidSnapshotBytes, imagePath)
 	}
 
-	log.Printf("Creating video segment for %s using codec %s with %d threads...", filepath.Base(imagePath), PreferredVideoCodec, getFFmpegThreads())
+	log.Printf("Creating video segment for %s using codec %s with %d threads...", filepath.Base(imagePath), opts.Encoder.Codec, getFFmpegThreads())
 
 	// 2. Process Control (Timeout)
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
-	videoFilter := "scale=out_color_matrix=bt709:out_range=tv,format=yuv420p"
-	maxBitrate := settings.Get("video.max_bitrate", "2M")
-	bufSize := computeBufSize(maxBitrate)
-	crf := settings.GetCRFForQuality(settings.Get("video.quality", "medium"))
-	var cmd *exec.Cmd
-	if PreferredVideoCodec == "libsvtav1" {
-		cmd = exec.CommandContext(ctx, "ffmpeg",
-			"-hide_banner",
-			"-loglevel", "error",
-			"-loop", "1",
-			"-i", imagePath,
-			"-t", "0.0333", // 1 frame at 30fps
-			"-vf", videoFilter,
-			"-c:v", PreferredVideoCodec,
-			"-preset", "10",
-			"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
-			"-g", "1", // Force Intra frame
-			"-keyint_min", "1",
-			"-crf", crf,
-			"-maxrate", maxBitrate,
-			"-bufsize", bufSize,
-			"-an",
-			"-f", "webm",
-			"-y", segmentPath,
-		)
-	} else {
-		cmd = exec.CommandContext(ctx, "ffmpeg",
-			"-hide_banner",
-			"-loglevel", "error",
-			"-loop", "1",
-			"-i", imagePath,
-			"-t", "0.0333",
-			"-vf", videoFilter,
-			"-c:v", PreferredVideoCodec,
-			"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
-			"-g", "1",
-			"-keyint_min", "1",
-			"-crf", crf,
-			"-maxrate", maxBitrate,
-			"-bufsize", bufSize,
-			"-an",
-			"-f", "webm",
-			"-y", segmentPath,
-		)
+	// The overlay text for a single frame is passed in a file beside the segment
+	// so it needs no escaping in the filter string. FFmpeg then runs in the
+	// segment's directory, so the other paths are made absolute.
+	overlay := opts.Overlay
+	var textFile string
+	if overlay != nil {
+		if abs, err := filepath.Abs(imagePath); err == nil {
+			imagePath = abs
+		}
+		if abs, err := filepath.Abs(segmentPath); err == nil {
+			segmentPath = abs
+		}
+		f, err := os.CreateTemp(filepath.Dir(segmentPath), "overlay_*.txt")
+		if err != nil {
+			return fmt.Errorf("failed to create overlay text file: %w", err)
+		}
+		_, err = f.WriteString(overlay.text(imagePath))
+		f.Close()
+		defer os.Remove(f.Name())
+		if err != nil {
+			return fmt.Errorf("failed to write overlay text file: %w", err)
+		}
+		textFile = filepath.Base(f.Name())
+	}
+
+	fps := opts.Timing.FPS
+	if fps < 1 {
+		fps = defaultFPS
+	}
+	frameDur := formatSeconds(1 / float64(fps))
+
+	// Every frame of a segment is a keyframe so segments concatenate cleanly.
+	enc := opts.Encoder
+	enc.GOP = 1
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-framerate", fmt.Sprintf("%d", fps),
+		"-loop", "1",
+		"-i", imagePath,
+		"-t", frameDur, // 1 frame
+		"-vf", withOverlay(overlay, textFile, enc.scaleFilter()),
+		"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
+	}
+	args = append(args, enc.args()...)
+	args = append(args, "-keyint_min", "1", "-an", "-f", "webm", "-y", segmentPath)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	if textFile != "" {
+		cmd.Dir = filepath.Dir(segmentPath)
 	}
 
 	// 3. Safe Logging
@@ -174,16 +215,21 @@ var createVideoSegment = func(imagePath, segmentPath string) error {
 
 // used .txt extension for concat list to some issues as ffprobes was doing weird things with frame counts
 
-var concatenateVideos = func(existingVideoPath, newSegmentPath, outputVideoPath string) error {
+var concatenateVideos = func(ctx context.Context, existingVideoPath, newSegmentPath, outputVideoPath string) error {
 	log.Printf("Concatenating %s and %s into %s...", filepath.Base(existingVideoPath), filepath.Base(newSegmentPath), filepath.Base(outputVideoPath))
 
-	concatListPath := "concat_list.txt" // Relative to DataDir
-	fullConcatListPath := filepath.Join(config.AppConfig.DataDir, concatListPath)
-	listFile, err := os.Create(fullConcatListPath)
+	// Segments and the output live next to the existing video (the camera's data
+	// directory), so FFmpeg runs there and the list uses bare filenames.
+	// Each call gets its own list, as jobs for other formats of the camera may be
+	// concatenating in the same directory at the same time.
+	workDir := filepath.Dir(outputVideoPath)
+	listFile, err := os.CreateTemp(workDir, "concat-*.txt")
 	if err != nil {
 		return fmt.Errorf("failed to create concat list: %w", err)
 	}
-	defer os.Remove(fullConcatListPath) // Clean up list file
+	fullConcatListPath := listFile.Name()
+	concatListPath := filepath.Base(fullConcatListPath) // Relative to workDir
+	defer os.Remove(fullConcatListPath)                 // Clean up list file
 
 	// Using ToSlash for cross-platform compatibility in the list file.
 	_, err = listFile.WriteString(fmt.Sprintf("file '%s'\n", filepath.ToSlash(filepath.Base(existingVideoPath))))
@@ -202,15 +248,19 @@ var concatenateVideos = func(existingVideoPath, newSegmentPath, outputVideoPath
 
 	// Use stream copy (-c copy) for concatenation. This is extremely fast and avoids re-encoding.
 	// It requires that all segments are perfectly compatible, which our createVideoSegment function now ensures.
-	cmd := exec.Command("ffmpeg",
+	args := []string{
 		"-f", "concat",
 		"-safe", "0",
 		"-i", concatListPath,
 		"-c", "copy", // Stream copy, not re-encode
 		"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
-		"-y", tempOutput,
-	)
-	cmd.Dir = config.AppConfig.DataDir
+	}
+	if strings.HasSuffix(outputVideoPath, ".mp4") {
+		args = append(args, "-movflags", fragmentedMovflags)
+	}
+	args = append(args, "-y", tempOutput)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Dir = workDir
 
 	var outputBuf bytes.Buffer
 	cmd.Stdout = &outputBuf
@@ -227,14 +277,28 @@ var concatenateVideos = func(existingVideoPath, newSegmentPath, outputVideoPath
 	return nil
 }
 
-// readLastAppendedSnapshot returns the last snapshot path recorded for a timelapse.
-var readLastAppendedSnapshot = func(timelapseName string) (string, error) {
-	return database.GetTimelapseTracker(timelapseName)
+// readLastAppendedSnapshot returns the last snapshot path recorded for a
+// timelapse's video in format.
+var readLastAppendedSnapshot = func(timelapseName, format string) (string, error) {
+	return database.GetTimelapseTracker(timelapseName, format)
+}
+
+// writeLastAppendedSnapshot records the last snapshot appended to a
+// timelapse's video in format.
+var writeLastAppendedSnapshot = func(timelapseName, format, snapshotPath string) error {
+	return database.SetTimelapseTracker(timelapseName, format, snapshotPath)
 }
 
-// writeLastAppendedSnapshot records the last snapshot appended to a timelapse.
-var writeLastAppendedSnapshot = func(timelapseName, snapshotPath string) error {
-	return database.SetTimelapseTracker(timelapseName, snapshotPath)
+// readRenderParams returns the render params a timelapse's video in format was
+// last built with.
+var readRenderParams = func(timelapseName, format string) (string, error) {
+	return database.GetTimelapseParams(timelapseName, format)
+}
+
+// writeRenderParams records the render params a timelapse's video in format
+// was built with.
+var writeRenderParams = func(timelapseName, format, params string) error {
+	return database.SetTimelapseParams(timelapseName, format, params)
 }
 
 // --- VIDEO GENERATION AND CLEANUP IMPLEMENTATION ---
@@ -256,25 +320,72 @@ func calendarWeekMonday(t time.Time) time.Time {
 	return t.AddDate(0, 0, -(weekday - 1)).Truncate(24 * time.Hour)
 }
 
+// EnqueueTimelapseJobs queues daily, weekly, monthly and yearly timelapse jobs for
+// every enabled camera, followed by the shared cleanup jobs.
 func EnqueueTimelapseJobs() {
 	log.Println("Enqueuing timelapse generation jobs...")
+	for _, cameraID := range util.ActiveCameraIDs() {
+		enqueueCameraTimelapseJobs(cameraID)
+	}
+
+	for _, jobType := range []string{"cleanup_snapshots", "cleanup_videos", "cleanup_logs", "cleanup_gallery", "cleanup_jobs"} {
+		if _, err := jobs.CreateJob(jobType, nil, jobs.PriorityNormal); err != nil {
+			log.Printf("Error enqueuing %s job: %v", jobType, err)
+		}
+	}
+}
+
+// enqueueCameraTimelapseJobs queues the timelapse jobs for one camera. Job payloads
+// carry camera-scoped names ("<cameraID>/<name>") so each camera has its own trackers.
+// Daily clips run first and the long year-to-date encode last, so it does not
+// hold up the lapses that change most often.
+func enqueueCameraTimelapseJobs(cameraID string) {
 	now := time.Now()
 
 	// Daily 24-hour timelapses
 	for i := 0; i < settings.GetInt("video.daily_days", 30); i++ {
 		targetDate := now.AddDate(0, 0, -i)
-		timelapseName := fmt.Sprintf("24_hour_%s", targetDate.Format("2006-01-02"))
-		if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": timelapseName}); err != nil {
+		timelapseName := util.ScopedName(cameraID, fmt.Sprintf("24_hour_%s", targetDate.Format("2006-01-02")))
+		if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": timelapseName}, jobs.PriorityHigh); err != nil {
 			log.Printf("Error enqueuing job for daily timelapse %s: %v", timelapseName, err)
 		}
 	}
 
+	// Capture-window clips: one per enabled window and day it ran
+	if windows, err := database.GetEnabledCaptureWindows(); err != nil {
+		log.Printf("Error loading capture windows: %v", err)
+	} else {
+		for _, w := range windows {
+			for i := 0; i < settings.GetInt("video.daily_days", 30); i++ {
+				targetDate := now.AddDate(0, 0, -i)
+				if start, _, ok := util.CaptureWindowRange(w, targetDate); !ok || start.After(now) {
+					continue
+				}
+				timelapseName := util.ScopedName(cameraID, windowTimelapseName(w.Name, targetDate))
+				if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": timelapseName}, jobs.PriorityHigh); err != nil {
+					log.Printf("Error enqueuing job for capture window timelapse %s: %v", timelapseName, err)
+				}
+			}
+		}
+	}
+
+	// Activity timelapses: one per day, built from event frames only
+	if settings.Get("video.activity_timelapse", "false") == "true" {
+		for i := 0; i < settings.GetInt("video.daily_days", 30); i++ {
+			targetDate := now.AddDate(0, 0, -i)
+			timelapseName := util.ScopedName(cameraID, fmt.Sprintf("activity_%s", targetDate.Format("2006-01-02")))
+			if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": timelapseName}, jobs.PriorityHigh); err != nil {
+				log.Printf("Error enqueuing job for activity timelapse %s: %v", timelapseName, err)
+			}
+		}
+	}
+
 	// Calendar-week timelapses: last WeeklyKeep Mondays
 	currentMonday := calendarWeekMonday(now)
 	for i := 0; i < settings.GetInt("video.weekly_keep", 4); i++ {
 		monday := currentMonday.AddDate(0, 0, -7*i)
-		timelapseName := fmt.Sprintf("week_%s", monday.Format("2006-01-02"))
-		if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": timelapseName}); err != nil {
+		timelapseName := util.ScopedName(cameraID, fmt.Sprintf("week_%s", monday.Format("2006-01-02")))
+		if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": timelapseName}, jobs.PriorityNormal); err != nil {
 			log.Printf("Error enqueuing job for weekly timelapse %s: %v", timelapseName, err)
 		}
 	}
@@ -282,32 +393,59 @@ func EnqueueTimelapseJobs() {
 	// Calendar-month timelapses: last MonthlyKeep months
 	for i := 0; i < settings.GetInt("video.monthly_keep", 3); i++ {
 		monthStart := time.Date(now.Year(), now.Month()-time.Month(i), 1, 0, 0, 0, 0, now.Location())
-		timelapseName := fmt.Sprintf("month_%s", monthStart.Format("2006-01"))
-		if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": timelapseName}); err != nil {
+		timelapseName := util.ScopedName(cameraID, fmt.Sprintf("month_%s", monthStart.Format("2006-01")))
+		if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": timelapseName}, jobs.PriorityNormal); err != nil {
 			log.Printf("Error enqueuing job for monthly timelapse %s: %v", timelapseName, err)
 		}
 	}
 
 	// Year-to-date timelapse
-	yearName := fmt.Sprintf("year_%d", now.Year())
-	if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": yearName}); err != nil {
+	yearName := util.ScopedName(cameraID, fmt.Sprintf("year_%d", now.Year()))
+	if _, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": yearName}, jobs.PriorityLow); err != nil {
 		log.Printf("Error enqueuing job for yearly timelapse %s: %v", yearName, err)
 	}
+}
 
-	for _, jobType := range []string{"cleanup_snapshots", "cleanup_videos", "cleanup_logs", "cleanup_gallery"} {
-		if _, err := jobs.CreateJob(jobType, nil); err != nil {
-			log.Printf("Error enqueuing %s job: %v", jobType, err)
-		}
+// Result summarises a timelapse generation for its job record.
+type Result struct {
+	Frames    int // frames in the timelapse
+	Available int // frames that matched the timelapse before decimation
+}
+
+// String describes the result, e.g. "sampled 5000 of 8760 frames".
+func (r Result) String() string {
+	if r.Frames < r.Available {
+		return fmt.Sprintf("sampled %d of %d frames", r.Frames, r.Available)
 	}
+	return fmt.Sprintf("%d frames", r.Frames)
 }
 
-var GenerateSingleTimelapse = func(timelapseName string) error {
+// GenerateSingleTimelapse builds or updates one timelapse. timelapseName may be
+// camera-scoped ("<cameraID>/<name>"); the scoped form is used as the tracker key
+// and selects the camera's snapshot, gallery and output directories. Cancelling
+// ctx kills any FFmpeg process it is running and returns ctx's error once the
+// encode's temporary files are removed.
+var GenerateSingleTimelapse = func(ctx context.Context, timelapseName string) (Result, error) {
+	var result Result
+	err := generateTimelapse(ctx, timelapseName, &result)
+	return result, err
+}
+
+// generateTimelapse does the work of GenerateSingleTimelapse, filling in result
+// once the timelapse's frames are known.
+func generateTimelapse(ctx context.Context, timelapseName string, result *Result) error {
 	log.Printf("--- Processing timelapse: %s ---", timelapseName)
 	detectFFmpegCapabilities()
 
 	var cfg models.TimelapseConfig
 	var targetDate = time.Now()
-	var useGallery bool
+	var useGallery, useEvents bool
+
+	cameraID, baseName := util.SplitScopedName(timelapseName)
+	if cameraID != "" && !config.ValidCameraID(cameraID) {
+		return fmt.Errorf("invalid camera ID in timelapse name %s", timelapseName)
+	}
+	timelapseName = baseName
 
 	switch {
 	case strings.HasPrefix(timelapseName, "24_hour_"):
@@ -323,6 +461,47 @@ var GenerateSingleTimelapse = func(timelapseName string) error {
 			FramePattern: "all",
 		}
 
+	case strings.HasPrefix(timelapseName, "window_"):
+		// One capture window's run on one day, every frame in its time range
+		windowName, day, err := parseWindowTimelapseName(timelapseName)
+		if err != nil {
+			return err
+		}
+		w, err := database.GetCaptureWindow(windowName)
+		if err != nil {
+			return fmt.Errorf("error loading capture window for %s: %w", timelapseName, err)
+		}
+		if w == nil {
+			log.Printf("Skipping %s: capture window %q no longer exists.", timelapseName, windowName)
+			return nil
+		}
+		start, end, ok := util.CaptureWindowRange(*w, time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, time.Local))
+		if !ok {
+			log.Printf("Skipping %s: capture window %q did not run that day.", timelapseName, windowName)
+			return nil
+		}
+		cfg = models.TimelapseConfig{
+			Name:         timelapseName,
+			FramePattern: "all",
+			WindowStart:  fileClock(start),
+			WindowEnd:    fileClock(end),
+		}
+
+	case strings.HasPrefix(timelapseName, "activity_"):
+		// One day of event frames, every frame
+		dateStr := strings.TrimPrefix(timelapseName, "activity_")
+		day, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return fmt.Errorf("invalid date format in timelapse name %s: %w", timelapseName, err)
+		}
+		cfg = models.TimelapseConfig{
+			Name:         timelapseName,
+			FramePattern: "all",
+			WindowStart:  day,
+			WindowEnd:    day.AddDate(0, 0, 1),
+		}
+		useEvents = true
+
 	case strings.HasPrefix(timelapseName, "week_"):
 		// Calendar week: Monday to Sunday, fixed window, sourced from gallery
 		dateStr := strings.TrimPrefix(timelapseName, "week_")
@@ -395,22 +574,24 @@ var GenerateSingleTimelapse = func(timelapseName string) error {
 	default:
 		return fmt.Errorf("no timelapse configuration found for name: %s", timelapseName)
 	}
+	cfg.CameraID = cameraID
+	trackerKey := util.ScopedName(cfg.CameraID, cfg.Name)
 
+	// Only the window's files are loaded from the snapshot index. A day's margin
+	// either side covers file times that filterSnapshots compares as wall-clock
+	// values; it applies the exact window.
+	windowStart, windowEnd := timelapseWindow(cfg, targetDate)
 	var allFiles []string
-	if useGallery {
-		allFiles = util.GetGalleryFiles()
+	if useEvents {
+		allFiles = util.GetEventFiles(cfg.CameraID, "", windowStart.Add(-24*time.Hour), windowEnd.Add(24*time.Hour))
 	} else {
-		allFiles = util.GetSnapshotFiles()
+		allFiles = util.GetIndexedFiles(cfg.CameraID, useGallery, windowStart.Add(-24*time.Hour), windowEnd.Add(24*time.Hour))
 	}
 	if len(allFiles) == 0 {
 		log.Println("No source files available to generate timelapse.")
 		return nil
 	}
 
-	format := settings.Get("video.format", "webm")
-	finalVideoPath := DiskPath(cfg.Name, format)
-	outputFileName := fmt.Sprintf("timelapse_%s.webm", cfg.Name) // used for webm path only
-
 	snapshotsForTimelapse := filterSnapshots(allFiles, cfg, targetDate)
 
 	if len(snapshotsForTimelapse) == 0 {
@@ -418,7 +599,67 @@ var GenerateSingleTimelapse = func(timelapseName string) error {
 		return nil
 	}
 
-	lastAppendedSnapshotPath, err := readLastAppendedSnapshot(cfg.Name)
+	// Keep one FFmpeg batch to the frame budget by sampling evenly across the
+	// whole window rather than dropping the oldest frames.
+	result.Available = len(snapshotsForTimelapse)
+	maxFrames := settings.GetInt("video.max_batch_frames", defaultMaxBatchFrames)
+	snapshotsForTimelapse = decimateFrames(snapshotsForTimelapse, maxFrames, windowStart, windowEnd, cfg.FramePattern)
+	result.Frames = len(snapshotsForTimelapse)
+	if result.Frames < result.Available {
+		log.Printf("%s has %d frames, over the %d frame budget; sampled %d evenly across the window.", cfg.Name, result.Available, maxFrames, result.Frames)
+	}
+
+	// Each format is built and tracked on its own, so one failing does not hold
+	// the others back. Formats no longer selected are removed once all of the
+	// selected ones are up to date.
+	formats := formatsFor(trackerKey)
+	var errs []error
+	for _, format := range formats {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := generateFormat(ctx, cfg, trackerKey, format, snapshotsForTimelapse, result.Frames < result.Available); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	cleanOtherFormats(trackerKey, formats)
+
+	// Seek thumbnails and animated previews are niceties: failing to build them
+	// does not fail the job.
+	if settings.Get("video.thumbnails", "true") == "true" {
+		if err := generateThumbnails(ctx, trackerKey, snapshotsForTimelapse, timingFor(trackerKey)); err != nil {
+			log.Printf("ERROR generating seek thumbnails for %s: %v", cfg.Name, err)
+		}
+	} else {
+		removeThumbnails(trackerKey)
+	}
+	if settings.Get("video.previews", "true") == "true" {
+		if err := generatePreviews(ctx, trackerKey, snapshotsForTimelapse); err != nil {
+			log.Printf("ERROR generating animated preview for %s: %v", cfg.Name, err)
+		}
+	} else {
+		removePreviews(trackerKey)
+	}
+	return ctx.Err()
+}
+
+// generateFormat builds or updates the (camera-scoped) trackerKey timelapse's
+// video in format from snapshotsForTimelapse, appending new frames where the
+// format allows and otherwise encoding it in full. sampled reports that the
+// frames were decimated to the frame budget, which can change the frames
+// already in the video, so it is always encoded in full.
+func generateFormat(ctx context.Context, cfg models.TimelapseConfig, trackerKey, format string, snapshotsForTimelapse []string, sampled bool) error {
+	finalVideoPath := DiskPath(trackerKey, format)
+	webmOutputPath := DiskPath(trackerKey, "webm") // used for webm path only
+	cameraDataDir := config.CameraDataDir(cfg.CameraID)
+
+	lastAppendedSnapshotPath, err := readLastAppendedSnapshot(trackerKey, format)
 	if err != nil {
 		log.Printf("ERROR reading last appended snapshot for %s: %v. Forcing full regeneration.", cfg.Name, err)
 		lastAppendedSnapshotPath = ""
@@ -434,7 +675,22 @@ var GenerateSingleTimelapse = func(timelapseName string) error {
 		}
 	}
 
-	needsFullRegen := !util.FileExists(finalVideoPath) || util.IsFileEmpty(finalVideoPath) || startIndex == 0
+	// Frames encoded with other settings cannot be joined to the video, and a
+	// settings change should show without waiting for new frames. Videos built
+	// before params were recorded are assumed to match.
+	opts := renderOptionsFor(trackerKey, format)
+	builtParams, err := readRenderParams(trackerKey, format)
+	if err != nil {
+		log.Printf("ERROR reading render params for %s: %v", cfg.Name, err)
+	}
+	paramsChanged := builtParams != "" && builtParams != opts.params()
+	recordParams := func() {
+		if err := writeRenderParams(trackerKey, format, opts.params()); err != nil {
+			log.Printf("ERROR writing render params for %s: %v", cfg.Name, err)
+		}
+	}
+
+	needsFullRegen := !util.FileExists(finalVideoPath) || util.IsFileEmpty(finalVideoPath) || startIndex == 0 || paramsChanged || sampled
 
 	if needsFullRegen {
 		switch {
@@ -442,31 +698,57 @@ var GenerateSingleTimelapse = func(timelapseName string) error {
 			log.Printf("Full regeneration for %s (%s): video file missing.", cfg.Name, format)
 		case util.IsFileEmpty(finalVideoPath):
 			log.Printf("Full regeneration for %s (%s): video file is empty.", cfg.Name, format)
+		case paramsChanged:
+			log.Printf("Full regeneration for %s (%s): encoding settings changed.", cfg.Name, format)
+		case sampled:
+			log.Printf("Full regeneration for %s (%s): frames sampled to fit the frame budget.", cfg.Name, format)
 		default:
 			log.Printf("Full regeneration for %s (%s): tracker reset.", cfg.Name, format)
 		}
 
-		if err := dispatchFullRegen(cfg.Name, format, snapshotsForTimelapse, outputFileName); err != nil {
+		if err := dispatchFullRegen(ctx, trackerKey, format, snapshotsForTimelapse, webmOutputPath, opts); err != nil {
 			return fmt.Errorf("error generating %s timelapse: %w", cfg.Name, err)
 		}
-		cleanOtherFormats(cfg.Name, format)
 		log.Printf("✅ Generated %s timelapse (%s).", cfg.Name, format)
 		if len(snapshotsForTimelapse) > 0 {
-			if err := writeLastAppendedSnapshot(cfg.Name, snapshotsForTimelapse[len(snapshotsForTimelapse)-1]); err != nil {
+			if err := writeLastAppendedSnapshot(trackerKey, format, snapshotsForTimelapse[len(snapshotsForTimelapse)-1]); err != nil {
 				log.Printf("ERROR writing last appended snapshot for %s: %v", cfg.Name, err)
 			}
 		}
 	} else if startIndex < len(snapshotsForTimelapse) {
-		if format != "webm" {
-			// MP4/HLS don't support incremental append; do a full regen.
+		if opts.Timing.appendable() && (format == "hls" || format == "mp4" && opts.Fragmented) {
+			log.Printf("Incremental update for %s (%s): %d new frame(s).", cfg.Name, format, len(snapshotsForTimelapse)-startIndex)
+			var appendErr error
+			if format == "hls" {
+				appendErr = appendHLS(ctx, trackerKey, snapshotsForTimelapse, opts)
+			} else {
+				appendErr = appendMP4(ctx, trackerKey, snapshotsForTimelapse[startIndex:], opts)
+			}
+			if appendErr == nil {
+				if err := writeLastAppendedSnapshot(trackerKey, format, snapshotsForTimelapse[len(snapshotsForTimelapse)-1]); err != nil {
+					log.Printf("ERROR writing last appended snapshot for %s: %v", cfg.Name, err)
+				}
+				recordParams()
+				log.Printf("✅ Appended %d frame(s) to %s.", len(snapshotsForTimelapse)-startIndex, cfg.Name)
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Could not append to %s (%s): %v. Regenerating in full.", cfg.Name, format, appendErr)
+		}
+		if format != "webm" || !opts.Timing.appendable() {
+			// Fast-start MP4s can't be appended to, HLS and fragmented MP4s land
+			// here when appending failed, and a target duration or held last
+			// frame re-times existing frames; do a full regen.
 			log.Printf("Full regeneration for %s (%s): %d new frame(s).", cfg.Name, format, len(snapshotsForTimelapse)-startIndex)
-			if err := dispatchFullRegen(cfg.Name, format, snapshotsForTimelapse, outputFileName); err != nil {
+			if err := dispatchFullRegen(ctx, trackerKey, format, snapshotsForTimelapse, webmOutputPath, opts); err != nil {
 				return fmt.Errorf("error regenerating %s timelapse: %w", cfg.Name, err)
 			}
-			cleanOtherFormats(cfg.Name, format)
-			if err := writeLastAppendedSnapshot(cfg.Name, snapshotsForTimelapse[len(snapshotsForTimelapse)-1]); err != nil {
+			if err := writeLastAppendedSnapshot(trackerKey, format, snapshotsForTimelapse[len(snapshotsForTimelapse)-1]); err != nil {
 				log.Printf("ERROR writing last appended snapshot for %s: %v", cfg.Name, err)
 			}
+			recordParams()
 			return nil
 		}
 
@@ -476,29 +758,32 @@ var GenerateSingleTimelapse = func(timelapseName string) error {
 
 		for i, newSnapshot := range newSnapshotsToAppend {
 			log.Printf("Appending snapshot %d/%d: %s", i+1, len(newSnapshotsToAppend), filepath.Base(newSnapshot))
-			tempSegmentPath := filepath.Join(config.AppConfig.DataDir, fmt.Sprintf("temp_segment_%s_%d.webm", cfg.Name, i))
-			tempConcatenatedVideoPath := filepath.Join(config.AppConfig.DataDir, fmt.Sprintf("temp_concat_video_%s_%d.webm", cfg.Name, i))
-
-			err := createVideoSegment(newSnapshot, tempSegmentPath)
+			tempSegmentPath := filepath.Join(cameraDataDir, fmt.Sprintf("temp_segment_%s_%d.webm", cfg.Name, i))
+			tempConcatenatedVideoPath := filepath.Join(cameraDataDir, fmt.Sprintf("temp_concat_video_%s_%d.webm", cfg.Name, i))
+
+			err := createVideoSegment(ctx, newSnapshot, tempSegmentPath, opts)
+			if err != nil && ctx.Err() != nil {
+				// Cancelled: the frame is fine, it just was not encoded.
+				os.Remove(tempSegmentPath)
+				return ctx.Err()
+			}
 			if err != nil {
 				log.Printf("ERROR creating segment for %s: %v. Moving to quarantine.", newSnapshot, err)
-
-				quarantineDir := filepath.Join(config.AppConfig.DataDir, "quarantine")
-				if err := os.MkdirAll(quarantineDir, 0755); err != nil {
-					log.Printf("ERROR creating quarantine directory %s: %v", quarantineDir, err)
-				}
-
-				quarantinedFile := filepath.Join(quarantineDir, filepath.Base(newSnapshot))
-				log.Printf("Moving corrupted snapshot from %s to %s", newSnapshot, quarantinedFile)
-				if err := os.Rename(newSnapshot, quarantinedFile); err != nil {
-					log.Printf("ERROR moving corrupted snapshot %s to %s: %v", newSnapshot, quarantinedFile, err)
+				if quarantinedFile, qErr := util.QuarantineFile(cfg.CameraID, newSnapshot, fmt.Sprintf("segment encoding failed: %v", err)); qErr != nil {
+					log.Printf("ERROR quarantining corrupted snapshot %s: %v", newSnapshot, qErr)
+				} else {
+					log.Printf("Moved corrupted snapshot from %s to %s", newSnapshot, quarantinedFile)
+					if err := database.DeleteSnapshotRecords(newSnapshot); err != nil {
+						log.Printf("ERROR removing %s from the snapshot index: %v", newSnapshot, err)
+					}
 				}
 				continue
 			}
 
-			err = concatenateVideos(finalVideoPath, tempSegmentPath, tempConcatenatedVideoPath)
+			err = concatenateVideos(ctx, finalVideoPath, tempSegmentPath, tempConcatenatedVideoPath)
 			os.Remove(tempSegmentPath)
 			if err != nil {
+				os.Remove(tempConcatenatedVideoPath)
 				return fmt.Errorf("error concatenating for %s: %w", finalVideoPath, err)
 			}
 
@@ -508,7 +793,7 @@ var GenerateSingleTimelapse = func(timelapseName string) error {
 			time.Sleep(100 * time.Millisecond)
 			log.Printf("✅ Appended %s to %s.", filepath.Base(newSnapshot), cfg.Name)
 
-			if err := writeLastAppendedSnapshot(cfg.Name, newSnapshot); err != nil {
+			if err := writeLastAppendedSnapshot(trackerKey, format, newSnapshot); err != nil {
 				log.Printf("ERROR writing last appended snapshot for %s: %v", cfg.Name, err)
 			}
 		}
@@ -516,36 +801,49 @@ var GenerateSingleTimelapse = func(timelapseName string) error {
 		log.Printf("No new snapshots to append for %s timelapse.", cfg.Name)
 	}
 
+	recordParams()
 	return nil
 }
 
 // DiskPath returns the absolute filesystem path to the primary video artifact
-// for the given timelapse name and format.
+// for the given (optionally camera-scoped) timelapse name and format.
 func DiskPath(name, format string) string {
+	cameraID, base := util.SplitScopedName(name)
+	dir := config.CameraDataDir(cameraID)
 	switch format {
 	case "hls":
-		return filepath.Join(config.AppConfig.DataDir, "hls", "timelapse_"+name, "master.m3u8")
+		return filepath.Join(hlsOutputDir(name), "master.m3u8")
 	case "mp4":
-		return filepath.Join(config.AppConfig.DataDir, fmt.Sprintf("timelapse_%s.mp4", name))
+		return filepath.Join(dir, fmt.Sprintf("timelapse_%s.mp4", base))
 	default: // webm
-		return filepath.Join(config.AppConfig.DataDir, fmt.Sprintf("timelapse_%s.webm", name))
+		return filepath.Join(dir, fmt.Sprintf("timelapse_%s.webm", base))
 	}
 }
 
+// hlsOutputDir returns the directory holding the HLS master playlist and renditions
+// for the given (optionally camera-scoped) timelapse name.
+func hlsOutputDir(name string) string {
+	cameraID, base := util.SplitScopedName(name)
+	return filepath.Join(config.CameraDataDir(cameraID), "hls", "timelapse_"+base)
+}
+
 // TimelapseWebPath returns the URL path (/data/...) for the timelapse video.
 func TimelapseWebPath(name, format string) string {
+	cameraID, base := util.SplitScopedName(name)
+	prefix := util.CameraWebPrefix(cameraID)
 	switch format {
 	case "hls":
-		return "/data/hls/timelapse_" + name + "/master.m3u8"
+		return prefix + "hls/timelapse_" + base + "/master.m3u8"
 	case "mp4":
-		return fmt.Sprintf("/data/timelapse_%s.mp4", name)
+		return fmt.Sprintf("%stimelapse_%s.mp4", prefix, base)
 	default:
-		return fmt.Sprintf("/data/timelapse_%s.webm", name)
+		return fmt.Sprintf("%stimelapse_%s.webm", prefix, base)
 	}
 }
 
-// buildConcatList writes a validated ffconcat list to a temp file and returns its path.
-func buildConcatList(name string, snapshots []string) (string, error) {
+// validSnapshots returns the snapshots that exist and are large enough to be
+// valid JPEGs.
+func validSnapshots(snapshots []string) []string {
 	var valid []string
 	for _, s := range snapshots {
 		info, err := os.Stat(s)
@@ -553,72 +851,78 @@ func buildConcatList(name string, snapshots []string) (string, error) {
 			valid = append(valid, s)
 		}
 	}
+	return valid
+}
+
+// buildConcatList writes a validated ffconcat list to a temp file and returns its path.
+func buildConcatList(name string, snapshots []string, opts renderOptions) (string, error) {
+	valid := validSnapshots(snapshots)
 	if len(valid) == 0 {
 		return "", fmt.Errorf("no valid snapshots for concat list")
 	}
-	path := filepath.Join(config.AppConfig.DataDir, fmt.Sprintf("hls_concat_%s.txt", name))
-	f, err := os.Create(path)
-	if err != nil {
+	cameraID, base := util.SplitScopedName(name)
+	path := filepath.Join(config.CameraDataDir(cameraID), fmt.Sprintf("hls_concat_%s.txt", base))
+	if err := writeConcatList(path, valid, opts); err != nil {
 		return "", err
 	}
-	fmt.Fprintln(f, "ffconcat version 1.0")
-	for _, s := range valid {
-		fmt.Fprintf(f, "file '%s'\nduration 0.0333\n", filepath.ToSlash(s))
-	}
-	// ffconcat requires the last entry repeated without duration
-	fmt.Fprintf(f, "file '%s'\n", filepath.ToSlash(valid[len(valid)-1]))
-	f.Close()
 	return path, nil
 }
 
 // dispatchFullRegen runs the appropriate generator for the configured format.
-func dispatchFullRegen(name, format string, snapshots []string, webmOutputFileName string) error {
+func dispatchFullRegen(ctx context.Context, name, format string, snapshots []string, webmOutputPath string, opts renderOptions) error {
 	switch format {
 	case "hls":
-		concatPath, err := buildConcatList(name, snapshots)
+		concatPath, err := buildConcatList(name, snapshots, opts)
 		if err != nil {
 			return err
 		}
 		defer os.Remove(concatPath)
-		return generateHLS(name, concatPath, parseHLSQualities(settings.Get("video.hls_qualities", "source,720p")))
+		return generateHLS(ctx, name, concatPath, opts)
 	case "mp4":
-		concatPath, err := buildConcatList(name, snapshots)
+		concatPath, err := buildConcatList(name, snapshots, opts)
 		if err != nil {
 			return err
 		}
 		defer os.Remove(concatPath)
-		return generateMP4(name, concatPath)
+		return generateMP4(ctx, name, concatPath, opts)
 	default: // webm
-		return regenerateFullTimelapse(snapshots, webmOutputFileName, false)
+		return regenerateFullTimelapse(ctx, name, snapshots, webmOutputPath, false, opts)
 	}
 }
 
-// cleanOtherFormats removes video artifacts in all formats except currentFormat.
-func cleanOtherFormats(name, currentFormat string) {
-	for _, fmt := range []string{"webm", "mp4", "hls"} {
-		if fmt == currentFormat {
+// cleanOtherFormats removes video artifacts, and their trackers, in all
+// formats except those in keep.
+func cleanOtherFormats(name string, keep []string) {
+	for _, format := range outputFormats {
+		if slices.Contains(keep, format) {
 			continue
 		}
-		if fmt == "hls" {
-			hlsDir := filepath.Join(config.AppConfig.DataDir, "hls", "timelapse_"+name)
-			if err := os.RemoveAll(hlsDir); err == nil {
-				log.Printf("Removed old HLS directory for %s", name)
+		if format == "hls" {
+			if util.FileExists(hlsOutputDir(name)) {
+				if err := os.RemoveAll(hlsOutputDir(name)); err == nil {
+					log.Printf("Removed old HLS directory for %s", name)
+				}
 			}
 		} else {
-			path := DiskPath(name, fmt)
+			path := DiskPath(name, format)
 			if util.FileExists(path) {
 				if err := os.Remove(path); err == nil {
-					log.Printf("Removed old %s artifact for %s", fmt, name)
+					log.Printf("Removed old %s artifact for %s", format, name)
 				}
 			}
 		}
+		if err := database.DeleteTimelapseTrackers(name, format); err != nil {
+			log.Printf("ERROR removing %s tracker for %s: %v", format, name, err)
+		}
 	}
 }
 
 // parseFileTime parses a timestamp from a snapshot or gallery filename basename.
-// Supports YYYY-MM-DD-HH-MM-SS (snapshot) and YYYY-MM-DD-HH (gallery) formats.
+// Supports YYYY-MM-DD-HH-MM-SS (snapshot) and YYYY-MM-DD-HH (gallery) formats;
+// the tags following an event frame's time stamp are ignored.
 func parseFileTime(filename string) (time.Time, error) {
 	base := strings.TrimSuffix(filepath.Base(filename), ".jpg")
+	base, _, _ = strings.Cut(base, "_")
 	parts := strings.Split(base, "-")
 	switch len(parts) {
 	case 6:
@@ -630,6 +934,26 @@ func parseFileTime(filename string) (time.Time, error) {
 	}
 }
 
+// windowTimelapseName returns the timelapse name of capture window windowName's
+// run on day: "window_<YYYY-MM-DD>_<name>". The date comes first so retention
+// can read it at a fixed offset, as for daily timelapses.
+func windowTimelapseName(windowName string, day time.Time) string {
+	return fmt.Sprintf("window_%s_%s", day.Format("2006-01-02"), windowName)
+}
+
+// parseWindowTimelapseName is the inverse of windowTimelapseName.
+func parseWindowTimelapseName(name string) (windowName string, day time.Time, err error) {
+	rest := strings.TrimPrefix(name, "window_")
+	if len(rest) < 12 || rest[10] != '_' {
+		return "", time.Time{}, fmt.Errorf("invalid capture window timelapse name %s", name)
+	}
+	day, err = time.Parse("2006-01-02", rest[:10])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid date format in timelapse name %s: %w", name, err)
+	}
+	return rest[11:], day, nil
+}
+
 // pickClosestToHour returns the file from files whose hour is closest to targetHour.
 func pickClosestToHour(files []string, targetHour int) string {
 	best := files[0]
@@ -651,21 +975,23 @@ func pickClosestToHour(files []string, targetHour int) string {
 	return best
 }
 
+// timelapseWindow returns the [start, end) capture window of a timelapse: fixed
+// (calendar) when cfg has one, otherwise rolling back from targetTime.
+func timelapseWindow(cfg models.TimelapseConfig, targetTime time.Time) (time.Time, time.Time) {
+	if !cfg.WindowStart.IsZero() {
+		return cfg.WindowStart, cfg.WindowEnd
+	}
+	if strings.HasPrefix(cfg.Name, "24_hour_") {
+		start := targetTime.Truncate(24 * time.Hour)
+		return start, start.Add(24 * time.Hour)
+	}
+	return targetTime.Add(-cfg.Duration), targetTime
+}
+
 var filterSnapshots = func(allFiles []string, cfg models.TimelapseConfig, targetTime time.Time) []string {
 	var filtered []string
 
-	// Determine window: fixed (calendar) or rolling (legacy/24-hour)
-	var windowStart, windowEnd time.Time
-	if !cfg.WindowStart.IsZero() {
-		windowStart = cfg.WindowStart
-		windowEnd = cfg.WindowEnd
-	} else if strings.HasPrefix(cfg.Name, "24_hour_") {
-		windowStart = targetTime.Truncate(24 * time.Hour)
-		windowEnd = windowStart.Add(24 * time.Hour)
-	} else {
-		windowStart = targetTime.Add(-cfg.Duration)
-		windowEnd = targetTime
-	}
+	windowStart, windowEnd := timelapseWindow(cfg, targetTime)
 
 	// Filter to the time window; handle both snapshot (6-part) and gallery (4-part) filenames
 	var recentFiles []string
@@ -679,18 +1005,16 @@ var filterSnapshots = func(allFiles []string, cfg models.TimelapseConfig, target
 		}
 	}
 
-	// Apply daylight-hours filter for all non-24-hour timelapses
-	if !strings.HasPrefix(cfg.Name, "24_hour_") {
-		startHour := settings.GetInt("video.daylight_start_hour", 7)
-		endHour := settings.GetInt("video.daylight_end_hour", 19)
-		if startHour > 0 || endHour < 24 {
+	// Apply the daylight filter to all but the 24-hour, capture-window and activity timelapses
+	if !strings.HasPrefix(cfg.Name, "24_hour_") && !strings.HasPrefix(cfg.Name, "window_") && !strings.HasPrefix(cfg.Name, "activity_") {
+		if inDaylight := daylightFilter(); inDaylight != nil {
 			var daytimeFiles []string
 			for _, file := range recentFiles {
 				t, err := parseFileTime(file)
 				if err != nil {
 					continue
 				}
-				if t.Hour() >= startHour && t.Hour() < endHour {
+				if inDaylight(t) {
 					daytimeFiles = append(daytimeFiles, file)
 				}
 			}
@@ -717,7 +1041,7 @@ var filterSnapshots = func(allFiles []string, cfg models.TimelapseConfig, target
 		}
 
 	case "daily":
-		// One file per day: the image whose hour is closest to DaylightTargetHour (default noon)
+		// One file per day: the image closest to the target hour or solar noon (see pickDailyFrame)
 		dayGroups := make(map[string][]string)
 		var dayOrder []string
 		for _, file := range recentFiles {
@@ -731,7 +1055,7 @@ var filterSnapshots = func(allFiles []string, cfg models.TimelapseConfig, target
 			}
 		}
 		for _, day := range dayOrder {
-			if best := pickClosestToHour(dayGroups[day], settings.GetInt("video.daylight_target_hour", 12)); best != "" {
+			if best := pickDailyFrame(dayGroups[day]); best != "" {
 				filtered = append(filtered, best)
 			}
 		}
@@ -775,7 +1099,7 @@ var filterSnapshots = func(allFiles []string, cfg models.TimelapseConfig, target
 			}
 		}
 		for _, day := range dayOrder {
-			if best := pickClosestToHour(dayGroups[day], settings.GetInt("video.daylight_target_hour", 12)); best != "" {
+			if best := pickDailyFrame(dayGroups[day]); best != "" {
 				filtered = append(filtered, best)
 			}
 		}
@@ -784,10 +1108,10 @@ var filterSnapshots = func(allFiles []string, cfg models.TimelapseConfig, target
 	sort.Strings(filtered)
 	return filtered
 }
-// prepareSnapshotsForBatch filters out missing or undersized snapshots and caps the
-// result to maxFrames (keeping the most recent), preventing FFmpeg OOM on large batches.
-// Pass maxFrames ≤ 0 to disable the cap.
-func prepareSnapshotsForBatch(snapshotFiles []string, maxFrames int) []string {
+// prepareSnapshotsForBatch filters out missing or undersized snapshots. The
+// frame budget is applied before this, by decimateFrames, which samples along
+// the capture window.
+func prepareSnapshotsForBatch(snapshotFiles []string) []string {
 	var valid []string
 	for _, snapshot := range snapshotFiles {
 		info, err := os.Stat(snapshot)
@@ -801,25 +1125,104 @@ func prepareSnapshotsForBatch(snapshotFiles []string, maxFrames int) []string {
 		}
 		valid = append(valid, snapshot)
 	}
-	if maxFrames > 0 && len(valid) > maxFrames {
-		log.Printf("WARNING: %d valid frames exceeds batch limit (%d); keeping most recent %d frames to prevent OOM",
-			len(valid), maxFrames, maxFrames)
-		valid = valid[len(valid)-maxFrames:]
-	}
 	return valid
 }
 
-var regenerateFullTimelapse = func(snapshotFiles []string, outputFileName string, archive bool) error {
+// decimateFrames reduces files, sorted by time, to at most maxFrames spread
+// evenly across the window. The window is cut into equal slots, rounded up to
+// whole slots of the frame pattern (an hour for "hourly", N hours for
+// "N_hourly", a day for "daily"), and the first frame of each slot is kept: the
+// one nearest the pattern slot at its start. Slots move as the window grows
+// or the frame count crosses the budget, so a decimated timelapse cannot be
+// appended to. Pass maxFrames ≤ 0 to disable the budget.
+func decimateFrames(files []string, maxFrames int, windowStart, windowEnd time.Time, framePattern string) []string {
+	if maxFrames <= 0 || len(files) <= maxFrames {
+		return files
+	}
+	// File times are wall-clock times labelled UTC; compare them with the
+	// window's wall-clock times.
+	start, end := wallClock(windowStart), wallClock(windowEnd)
+	step := end.Sub(start) / time.Duration(maxFrames)
+	if interval := patternInterval(framePattern); interval > 0 && step > 0 {
+		step = (step + interval - 1) / interval * interval
+	}
+	if step <= 0 {
+		return sampleEvenly(files, maxFrames)
+	}
+
+	var kept []string
+	lastSlot := int64(-1)
+	for _, file := range files {
+		t, err := parseFileTime(file)
+		if err != nil || t.Before(start) {
+			continue
+		}
+		if slot := int64(t.Sub(start) / step); slot != lastSlot {
+			kept = append(kept, file)
+			lastSlot = slot
+		}
+	}
+	if len(kept) > maxFrames {
+		kept = sampleEvenly(kept, maxFrames)
+	}
+	return kept
+}
+
+// patternInterval returns the spacing of a frame pattern's slots, or 0 for
+// "all", which has none.
+func patternInterval(framePattern string) time.Duration {
+	switch framePattern {
+	case "all":
+		return 0
+	case "hourly":
+		return time.Hour
+	}
+	if hours, ok := strings.CutSuffix(framePattern, "_hourly"); ok {
+		if n, err := strconv.Atoi(hours); err == nil && n > 0 {
+			return time.Duration(n) * time.Hour
+		}
+	}
+	return 24 * time.Hour // "daily" and the one-per-day fallback
+}
+
+// sampleEvenly returns n items of files at evenly spaced indices, always
+// keeping the first and last.
+func sampleEvenly(files []string, n int) []string {
+	if n <= 0 || len(files) <= n {
+		return files
+	}
+	if n == 1 {
+		return files[:1]
+	}
+	sampled := make([]string, n)
+	for i := range sampled {
+		sampled[i] = files[int(math.Round(float64(i)*float64(len(files)-1)/float64(n-1)))]
+	}
+	return sampled
+}
+
+// wallClock returns t's wall-clock time in its own location, labelled UTC, to
+// match the times parseFileTime reads from filenames.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// regenerateFullTimelapse re-encodes the (camera-scoped) name timelapse's WebM
+// from scratch into outputPath. Temporary files are written alongside
+// outputPath (the camera's data directory). Frames are timed and overlaid
+// according to opts.
+var regenerateFullTimelapse = func(ctx context.Context, name string, snapshotFiles []string, outputPath string, archive bool, opts renderOptions) error {
 	if len(snapshotFiles) == 0 {
 		log.Println("No snapshots to generate timelapse.")
 		return nil
 	}
 
-	tempVideoPath := filepath.Join(config.AppConfig.DataDir, "temp_"+outputFileName)
-	finalVideoPath := filepath.Join(config.AppConfig.DataDir, outputFileName)
+	workDir := filepath.Dir(outputPath)
+	outputFileName := filepath.Base(outputPath)
+	tempVideoPath := filepath.Join(workDir, "temp_"+outputFileName)
+	finalVideoPath := outputPath
 
-	maxFrames := settings.GetInt("video.max_batch_frames", defaultMaxBatchFrames)
-	validSnapshots := prepareSnapshotsForBatch(snapshotFiles, maxFrames)
+	validSnapshots := prepareSnapshotsForBatch(snapshotFiles)
 	if len(validSnapshots) == 0 {
 		log.Printf("No valid snapshots found to generate timelapse %s.", outputFileName)
 		return nil
@@ -827,61 +1230,38 @@ var regenerateFullTimelapse = func(snapshotFiles []string, outputFileName string
 
 	// Write an ffconcat list so FFmpeg processes all frames in a single pass instead
 	// of one FFmpeg invocation per frame (which was causing extreme CPU usage on large sets).
-	concatListPath := filepath.Join(config.AppConfig.DataDir, "regen_concat_list.txt")
-	listFile, err := os.Create(concatListPath)
+	// The list is unique to this call so that other formats of the camera can be
+	// regenerated in the same directory at the same time.
+	listFile, err := os.CreateTemp(workDir, "regen-concat-*.txt")
 	if err != nil {
 		return fmt.Errorf("failed to create concat list: %w", err)
 	}
-	fmt.Fprintln(listFile, "ffconcat version 1.0")
-	for _, snapshot := range validSnapshots {
-		// duration 0.0333 ≈ 30 fps
-		fmt.Fprintf(listFile, "file '%s'\nduration 0.0333\n", filepath.ToSlash(snapshot))
-	}
-	// ffconcat requires the last entry to be repeated without a duration to avoid a missing final frame.
-	fmt.Fprintf(listFile, "file '%s'\n", filepath.ToSlash(validSnapshots[len(validSnapshots)-1]))
 	listFile.Close()
+	concatListPath := listFile.Name()
 	defer os.Remove(concatListPath)
+	if err := writeConcatList(concatListPath, validSnapshots, opts); err != nil {
+		return fmt.Errorf("failed to create concat list: %w", err)
+	}
 
-	log.Printf("Starting batch timelapse generation for %s (%d frames)...", outputFileName, len(validSnapshots))
+	log.Printf("Starting batch timelapse generation for %s (%d frames, %s)...", outputFileName, len(validSnapshots), opts.Encoder.Codec)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Hour)
 	defer cancel()
 
-	videoFilter := "scale=out_color_matrix=bt709:out_range=tv,format=yuv420p"
-	maxBitrate := settings.Get("video.max_bitrate", "2M")
-	bufSize := computeBufSize(maxBitrate)
-	crf := settings.GetCRFForQuality(settings.Get("video.quality", "medium"))
-	var cmd *exec.Cmd
-	if PreferredVideoCodec == "libsvtav1" {
-		cmd = exec.CommandContext(ctx, "ffmpeg",
-			"-hide_banner", "-loglevel", "error",
-			"-f", "concat", "-safe", "0", "-i", concatListPath,
-			"-vf", videoFilter,
-			"-c:v", PreferredVideoCodec, "-preset", "10",
-			"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
-			"-crf", crf,
-			"-maxrate", maxBitrate,
-			"-bufsize", bufSize,
-			"-an", "-f", "webm", "-y", tempVideoPath,
-		)
-	} else {
-		cmd = exec.CommandContext(ctx, "ffmpeg",
-			"-hide_banner", "-loglevel", "error",
-			"-f", "concat", "-safe", "0", "-i", concatListPath,
-			"-vf", videoFilter,
-			"-c:v", PreferredVideoCodec,
-			"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
-			"-crf", crf,
-			"-maxrate", maxBitrate,
-			"-bufsize", bufSize,
-			"-an", "-f", "webm", "-y", tempVideoPath,
-		)
-	}
-	cmd.Dir = config.AppConfig.DataDir
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", "concat", "-safe", "0", "-i", concatListPath,
+		"-vf", withOverlay(opts.Overlay, "", opts.Encoder.scaleFilter()),
+		"-threads", fmt.Sprintf("%d", getFFmpegThreads()),
+	}
+	args = append(args, opts.Encoder.args()...)
+	args = append(args, "-an", "-f", "webm", "-y", tempVideoPath)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Dir = workDir
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
+	if err := runFFmpeg(cmd, name, "webm", finalVideoPath, len(validSnapshots)); err != nil {
 		os.Remove(tempVideoPath)
 		today := time.Now().Format("2006-01-02")
 		if logErr := database.AppendFFmpegLog(today, outputFileName, fmt.Sprintf("--- FFmpeg Batch Error for %s: %s ---\n%s\n", outputFileName, time.Now(), stderr.String())); logErr != nil {
@@ -894,7 +1274,7 @@ var regenerateFullTimelapse = func(snapshotFiles []string, outputFileName string
 	if util.FileExists(finalVideoPath) {
 		if archive {
 			archiveFileName := fmt.Sprintf("%s_%s.webm", strings.TrimSuffix(outputFileName, ".webm"), time.Now().Format("20060102_150405"))
-			archiveVideoPath := filepath.Join(config.AppConfig.DataDir, archiveFileName)
+			archiveVideoPath := filepath.Join(workDir, archiveFileName)
 			log.Printf("Archiving existing video to: %s", archiveVideoPath)
 			if err := os.Rename(finalVideoPath, archiveVideoPath); err != nil {
 				log.Printf("Warning: failed to archive video %s: %v", finalVideoPath, err)
@@ -915,84 +1295,122 @@ var regenerateFullTimelapse = func(snapshotFiles []string, outputFileName string
 
 var CleanupSnapshots = func() {
 	log.Println("Starting snapshot cleanup...")
-	allSnapshots := util.GetSnapshotFiles()
+	retentionDays := settings.GetInt("snapshot.retention_days", 30)
+	retentionCutoff := time.Now().Add(-time.Duration(retentionDays) * 24 * time.Hour)
+	if err := database.DeleteMissedSnapshotsBefore(retentionCutoff); err != nil {
+		log.Printf("Warning: failed to prune missed snapshot records: %v", err)
+	}
+	if err := database.DeleteCameraHealthBefore(retentionCutoff); err != nil {
+		log.Printf("Warning: failed to prune camera health records: %v", err)
+	}
+
+	var allSnapshots []models.Snapshot
+	for _, cameraID := range util.AllCameraIDs() {
+		snapshots, err := database.GetSnapshots(cameraID, false, time.Time{}, time.Time{})
+		if err != nil {
+			log.Printf("Error querying snapshot index for camera %q: %v", cameraID, err)
+		}
+		allSnapshots = append(allSnapshots, snapshots...)
+		if n := util.PruneQuarantine(cameraID, retentionCutoff); n > 0 {
+			log.Printf("Removed %d expired quarantined files for camera %q", n, cameraID)
+		}
+	}
+	cleanupEventFrames()
 	if len(allSnapshots) == 0 {
 		log.Println("No snapshot files found to cleanup.")
 		return
 	}
 
-	retentionDays := settings.GetInt("snapshot.retention_days", 30)
-	retentionCutoff := time.Now().Add(-time.Duration(retentionDays) * 24 * time.Hour)
 	log.Printf("Snapshot retention is %d days. Deleting files older than %s", retentionDays, retentionCutoff.Format("2006-01-02 15:04:05"))
 
 	filesToDelete := 0
 	filesKept := 0
 	corruptFiles := 0
+	var removed []string
 
-	for _, file := range allSnapshots {
+	for _, snap := range allSnapshots {
 		// Remove files too small to be a real JPEG — these are placeholder responses
 		// saved during NVR outages before the minimum-size guard was applied.
-		info, err := os.Stat(file)
-		if err == nil && info.Size() < minValidSnapshotBytes {
-			log.Printf("Found undersized snapshot (%d bytes), deleting: %s", info.Size(), file)
-			if err := os.Remove(file); err != nil {
-				log.Printf("Warning: failed to remove undersized snapshot %s: %v", file, err)
-			} else {
-				corruptFiles++
-				continue
-			}
+		switch {
+		case snap.Size < minValidSnapshotBytes:
+			log.Printf("Found undersized snapshot (%d bytes), deleting: %s", snap.Size, snap.Path)
+			corruptFiles++
+		case snap.CapturedAt.Before(retentionCutoff):
+			filesToDelete++
+		default:
+			filesKept++
+			continue
 		}
-
-		// Extract timestamp from filename
-		parts := strings.Split(strings.TrimSuffix(filepath.Base(file), ".jpg"), "-")
-		if len(parts) != 6 {
-			log.Printf("Skipping malformed snapshot filename: %s", file)
-			continue // Skip malformed filenames
+		if err := os.Remove(snap.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove snapshot %s: %v", snap.Path, err)
+			continue
 		}
-		fileTime, err := time.Parse("2006-01-02-15-04-05", strings.Join(parts, "-"))
+		removed = append(removed, snap.Path)
+	}
+	if err := database.DeleteSnapshotRecords(removed...); err != nil {
+		log.Printf("Warning: failed to remove deleted snapshots from the index: %v", err)
+	}
+
+	log.Printf("Snapshot cleanup finished. Kept %d files, removed %d old files, and removed %d corrupt (zero-byte) files.", filesKept, filesToDelete, corruptFiles)
+}
+
+// cleanupEventFrames removes event frames older than events.retention_days.
+func cleanupEventFrames() {
+	cutoff := time.Now().Add(-time.Duration(settings.GetInt("events.retention_days", 30)) * 24 * time.Hour)
+	var removed []string
+	for _, cameraID := range util.AllCameraIDs() {
+		expired, err := database.GetEventSnapshots(cameraID, "", time.Time{}, cutoff)
 		if err != nil {
-			log.Printf("Skipping snapshot with unparsable time: %s", file)
+			log.Printf("Error querying event frames for camera %q: %v", cameraID, err)
 			continue
 		}
-
-		if fileTime.Before(retentionCutoff) {
-			if err := os.Remove(file); err != nil {
-				log.Printf("Warning: failed to remove snapshot %s: %v", file, err)
-			} else {
-				filesToDelete++
+		for _, frame := range expired {
+			if err := os.Remove(frame.Path); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: failed to remove event frame %s: %v", frame.Path, err)
+				continue
 			}
-		} else {
-			filesKept++
+			removed = append(removed, frame.Path)
 		}
 	}
-
-	log.Printf("Snapshot cleanup finished. Kept %d files, removed %d old files, and removed %d corrupt (zero-byte) files.", filesKept, filesToDelete, corruptFiles)
+	if err := database.DeleteSnapshotRecords(removed...); err != nil {
+		log.Printf("Warning: failed to remove deleted event frames from the index: %v", err)
+	}
+	if len(removed) > 0 {
+		log.Printf("Removed %d expired event frame(s).", len(removed))
+	}
 }
 
 // cleanVideosByCount removes the oldest videos for a given prefix across all formats, keeping only the N newest.
 // Used for timelapses without a natural date in the filename (e.g. yearly).
-func cleanVideosByCount(prefix string, keep int) {
-	dataDir := config.AppConfig.DataDir
+func cleanVideosByCount(dataDir, prefix string, keep int) {
 	files, err := os.ReadDir(dataDir)
 	if err != nil {
 		log.Printf("Error reading data directory during video cleanup: %v", err)
 		return
 	}
-	var matches []string
+	// A timelapse may have several files (formats and seek thumbnails), so
+	// count timelapses rather than files.
+	filesByTimelapse := map[string][]string{}
+	var timelapses []string
 	for _, f := range files {
 		name := f.Name()
-		if strings.HasPrefix(name, prefix) &&
-			(strings.HasSuffix(name, ".webm") || strings.HasSuffix(name, ".mp4")) {
-			matches = append(matches, name)
+		if strings.HasPrefix(name, prefix) && isTimelapseFile(name) {
+			timelapse, _, _ := strings.Cut(name, ".")
+			if filesByTimelapse[timelapse] == nil {
+				timelapses = append(timelapses, timelapse)
+			}
+			filesByTimelapse[timelapse] = append(filesByTimelapse[timelapse], name)
 		}
 	}
-	sort.Strings(matches)
-	if len(matches) <= keep {
+	sort.Strings(timelapses)
+	if len(timelapses) <= keep {
 		return
 	}
-	for _, name := range matches[:len(matches)-keep] {
-		if err := os.Remove(filepath.Join(dataDir, name)); err != nil {
-			log.Printf("Error removing old video %s: %v", name, err)
+	for _, timelapse := range timelapses[:len(timelapses)-keep] {
+		for _, name := range filesByTimelapse[timelapse] {
+			if err := os.Remove(filepath.Join(dataDir, name)); err != nil {
+				log.Printf("Error removing old video %s: %v", name, err)
+			}
 		}
 	}
 
@@ -1018,7 +1436,7 @@ func cleanVideosByCount(prefix string, keep int) {
 // cleanWeeklyVideos deletes weekly timelapse files whose Monday date is older than the
 // retention window. This is date-based rather than count-based so that in-window videos
 // are never deleted, preventing the rebuild-then-delete loop that count-based cleanup caused.
-func cleanWeeklyVideos() {
+func cleanWeeklyVideos(dataDir string) {
 	now := time.Now()
 	keepWeeks := settings.GetInt("video.weekly_keep", 4)
 	if keepWeeks < 1 {
@@ -1027,7 +1445,7 @@ func cleanWeeklyVideos() {
 	currentMonday := calendarWeekMonday(now)
 	oldestAllowed := currentMonday.AddDate(0, 0, -7*(keepWeeks-1))
 
-	files, err := os.ReadDir(config.AppConfig.DataDir)
+	files, err := os.ReadDir(dataDir)
 	if err != nil {
 		log.Printf("Error reading data directory during weekly video cleanup: %v", err)
 		return
@@ -1038,7 +1456,7 @@ func cleanWeeklyVideos() {
 		if !strings.HasPrefix(name, "timelapse_week_") {
 			continue
 		}
-		if !strings.HasSuffix(name, ".webm") && !strings.HasSuffix(name, ".mp4") {
+		if !isTimelapseFile(name) {
 			continue
 		}
 		dateStr := name[len("timelapse_week_") : len("timelapse_week_")+10]
@@ -1047,7 +1465,7 @@ func cleanWeeklyVideos() {
 			continue
 		}
 		if monday.Before(oldestAllowed) {
-			if err := os.Remove(filepath.Join(config.AppConfig.DataDir, name)); err != nil {
+			if err := os.Remove(filepath.Join(dataDir, name)); err != nil {
 				log.Printf("Error removing old weekly video %s: %v", name, err)
 			} else {
 				deleted++
@@ -1055,7 +1473,7 @@ func cleanWeeklyVideos() {
 		}
 	}
 	// Also remove expired HLS weekly directories
-	hlsBase := filepath.Join(config.AppConfig.DataDir, "hls")
+	hlsBase := filepath.Join(dataDir, "hls")
 	if hlsDirs, err := os.ReadDir(hlsBase); err == nil {
 		for _, d := range hlsDirs {
 			name := d.Name()
@@ -1079,7 +1497,7 @@ func cleanWeeklyVideos() {
 }
 
 // cleanMonthlyVideos deletes monthly timelapse files whose month is older than the retention window.
-func cleanMonthlyVideos() {
+func cleanMonthlyVideos(dataDir string) {
 	now := time.Now()
 	keepMonths := settings.GetInt("video.monthly_keep", 3)
 	if keepMonths < 1 {
@@ -1096,7 +1514,7 @@ func cleanMonthlyVideos() {
 	}
 	oldestAllowed := time.Date(oldestAllowedYear, oldestAllowedMonth, 1, 0, 0, 0, 0, now.Location())
 
-	files, err := os.ReadDir(config.AppConfig.DataDir)
+	files, err := os.ReadDir(dataDir)
 	if err != nil {
 		log.Printf("Error reading data directory during monthly video cleanup: %v", err)
 		return
@@ -1107,7 +1525,7 @@ func cleanMonthlyVideos() {
 		if !strings.HasPrefix(name, "timelapse_month_") {
 			continue
 		}
-		if !strings.HasSuffix(name, ".webm") && !strings.HasSuffix(name, ".mp4") {
+		if !isTimelapseFile(name) {
 			continue
 		}
 		dateStr := name[len("timelapse_month_") : len("timelapse_month_")+7]
@@ -1116,7 +1534,7 @@ func cleanMonthlyVideos() {
 			continue
 		}
 		if monthStart.Before(oldestAllowed) {
-			if err := os.Remove(filepath.Join(config.AppConfig.DataDir, name)); err != nil {
+			if err := os.Remove(filepath.Join(dataDir, name)); err != nil {
 				log.Printf("Error removing old monthly video %s: %v", name, err)
 			} else {
 				deleted++
@@ -1130,10 +1548,16 @@ func cleanMonthlyVideos() {
 
 var CleanOldVideos = func() {
 	log.Printf("Starting video cleanup...")
+	for _, cameraID := range util.AllCameraIDs() {
+		cleanCameraVideos(config.CameraDataDir(cameraID))
+	}
+}
 
-	// Daily 24-hour timelapses: remove by cutoff date
+// cleanCameraVideos applies the video retention rules to one camera's data directory.
+func cleanCameraVideos(dataDir string) {
+	// Daily 24-hour, capture-window and activity timelapses: remove by cutoff date
 	cutoffDate := time.Now().AddDate(0, 0, -settings.GetInt("video.daily_days", 30)).Truncate(24 * time.Hour)
-	files, err := os.ReadDir(config.AppConfig.DataDir)
+	files, err := os.ReadDir(dataDir)
 	if err != nil {
 		log.Printf("Error reading data directory for daily video cleanup: %v", err)
 		return
@@ -1141,20 +1565,21 @@ var CleanOldVideos = func() {
 	dailyRemoved := 0
 	for _, f := range files {
 		name := f.Name()
-		if !strings.HasPrefix(name, "timelapse_24_hour_") {
+		prefix := dailyVideoPrefix(name)
+		if prefix == "" {
 			continue
 		}
-		if !strings.HasSuffix(name, ".webm") && !strings.HasSuffix(name, ".mp4") {
+		if !isTimelapseFile(name) {
 			continue
 		}
-		dateStr := name[len("timelapse_24_hour_") : len("timelapse_24_hour_")+10]
+		dateStr := name[len(prefix) : len(prefix)+10]
 		fileDate, err := time.Parse("2006-01-02", dateStr)
 		if err != nil {
 			log.Printf("Warning: could not parse date from daily timelapse video %s: %v", name, err)
 			continue
 		}
 		if fileDate.Before(cutoffDate) {
-			if err := os.Remove(filepath.Join(config.AppConfig.DataDir, name)); err != nil {
+			if err := os.Remove(filepath.Join(dataDir, name)); err != nil {
 				log.Printf("Error removing old daily timelapse video %s: %v", name, err)
 			} else {
 				dailyRemoved++
@@ -1162,14 +1587,15 @@ var CleanOldVideos = func() {
 		}
 	}
 	// Also remove expired HLS daily directories
-	hlsBase := filepath.Join(config.AppConfig.DataDir, "hls")
+	hlsBase := filepath.Join(dataDir, "hls")
 	if hlsDirs, err := os.ReadDir(hlsBase); err == nil {
 		for _, d := range hlsDirs {
 			name := d.Name()
-			if !strings.HasPrefix(name, "timelapse_24_hour_") {
+			prefix := dailyVideoPrefix(name)
+			if prefix == "" {
 				continue
 			}
-			dateStr := name[len("timelapse_24_hour_") : len("timelapse_24_hour_")+10]
+			dateStr := name[len(prefix) : len(prefix)+10]
 			fileDate, err := time.Parse("2006-01-02", dateStr)
 			if err != nil {
 				continue
@@ -1180,51 +1606,67 @@ var CleanOldVideos = func() {
 			}
 		}
 	}
-	log.Printf("Removed %d old daily 24-hour timelapse(s).", dailyRemoved)
+	log.Printf("Removed %d old daily, capture-window and activity timelapse(s).", dailyRemoved)
 
 	// Weekly timelapses: date-based — never deletes in-window videos
-	cleanWeeklyVideos()
+	cleanWeeklyVideos(dataDir)
 
 	// Monthly timelapses: date-based — never deletes in-window videos
-	cleanMonthlyVideos()
+	cleanMonthlyVideos(dataDir)
 
 	// Yearly timelapses: keep current + previous year
-	cleanVideosByCount("timelapse_year_", 2)
+	cleanVideosByCount(dataDir, "timelapse_year_", 2)
 }
 
-var CleanupGallery = func() {
-	log.Println("Starting gallery cleanup...")
-	galleryPath := config.AppConfig.GalleryDir
-	files, err := filepath.Glob(filepath.Join(galleryPath, "*.jpg"))
-	if err != nil {
-		log.Printf("Error finding gallery files for cleanup: %v", err)
-		return
+// isTimelapseFile reports whether name is a timelapse file removed by the
+// retention rules: a WebM or MP4 video, its seek thumbnails or its animated
+// previews.
+func isTimelapseFile(name string) bool {
+	for _, suffix := range []string{".webm", ".mp4", ".sprite.jpg", ".vtt", ".preview.webp", ".preview.gif"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// dailyVideoPrefix returns the prefix of a timelapse file or HLS directory name
+// that is followed by a YYYY-MM-DD date and kept for video.daily_days, or "" if
+// name is not one.
+func dailyVideoPrefix(name string) string {
+	for _, prefix := range []string{"timelapse_24_hour_", "timelapse_window_", "timelapse_activity_"} {
+		if strings.HasPrefix(name, prefix) && len(name) >= len(prefix)+10 {
+			return prefix
+		}
 	}
+	return ""
+}
 
+var CleanupGallery = func() {
+	log.Println("Starting gallery cleanup...")
 	retentionCutoff := time.Now().Add(-time.Duration(settings.GetInt("gallery.retention_days", 365)) * 24 * time.Hour)
-	filesToDelete := 0
 
-	for _, file := range files {
-		name := filepath.Base(file)
-		// Name is YYYY-MM-DD-HH.jpg
-		dateStr := strings.TrimSuffix(name, ".jpg")
-		fileTime, err := time.Parse("2006-01-02-15", dateStr)
+	var removed []string
+	for _, cameraID := range util.AllCameraIDs() {
+		expired, err := database.GetSnapshots(cameraID, true, time.Time{}, retentionCutoff)
 		if err != nil {
-			log.Printf("Warning: could not parse date from gallery file %s: %v", name, err)
-			continue
+			log.Printf("Error finding gallery files for cleanup: %v", err)
+			return
 		}
-
-		if fileTime.Before(retentionCutoff) {
-			if err := os.Remove(file); err != nil {
-				log.Printf("Warning: failed to remove gallery file %s: %v", file, err)
-			} else {
-				filesToDelete++
+		for _, image := range expired {
+			if err := os.Remove(image.Path); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: failed to remove gallery file %s: %v", image.Path, err)
+				continue
 			}
+			removed = append(removed, image.Path)
 		}
 	}
+	if err := database.DeleteSnapshotRecords(removed...); err != nil {
+		log.Printf("Warning: failed to remove deleted gallery images from the index: %v", err)
+	}
 
-	if filesToDelete > 0 {
-		log.Printf("Gallery cleanup complete. Removed %d old files.", filesToDelete)
+	if len(removed) > 0 {
+		log.Printf("Gallery cleanup complete. Removed %d old files.", len(removed))
 	} else {
 		log.Println("No old gallery files to clean up.")
 	}
@@ -2,10 +2,13 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -45,6 +48,7 @@ func setupTest(t *testing.T) (string, func()) {
 		dummyFile := filepath.Join(snapshotDir, now.Format("2006-01-02-15-04-05")+".jpg")
 		os.WriteFile(dummyFile, validSnapshotData(), 0644)
 	}
+	util.ReindexSnapshots()
 
 	return tempDir, func() {
 		os.RemoveAll(tempDir)
@@ -58,10 +62,10 @@ func TestReadWriteLastAppendedSnapshot(t *testing.T) {
 	timelapseName := "test_timelapse"
 	snapshotPath := "/path/to/snapshot.jpg"
 
-	err := writeLastAppendedSnapshot(timelapseName, snapshotPath)
+	err := writeLastAppendedSnapshot(timelapseName, "webm", snapshotPath)
 	assert.NoError(t, err)
 
-	readPath, err := readLastAppendedSnapshot(timelapseName)
+	readPath, err := readLastAppendedSnapshot(timelapseName, "webm")
 	assert.NoError(t, err)
 	assert.Equal(t, snapshotPath, readPath)
 }
@@ -93,7 +97,8 @@ func TestFilterSnapshots(t *testing.T) {
 		}
 	}
 
-	allFiles := util.GetSnapshotFiles()
+	util.ReindexSnapshots()
+	allFiles := util.GetSnapshotFiles("")
 	assert.Len(t, allFiles, 3*24, "should have 72 snapshots across 3 days")
 
 	// "all" pattern for a fixed 24-hour day (the 24_hour_ prefix triggers calendar-day window)
@@ -154,6 +159,7 @@ func TestCleanupSnapshots(t *testing.T) {
 	tinyTime := newTime.Add(time.Minute)
 	tinyFile := filepath.Join(tinyDir, tinyTime.Format("2006-01-02-15-04-05")+".jpg")
 	os.WriteFile(tinyFile, bytes.Repeat([]byte("x"), int(minValidSnapshotBytes)-1), 0644)
+	util.ReindexSnapshots()
 
 	CleanupSnapshots()
 
@@ -186,7 +192,7 @@ func TestCreateVideoSegment_ErrorHandling(t *testing.T) {
 		assert.NoError(t, err)
 
 		segmentPath := filepath.Join(tempDir, "segment.webm")
-		err = createVideoSegment(zeroByteFile, segmentPath)
+		err = createVideoSegment(t.Context(), zeroByteFile, segmentPath, renderOptions{})
 
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "below minimum size")
@@ -198,7 +204,7 @@ func TestCreateVideoSegment_ErrorHandling(t *testing.T) {
 		assert.NoError(t, err)
 
 		segmentPath := filepath.Join(tempDir, "tiny_segment.webm")
-		err = createVideoSegment(tinyFile, segmentPath)
+		err = createVideoSegment(t.Context(), tinyFile, segmentPath, renderOptions{})
 
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "below minimum size")
@@ -211,7 +217,7 @@ func TestCreateVideoSegment_ErrorHandling(t *testing.T) {
 		os.WriteFile(badSnapshot, bytes.Repeat([]byte("this is not a jpeg "), int(minValidSnapshotBytes)/19+1), 0644)
 
 		segmentPath := filepath.Join(tempDir, "bad_segment.webm")
-		err := createVideoSegment(badSnapshot, segmentPath)
+		err := createVideoSegment(t.Context(), badSnapshot, segmentPath, renderOptions{})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "ffmpeg (create segment) execution failed")
 
@@ -281,6 +287,57 @@ func TestCleanOldVideos(t *testing.T) {
 	assert.Contains(t, filesWeek, filepath.Join(tempDir, fmt.Sprintf("timelapse_week_%s.webm", thisMonday.Format("2006-01-02"))), "should keep the current week")
 }
 
+func TestCleanOldVideos_CaptureWindows(t *testing.T) {
+	tempDir, cleanup := setupTest(t)
+	defer cleanup()
+	settings.Set("video.daily_days", "2")
+	settings.Invalidate()
+
+	today := time.Now().Truncate(24 * time.Hour)
+	keep := filepath.Join(tempDir, "timelapse_"+windowTimelapseName("sunrise", today)+".mp4")
+	old := filepath.Join(tempDir, "timelapse_"+windowTimelapseName("sunrise", today.AddDate(0, 0, -3))+".mp4")
+	oldHLS := filepath.Join(tempDir, "hls", "timelapse_"+windowTimelapseName("sunrise", today.AddDate(0, 0, -3)))
+	os.WriteFile(keep, []byte("dummy"), 0644)
+	os.WriteFile(old, []byte("dummy"), 0644)
+	os.MkdirAll(oldHLS, 0755)
+
+	CleanOldVideos()
+
+	assert.FileExists(t, keep)
+	assert.NoFileExists(t, old, "capture-window clips follow daily retention")
+	assert.NoDirExists(t, oldHLS)
+
+	oldActivity := filepath.Join(tempDir, "timelapse_activity_"+today.AddDate(0, 0, -3).Format("2006-01-02")+".webm")
+	os.WriteFile(oldActivity, []byte("dummy"), 0644)
+	CleanOldVideos()
+	assert.NoFileExists(t, oldActivity, "activity clips follow daily retention")
+}
+
+func TestCleanupSnapshots_EventFrames(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	settings.Set("events.retention_days", "7")
+	settings.Invalidate()
+	database.AddCamera("cam1", "")
+
+	writeEvent := func(at time.Time) string {
+		dir := filepath.Join(config.CameraEventsDir("cam1"), at.Format("2006-01"), at.Format("02"))
+		os.MkdirAll(dir, 0755)
+		path := filepath.Join(dir, util.EventFileName(at, []string{"motion"}))
+		os.WriteFile(path, validSnapshotData(), 0644)
+		return path
+	}
+	oldFrame := writeEvent(time.Now().Add(-8 * 24 * time.Hour))
+	newFrame := writeEvent(time.Now().Add(-time.Hour))
+	util.ReindexSnapshots()
+
+	CleanupSnapshots()
+
+	assert.NoFileExists(t, oldFrame)
+	assert.FileExists(t, newFrame)
+	assert.Equal(t, []string{newFrame}, util.GetEventFiles("cam1", "", time.Time{}, time.Time{}))
+}
+
 func TestCleanupLogFiles(t *testing.T) {
 	tempDir, cleanup := setupTest(t)
 	defer cleanup()
@@ -324,6 +381,7 @@ func TestCleanupGallery(t *testing.T) {
 	newTime := time.Now()
 	newFile := filepath.Join(config.AppConfig.GalleryDir, newTime.Format("2006-01-02-15")+".jpg")
 	os.WriteFile(newFile, []byte("new"), 0644)
+	util.ReindexSnapshots()
 
 	CleanupGallery()
 
@@ -341,8 +399,13 @@ func TestEnqueueTimelapseJobs(t *testing.T) {
 	defer func() { jobs.CreateJob = originalCreateJob }()
 
 	var calledJobTypes []string
-	jobs.CreateJob = func(jobType string, payload interface{}) (int64, error) {
+	priorities := map[string]int{}
+	jobs.CreateJob = func(jobType string, payload interface{}, priority int) (int64, error) {
 		calledJobTypes = append(calledJobTypes, jobType)
+		if p, ok := payload.(map[string]string); ok {
+			_, base := util.SplitScopedName(p["timelapse_name"])
+			priorities[strings.SplitN(base, "_", 2)[0]] = priority
+		}
 		return 1, nil
 	}
 
@@ -355,8 +418,8 @@ func TestEnqueueTimelapseJobs(t *testing.T) {
 
 	EnqueueTimelapseJobs()
 
-	// 2 daily + 2 weekly + 1 monthly + 1 yearly + 4 cleanup = 10 jobs
-	assert.Len(t, calledJobTypes, 2+2+1+1+4)
+	// 2 daily + 2 weekly + 1 monthly + 1 yearly + 5 cleanup = 11 jobs
+	assert.Len(t, calledJobTypes, 2+2+1+1+5)
 
 	generateCount := 0
 	cleanupCount := 0
@@ -364,12 +427,156 @@ func TestEnqueueTimelapseJobs(t *testing.T) {
 		switch jt {
 		case "generate_timelapse":
 			generateCount++
-		case "cleanup_snapshots", "cleanup_videos", "cleanup_logs", "cleanup_gallery":
+		case "cleanup_snapshots", "cleanup_videos", "cleanup_logs", "cleanup_gallery", "cleanup_jobs":
 			cleanupCount++
 		}
 	}
 	assert.Equal(t, 6, generateCount, "should enqueue 2 daily + 2 weekly + 1 monthly + 1 yearly generate jobs")
-	assert.Equal(t, 4, cleanupCount, "should enqueue 4 cleanup jobs")
+	assert.Equal(t, 5, cleanupCount, "should enqueue 5 cleanup jobs")
+	assert.Equal(t, map[string]int{"24": jobs.PriorityHigh, "week": jobs.PriorityNormal, "month": jobs.PriorityNormal, "year": jobs.PriorityLow}, priorities,
+		"daily lapses run ahead of the year-to-date encode")
+}
+
+func TestEnqueueTimelapseJobs_CaptureWindows(t *testing.T) {
+	originalCreateJob := jobs.CreateJob
+	defer func() { jobs.CreateJob = originalCreateJob }()
+
+	var windowJobs []string
+	jobs.CreateJob = func(jobType string, payload interface{}, _ int) (int64, error) {
+		if p, ok := payload.(map[string]string); ok && strings.HasPrefix(p["timelapse_name"], "window_") {
+			windowJobs = append(windowJobs, p["timelapse_name"])
+		}
+		return 1, nil
+	}
+
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	settings.Set("video.daily_days", "2")
+	settings.Invalidate()
+	database.SaveCaptureWindow(models.CaptureWindow{Name: "early", IntervalSec: 10, StartAnchor: "clock", EndAnchor: "clock", EndOffset: 1, Weekdays: 0x7f, Enabled: true})
+	database.SaveCaptureWindow(models.CaptureWindow{Name: "off", IntervalSec: 10, StartAnchor: "clock", EndAnchor: "clock", EndOffset: 1, Weekdays: 0x7f})
+
+	EnqueueTimelapseJobs()
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	assert.ElementsMatch(t, []string{
+		windowTimelapseName("early", time.Now()),
+		windowTimelapseName("early", yesterday),
+	}, windowJobs, "one clip per enabled window and day")
+}
+
+func TestGenerateSingleTimelapse_CaptureWindow(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	settings.Set("video.daylight_start_hour", "7")
+	settings.Set("video.daylight_end_hour", "19")
+	settings.Invalidate()
+	database.SaveCaptureWindow(models.CaptureWindow{Name: "dawn-burst", IntervalSec: 10, StartAnchor: "clock", StartOffset: 6 * 60, EndAnchor: "clock", EndOffset: 6*60 + 30, Weekdays: 0x7f, Enabled: true})
+
+	var rendered []string
+	_, restore := mockVideoFunctions(t)
+	defer restore()
+	regenerateFullTimelapse = func(_ context.Context, _ string, snapshotFiles []string, _ string, _ bool, _ renderOptions) error {
+		rendered = snapshotFiles
+		return nil
+	}
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, clock := range []string{"05-59-50", "06-00-00", "06-00-10", "06-29-50", "06-30-00"} {
+		dir := filepath.Join(config.AppConfig.SnapshotsDir, "2024-05", "01", clock[:2])
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "2024-05-01-"+clock+".jpg"), validSnapshotData(), 0644)
+	}
+	util.ReindexSnapshots()
+
+	_, err := GenerateSingleTimelapse(t.Context(), windowTimelapseName("dawn-burst", day))
+	assert.NoError(t, err)
+	var clocks []string
+	for _, f := range rendered {
+		clocks = append(clocks, strings.TrimSuffix(filepath.Base(f), ".jpg")[11:])
+	}
+	assert.Equal(t, []string{"06-00-00", "06-00-10", "06-29-50"}, clocks, "every frame inside the window, ignoring daylight hours")
+
+	// A deleted window's clip is skipped rather than failing.
+	rendered = nil
+	database.DeleteCaptureWindow("dawn-burst")
+	_, err = GenerateSingleTimelapse(t.Context(), windowTimelapseName("dawn-burst", day))
+	assert.NoError(t, err)
+	assert.Nil(t, rendered)
+
+	_, err = GenerateSingleTimelapse(t.Context(), "window_2024-05-01")
+	assert.Error(t, err, "name without a window")
+}
+
+func TestEnqueueTimelapseJobs_Activity(t *testing.T) {
+	originalCreateJob := jobs.CreateJob
+	defer func() { jobs.CreateJob = originalCreateJob }()
+
+	var activityJobs []string
+	jobs.CreateJob = func(jobType string, payload interface{}, _ int) (int64, error) {
+		if p, ok := payload.(map[string]string); ok && strings.HasPrefix(p["timelapse_name"], "activity_") {
+			activityJobs = append(activityJobs, p["timelapse_name"])
+		}
+		return 1, nil
+	}
+
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	settings.Set("video.daily_days", "2")
+	settings.Invalidate()
+
+	EnqueueTimelapseJobs()
+	assert.Empty(t, activityJobs, "activity timelapses are off by default")
+
+	settings.Set("video.activity_timelapse", "true")
+	settings.Invalidate()
+	EnqueueTimelapseJobs()
+	assert.ElementsMatch(t, []string{
+		"activity_" + time.Now().Format("2006-01-02"),
+		"activity_" + time.Now().AddDate(0, 0, -1).Format("2006-01-02"),
+	}, activityJobs)
+}
+
+func TestGenerateSingleTimelapse_Activity(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	settings.Set("video.daylight_start_hour", "7")
+	settings.Set("video.daylight_end_hour", "19")
+	settings.Invalidate()
+
+	var rendered []string
+	_, restore := mockVideoFunctions(t)
+	defer restore()
+	regenerateFullTimelapse = func(_ context.Context, _ string, snapshotFiles []string, _ string, _ bool, _ renderOptions) error {
+		rendered = snapshotFiles
+		return nil
+	}
+
+	// Event frames of cam1 on 2024-05-01 and the next day, plus a scheduled snapshot.
+	for _, at := range []time.Time{
+		time.Date(2024, 5, 1, 3, 0, 0, 0, time.Local),
+		time.Date(2024, 5, 1, 12, 0, 5, 0, time.Local),
+		time.Date(2024, 5, 2, 9, 0, 0, 0, time.Local),
+	} {
+		dir := filepath.Join(config.CameraEventsDir("cam1"), at.Format("2006-01"), at.Format("02"))
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, util.EventFileName(at, []string{"motion", "person"})), validSnapshotData(), 0644)
+	}
+	snapDir := filepath.Join(config.CameraSnapshotsDir("cam1"), "2024-05", "01", "12")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "2024-05-01-12-00-00.jpg"), validSnapshotData(), 0644)
+	util.ReindexSnapshots()
+
+	_, err := GenerateSingleTimelapse(t.Context(), util.ScopedName("cam1", "activity_2024-05-01"))
+	assert.NoError(t, err)
+	var names []string
+	for _, f := range rendered {
+		names = append(names, filepath.Base(f))
+	}
+	assert.Equal(t, []string{
+		"2024-05-01-03-00-00_motion_person.jpg",
+		"2024-05-01-12-00-05_motion_person.jpg",
+	}, names, "only that day's event frames, ignoring daylight hours")
 }
 
 func TestGenerateSingleTimelapse_Daily(t *testing.T) {
@@ -392,16 +599,16 @@ func TestGenerateSingleTimelapse_Daily(t *testing.T) {
 	}()
 
 	regenerateFullTimelapseCalled := false
-	regenerateFullTimelapse = func(snapshotFiles []string, outputFileName string, archive bool) error {
+	regenerateFullTimelapse = func(_ context.Context, _ string, snapshotFiles []string, outputFileName string, archive bool, _ renderOptions) error {
 		regenerateFullTimelapseCalled = true
 		assert.NotEmpty(t, snapshotFiles)
 		assert.Contains(t, outputFileName, "timelapse_24_hour_")
 		return nil
 	}
-	writeLastAppendedSnapshot = func(timelapseName, snapshotPath string) error { return nil }
-	readLastAppendedSnapshot = func(timelapseName string) (string, error) { return "", nil } // Force full regeneration
-	createVideoSegment = func(imagePath, segmentPath string) error { return nil }
-	concatenateVideos = func(existingVideoPath, newSegmentPath, outputVideoPath string) error { return nil }
+	writeLastAppendedSnapshot = func(timelapseName, format, snapshotPath string) error { return nil }
+	readLastAppendedSnapshot = func(timelapseName, format string) (string, error) { return "", nil } // Force full regeneration
+	createVideoSegment = func(_ context.Context, imagePath, segmentPath string, _ renderOptions) error { return nil }
+	concatenateVideos = func(_ context.Context, existingVideoPath, newSegmentPath, outputVideoPath string) error { return nil }
 
 	// Ensure there are snapshots for today
 	testDay := time.Now().Truncate(24 * time.Hour)
@@ -412,9 +619,10 @@ func TestGenerateSingleTimelapse_Daily(t *testing.T) {
 		dummyFile := filepath.Join(snapshotDir, tm.Format("2006-01-02-15-04-05")+".jpg")
 		os.WriteFile(dummyFile, []byte("dummy"), 0644)
 	}
+	util.ReindexSnapshots()
 
 	dailyTimelapseName := fmt.Sprintf("24_hour_%s", testDay.Format("2006-01-02"))
-	err := GenerateSingleTimelapse(dailyTimelapseName)
+	_, err := GenerateSingleTimelapse(t.Context(), dailyTimelapseName)
 	assert.NoError(t, err)
 	assert.True(t, regenerateFullTimelapseCalled, "regenerateFullTimelapse should have been called for a new daily timelapse")
 
@@ -422,11 +630,98 @@ func TestGenerateSingleTimelapse_Daily(t *testing.T) {
 	nonExistentDay := time.Now().AddDate(0, 0, -100).Truncate(24 * time.Hour)
 	nonExistentTimelapseName := fmt.Sprintf("24_hour_%s", nonExistentDay.Format("2006-01-02"))
 	regenerateFullTimelapseCalled = false
-	err = GenerateSingleTimelapse(nonExistentTimelapseName)
+	_, err = GenerateSingleTimelapse(t.Context(), nonExistentTimelapseName)
 	assert.NoError(t, err)
 	assert.False(t, regenerateFullTimelapseCalled, "regenerateFullTimelapse should NOT be called when no snapshots exist")
 }
 
+func TestGenerateFormat_CancelledAppend(t *testing.T) {
+	tempDir, cleanup := setupTest(t)
+	defer cleanup()
+	_, restore := mockVideoFunctions(t)
+	defer restore()
+
+	var frames []string
+	for i := 0; i < 3; i++ {
+		frame := filepath.Join(tempDir, fmt.Sprintf("2026-10-16-%02d-00-00.jpg", i))
+		os.WriteFile(frame, validSnapshotData(), 0644)
+		frames = append(frames, frame)
+	}
+	name := "24_hour_2026-10-16"
+	os.WriteFile(DiskPath(name, "webm"), []byte("webm"), 0644)
+	readLastAppendedSnapshot = func(_, _ string) (string, error) { return frames[0], nil }
+
+	ctx, cancel := context.WithCancel(t.Context())
+	createVideoSegment = func(_ context.Context, _, segmentPath string, _ renderOptions) error {
+		os.WriteFile(segmentPath, []byte("partial"), 0644)
+		cancel()
+		return fmt.Errorf("signal: killed")
+	}
+
+	err := generateFormat(ctx, models.TimelapseConfig{Name: name}, name, "webm", frames, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.FileExists(t, frames[1], "a frame whose encode was cancelled is not quarantined")
+	leftovers, _ := filepath.Glob(filepath.Join(tempDir, "temp_segment_*"))
+	assert.Empty(t, leftovers, "the partial segment is removed")
+}
+
+func TestGenerateSingleTimelapse_CameraScoped(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	originalRegenerateFullTimelapse := regenerateFullTimelapse
+	originalReadLastAppendedSnapshot := readLastAppendedSnapshot
+	originalWriteLastAppendedSnapshot := writeLastAppendedSnapshot
+	defer func() {
+		regenerateFullTimelapse = originalRegenerateFullTimelapse
+		readLastAppendedSnapshot = originalReadLastAppendedSnapshot
+		writeLastAppendedSnapshot = originalWriteLastAppendedSnapshot
+	}()
+
+	var gotSnapshots []string
+	var gotOutput, gotTracker string
+	regenerateFullTimelapse = func(_ context.Context, _ string, snapshotFiles []string, outputFileName string, archive bool, _ renderOptions) error {
+		gotSnapshots = snapshotFiles
+		gotOutput = outputFileName
+		return nil
+	}
+	readLastAppendedSnapshot = func(timelapseName, format string) (string, error) { return "", nil }
+	writeLastAppendedSnapshot = func(timelapseName, format, snapshotPath string) error {
+		gotTracker = timelapseName
+		return nil
+	}
+
+	// Only cam1 has snapshots; the legacy root snapshots from setupTest must be ignored.
+	now := time.Now()
+	snapshotDir := filepath.Join(config.CameraSnapshotsDir("cam1"), now.Format("2006-01"), now.Format("02"), now.Format("15"))
+	assert.NoError(t, os.MkdirAll(snapshotDir, 0755))
+	camSnap := filepath.Join(snapshotDir, now.Format("2006-01-02-15-04-05")+".jpg")
+	assert.NoError(t, os.WriteFile(camSnap, validSnapshotData(), 0644))
+	util.ReindexSnapshots()
+
+	name := "cam1/24_hour_" + now.Format("2006-01-02")
+	_, err := GenerateSingleTimelapse(t.Context(), name)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{camSnap}, gotSnapshots)
+	assert.Equal(t, DiskPath(name, "webm"), gotOutput)
+	assert.Equal(t, name, gotTracker)
+
+	_, err = GenerateSingleTimelapse(t.Context(), "../etc/24_hour_"+now.Format("2006-01-02"))
+	assert.Error(t, err)
+}
+
+func TestTimelapsePaths_CameraScoped(t *testing.T) {
+	config.AppConfig.DataDir = "/data"
+
+	assert.Equal(t, "/data/timelapse_week_2024-01-01.webm", DiskPath("week_2024-01-01", "webm"))
+	assert.Equal(t, "/data/cameras/cam1/timelapse_week_2024-01-01.mp4", DiskPath("cam1/week_2024-01-01", "mp4"))
+	assert.Equal(t, "/data/cameras/cam1/hls/timelapse_week_2024-01-01/master.m3u8", DiskPath("cam1/week_2024-01-01", "hls"))
+
+	assert.Equal(t, "/data/timelapse_year_2024.webm", TimelapseWebPath("year_2024", "webm"))
+	assert.Equal(t, "/data/cameras/cam1/timelapse_year_2024.webm", TimelapseWebPath("cam1/year_2024", "webm"))
+	assert.Equal(t, "/data/cameras/cam1/hls/timelapse_year_2024/master.m3u8", TimelapseWebPath("cam1/year_2024", "hls"))
+}
+
 // --- Helper function tests ---
 
 func TestParseFileTime(t *testing.T) {
@@ -448,6 +743,12 @@ func TestParseFileTime(t *testing.T) {
 		assert.Equal(t, 12, tm.Hour())
 	})
 
+	t.Run("event frame with tags", func(t *testing.T) {
+		tm, err := parseFileTime("/events/2025-12-22-14-30-05_motion_person.jpg")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2025, 12, 22, 14, 30, 5, 0, time.UTC), tm)
+	})
+
 	t.Run("invalid format", func(t *testing.T) {
 		_, err := parseFileTime("not-a-timestamp.jpg")
 		assert.Error(t, err)
@@ -500,6 +801,7 @@ func setupGalleryFiles(t *testing.T, galleryDir string, start time.Time, days in
 			os.WriteFile(filepath.Join(galleryDir, name), data, 0644)
 		}
 	}
+	util.ReindexSnapshots()
 }
 
 func TestFilterSnapshots_CalendarWindow(t *testing.T) {
@@ -514,7 +816,7 @@ func TestFilterSnapshots_CalendarWindow(t *testing.T) {
 
 	monday := time.Date(2026, 5, 11, 0, 0, 0, 0, time.UTC)
 	setupGalleryFiles(t, config.AppConfig.GalleryDir, monday, 7) // Mon–Sun
-	allFiles := util.GetGalleryFiles()
+	allFiles := util.GetGalleryFiles("")
 	assert.Len(t, allFiles, 7*24, "7 days × 24 hours = 168 gallery files")
 
 	// Weekly calendar window: hourly pattern, no daylight filter
@@ -541,7 +843,7 @@ func TestFilterSnapshots_DaylightFilter(t *testing.T) {
 
 	monday := time.Date(2026, 5, 11, 0, 0, 0, 0, time.UTC)
 	setupGalleryFiles(t, config.AppConfig.GalleryDir, monday, 3)
-	allFiles := util.GetGalleryFiles()
+	allFiles := util.GetGalleryFiles("")
 
 	// Hourly with daylight 7–19: 12 daylight hours per day, 3 days
 	cfg := models.TimelapseConfig{
@@ -571,7 +873,7 @@ func TestFilterSnapshots_3Hourly(t *testing.T) {
 
 	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
 	setupGalleryFiles(t, config.AppConfig.GalleryDir, start, 2)
-	allFiles := util.GetGalleryFiles()
+	allFiles := util.GetGalleryFiles("")
 
 	cfg := models.TimelapseConfig{
 		Name:         "year_2026",
@@ -597,7 +899,7 @@ func TestFilterSnapshots_MonthlyNoonPicking(t *testing.T) {
 	// Create 3 days of gallery images
 	monthStart := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
 	setupGalleryFiles(t, config.AppConfig.GalleryDir, monthStart, 3)
-	allFiles := util.GetGalleryFiles()
+	allFiles := util.GetGalleryFiles("")
 
 	cfg := models.TimelapseConfig{
 		Name:         "month_2026-05",
@@ -614,6 +916,101 @@ func TestFilterSnapshots_MonthlyNoonPicking(t *testing.T) {
 	}
 }
 
+// useSydney pins the local zone to Sydney summer time and sets the site location,
+// so sun times are known: on 2024-12-21 sunrise is 05:41, sunset 20:05 and solar
+// noon 12:53.
+func useSydney(t *testing.T) {
+	t.Helper()
+	orig := time.Local
+	time.Local = time.FixedZone("AEDT", 11*3600)
+	t.Cleanup(func() { time.Local = orig })
+	settings.Set("site.latitude", "-33.8688")
+	settings.Set("site.longitude", "151.2093")
+}
+
+func TestFilterSnapshots_SolarDaylight(t *testing.T) {
+	tempDir, cleanup := setupTest(t)
+	defer cleanup()
+	useSydney(t)
+
+	config.AppConfig.GalleryDir = filepath.Join(tempDir, "gallery")
+	settings.Set("video.daylight_start_hour", "7")
+	settings.Set("video.daylight_end_hour", "19")
+	settings.Set("video.daylight_mode", "sun")
+	settings.Invalidate()
+
+	start := time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC)
+	setupGalleryFiles(t, config.AppConfig.GalleryDir, start, 1)
+	allFiles := util.GetGalleryFiles("")
+	cfg := models.TimelapseConfig{
+		Name:         "week_2024-12-16",
+		FramePattern: "all",
+		WindowStart:  start,
+		WindowEnd:    start.AddDate(0, 0, 1),
+	}
+	hours := func(files []string) []int {
+		var out []int
+		for _, f := range files {
+			tm, err := parseFileTime(f)
+			assert.NoError(t, err)
+			out = append(out, tm.Hour())
+		}
+		return out
+	}
+
+	filtered := filterSnapshots(allFiles, cfg, start)
+	assert.Equal(t, []int{6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, hours(filtered), "sunrise 05:41 to sunset 20:05")
+
+	settings.Set("video.daylight_start_offset_min", "30")
+	settings.Set("video.daylight_end_offset_min", "-30")
+	settings.Invalidate()
+	filtered = filterSnapshots(allFiles, cfg, start)
+	assert.Equal(t, []int{7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, hours(filtered), "06:11 to 19:35 with offsets")
+
+	// Without a site location the solar modes fall back to the fixed hours.
+	settings.Set("site.latitude", "")
+	settings.Invalidate()
+	filtered = filterSnapshots(allFiles, cfg, start)
+	assert.Len(t, filtered, 12, "fixed 7–19 daylight hours")
+}
+
+func TestFilterSnapshots_SolarNoonPicking(t *testing.T) {
+	tempDir, cleanup := setupTest(t)
+	defer cleanup()
+	useSydney(t)
+
+	config.AppConfig.GalleryDir = filepath.Join(tempDir, "gallery")
+	settings.Set("video.daylight_target_hour", "12")
+	settings.Set("video.daylight_target", "solar_noon")
+	settings.Invalidate()
+
+	start := time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC)
+	setupGalleryFiles(t, config.AppConfig.GalleryDir, start, 3)
+	cfg := models.TimelapseConfig{
+		Name:         "month_2024-12",
+		FramePattern: "daily",
+		WindowStart:  start,
+		WindowEnd:    start.AddDate(0, 0, 3),
+	}
+	filtered := filterSnapshots(util.GetGalleryFiles(""), cfg, start)
+	assert.Len(t, filtered, 3, "one image per day for 3 days")
+	for _, f := range filtered {
+		tm, err := parseFileTime(f)
+		assert.NoError(t, err)
+		assert.Equal(t, 13, tm.Hour(), "13:00 is closest to solar noon at 12:53")
+	}
+}
+
+func TestPickClosestToTime(t *testing.T) {
+	files := []string{
+		"/snapshots/2024-12-21-12-30-00.jpg",
+		"/snapshots/2024-12-21-12-45-00.jpg",
+		"/snapshots/2024-12-21-13-15-00.jpg",
+	}
+	target := time.Date(2024, 12, 21, 12, 53, 0, 0, time.UTC)
+	assert.Equal(t, files[1], pickClosestToTime(files, target), "8 minutes beats 22")
+}
+
 // --- GenerateSingleTimelapse: calendar prefix tests ---
 
 func setupCalendarTest(t *testing.T) (string, func()) {
@@ -641,14 +1038,14 @@ func mockVideoFunctions(t *testing.T) (called *bool, restore func()) {
 	origConcat := concatenateVideos
 
 	wasCalled := false
-	regenerateFullTimelapse = func(_ []string, _ string, _ bool) error {
+	regenerateFullTimelapse = func(_ context.Context, _ string, _ []string, _ string, _ bool, _ renderOptions) error {
 		wasCalled = true
 		return nil
 	}
-	writeLastAppendedSnapshot = func(_, _ string) error { return nil }
-	readLastAppendedSnapshot = func(_ string) (string, error) { return "", nil }
-	createVideoSegment = func(_, _ string) error { return nil }
-	concatenateVideos = func(_, _, _ string) error { return nil }
+	writeLastAppendedSnapshot = func(_, _, _ string) error { return nil }
+	readLastAppendedSnapshot = func(_, _ string) (string, error) { return "", nil }
+	createVideoSegment = func(_ context.Context, _, _ string, _ renderOptions) error { return nil }
+	concatenateVideos = func(_ context.Context, _, _, _ string) error { return nil }
 
 	return &wasCalled, func() {
 		regenerateFullTimelapse = origRegen
@@ -670,7 +1067,7 @@ func TestGenerateSingleTimelapse_Week(t *testing.T) {
 	setupGalleryFiles(t, config.AppConfig.GalleryDir, monday, 7)
 
 	name := fmt.Sprintf("week_%s", monday.Format("2006-01-02"))
-	err := GenerateSingleTimelapse(name)
+	_, err := GenerateSingleTimelapse(t.Context(), name)
 	assert.NoError(t, err)
 	assert.True(t, *called, "regenerateFullTimelapse should be called when gallery files exist for the week")
 }
@@ -685,7 +1082,7 @@ func TestGenerateSingleTimelapse_Month(t *testing.T) {
 	setupGalleryFiles(t, config.AppConfig.GalleryDir, monthStart, 5)
 
 	name := fmt.Sprintf("month_%s", monthStart.Format("2006-01"))
-	err := GenerateSingleTimelapse(name)
+	_, err := GenerateSingleTimelapse(t.Context(), name)
 	assert.NoError(t, err)
 	assert.True(t, *called, "regenerateFullTimelapse should be called for a month with gallery files")
 }
@@ -700,7 +1097,7 @@ func TestGenerateSingleTimelapse_Year(t *testing.T) {
 	setupGalleryFiles(t, config.AppConfig.GalleryDir, yearStart, 10)
 
 	name := fmt.Sprintf("year_%d", time.Now().Year())
-	err := GenerateSingleTimelapse(name)
+	_, err := GenerateSingleTimelapse(t.Context(), name)
 	assert.NoError(t, err)
 	assert.True(t, *called, "regenerateFullTimelapse should be called for a year with gallery files")
 }
@@ -709,7 +1106,7 @@ func TestGenerateSingleTimelapse_InvalidName(t *testing.T) {
 	_, cleanup := setupCalendarTest(t)
 	defer cleanup()
 
-	err := GenerateSingleTimelapse("unknown_timelapse_type")
+	_, err := GenerateSingleTimelapse(t.Context(), "unknown_timelapse_type")
 	assert.Error(t, err, "unrecognized timelapse name should return an error")
 }
 
@@ -722,7 +1119,7 @@ func TestGenerateSingleTimelapse_NoGalleryFiles(t *testing.T) {
 	// Empty gallery — no files for the requested week
 	monday := calendarWeekMonday(time.Now().AddDate(0, 0, -365))
 	name := fmt.Sprintf("week_%s", monday.Format("2006-01-02"))
-	err := GenerateSingleTimelapse(name)
+	_, err := GenerateSingleTimelapse(t.Context(), name)
 	assert.NoError(t, err)
 	assert.False(t, *called, "regenerateFullTimelapse should NOT be called when gallery is empty for the window")
 }
@@ -785,28 +1182,57 @@ func TestPrepareSnapshotsForBatch_FiltersSmallFiles(t *testing.T) {
 		filepath.Join(dir, "tiny.jpg"),
 		filepath.Join(dir, "zero.jpg"),
 		filepath.Join(dir, "missing.jpg"),
-	}, 0)
+	})
 
 	assert.Equal(t, []string{valid1, valid2}, result, "only files at or above minValidSnapshotBytes should pass")
 }
 
-func TestPrepareSnapshotsForBatch_CapsAtMaxFrames(t *testing.T) {
-	dir := t.TempDir()
+func TestDecimateFrames(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(1, 0, 0)
+	var daily []string
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		daily = append(daily, d.Add(12*time.Hour).Format("2006-01-02-15-04-05")+".jpg")
+	}
 
-	var files []string
-	for i := 0; i < 10; i++ {
-		f := makeSnapshotFile(t, dir, fmt.Sprintf("snap%02d.jpg", i), int(minValidSnapshotBytes)+i)
-		files = append(files, f)
+	kept := decimateFrames(daily, 100, start, end, "daily")
+	assert.LessOrEqual(t, len(kept), 100)
+	assert.Greater(t, len(kept), 80)
+	assert.Equal(t, "2026-01-01-12-00-00.jpg", kept[0], "January is kept")
+	assert.True(t, strings.HasPrefix(kept[len(kept)-1], "2026-12-"), "the whole year is covered")
+	for _, f := range kept {
+		assert.True(t, strings.HasSuffix(f, "-12-00-00.jpg"), "only pattern frames are kept")
 	}
+	// 365 days into 100 slots rounds up to 4-day slots.
+	assert.Equal(t, "2026-01-05-12-00-00.jpg", kept[1])
 
-	result := prepareSnapshotsForBatch(files, 5)
+	// Within a fixed window, the selection is stable as later frames arrive.
+	partial := decimateFrames(daily[:200], 100, start, end, "daily")
+	assert.Equal(t, kept[:len(partial)], partial)
 
-	assert.Len(t, result, 5, "result should be capped at maxFrames")
-	// Should keep the most recent (last) 5
-	assert.Equal(t, files[5:], result, "should keep the most recent frames when capping")
+	assert.Equal(t, daily, decimateFrames(daily, 0, start, end, "daily"), "0 disables the budget")
+	assert.Equal(t, daily[:10], decimateFrames(daily[:10], 100, start, end, "daily"), "under budget is unchanged")
+
+	var every10s []string
+	for t0 := start; t0.Before(start.Add(24 * time.Hour)); t0 = t0.Add(10 * time.Second) {
+		every10s = append(every10s, t0.Format("2006-01-02-15-04-05")+".jpg")
+	}
+	kept = decimateFrames(every10s, 1000, start, start.Add(24*time.Hour), "all")
+	assert.Len(t, kept, 1000)
+	assert.Equal(t, every10s[0], kept[0])
+
+	assert.Equal(t, time.Hour, patternInterval("hourly"))
+	assert.Equal(t, 3*time.Hour, patternInterval("3_hourly"))
+	assert.Equal(t, 24*time.Hour, patternInterval("daily"))
+	assert.Equal(t, time.Duration(0), patternInterval("all"))
 }
 
-func TestPrepareSnapshotsForBatch_NoCap(t *testing.T) {
+func TestResultString(t *testing.T) {
+	assert.Equal(t, "sampled 5000 of 8760 frames", Result{Frames: 5000, Available: 8760}.String())
+	assert.Equal(t, "24 frames", Result{Frames: 24, Available: 24}.String())
+}
+
+func TestPrepareSnapshotsForBatch_KeepsEveryValidFrame(t *testing.T) {
 	dir := t.TempDir()
 
 	var files []string
@@ -815,12 +1241,12 @@ func TestPrepareSnapshotsForBatch_NoCap(t *testing.T) {
 		files = append(files, f)
 	}
 
-	result := prepareSnapshotsForBatch(files, 0)
-	assert.Len(t, result, 8, "maxFrames=0 disables the cap")
+	result := prepareSnapshotsForBatch(files)
+	assert.Equal(t, files, result, "the frame budget is applied by decimateFrames, not here")
 }
 
 func TestPrepareSnapshotsForBatch_EmptyInput(t *testing.T) {
-	result := prepareSnapshotsForBatch(nil, 100)
+	result := prepareSnapshotsForBatch(nil)
 	assert.Empty(t, result)
 }
 
@@ -835,7 +1261,7 @@ func TestBuildConcatList_FiltersSmallFiles(t *testing.T) {
 	_ = makeSnapshotFile(t, dir, "tiny.jpg", int(minValidSnapshotBytes)-1)
 	missing := filepath.Join(dir, "missing.jpg")
 
-	path, err := buildConcatList("test", []string{validFile, filepath.Join(dir, "tiny.jpg"), missing})
+	path, err := buildConcatList("test", []string{validFile, filepath.Join(dir, "tiny.jpg"), missing}, renderOptions{})
 	assert.NoError(t, err)
 	defer os.Remove(path)
 
@@ -853,7 +1279,67 @@ func TestBuildConcatList_AllInvalid(t *testing.T) {
 	dir := config.AppConfig.DataDir
 	_ = makeSnapshotFile(t, dir, "tiny.jpg", int(minValidSnapshotBytes)-1)
 
-	_, err := buildConcatList("test", []string{filepath.Join(dir, "tiny.jpg")})
+	_, err := buildConcatList("test", []string{filepath.Join(dir, "tiny.jpg")}, renderOptions{})
 	assert.Error(t, err, "all-invalid input should return an error")
 	assert.Contains(t, err.Error(), "no valid snapshots")
 }
+
+// --- concurrent encodes for one camera ---
+
+// installSlowFFmpeg puts an ffmpeg on PATH that waits a moment, then copies the
+// concat list it was given to its output, so overlapping encodes can be told apart.
+func installSlowFFmpeg(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor arg; do\n  [ \"$prev\" = \"-i\" ] && list=\"$arg\"\n  prev=\"$arg\"\ndone\nsleep 0.2\ncat \"$list\" > \"$prev\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestConcurrentEncodes_SameCamera(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	installSlowFFmpeg(t)
+
+	dir := config.CameraDataDir("cam1")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	formats := map[string][]string{
+		"timelapse_24_hour.webm": {makeSnapshotFile(t, dir, "daily_1.jpg", int(minValidSnapshotBytes)), makeSnapshotFile(t, dir, "daily_2.jpg", int(minValidSnapshotBytes))},
+		"timelapse_1_week.webm":  {makeSnapshotFile(t, dir, "weekly_1.jpg", int(minValidSnapshotBytes))},
+	}
+
+	var wg sync.WaitGroup
+	for name, frames := range formats {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, regenerateFullTimelapse(context.Background(), name, frames, filepath.Join(dir, name), false, renderOptions{}))
+		}()
+	}
+	wg.Wait()
+	for name := range formats {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, strings.Contains(name, "24_hour"), strings.Contains(string(content), "daily_"), "%s must be encoded from its own frames", name)
+		assert.Equal(t, strings.Contains(name, "1_week"), strings.Contains(string(content), "weekly_"), "%s must be encoded from its own frames", name)
+	}
+
+	for _, name := range []string{"timelapse_24_hour.webm", "timelapse_1_week.webm"} {
+		segment := filepath.Join(dir, "segment_"+name)
+		assert.NoError(t, os.WriteFile(segment, nil, 0644))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, concatenateVideos(context.Background(), filepath.Join(dir, name), segment, filepath.Join(dir, "concat_"+name)))
+		}()
+	}
+	wg.Wait()
+	for _, name := range []string{"timelapse_24_hour.webm", "timelapse_1_week.webm"} {
+		content, err := os.ReadFile(filepath.Join(dir, "concat_"+name))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("file '%s'\nfile 'segment_%s'\n", name, name), string(content))
+	}
+
+	lists, _ := filepath.Glob(filepath.Join(dir, "*.txt"))
+	assert.Empty(t, lists, "concat lists are removed once each encode finishes")
+}
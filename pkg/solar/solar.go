@@ -0,0 +1,95 @@
+// Package solar computes sunrise, sunset, civil twilight and solar noon for a
+// site from its latitude and longitude, using the sunrise equation NOAA
+// publishes. Results are within a minute or two of published tables, which is
+// ample for picking timelapse frames, and need no network access.
+package solar
+
+import (
+	"math"
+	"time"
+)
+
+// Sun altitudes, in degrees, that mark each event. Sunrise and sunset allow for
+// atmospheric refraction and the radius of the sun's disc.
+const (
+	sunriseAltitude = -0.833
+	civilAltitude   = -6.0
+)
+
+// j2000 is the Julian epoch J2000.0, Julian day 2451545.0.
+var j2000 = time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// Span is the part of a day during which the sun is above a given altitude.
+// Near the poles the sun may stay above it all day (AllDay) or never reach it
+// (None); Start and End are zero in both cases.
+type Span struct {
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+	None   bool
+}
+
+// Contains reports whether t falls within the span.
+func (s Span) Contains(t time.Time) bool {
+	switch {
+	case s.AllDay:
+		return true
+	case s.None:
+		return false
+	default:
+		return !t.Before(s.Start) && t.Before(s.End)
+	}
+}
+
+// Day holds the sun events for one calendar day at a site.
+type Day struct {
+	Noon     time.Time // solar noon, when the sun is highest
+	Daylight Span      // sunrise to sunset
+	Civil    Span      // civil dawn to civil dusk (sun 6° below the horizon)
+}
+
+// For returns the sun events of date's calendar day at latitude lat and
+// longitude lon (degrees, north and east positive). Times are in date's location.
+func For(date time.Time, lat, lon float64) Day {
+	loc := date.Location()
+	y, m, d := date.Date()
+	n := math.Round(time.Date(y, m, d, 12, 0, 0, 0, time.UTC).Sub(j2000).Hours() / 24)
+
+	// Mean solar time, solar mean anomaly, equation of the centre and ecliptic longitude.
+	meanSolar := n - lon/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolar, 360)
+	centre := 1.9148*sinDeg(anomaly) + 0.0200*sinDeg(2*anomaly) + 0.0003*sinDeg(3*anomaly)
+	eclipticLon := math.Mod(anomaly+centre+180+102.9372, 360)
+
+	transit := 2451545.0 + meanSolar + 0.0053*sinDeg(anomaly) - 0.0069*sinDeg(2*eclipticLon)
+	sinDecl := sinDeg(eclipticLon) * sinDeg(23.4397)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+
+	span := func(altitude float64) Span {
+		cosHourAngle := (sinDeg(altitude) - sinDeg(lat)*sinDecl) / (cosDeg(lat) * cosDecl)
+		switch {
+		case cosHourAngle > 1:
+			return Span{None: true}
+		case cosHourAngle < -1:
+			return Span{AllDay: true}
+		}
+		hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+		return Span{
+			Start: julianToTime(transit-hourAngle/360, loc),
+			End:   julianToTime(transit+hourAngle/360, loc),
+		}
+	}
+
+	return Day{
+		Noon:     julianToTime(transit, loc),
+		Daylight: span(sunriseAltitude),
+		Civil:    span(civilAltitude),
+	}
+}
+
+func julianToTime(jd float64, loc *time.Location) time.Time {
+	return j2000.Add(time.Duration((jd - 2451545.0) * 24 * float64(time.Hour))).Round(time.Second).In(loc)
+}
+
+func sinDeg(deg float64) float64 { return math.Sin(deg * math.Pi / 180) }
+func cosDeg(deg float64) float64 { return math.Cos(deg * math.Pi / 180) }
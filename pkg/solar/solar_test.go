@@ -0,0 +1,68 @@
+package solar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertNear checks that got is within two minutes of the published hh:mm.
+func assertNear(t *testing.T, want string, got time.Time, msg string) {
+	t.Helper()
+	w, err := time.ParseInLocation("2006-01-02 15:04", got.Format("2006-01-02 ")+want, got.Location())
+	assert.NoError(t, err)
+	diff := got.Sub(w)
+	if diff < 0 {
+		diff = -diff
+	}
+	assert.LessOrEqual(t, diff, 2*time.Minute, "%s: want ~%s, got %s", msg, want, got.Format("15:04:05"))
+}
+
+func TestFor_London(t *testing.T) {
+	bst := time.FixedZone("BST", 3600)
+	day := For(time.Date(2024, 6, 21, 0, 0, 0, 0, bst), 51.5074, -0.1278)
+
+	assertNear(t, "04:43", day.Daylight.Start, "sunrise")
+	assertNear(t, "21:21", day.Daylight.End, "sunset")
+	assertNear(t, "13:02", day.Noon, "solar noon")
+	assertNear(t, "03:56", day.Civil.Start, "civil dawn")
+	assertNear(t, "22:09", day.Civil.End, "civil dusk")
+	assert.Equal(t, bst, day.Noon.Location())
+}
+
+func TestFor_Sydney(t *testing.T) {
+	aedt := time.FixedZone("AEDT", 11*3600)
+	day := For(time.Date(2024, 12, 21, 15, 30, 0, 0, aedt), -33.8688, 151.2093)
+
+	assertNear(t, "05:41", day.Daylight.Start, "sunrise")
+	assertNear(t, "20:05", day.Daylight.End, "sunset")
+	assertNear(t, "12:53", day.Noon, "solar noon")
+}
+
+func TestFor_Polar(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	lat, lon := 69.6492, 18.9553 // Tromsø
+
+	summer := For(time.Date(2024, 6, 21, 0, 0, 0, 0, cet), lat, lon)
+	assert.True(t, summer.Daylight.AllDay, "midnight sun")
+	assert.True(t, summer.Civil.AllDay)
+	assert.True(t, summer.Daylight.Contains(time.Date(2024, 6, 21, 0, 30, 0, 0, cet)))
+
+	// In midwinter the sun stays below the horizon but still brings civil twilight.
+	winter := For(time.Date(2024, 12, 21, 0, 0, 0, 0, cet), lat, lon)
+	assert.True(t, winter.Daylight.None, "polar night")
+	assert.False(t, winter.Daylight.Contains(winter.Noon))
+	assert.False(t, winter.Civil.None)
+	assert.True(t, winter.Civil.Contains(winter.Noon))
+	assert.False(t, winter.Civil.Contains(winter.Noon.Add(-4*time.Hour)))
+}
+
+func TestSpan_Contains(t *testing.T) {
+	start := time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC)
+	s := Span{Start: start, End: start.Add(12 * time.Hour)}
+
+	assert.True(t, s.Contains(start), "start is inclusive")
+	assert.False(t, s.Contains(start.Add(12*time.Hour)), "end is exclusive")
+	assert.False(t, s.Contains(start.Add(-time.Minute)))
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/shirou/gopsutil/v4/mem"
 
 	"time-machine/pkg/config"
+	"time-machine/pkg/database"
 	"time-machine/pkg/models"
 	"time-machine/pkg/services/video" // Import the video package
 	"time-machine/pkg/util"
@@ -73,19 +74,22 @@ func StartStatsCollector() {
 
 // needs good wrapping with go routines and caching later, leverage the dB and make the UI more async for faster loads.
 
-func HandleImageStatsData() gin.H {
+func HandleImageStatsData(cameraID string) gin.H {
 	return gin.H{
-		"total_images":         GetTotalImagesCount(),
+		"total_images":         GetTotalImagesCount(cameraID),
 		"image_size":           GetImagesDiskUsage(),
-		"last_image_time":      GetLastImageTime(),
+		"last_image_time":      GetLastImageTime(cameraID),
 		"last_processed_image": GetLastProcessedImageName(),
-		"available_dates":      GetAvailableImageDates(),
+		"available_dates":      GetAvailableImageDates(cameraID),
 	}
 }
 
-var GetTotalImagesCount = func() int {
-	// This now counts unprocessed images waiting for the next timelapse generation.
-	return len(GetSnapshotFiles())
+var GetTotalImagesCount = func(cameraID string) int {
+	count, _, err := database.CountSnapshots(cameraID, false)
+	if err != nil {
+		log.Printf("Error counting snapshots: %v", err)
+	}
+	return count
 }
 
 var GetImagesDiskUsage = func() gin.H {
@@ -119,22 +123,22 @@ var GetImagesDiskUsage = func() gin.H {
 	}
 }
 
-var GetLastImageTime = func() string {
-	// This now reflects the most recent snapshot taken for the timelapse.
-	files := GetSnapshotFiles()
-	if len(files) == 0 {
+var GetLastImageTime = func(cameraID string) string {
+	count, latest, err := database.CountSnapshots(cameraID, false)
+	if err != nil || count == 0 {
 		return "N/A"
 	}
+	return util.FormatDateTime(latest.Local())
+}
 
-	lastFilePath := files[len(files)-1]
-	lastFileName := filepath.Base(lastFilePath)
-	timeStr := strings.TrimSuffix(lastFileName, ".jpg")
-
-	t, err := time.Parse("2006-01-02-15-04-05", timeStr)
+// GetMissedSlotCount returns how many of cameraID's capture slots in the last
+// 24 hours produced no snapshot.
+var GetMissedSlotCount = func(cameraID string) int {
+	missed, err := database.GetMissedSnapshots(cameraID, time.Now().Add(-24*time.Hour))
 	if err != nil {
-		return "N/A (Parse Error)"
+		return 0
 	}
-	return util.FormatDateTime(t)
+	return len(missed)
 }
 
 var GetLastProcessedImageName = func() string {
@@ -206,24 +210,17 @@ var GetSystemInfo = func() gin.H {
 	return info
 }
 
-// GetAvailableImageDates now scans the flat gallery directory.
-var GetAvailableImageDates = func() []map[string]string {
-	files, err := os.ReadDir(config.AppConfig.GalleryDir)
+// GetAvailableImageDates lists the dates with gallery images for the given camera, newest first.
+var GetAvailableImageDates = func(cameraID string) []map[string]string {
+	images, err := database.GetSnapshots(cameraID, true, time.Time{}, time.Time{})
 	if err != nil {
-		log.Printf("Error reading gallery directory: %v", err)
+		log.Printf("Error querying gallery index: %v", err)
 		return []map[string]string{}
 	}
 
 	dateSet := make(map[string]struct{})
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".jpg") {
-			// Filename: YYYY-MM-DD-HH.jpg
-			fileName := file.Name()
-			if len(fileName) >= 13 {
-				dateStr := fileName[:10]
-				dateSet[dateStr] = struct{}{}
-			}
-		}
+	for _, image := range images {
+		dateSet[image.CapturedAt.Local().Format("2006-01-02")] = struct{}{}
 	}
 
 	var dates []string
@@ -243,29 +240,36 @@ var GetAvailableImageDates = func() []map[string]string {
 	return result
 }
 
-// GetDailyGallery now uses the dedicated, retained gallery images.
-var GetDailyGallery = func(dateStr string) []map[string]string {
+// GetDailyGallery returns one slot per hour of dateStr with the gallery image of
+// the given camera for that hour, if there is one.
+var GetDailyGallery = func(cameraID, dateStr string) []map[string]string {
 	gallery := make([]map[string]string, 24)
+	urlPrefix := util.CameraWebPrefix(cameraID) + "gallery/"
 
-	for i := 0; i < 24; i++ {
-		hour := fmt.Sprintf("%02d", i)
-		timeLabel := fmt.Sprintf("%s:00", hour)
-
-		// Look for a specific file like 'YYYY-MM-DD-HH.jpg'
-		galleryFileName := fmt.Sprintf("%s-%s.jpg", dateStr, hour)
-		galleryFilePath := filepath.Join(config.AppConfig.GalleryDir, galleryFileName)
+	byHour := make(map[int]string)
+	if day, err := time.ParseInLocation("2006-01-02", dateStr, time.Local); err == nil {
+		images, err := database.GetSnapshots(cameraID, true, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			log.Printf("Error querying gallery index: %v", err)
+		}
+		for _, image := range images {
+			if _, ok := byHour[image.CapturedAt.Local().Hour()]; !ok {
+				byHour[image.CapturedAt.Local().Hour()] = filepath.Base(image.Path)
+			}
+		}
+	}
 
+	for i := 0; i < 24; i++ {
 		url := ""
 		available := "false"
-
-		if util.FileExists(galleryFilePath) {
+		if name, ok := byHour[i]; ok {
 			available = "true"
 			// URL needs to be relative to the DataDir root for serving
-			url = "/data/gallery/" + galleryFileName
+			url = urlPrefix + name
 		}
 
 		gallery[i] = map[string]string{
-			"time":      timeLabel,
+			"time":      fmt.Sprintf("%02d:00", i),
 			"url":       url,
 			"available": available,
 		}
@@ -273,26 +277,37 @@ var GetDailyGallery = func(dateStr string) []map[string]string {
 	return gallery
 }
 
-// GetSnapshotFiles recursively finds all snapshot files in the structured directory.
-func GetSnapshotFiles() []string {
-	var files []string
-	err := filepath.WalkDir(config.AppConfig.SnapshotsDir, func(path string, d os.DirEntry, err error) error {
+// GetEventGallery returns the event frames the given camera captured on dateStr,
+// oldest first, keeping only those tagged tag when it is non-empty.
+func GetEventGallery(cameraID, dateStr, tag string) ([]map[string]string, error) {
+	day, err := time.ParseInLocation("2006-01-02", dateStr, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q: %w", dateStr, err)
+	}
+	frames, err := database.GetEventSnapshots(cameraID, tag, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	dataDir := config.CameraDataDir(cameraID)
+	gallery := make([]map[string]string, 0, len(frames))
+	for _, frame := range frames {
+		rel, err := filepath.Rel(dataDir, frame.Path)
 		if err != nil {
-			return err
+			continue
 		}
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".jpg") {
-			files = append(files, path)
-		}
-		return nil
-	})
-
-	if err != nil {
-		log.Printf("Error walking snapshot directory: %v", err)
-		return []string{}
+		gallery = append(gallery, map[string]string{
+			"time": frame.CapturedAt.Local().Format("15:04:05"),
+			"url":  util.CameraWebPrefix(cameraID) + filepath.ToSlash(rel),
+			"tags": strings.Join(frame.Tags, ","),
+		})
 	}
+	return gallery, nil
+}
 
-	sort.Strings(files) // Sorts chronologically due to file path structure
-	return files
+// GetSnapshotFiles returns every indexed snapshot of the given camera, oldest first.
+func GetSnapshotFiles(cameraID string) []string {
+	return util.GetSnapshotFiles(cameraID)
 }
 
 func fileExists(path string) bool {
@@ -13,6 +13,7 @@ import (
 	"time-machine/pkg/database"
 	"time-machine/pkg/models"
 	"time-machine/pkg/services/settings"
+	"time-machine/pkg/util"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shirou/gopsutil/v4/mem"
@@ -46,6 +47,8 @@ func setupTest(t *testing.T) (string, func()) {
 		dummyFile := filepath.Join(config.AppConfig.GalleryDir, now.Format("2006-01-02-15")+".jpg")
 		os.WriteFile(dummyFile, []byte("dummy"), 0644)
 	}
+	_, _, err = util.ReindexSnapshots()
+	assert.NoError(t, err)
 
 	return tempDir, func() {
 		os.RemoveAll(tempDir)
@@ -56,7 +59,7 @@ func TestGetTotalImagesCount(t *testing.T) {
 	_, cleanup := setupTest(t)
 	defer cleanup()
 
-	count := GetTotalImagesCount()
+	count := GetTotalImagesCount("")
 	assert.Equal(t, 5, count)
 }
 
@@ -76,7 +79,7 @@ func TestGetLastImageTime(t *testing.T) {
 	_, cleanup := setupTest(t)
 	defer cleanup()
 
-	lastTime := GetLastImageTime()
+	lastTime := GetLastImageTime("")
 	assert.NotEqual(t, "N/A", lastTime)
 	assert.NotEqual(t, "N/A (Parse Error)", lastTime)
 }
@@ -140,7 +143,7 @@ func TestGetAvailableImageDates(t *testing.T) {
 	_, cleanup := setupTest(t)
 	defer cleanup()
 
-	dates := GetAvailableImageDates()
+	dates := GetAvailableImageDates("")
 	// The dummy file format is YYYY-MM-DD-HH.jpg, so we get the date part
 	expectedDates := []string{
 		time.Now().Format("2006-01-02"),
@@ -171,7 +174,7 @@ func TestGetDailyGallery(t *testing.T) {
 	defer cleanup()
 
 	today := time.Now().Format("2006-01-02")
-	gallery := GetDailyGallery(today)
+	gallery := GetDailyGallery("", today)
 	assert.Len(t, gallery, 24)
 
 	// Find the created gallery image and check its data
@@ -188,11 +191,57 @@ func TestGetDailyGallery(t *testing.T) {
 	assert.True(t, found, "Did not find gallery item for the current hour")
 }
 
+func TestGetEventGallery(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	at := time.Now().Truncate(time.Second)
+	eventDir := filepath.Join(config.CameraEventsDir("cam1"), at.Format("2006-01"), at.Format("02"))
+	os.MkdirAll(eventDir, 0755)
+	os.WriteFile(filepath.Join(eventDir, util.EventFileName(at, []string{"motion"})), []byte("dummy"), 0644)
+	os.WriteFile(filepath.Join(eventDir, util.EventFileName(at.Add(time.Second), []string{"motion", "person"})), []byte("dummy"), 0644)
+	util.ReindexSnapshots()
+
+	frames, err := GetEventGallery("cam1", at.Format("2006-01-02"), "person")
+	assert.NoError(t, err)
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "motion,person", frames[0]["tags"])
+		expectedURL := fmt.Sprintf("/data/cameras/cam1/events/%s/%s/%s", at.Format("2006-01"), at.Format("02"),
+			util.EventFileName(at.Add(time.Second), []string{"motion", "person"}))
+		assert.Equal(t, expectedURL, frames[0]["url"])
+	}
+
+	frames, err = GetEventGallery("cam1", at.Format("2006-01-02"), "")
+	assert.NoError(t, err)
+	assert.Len(t, frames, 2)
+
+	_, err = GetEventGallery("cam1", "not-a-date", "")
+	assert.Error(t, err)
+}
+
 func TestGetSnapshotFiles(t *testing.T) {
 	_, cleanup := setupTest(t)
 	defer cleanup()
 
-	files := GetSnapshotFiles()
+	files := GetSnapshotFiles("")
 	assert.Len(t, files, 5)
 	assert.True(t, sort.StringsAreSorted(files))
 }
+
+func TestGetDailyGallery_PerCamera(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	now := time.Now()
+	galleryDir := config.CameraGalleryDir("cam1")
+	os.MkdirAll(galleryDir, 0755)
+	os.WriteFile(filepath.Join(galleryDir, now.Format("2006-01-02-15")+".jpg"), []byte("dummy"), 0644)
+	util.ReindexSnapshots()
+
+	gallery := GetDailyGallery("cam1", now.Format("2006-01-02"))
+	expectedURL := fmt.Sprintf("/data/cameras/cam1/gallery/%s.jpg", now.Format("2006-01-02-15"))
+	assert.Equal(t, expectedURL, gallery[now.Hour()]["url"])
+
+	// The legacy root gallery is not visible through the camera's view
+	assert.Empty(t, GetSnapshotFiles("cam1"))
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"strings"
+
+	"time-machine/pkg/database"
+)
+
+// ScopedName prefixes a timelapse name with its camera ID ("<cameraID>/<name>").
+// Scoped names are used for job payloads and timelapse tracker keys so that the
+// same daily/weekly/monthly/yearly name can exist once per camera.
+// An empty cameraID returns name unchanged (legacy single-camera layout).
+func ScopedName(cameraID, name string) string {
+	if cameraID == "" {
+		return name
+	}
+	return cameraID + "/" + name
+}
+
+// SplitScopedName is the inverse of ScopedName.
+func SplitScopedName(scoped string) (cameraID, name string) {
+	if i := strings.Index(scoped, "/"); i >= 0 {
+		return scoped[:i], scoped[i+1:]
+	}
+	return "", scoped
+}
+
+// CameraWebPrefix returns the /data/ URL prefix under which a camera's files are
+// served, ending in a slash. The legacy "" camera maps to "/data/".
+func CameraWebPrefix(cameraID string) string {
+	if cameraID == "" {
+		return "/data/"
+	}
+	return "/data/cameras/" + cameraID + "/"
+}
+
+// ActiveCameraIDs returns the IDs of all enabled cameras. When no cameras are
+// registered (or the DB is unavailable) it returns a single empty ID, which
+// selects the legacy single-camera layout rooted at DataDir.
+func ActiveCameraIDs() []string {
+	cameras, err := database.GetEnabledCameras()
+	if err != nil || len(cameras) == 0 {
+		return []string{""}
+	}
+	ids := make([]string, len(cameras))
+	for i, cam := range cameras {
+		ids[i] = cam.ID
+	}
+	return ids
+}
+
+// AllCameraIDs returns every registered camera, enabled or not, plus the legacy
+// "" root. Cleanup uses this so retention still applies to disabled cameras.
+func AllCameraIDs() []string {
+	ids := []string{""}
+	cameras, err := database.GetCameras()
+	if err != nil {
+		return ids
+	}
+	for _, cam := range cameras {
+		ids = append(ids, cam.ID)
+	}
+	return ids
+}
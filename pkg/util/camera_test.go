@@ -0,0 +1,33 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopedName(t *testing.T) {
+	assert.Equal(t, "24_hour_2024-01-01", ScopedName("", "24_hour_2024-01-01"))
+	assert.Equal(t, "cam1/week_2024-01-01", ScopedName("cam1", "week_2024-01-01"))
+}
+
+func TestSplitScopedName(t *testing.T) {
+	cam, name := SplitScopedName("cam1/month_2024-01")
+	assert.Equal(t, "cam1", cam)
+	assert.Equal(t, "month_2024-01", name)
+
+	cam, name = SplitScopedName("year_2024")
+	assert.Equal(t, "", cam)
+	assert.Equal(t, "year_2024", name)
+}
+
+func TestCameraWebPrefix(t *testing.T) {
+	assert.Equal(t, "/data/", CameraWebPrefix(""))
+	assert.Equal(t, "/data/cameras/cam1/", CameraWebPrefix("cam1"))
+}
+
+func TestActiveCameraIDs_NoDatabase(t *testing.T) {
+	// Without registered cameras the legacy single-camera layout is used.
+	assert.Equal(t, []string{""}, ActiveCameraIDs())
+	assert.Equal(t, []string{""}, AllCameraIDs())
+}
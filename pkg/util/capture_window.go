@@ -0,0 +1,101 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"time-machine/pkg/models"
+	"time-machine/pkg/services/settings"
+	"time-machine/pkg/solar"
+)
+
+// CaptureWindowAnchors lists the events a capture window can start or end at.
+var CaptureWindowAnchors = []string{"clock", "dawn", "sunrise", "noon", "sunset", "dusk"}
+
+var captureWindowNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ValidateCaptureWindow checks a capture window before it is saved. Names become
+// part of timelapse file names, so they are limited to lower-case letters,
+// digits and '-'.
+func ValidateCaptureWindow(w models.CaptureWindow) error {
+	if !captureWindowNamePattern.MatchString(w.Name) {
+		return fmt.Errorf("name may only contain lower-case letters, digits and '-' (up to 32 characters)")
+	}
+	if w.IntervalSec < 1 {
+		return fmt.Errorf("interval must be at least 1 second")
+	}
+	for _, anchor := range []string{w.StartAnchor, w.EndAnchor} {
+		if !validAnchor(anchor) {
+			return fmt.Errorf("unknown anchor %q", anchor)
+		}
+	}
+	if w.Weekdays&0x7f == 0 {
+		return fmt.Errorf("select at least one weekday")
+	}
+	return nil
+}
+
+func validAnchor(anchor string) bool {
+	for _, a := range CaptureWindowAnchors {
+		if a == anchor {
+			return true
+		}
+	}
+	return false
+}
+
+// CaptureWindowRange returns when w runs on day's calendar date, in day's
+// location. ok is false when it does not run that day: the weekday is not in its
+// mask, or it is anchored to a sun event that has no site location set or does
+// not happen that day (polar day or night). A window whose end is not after its
+// start runs past midnight into the next day.
+func CaptureWindowRange(w models.CaptureWindow, day time.Time) (start, end time.Time, ok bool) {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	if w.Weekdays&(1<<uint(midnight.Weekday())) == 0 {
+		return time.Time{}, time.Time{}, false
+	}
+
+	var sun *solar.Day
+	at := func(anchor string, offsetMin int) (time.Time, bool) {
+		offset := time.Duration(offsetMin) * time.Minute
+		if anchor == "clock" {
+			return midnight.Add(offset), true
+		}
+		if sun == nil {
+			lat, lon, ok := settings.SiteLocation()
+			if !ok {
+				return time.Time{}, false
+			}
+			d := solar.For(midnight.Add(12*time.Hour), lat, lon)
+			sun = &d
+		}
+		var event time.Time
+		switch anchor {
+		case "dawn":
+			event = sun.Civil.Start
+		case "sunrise":
+			event = sun.Daylight.Start
+		case "noon":
+			event = sun.Noon
+		case "sunset":
+			event = sun.Daylight.End
+		case "dusk":
+			event = sun.Civil.End
+		}
+		if event.IsZero() {
+			return time.Time{}, false
+		}
+		return event.Add(offset), true
+	}
+
+	start, okStart := at(w.StartAnchor, w.StartOffset)
+	end, okEnd := at(w.EndAnchor, w.EndOffset)
+	if !okStart || !okEnd {
+		return time.Time{}, time.Time{}, false
+	}
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, true
+}
@@ -0,0 +1,76 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"time-machine/pkg/models"
+	"time-machine/pkg/services/settings"
+)
+
+func TestCaptureWindowRange_Clock(t *testing.T) {
+	loc := time.FixedZone("AEST", 10*3600)
+	w := models.CaptureWindow{Name: "morning", IntervalSec: 10, StartAnchor: "clock", StartOffset: 6*60 + 30, EndAnchor: "clock", EndOffset: 7 * 60, Weekdays: 0x7f}
+
+	start, end, ok := CaptureWindowRange(w, time.Date(2024, 5, 1, 15, 0, 0, 0, loc))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 5, 1, 6, 30, 0, 0, loc), start)
+	assert.Equal(t, time.Date(2024, 5, 1, 7, 0, 0, 0, loc), end)
+
+	// 2024-05-01 is a Wednesday; a weekends-only window does not run.
+	w.Weekdays = 1<<uint(time.Saturday) | 1<<uint(time.Sunday)
+	_, _, ok = CaptureWindowRange(w, time.Date(2024, 5, 1, 15, 0, 0, 0, loc))
+	assert.False(t, ok)
+
+	// An end before the start runs past midnight.
+	w = models.CaptureWindow{StartAnchor: "clock", StartOffset: 23 * 60, EndAnchor: "clock", EndOffset: 60, Weekdays: 0x7f}
+	start, end, ok = CaptureWindowRange(w, time.Date(2024, 5, 1, 0, 0, 0, 0, loc))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 5, 1, 23, 0, 0, 0, loc), start)
+	assert.Equal(t, time.Date(2024, 5, 2, 1, 0, 0, 0, loc), end)
+}
+
+func TestCaptureWindowRange_Sun(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	settings.Init()
+
+	aedt := time.FixedZone("AEDT", 11*3600)
+	day := time.Date(2024, 12, 21, 0, 0, 0, 0, aedt)
+	w := models.CaptureWindow{StartAnchor: "sunrise", StartOffset: -30, EndAnchor: "sunrise", EndOffset: 30, Weekdays: 0x7f}
+
+	settings.Set("site.latitude", "")
+	_, _, ok := CaptureWindowRange(w, day)
+	assert.False(t, ok, "sun anchors need a site location")
+
+	// Sydney: sunrise is 05:41 on 2024-12-21.
+	settings.Set("site.latitude", "-33.8688")
+	settings.Set("site.longitude", "151.2093")
+	start, end, ok := CaptureWindowRange(w, day)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Date(2024, 12, 21, 5, 11, 0, 0, aedt), start, 2*time.Minute)
+	assert.Equal(t, time.Hour, end.Sub(start))
+}
+
+func TestValidateCaptureWindow(t *testing.T) {
+	valid := models.CaptureWindow{Name: "sunrise-burst", IntervalSec: 10, StartAnchor: "sunrise", EndAnchor: "clock", Weekdays: 0x7f}
+	assert.NoError(t, ValidateCaptureWindow(valid))
+
+	bad := valid
+	bad.Name = "Sunrise Burst"
+	assert.Error(t, ValidateCaptureWindow(bad), "upper case and spaces")
+
+	bad = valid
+	bad.IntervalSec = 0
+	assert.Error(t, ValidateCaptureWindow(bad))
+
+	bad = valid
+	bad.EndAnchor = "moonrise"
+	assert.Error(t, ValidateCaptureWindow(bad))
+
+	bad = valid
+	bad.Weekdays = 0
+	assert.Error(t, ValidateCaptureWindow(bad))
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"time-machine/pkg/config"
+)
+
+// quarantineReasonSuffix names the text file stored next to each quarantined image.
+const quarantineReasonSuffix = ".reason.txt"
+
+// QuarantineFile moves path into cameraID's quarantine directory and records
+// why it was rejected in a "<name>.reason.txt" file alongside it.
+func QuarantineFile(cameraID, path, reason string) (string, error) {
+	dst, err := quarantinePath(cameraID, filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(path, dst); err != nil {
+		return "", fmt.Errorf("moving %s to quarantine: %w", path, err)
+	}
+	return dst, writeQuarantineReason(dst, reason)
+}
+
+// QuarantineData writes data as name in cameraID's quarantine directory, with
+// the rejection reason alongside it. It is used for captures that were rejected
+// before being stored in the snapshot tree.
+func QuarantineData(cameraID, name string, data []byte, reason string) (string, error) {
+	dst, err := quarantinePath(cameraID, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return "", fmt.Errorf("writing quarantined file %s: %w", dst, err)
+	}
+	return dst, writeQuarantineReason(dst, reason)
+}
+
+// PruneQuarantine removes quarantined files of cameraID last modified before
+// cutoff and returns how many were removed.
+func PruneQuarantine(cameraID string, cutoff time.Time) int {
+	dir := config.CameraQuarantineDir(cameraID)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, entry.Name())) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+func quarantinePath(cameraID, name string) (string, error) {
+	dir := config.CameraQuarantineDir(cameraID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating quarantine directory %s: %w", dir, err)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func writeQuarantineReason(path, reason string) error {
+	reasonPath := strings.TrimSuffix(path, filepath.Ext(path)) + quarantineReasonSuffix
+	line := fmt.Sprintf("%s %s\n", time.Now().UTC().Format(time.RFC3339), reason)
+	if err := os.WriteFile(reasonPath, []byte(line), 0644); err != nil {
+		return fmt.Errorf("writing quarantine reason %s: %w", reasonPath, err)
+	}
+	return nil
+}
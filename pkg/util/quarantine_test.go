@@ -0,0 +1,38 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"time-machine/pkg/config"
+)
+
+func TestQuarantine(t *testing.T) {
+	config.AppConfig.DataDir = t.TempDir()
+	dir := config.CameraQuarantineDir("cam1")
+
+	src := filepath.Join(t.TempDir(), "2024-05-01-10-00-00.jpg")
+	assert.NoError(t, os.WriteFile(src, []byte("jpeg"), 0644))
+	dst, err := QuarantineFile("cam1", src, "segment encoding failed")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "2024-05-01-10-00-00.jpg"), dst)
+	assert.NoFileExists(t, src)
+	reason, _ := os.ReadFile(filepath.Join(dir, "2024-05-01-10-00-00.reason.txt"))
+	assert.Contains(t, string(reason), "segment encoding failed")
+
+	_, err = QuarantineData("cam1", "2024-05-01-10-15-00.jpg", []byte("grey"), "near-uniform image")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "2024-05-01-10-15-00.jpg"))
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"2024-05-01-10-00-00.jpg", "2024-05-01-10-00-00.reason.txt"} {
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, name), old, old))
+	}
+	assert.Equal(t, 2, PruneQuarantine("cam1", time.Now().Add(-24*time.Hour)))
+	remaining, _ := os.ReadDir(dir)
+	assert.Len(t, remaining, 2)
+	assert.Equal(t, 0, PruneQuarantine("missing", time.Now()))
+}
@@ -0,0 +1,186 @@
+package util
+
+import (
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+)
+
+// IndexFile adds the image at path to the snapshot index. The capture time comes
+// from the file name (YYYY-MM-DD-HH-MM-SS.jpg for snapshots, YYYY-MM-DD-HH.jpg
+// for gallery images), falling back to the modification time. Event frames carry
+// their tags in the name too (see EventFileName).
+func IndexFile(cameraID, path string, gallery bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	layout := "2006-01-02-15-04-05"
+	if gallery {
+		layout = "2006-01-02-15"
+	}
+	stamp, tags := splitEventFileName(filepath.Base(path))
+	capturedAt, err := time.ParseInLocation(layout, stamp, time.Local)
+	if err != nil {
+		// Not one of our names, so any '_' in it does not introduce tags either.
+		capturedAt, tags = info.ModTime(), nil
+	}
+
+	record := models.Snapshot{
+		CameraID:   cameraID,
+		Path:       path,
+		CapturedAt: capturedAt,
+		Size:       info.Size(),
+		InGallery:  gallery,
+		Tags:       tags,
+	}
+	if f, err := os.Open(path); err == nil {
+		if cfg, err := jpeg.DecodeConfig(f); err == nil {
+			record.Width, record.Height = cfg.Width, cfg.Height
+		}
+		f.Close()
+	}
+	return database.UpsertSnapshot(record)
+}
+
+// ReindexSnapshots reconciles the snapshot index with the files on disk: files
+// that are not yet indexed are added and rows whose file has gone are removed.
+// Perceptual hashes are only computed at capture time, so files added here have
+// none. It returns how many rows were added and removed.
+func ReindexSnapshots() (added, removed int, err error) {
+	start := time.Now()
+	indexed, err := database.GetIndexedSnapshotPaths()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	seen := make(map[string]bool)
+	index := func(cameraID, path string, gallery bool) {
+		seen[path] = true
+		if indexed[path] {
+			return
+		}
+		if err := IndexFile(cameraID, path, gallery); err != nil {
+			log.Printf("Warning: could not index %s: %v", path, err)
+			return
+		}
+		added++
+	}
+
+	for _, cameraID := range indexCameraIDs() {
+		// An unconfigured legacy layout has empty directories; skip rather than scan ".".
+		if dir := config.CameraSnapshotsDir(cameraID); dir != "" {
+			filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return nil // a missing or unreadable directory just has nothing to index
+				}
+				if !d.IsDir() && strings.HasSuffix(d.Name(), ".jpg") {
+					index(cameraID, path, false)
+				}
+				return nil
+			})
+		}
+		if dir := config.CameraGalleryDir(cameraID); dir != "" {
+			galleryFiles, _ := filepath.Glob(filepath.Join(dir, "*.jpg"))
+			for _, path := range galleryFiles {
+				index(cameraID, path, true)
+			}
+		}
+		// Event frames are only captured for registered cameras, never the legacy layout.
+		if cameraID != "" {
+			filepath.WalkDir(config.CameraEventsDir(cameraID), func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && strings.HasSuffix(d.Name(), ".jpg") {
+					index(cameraID, path, false)
+				}
+				return nil
+			})
+		}
+	}
+
+	var stale []string
+	for path := range indexed {
+		if !seen[path] {
+			stale = append(stale, path)
+		}
+	}
+	if err := database.DeleteSnapshotRecords(stale...); err != nil {
+		return added, 0, err
+	}
+
+	log.Printf("Snapshot index rebuilt in %s: %d added, %d removed.", time.Since(start).Round(time.Millisecond), added, len(stale))
+	return added, len(stale), nil
+}
+
+// EventFileName returns the file name of an event frame captured at t with the
+// given tags: the snapshot time stamp followed by the tags, each after a '_',
+// e.g. "2024-05-01-10-00-00_motion_person.jpg". Keeping the tags in the name
+// lets ReindexSnapshots recover them.
+func EventFileName(t time.Time, tags []string) string {
+	name := t.Format("2006-01-02-15-04-05")
+	for _, tag := range tags {
+		name += "_" + tag
+	}
+	return name + ".jpg"
+}
+
+// splitEventFileName splits a snapshot file name into its time stamp and, for
+// event frames, the tags that follow it.
+func splitEventFileName(name string) (stamp string, tags []string) {
+	parts := strings.Split(strings.TrimSuffix(name, ".jpg"), "_")
+	if len(parts) > 1 {
+		tags = parts[1:]
+	}
+	return parts[0], tags
+}
+
+// NormaliseEventTags turns Protect event types into tags: lower-case letters and
+// digits only ("licensePlate" becomes "licenseplate"), without duplicates or
+// empties, sorted.
+func NormaliseEventTags(types []string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, t := range types {
+		tag := strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+				return r
+			case r >= 'A' && r <= 'Z':
+				return r + 'a' - 'A'
+			}
+			return -1
+		}, t)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// indexCameraIDs returns every registered camera plus any camera directory on
+// disk, so files of cameras that were removed from the database are still indexed
+// and cleaned up.
+func indexCameraIDs() []string {
+	ids := AllCameraIDs()
+	known := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		known[id] = true
+	}
+	entries, _ := os.ReadDir(filepath.Join(config.AppConfig.DataDir, "cameras"))
+	for _, entry := range entries {
+		if entry.IsDir() && !known[entry.Name()] && config.ValidCameraID(entry.Name()) {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids
+}
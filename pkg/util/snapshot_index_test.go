@@ -0,0 +1,100 @@
+package util
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"time-machine/pkg/config"
+	"time-machine/pkg/database"
+	"time-machine/pkg/models"
+)
+
+func TestReindexSnapshots(t *testing.T) {
+	dataDir := t.TempDir()
+	config.AppConfig.DataDir = dataDir
+	config.AppConfig.SnapshotsDir = filepath.Join(dataDir, "snapshots")
+	config.AppConfig.GalleryDir = filepath.Join(dataDir, "gallery")
+	database.InitDB()
+	defer database.GetDB().Close()
+
+	var img bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 64, 48)), nil))
+
+	// cam1 is not registered, but its directory on disk is still indexed.
+	snapDir := filepath.Join(config.CameraSnapshotsDir("cam1"), "2024-05", "01", "10")
+	assert.NoError(t, os.MkdirAll(snapDir, 0755))
+	snap := filepath.Join(snapDir, "2024-05-01-10-15-00.jpg")
+	assert.NoError(t, os.WriteFile(snap, img.Bytes(), 0644))
+	assert.NoError(t, os.MkdirAll(config.CameraGalleryDir("cam1"), 0755))
+	galleryImage := filepath.Join(config.CameraGalleryDir("cam1"), "2024-05-01-10.jpg")
+	assert.NoError(t, os.WriteFile(galleryImage, img.Bytes(), 0644))
+
+	// A row whose file has gone is removed; an existing row keeps its hash.
+	assert.NoError(t, database.UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: "/gone.jpg", CapturedAt: time.Now()}))
+	assert.NoError(t, database.UpsertSnapshot(models.Snapshot{CameraID: "cam1", Path: snap, CapturedAt: time.Now(), Hash: "abcd"}))
+
+	added, removed, err := ReindexSnapshots()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, added, "only the gallery image was missing from the index")
+	assert.Equal(t, 1, removed)
+
+	assert.Equal(t, []string{snap}, GetSnapshotFiles("cam1"))
+	gallery, err := database.GetSnapshots("cam1", true, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, gallery, 1) {
+		assert.Equal(t, galleryImage, gallery[0].Path)
+		assert.Equal(t, 64, gallery[0].Width)
+		assert.Equal(t, 48, gallery[0].Height)
+		assert.True(t, gallery[0].CapturedAt.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)))
+	}
+	snaps, _ := database.GetSnapshots("cam1", false, time.Time{}, time.Time{})
+	if assert.Len(t, snaps, 1) {
+		assert.Equal(t, "abcd", snaps[0].Hash)
+	}
+
+	added, removed, err = ReindexSnapshots()
+	assert.NoError(t, err)
+	assert.Zero(t, added)
+	assert.Zero(t, removed)
+}
+
+func TestReindexSnapshots_EventFrames(t *testing.T) {
+	dataDir := t.TempDir()
+	config.AppConfig.DataDir = dataDir
+	config.AppConfig.SnapshotsDir = filepath.Join(dataDir, "snapshots")
+	config.AppConfig.GalleryDir = filepath.Join(dataDir, "gallery")
+	database.InitDB()
+	defer database.GetDB().Close()
+
+	at := time.Date(2024, 5, 1, 10, 15, 30, 0, time.Local)
+	eventDir := filepath.Join(config.CameraEventsDir("cam1"), "2024-05", "01")
+	assert.NoError(t, os.MkdirAll(eventDir, 0755))
+	frame := filepath.Join(eventDir, EventFileName(at, []string{"motion", "person"}))
+	assert.NoError(t, os.WriteFile(frame, []byte("jpeg"), 0644))
+	assert.Equal(t, "2024-05-01-10-15-30_motion_person.jpg", filepath.Base(frame))
+
+	added, _, err := ReindexSnapshots()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	assert.Empty(t, GetSnapshotFiles("cam1"), "event frames stay out of the snapshot listing")
+	events, err := database.GetEventSnapshots("cam1", "person", time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, []string{"motion", "person"}, events[0].Tags)
+		assert.True(t, events[0].CapturedAt.Equal(at))
+	}
+	assert.Empty(t, GetEventFiles("cam1", "vehicle", time.Time{}, time.Time{}))
+}
+
+func TestNormaliseEventTags(t *testing.T) {
+	assert.Equal(t, []string{"licenseplate", "motion", "person"},
+		NormaliseEventTags([]string{"person", "licensePlate", "motion", "Person", "", "_"}))
+	assert.Nil(t, NormaliseEventTags(nil))
+}
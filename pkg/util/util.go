@@ -6,13 +6,11 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-
-	"time-machine/pkg/config"
+	"time-machine/pkg/database"
 )
 
 func CopyFile(src, dst string) error {
@@ -32,47 +30,47 @@ func CopyFile(src, dst string) error {
 	return err
 }
 
-// GetSnapshotFiles recursively finds all snapshot files in the structured directory.
-func GetSnapshotFiles() []string {
-	var files []string
-	err := filepath.WalkDir(config.AppConfig.SnapshotsDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".jpg") {
-			files = append(files, path)
-		}
-		return nil
-	})
+// GetSnapshotFiles returns every indexed snapshot of the given camera ("" for the
+// legacy single-camera layout), oldest first.
+func GetSnapshotFiles(cameraID string) []string {
+	return GetIndexedFiles(cameraID, false, time.Time{}, time.Time{})
+}
+
+// GetGalleryFiles returns all gallery images sorted chronologically.
+// Gallery files are named YYYY-MM-DD-HH.jpg and have up to 365 days of retention,
+// making them suitable as the image source for weekly, monthly, and yearly timelapses.
+func GetGalleryFiles(cameraID string) []string {
+	return GetIndexedFiles(cameraID, true, time.Time{}, time.Time{})
+}
 
+// GetIndexedFiles returns the paths of cameraID's indexed snapshots (or gallery
+// images) captured in [from, to), oldest first. A zero to means no upper bound.
+func GetIndexedFiles(cameraID string, gallery bool, from, to time.Time) []string {
+	snapshots, err := database.GetSnapshots(cameraID, gallery, from, to)
 	if err != nil {
-		log.Printf("Error walking snapshot directory: %v", err)
+		log.Printf("Error querying snapshot index: %v", err)
 		return []string{}
 	}
-
-	sort.Strings(files) // Sorts chronologically due to file path structure
+	files := make([]string, len(snapshots))
+	for i, s := range snapshots {
+		files[i] = s.Path
+	}
 	return files
 }
 
-// GetGalleryFiles returns all gallery images sorted chronologically.
-// Gallery files are named YYYY-MM-DD-HH.jpg and have up to 365 days of retention,
-// making them suitable as the image source for weekly, monthly, and yearly timelapses.
-func GetGalleryFiles() []string {
-	var files []string
-	err := filepath.WalkDir(config.AppConfig.GalleryDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".jpg") {
-			files = append(files, path)
-		}
-		return nil
-	})
+// GetEventFiles returns the paths of cameraID's event frames captured in
+// [from, to), oldest first, optionally only those tagged tag. A zero to means no
+// upper bound.
+func GetEventFiles(cameraID, tag string, from, to time.Time) []string {
+	snapshots, err := database.GetEventSnapshots(cameraID, tag, from, to)
 	if err != nil {
-		log.Printf("Error walking gallery directory: %v", err)
+		log.Printf("Error querying snapshot index: %v", err)
 		return []string{}
 	}
-	sort.Strings(files)
+	files := make([]string, len(snapshots))
+	for i, s := range snapshots {
+		files[i] = s.Path
+	}
 	return files
 }
 
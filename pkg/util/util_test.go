@@ -9,20 +9,25 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"time-machine/pkg/config"
+	"time-machine/pkg/database"
 )
 
 func setupTest(t *testing.T) (string, func()) {
 	tempDir, err := os.MkdirTemp("", "util-test")
 	assert.NoError(t, err)
 
+	config.AppConfig.DataDir = tempDir
 	config.AppConfig.SnapshotsDir = filepath.Join(tempDir, "snapshots")
 	os.MkdirAll(config.AppConfig.SnapshotsDir, 0755)
+	database.InitDB()
 
 	// Create some dummy snapshot files
 	for i := 0; i < 3; i++ {
 		dummyFile := filepath.Join(config.AppConfig.SnapshotsDir, fmt.Sprintf("snapshot_%d.jpg", i))
 		os.WriteFile(dummyFile, []byte("dummy"), 0644)
 	}
+	_, _, err = ReindexSnapshots()
+	assert.NoError(t, err)
 
 	return tempDir, func() {
 		os.RemoveAll(tempDir)
@@ -49,7 +54,7 @@ func TestGetSnapshotFiles(t *testing.T) {
 	_, cleanup := setupTest(t)
 	defer cleanup()
 
-	files := GetSnapshotFiles()
+	files := GetSnapshotFiles("")
 	assert.Len(t, files, 3)
 	assert.True(t, sort.StringsAreSorted(files))
 }
@@ -99,8 +104,9 @@ func TestGetGalleryFiles(t *testing.T) {
 	}
 	// Non-jpg file should be ignored
 	os.WriteFile(filepath.Join(galleryDir, "notes.txt"), []byte("x"), 0644)
+	ReindexSnapshots()
 
-	files := GetGalleryFiles()
+	files := GetGalleryFiles("")
 	assert.Len(t, files, 3, "should return only .jpg files")
 	assert.True(t, sort.StringsAreSorted(files), "results must be sorted chronologically")
 
@@ -120,7 +126,22 @@ func TestGetGalleryFiles_EmptyDir(t *testing.T) {
 	originalGalleryDir := config.AppConfig.GalleryDir
 	config.AppConfig.GalleryDir = galleryDir
 	defer func() { config.AppConfig.GalleryDir = originalGalleryDir }()
+	config.AppConfig.DataDir = tempDir
+	database.InitDB()
+	ReindexSnapshots()
 
-	files := GetGalleryFiles()
+	files := GetGalleryFiles("")
 	assert.Empty(t, files, "empty gallery directory should return no files")
 }
+
+func TestGetSnapshotFiles_PerCamera(t *testing.T) {
+	config.AppConfig.DataDir = t.TempDir()
+	camDir := filepath.Join(config.CameraSnapshotsDir("cam1"), "2024-01", "01", "10")
+	os.MkdirAll(camDir, 0755)
+	os.WriteFile(filepath.Join(camDir, "2024-01-01-10-00-00.jpg"), []byte("x"), 0644)
+	database.InitDB()
+	ReindexSnapshots()
+
+	assert.Len(t, GetSnapshotFiles("cam1"), 1)
+	assert.Empty(t, GetSnapshotFiles("cam2"))
+}
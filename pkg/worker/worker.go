@@ -1,34 +1,127 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sync"
 	"time"
 
 	"time-machine/pkg/jobs"
 	"time-machine/pkg/models"
+	"time-machine/pkg/services/settings"
 	"time-machine/pkg/services/video"
 )
 
+// ErrJobNotActive is returned by Cancel for a job that is neither pending nor
+// running.
+var ErrJobNotActive = errors.New("job is not pending or running")
+
+// ErrJobNotCancellable is returned by Cancel for a running job that cannot be
+// stopped part way, such as a cleanup.
+var ErrJobNotCancellable = errors.New("running job cannot be cancelled")
+
+// running holds the cancel func of each job being processed, by job ID.
+var running = struct {
+	sync.Mutex
+	cancels map[int64]context.CancelFunc
+}{cancels: make(map[int64]context.CancelFunc)}
+
+// Cancel stops job id. A running timelapse job has its context cancelled,
+// which kills its FFmpeg process; processJob then marks it cancelled. A pending
+// job is marked cancelled straight away so it is never picked up. Other running
+// jobs are left to finish.
+func Cancel(id int64) error {
+	running.Lock()
+	cancel, ok := running.cancels[id]
+	running.Unlock()
+	if ok {
+		log.Printf("Cancelling running job %d", id)
+		cancel()
+		return nil
+	}
+
+	cancelled, err := jobs.CancelPendingJob(id)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		if status, err := jobs.GetJobStatus(id); err == nil && status == "processing" {
+			return ErrJobNotCancellable
+		}
+		return ErrJobNotActive
+	}
+	log.Printf("Cancelled pending job %d", id)
+	return nil
+}
+
+// Cancellable reports whether a running job of jobType can be cancelled. Only
+// timelapse generation stops part way; cleanups run to completion.
+func Cancellable(jobType string) bool {
+	return jobType == "generate_timelapse"
+}
+
+// trackJob registers the cancel func of job id until the returned func is called.
+func trackJob(id int64, cancel context.CancelFunc) func() {
+	running.Lock()
+	running.cancels[id] = cancel
+	running.Unlock()
+	return func() {
+		running.Lock()
+		delete(running.cancels, id)
+		running.Unlock()
+		cancel()
+	}
+}
+
+// processJob runs a job and records how it went. Finished jobs stay in the
+// table as history until a cleanup_jobs job prunes them; a failed job is
+// retried after a backoff until it runs out of attempts.
 func processJob(job *models.Job) {
-	log.Printf("Processing job %d: %s", job.ID, job.JobType)
-	err := jobs.UpdateJobStatus(job.ID, "processing", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	if Cancellable(job.JobType) {
+		defer trackJob(job.ID, cancel)()
+	} else {
+		defer cancel()
+	}
+
+	// StartJob only claims a job that is still pending, so one cancelled
+	// between being fetched and registered is skipped.
+	started, err := jobs.StartJob(job.ID)
 	if err != nil {
 		log.Printf("Error updating job status to processing: %v", err)
 		return
 	}
+	if !started {
+		log.Printf("Skipping job %d, which is no longer pending", job.ID)
+		return
+	}
+	log.Printf("Processing job %d: %s", job.ID, job.JobType)
 
+	// A job that can never succeed is dead-lettered without being retried.
 	var jobErr error
+	permanent := false
 	switch job.JobType {
 	case "generate_timelapse":
 		var payload struct {
 			TimelapseName string `json:"timelapse_name"`
 		}
 		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
-			jobErr = err
+			jobErr, permanent = err, true
 		} else {
-			jobErr = video.GenerateSingleTimelapse(payload.TimelapseName)
+			var result video.Result
+			startGenerating(payload.TimelapseName)
+			result, jobErr = video.GenerateSingleTimelapse(ctx, payload.TimelapseName)
+			finishGenerating(payload.TimelapseName, jobErr)
+			if jobErr == nil && result.Available > 0 {
+				log.Printf("Job %d (%s): %s", job.ID, payload.TimelapseName, result)
+				if err := jobs.SetJobResult(job.ID, result.String()); err != nil {
+					log.Printf("Error recording result of job %d: %v", job.ID, err)
+				}
+			}
 		}
 	case "cleanup_snapshots":
 		video.CleanupSnapshots()
@@ -38,48 +131,145 @@ func processJob(job *models.Job) {
 		video.CleanOldVideos()
 	case "cleanup_logs":
 		video.CleanupLogFiles()
+	case "cleanup_jobs":
+		var n int64
+		if n, jobErr = jobs.PruneJobs(settings.GetInt("jobs.history_days", 7)); jobErr == nil && n > 0 {
+			log.Printf("Pruned %d finished job(s) from the job history", n)
+		}
 	default:
-		jobErr = fmt.Errorf("unknown job type: %s", job.JobType)
+		jobErr, permanent = fmt.Errorf("unknown job type: %s", job.JobType), true
 		log.Println(jobErr)
 	}
 
-	if jobErr != nil {
-		log.Printf("Error processing job %d: %v", job.ID, jobErr)
-		err = jobs.UpdateJobStatus(job.ID, "failed", jobErr)
-	} else {
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("Job %d cancelled", job.ID)
+		err = jobs.FinishJob(job.ID, "cancelled", nil)
+	case jobErr == nil:
 		log.Printf("Job %d completed successfully", job.ID)
-		err = jobs.UpdateJobStatus(job.ID, "completed", nil)
+		err = jobs.FinishJob(job.ID, "completed", nil)
+	case permanent:
+		log.Printf("Error processing job %d, not retrying: %v", job.ID, jobErr)
+		err = jobs.FinishJob(job.ID, "dead", jobErr)
+	default:
+		var status string
+		if status, err = jobs.FailJob(job.ID, jobErr); status == "dead" {
+			log.Printf("Error processing job %d, giving up after its last attempt: %v", job.ID, jobErr)
+		} else if err == nil {
+			log.Printf("Error processing job %d, will retry: %v", job.ID, jobErr)
+		}
 	}
-
 	if err != nil {
-		log.Printf("Error updating job status after completion/failure: %v", err)
+		log.Printf("Error updating status of job %d: %v", job.ID, err)
 	}
+}
 
-	err = jobs.DeleteJob(job.ID)
-	if err != nil {
-		log.Printf("Error deleting job %d: %v", job.ID, err)
+// generating lists the timelapses being generated, in the order they started.
+// It is guarded by models.VideoStatusData.
+var generating []string
+
+// startGenerating publishes name as the timelapse being generated. With
+// several generating at once, the status shows the latest to start.
+func startGenerating(name string) {
+	models.VideoStatusData.Lock()
+	defer models.VideoStatusData.Unlock()
+	generating = append(generating, name)
+	models.VideoStatusData.IsRunning = true
+	models.VideoStatusData.CurrentlyGenerating = name
+}
+
+// finishGenerating removes name from the timelapses being generated, recording
+// when it finished and the error it failed with, if any, or "cancelled".
+func finishGenerating(name string, err error) {
+	now := time.Now()
+	models.VideoStatusData.Lock()
+	defer models.VideoStatusData.Unlock()
+	if i := slices.Index(generating, name); i >= 0 {
+		generating = slices.Delete(generating, i, i+1)
+	}
+	models.VideoStatusData.IsRunning = len(generating) > 0
+	models.VideoStatusData.CurrentlyGenerating = ""
+	if len(generating) > 0 {
+		models.VideoStatusData.CurrentlyGenerating = generating[len(generating)-1]
+	}
+	models.VideoStatusData.LastRun = &now
+	models.VideoStatusData.Error = ""
+	if errors.Is(err, context.Canceled) {
+		models.VideoStatusData.Error = "cancelled"
+	} else if err != nil {
+		models.VideoStatusData.Error = err.Error()
 	}
 }
 
-func Start() {
-	log.Println("Starting job worker...")
-	// This is a simple, single-threaded worker.
-	// Will need to expand this if we do more cameras
+// pollInterval is how often the worker looks for pending jobs when it has not
+// been woken by a job being queued or finishing.
+const pollInterval = 10 * time.Second
 
-	for {
-		job, err := jobs.GetPendingJob()
-		if err != nil {
-			log.Printf("Error getting pending job: %v", err)
-			time.Sleep(10 * time.Second) // Wait before retrying
-			continue
-		}
+// Concurrency returns how many jobs of jobType may run at once, from the
+// jobs.<jobType>_concurrency setting; at least one.
+func Concurrency(jobType string) int {
+	return max(settings.GetInt("jobs."+jobType+"_concurrency", 1), 1)
+}
+
+// pool runs pending jobs on goroutines of their own, highest priority first,
+// keeping each job type within its Concurrency.
+type pool struct {
+	run     func(*models.Job)
+	active  map[string]int // running jobs by job type
+	started map[int64]bool // IDs of running jobs
+	done    chan *models.Job
+}
 
-		if job == nil {
-			// No pending jobs, wait a bit
-			time.Sleep(10 * time.Second)
+func newPool(run func(*models.Job)) *pool {
+	return &pool{
+		run:     run,
+		active:  make(map[string]int),
+		started: make(map[int64]bool),
+		done:    make(chan *models.Job),
+	}
+}
+
+// dispatch starts every pending job whose type has a free slot. Jobs already
+// started are skipped: they stay pending until their goroutine marks them
+// processing.
+func (p *pool) dispatch() {
+	pending, err := jobs.GetPendingJobs()
+	if err != nil {
+		log.Printf("Error getting pending jobs: %v", err)
+		return
+	}
+	for i := range pending {
+		job := &pending[i]
+		if p.started[job.ID] || p.active[job.JobType] >= Concurrency(job.JobType) {
 			continue
 		}
+		p.active[job.JobType]++
+		p.started[job.ID] = true
+		go func() {
+			p.run(job)
+			p.done <- job
+		}()
+	}
+}
+
+// finish frees the slot of a job that has returned.
+func (p *pool) finish(job *models.Job) {
+	p.active[job.JobType]--
+	delete(p.started, job.ID)
+}
 
-		processJob(job)
+// Start runs the job worker. Jobs are dispatched as soon as they are queued or
+// a slot frees up, and otherwise every pollInterval.
+func Start() {
+	log.Println("Starting job worker...")
+	p := newPool(processJob)
+	for {
+		p.dispatch()
+		select {
+		case <-jobs.Wake():
+		case job := <-p.done:
+			p.finish(job)
+		case <-time.After(pollInterval):
+		}
 	}
 }
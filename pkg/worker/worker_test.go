@@ -1,9 +1,12 @@
 package worker
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 	"time-machine/pkg/jobs"
 	"time-machine/pkg/models"
 	"time-machine/pkg/services/video"
@@ -21,7 +24,15 @@ func setupTestDB(t *testing.T) *sql.DB {
 		"job_type" TEXT NOT NULL,
 		"payload" TEXT,
 		"status" TEXT NOT NULL DEFAULT 'pending',
+		"priority" INTEGER NOT NULL DEFAULT 0,
+		"attempts" INTEGER NOT NULL DEFAULT 0,
+		"max_attempts" INTEGER NOT NULL DEFAULT 3,
+		"run_after" DATETIME,
+		"started_at" DATETIME,
+		"finished_at" DATETIME,
+		"duration_ms" INTEGER,
 		"error" TEXT,
+		"result" TEXT,
 		"created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
 		"updated_at" DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
@@ -37,7 +48,7 @@ func TestProcessJob(t *testing.T) {
 	defer db.Close()
 
 	// Mock video service functions
-	video.GenerateSingleTimelapse = func(timelapseName string) error { return nil }
+	video.GenerateSingleTimelapse = func(_ context.Context, timelapseName string) (video.Result, error) { return video.Result{}, nil }
 	video.CleanupSnapshots = func() {}
 	video.CleanOldVideos = func() {}
 	video.CleanupLogFiles = func() {}
@@ -45,17 +56,20 @@ func TestProcessJob(t *testing.T) {
 	// Test "generate_timelapse" job
 	payload, _ := json.Marshal(map[string]string{"timelapse_name": "24_hour"})
 	job := &models.Job{ID: 1, JobType: "generate_timelapse", Payload: string(payload)}
+	jobs.CreateJob(job.JobType, map[string]string{"timelapse_name": "24_hour"}, jobs.PriorityNormal)
 	processJob(job)
 
 	var status string
 	err := db.QueryRow("SELECT status FROM jobs WHERE id = ?", 1).Scan(&status)
-	if err != nil && err != sql.ErrNoRows { // Job is deleted after processing
+	if err != nil && err != sql.ErrNoRows {
 		t.Fatalf("Failed to query job status: %v", err)
 	}
+	assert.False(t, models.VideoStatusData.IsRunning)
+	assert.NotNil(t, models.VideoStatusData.LastRun, "finished generations are recorded")
 
 	// Test "cleanup_snapshots" job
 	job = &models.Job{ID: 2, JobType: "cleanup_snapshots"}
-	jobs.CreateJob(job.JobType, nil)
+	jobs.CreateJob(job.JobType, nil, jobs.PriorityNormal)
 	processJob(job)
 	err = db.QueryRow("SELECT status FROM jobs WHERE id = ?", 2).Scan(&status)
 	if err != nil && err != sql.ErrNoRows {
@@ -64,7 +78,7 @@ func TestProcessJob(t *testing.T) {
 
 	// Test "cleanup_videos" job
 	job = &models.Job{ID: 3, JobType: "cleanup_videos"}
-	jobs.CreateJob(job.JobType, nil)
+	jobs.CreateJob(job.JobType, nil, jobs.PriorityNormal)
 	processJob(job)
 	err = db.QueryRow("SELECT status FROM jobs WHERE id = ?", 3).Scan(&status)
 	if err != nil && err != sql.ErrNoRows {
@@ -73,7 +87,7 @@ func TestProcessJob(t *testing.T) {
 
 	// Test "cleanup_logs" job
 	job = &models.Job{ID: 4, JobType: "cleanup_logs"}
-	jobs.CreateJob(job.JobType, nil)
+	jobs.CreateJob(job.JobType, nil, jobs.PriorityNormal)
 	processJob(job)
 	err = db.QueryRow("SELECT status FROM jobs WHERE id = ?", 4).Scan(&status)
 	if err != nil && err != sql.ErrNoRows {
@@ -82,7 +96,7 @@ func TestProcessJob(t *testing.T) {
 
 	// Test unknown job type
 	job = &models.Job{ID: 5, JobType: "unknown_job"}
-	jobs.CreateJob(job.JobType, nil)
+	jobs.CreateJob(job.JobType, nil, jobs.PriorityNormal)
 	processJob(job)
 	err = db.QueryRow("SELECT status FROM jobs WHERE id = ?", 5).Scan(&status)
 	if err != nil && err != sql.ErrNoRows {
@@ -91,10 +105,238 @@ func TestProcessJob(t *testing.T) {
 
 	// Test invalid payload
 	job = &models.Job{ID: 6, JobType: "generate_timelapse", Payload: "invalid payload"}
-	jobs.CreateJob(job.JobType, "invalid payload")
+	jobs.CreateJob(job.JobType, "invalid payload", jobs.PriorityNormal)
 	processJob(job)
 	err = db.QueryRow("SELECT status FROM jobs WHERE id = ?", 6).Scan(&status)
 	if err != nil && err != sql.ErrNoRows {
 		t.Fatalf("Failed to query job status: %v", err)
 	}
 }
+
+func TestProcessJob_PublishesGenerationStatus(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	orig := video.GenerateSingleTimelapse
+	t.Cleanup(func() { video.GenerateSingleTimelapse = orig })
+	var runningDuring bool
+	var nameDuring string
+	video.GenerateSingleTimelapse = func(_ context.Context, timelapseName string) (video.Result, error) {
+		models.VideoStatusData.RLock()
+		defer models.VideoStatusData.RUnlock()
+		runningDuring = models.VideoStatusData.IsRunning
+		nameDuring = models.VideoStatusData.CurrentlyGenerating
+		return video.Result{}, errors.New("encode failed")
+	}
+
+	payload, _ := json.Marshal(map[string]string{"timelapse_name": "cam1/year_2026"})
+	id, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": "cam1/year_2026"}, jobs.PriorityNormal)
+	assert.NoError(t, err)
+	processJob(&models.Job{ID: id, JobType: "generate_timelapse", Payload: string(payload)})
+
+	assert.True(t, runningDuring)
+	assert.Equal(t, "cam1/year_2026", nameDuring)
+	assert.False(t, models.VideoStatusData.IsRunning)
+	assert.Empty(t, models.VideoStatusData.CurrentlyGenerating)
+	assert.Equal(t, "encode failed", models.VideoStatusData.Error)
+}
+
+func TestCancel(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	orig := video.GenerateSingleTimelapse
+	t.Cleanup(func() { video.GenerateSingleTimelapse = orig })
+	started := make(chan struct{})
+	video.GenerateSingleTimelapse = func(ctx context.Context, _ string) (video.Result, error) {
+		close(started)
+		<-ctx.Done()
+		return video.Result{}, ctx.Err()
+	}
+
+	payload, _ := json.Marshal(map[string]string{"timelapse_name": "24_hour"})
+	id, err := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": "24_hour"}, jobs.PriorityNormal)
+	assert.NoError(t, err)
+	job := &models.Job{ID: id, JobType: "generate_timelapse", Payload: string(payload)}
+
+	done := make(chan struct{})
+	go func() {
+		processJob(job)
+		close(done)
+	}()
+	<-started
+	assert.NoError(t, Cancel(job.ID))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled job did not stop")
+	}
+
+	status, err := jobs.GetJobStatus(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "cancelled", status, "cancelled jobs are kept, not deleted")
+	assert.Equal(t, "cancelled", models.VideoStatusData.Error)
+	assert.ErrorIs(t, Cancel(job.ID), ErrJobNotActive)
+}
+
+func TestCancel_Pending(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	orig := video.CleanupSnapshots
+	t.Cleanup(func() { video.CleanupSnapshots = orig })
+	ran := false
+	video.CleanupSnapshots = func() { ran = true }
+
+	id, err := jobs.CreateJob("cleanup_snapshots", nil, jobs.PriorityNormal)
+	assert.NoError(t, err)
+	job := &models.Job{ID: id, JobType: "cleanup_snapshots"}
+	assert.NoError(t, Cancel(job.ID))
+
+	pending, err := jobs.GetPendingJobs()
+	assert.NoError(t, err)
+	assert.Empty(t, pending, "a cancelled job is not picked up")
+	processJob(job)
+	assert.False(t, ran, "a job cancelled after it was fetched is skipped")
+	status, _ := jobs.GetJobStatus(job.ID)
+	assert.Equal(t, "cancelled", status)
+}
+
+func TestCancel_RunningCleanup(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	orig := video.CleanupSnapshots
+	t.Cleanup(func() { video.CleanupSnapshots = orig })
+	started, release := make(chan struct{}), make(chan struct{})
+	video.CleanupSnapshots = func() {
+		close(started)
+		<-release
+	}
+
+	id, err := jobs.CreateJob("cleanup_snapshots", nil, jobs.PriorityNormal)
+	assert.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		processJob(&models.Job{ID: id, JobType: "cleanup_snapshots"})
+		close(done)
+	}()
+	<-started
+	assert.ErrorIs(t, Cancel(id), ErrJobNotCancellable, "a running cleanup cannot be stopped part way")
+	close(release)
+	<-done
+
+	status, _ := jobs.GetJobStatus(id)
+	assert.Equal(t, "completed", status, "the cleanup ran to completion")
+}
+
+func TestPool_PriorityAndConcurrency(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	yearly, _ := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": "year_2026"}, jobs.PriorityLow)
+	daily, _ := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": "24_hour_2026-10-16"}, jobs.PriorityHigh)
+	cleanup, _ := jobs.CreateJob("cleanup_logs", nil, jobs.PriorityNormal)
+
+	started := make(chan int64, 3)
+	release := map[int64]chan struct{}{yearly: make(chan struct{}), daily: make(chan struct{}), cleanup: make(chan struct{})}
+	p := newPool(func(job *models.Job) {
+		started <- job.ID
+		<-release[job.ID]
+		jobs.FinishJob(job.ID, "completed", nil)
+	})
+
+	p.dispatch()
+	assert.ElementsMatch(t, []int64{daily, cleanup}, []int64{<-started, <-started},
+		"the daily lapse goes ahead of the yearly one, and the cleanup runs alongside it")
+	p.dispatch()
+	assert.Empty(t, started, "generate_timelapse jobs run one at a time by default")
+
+	close(release[daily])
+	p.finish(<-p.done)
+	p.dispatch()
+	assert.Equal(t, yearly, <-started, "a freed slot goes to the next job of its type")
+
+	close(release[yearly])
+	close(release[cleanup])
+	p.finish(<-p.done)
+	p.finish(<-p.done)
+	assert.Empty(t, p.started)
+}
+
+func TestCreateJob_WakesWorker(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	select {
+	case <-jobs.Wake():
+	default:
+	}
+	jobs.CreateJob("cleanup_logs", nil, jobs.PriorityNormal)
+	select {
+	case <-jobs.Wake():
+	case <-time.After(time.Second):
+		t.Fatal("queuing a job did not wake the worker")
+	}
+}
+
+func TestFinishGenerating_Concurrent(t *testing.T) {
+	startGenerating("year_2026")
+	startGenerating("24_hour_2026-10-16")
+
+	finishGenerating("24_hour_2026-10-16", nil)
+	assert.True(t, models.VideoStatusData.IsRunning, "the yearly lapse is still generating")
+	assert.Equal(t, "year_2026", models.VideoStatusData.CurrentlyGenerating)
+
+	finishGenerating("year_2026", nil)
+	assert.False(t, models.VideoStatusData.IsRunning)
+	assert.Empty(t, models.VideoStatusData.CurrentlyGenerating)
+}
+
+func TestProcessJob_RetriesAndKeepsHistory(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	orig, origCleanup := video.GenerateSingleTimelapse, video.CleanupLogFiles
+	t.Cleanup(func() { video.GenerateSingleTimelapse, video.CleanupLogFiles = orig, origCleanup })
+	video.GenerateSingleTimelapse = func(context.Context, string) (video.Result, error) {
+		return video.Result{}, errors.New("encode failed")
+	}
+	video.CleanupLogFiles = func() {}
+
+	type row struct {
+		status            string
+		attempts          int
+		waiting, finished bool
+		errStr            sql.NullString
+	}
+	load := func(id int64) row {
+		t.Helper()
+		var r row
+		err := db.QueryRow("SELECT status, attempts, run_after IS NOT NULL, finished_at IS NOT NULL AND duration_ms IS NOT NULL, error FROM jobs WHERE id = ?", id).
+			Scan(&r.status, &r.attempts, &r.waiting, &r.finished, &r.errStr)
+		assert.NoError(t, err)
+		return r
+	}
+
+	payload, _ := json.Marshal(map[string]string{"timelapse_name": "year_2026"})
+	failing, _ := jobs.CreateJob("generate_timelapse", map[string]string{"timelapse_name": "year_2026"}, jobs.PriorityLow)
+	processJob(&models.Job{ID: failing, JobType: "generate_timelapse", Payload: string(payload)})
+	job := load(failing)
+	assert.Equal(t, "pending", job.status, "a failed job is retried")
+	assert.Equal(t, 1, job.attempts)
+	assert.True(t, job.waiting, "the retry waits out a backoff")
+	assert.Equal(t, "encode failed", job.errStr.String)
+
+	unknown, _ := jobs.CreateJob("unknown_job", nil, jobs.PriorityNormal)
+	processJob(&models.Job{ID: unknown, JobType: "unknown_job"})
+	job = load(unknown)
+	assert.Equal(t, "dead", job.status, "a job that can never succeed is not retried")
+	assert.Equal(t, 1, job.attempts)
+
+	done, _ := jobs.CreateJob("cleanup_logs", nil, jobs.PriorityNormal)
+	processJob(&models.Job{ID: done, JobType: "cleanup_logs"})
+	job = load(done)
+	assert.Equal(t, "completed", job.status, "finished jobs are kept as history")
+	assert.True(t, job.finished)
+}
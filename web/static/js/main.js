@@ -1,6 +1,14 @@
-// Go variables (availableDates, defaultDate, initialGalleryData) are defined in index.html.
+// Go variables (availableDates, defaultDate, initialGalleryData, selectedCamera) are defined in index.html.
 document.addEventListener('DOMContentLoaded', () => {
 
+    // --- Camera picker ---
+    const cameraPicker = document.getElementById('camera-picker');
+    if (cameraPicker) {
+        cameraPicker.addEventListener('change', () => {
+            window.location.search = `?camera=${encodeURIComponent(cameraPicker.value)}`;
+        });
+    }
+
     // --- Player initialisation (Video.js) ---
     const vjsInstances = new Map();
 
@@ -10,10 +18,67 @@ document.addEventListener('DOMContentLoaded', () => {
         return 'video/webm';
     }
 
+    // --- Seek-preview thumbnails ---
+    // A WebVTT thumbnails track maps time ranges to regions of a sprite sheet:
+    // "00:00:01.000 --> 00:00:02.000" followed by "sprite.jpg#xywh=x,y,w,h".
+    function vttSeconds(stamp) {
+        return stamp.split(':').reduce((total, part) => total * 60 + parseFloat(part), 0);
+    }
+
+    function parseThumbnailTrack(text) {
+        const cues = [];
+        text.split(/\r?\n\r?\n/).forEach(block => {
+            const lines = block.trim().split(/\r?\n/);
+            const timing = lines.findIndex(line => line.includes('-->'));
+            if (timing < 0 || !lines[timing + 1]) return;
+            const [start, end] = lines[timing].split('-->').map(s => vttSeconds(s.trim()));
+            const [url, hash] = lines[timing + 1].trim().split('#xywh=');
+            if (!hash) return;
+            const [x, y, w, h] = hash.split(',').map(Number);
+            cues.push({ start, end, url, x, y, w, h });
+        });
+        return cues;
+    }
+
+    function setThumbnails(player, url) {
+        player.thumbnailCues = [];
+        if (!url) return;
+        fetch(url)
+            .then(response => response.ok ? response.text() : '')
+            .then(text => { player.thumbnailCues = parseThumbnailTrack(text); })
+            .catch(error => console.error('Error fetching seek thumbnails:', error));
+    }
+
+    // Shows the thumbnail for the hovered time above the progress bar.
+    function attachThumbnailPreview(player) {
+        const progress = player.controlBar && player.controlBar.progressControl;
+        if (!progress) return;
+        const preview = document.createElement('div');
+        preview.className = 'vjs-thumbnail-preview';
+        progress.el().appendChild(preview);
+
+        progress.on('mousemove', event => {
+            const cues = player.thumbnailCues || [];
+            if (!cues.length) return;
+            const rect     = progress.el().getBoundingClientRect();
+            const fraction = Math.min(Math.max((event.clientX - rect.left) / rect.width, 0), 1);
+            const time     = fraction * (player.duration() || cues[cues.length - 1].end);
+            const cue      = cues.find(c => time >= c.start && time < c.end) || cues[cues.length - 1];
+            preview.style.width              = `${cue.w}px`;
+            preview.style.height             = `${cue.h}px`;
+            preview.style.backgroundImage    = `url("${cue.url}")`;
+            preview.style.backgroundPosition = `-${cue.x}px -${cue.y}px`;
+            preview.style.left = `${Math.min(Math.max(event.clientX - rect.left - cue.w / 2, 0), rect.width - cue.w)}px`;
+            preview.style.display = 'block';
+        });
+        progress.on('mouseleave', () => { preview.style.display = 'none'; });
+    }
+
     function initPlayer(type) {
         const el = document.getElementById(`video-${type}`);
         if (!el) return;
 
+        const thumbnails = el.dataset.thumbnails || '';
         const srcEl = el.querySelector('source');
         const src   = srcEl ? srcEl.getAttribute('src') : '';
         const isHLS = src.endsWith('.m3u8');
@@ -45,6 +110,8 @@ document.addEventListener('DOMContentLoaded', () => {
             player.hlsQualitySelector({ displayCurrentQuality: true });
         }
 
+        attachThumbnailPreview(player);
+        setThumbnails(player, thumbnails);
         vjsInstances.set(type, player);
     }
 
@@ -60,6 +127,7 @@ document.addEventListener('DOMContentLoaded', () => {
         imageUsage:       document.getElementById('image-usage'),
         diskUsage:        document.getElementById('disk-usage'),
         lastSnapshotTime: document.getElementById('last-snapshot-time'),
+        missedSlots:      document.getElementById('missed-slots'),
     };
 
     const updateUsageColor = (element, value) => {
@@ -81,6 +149,7 @@ document.addEventListener('DOMContentLoaded', () => {
         }
         elements.totalImages.textContent      = data.total_images    || 'Loading...';
         elements.lastSnapshotTime.textContent = data.last_image_time || 'Loading...';
+        if (elements.missedSlots) elements.missedSlots.textContent = data.missed_slots ?? 0;
         if (data.image_size && typeof data.image_size === 'object') {
             elements.imageUsage.textContent = data.image_size.image_usage_gb || 'N/A';
             elements.diskUsage.textContent  = `${data.image_size.disk_used_gb} / ${data.image_size.disk_total_gb} (${data.image_size.disk_used_percent})`;
@@ -93,7 +162,7 @@ document.addEventListener('DOMContentLoaded', () => {
     const pollAndUpdateDashboard = async () => {
         if (document.hidden) return;
         try {
-            const response = await fetch('/api/images');
+            const response = await fetch(`/api/images?camera=${encodeURIComponent(selectedCamera)}`);
             const data     = await response.json();
             updateDashboard(data);
         } catch (error) {
@@ -111,28 +180,78 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     });
 
+    // --- Video generation progress ---
+    // Polled often while a timelapse is being generated, and slowly otherwise.
+    const videoStatusEls = {
+        text:         document.getElementById('video-status-text'),
+        progress:     document.getElementById('video-progress'),
+        progressBar:  document.getElementById('video-progress-bar'),
+        progressText: document.getElementById('video-progress-text'),
+        lastRun:      document.getElementById('video-last-run'),
+        error:        document.getElementById('video-error'),
+    };
+
+    const updateVideoStatus = (status) => {
+        videoStatusEls.text.textContent = status.is_running ? `Generating ${status.currently_generating}` : 'Idle';
+        videoStatusEls.lastRun.textContent = status.last_run;
+        videoStatusEls.error.textContent = status.error;
+        videoStatusEls.error.classList.toggle('d-none', !status.error);
+
+        const progress = status.progress;
+        videoStatusEls.progress.classList.toggle('d-none', !progress);
+        if (!progress) return;
+        const known = progress.total_frames > 0;
+        videoStatusEls.progressBar.style.width = `${known ? progress.percent : 100}%`;
+        videoStatusEls.progressBar.textContent = known ? `${progress.percent.toFixed(0)}%` : '';
+        const parts = [status.current_file];
+        parts.push(known ? `frame ${progress.frame} of ${progress.total_frames}` : `frame ${progress.frame}`);
+        if (progress.speed > 0) parts.push(`${progress.speed}x`);
+        if (progress.eta) parts.push(`about ${progress.eta} left`);
+        videoStatusEls.progressText.textContent = parts.join(' · ');
+    };
+
+    const pollVideoStatus = async () => {
+        let running = false;
+        if (!document.hidden && videoStatusEls.text) {
+            try {
+                const response = await fetch('/api/video-status');
+                const status   = await response.json();
+                updateVideoStatus(status);
+                running = status.is_running || !!status.progress;
+            } catch (error) {
+                console.error('Error fetching video status:', error);
+            }
+        }
+        setTimeout(pollVideoStatus, running ? 2000 : 15000);
+    };
+    pollVideoStatus();
+
     // --- Timelapse select handlers ---
     document.querySelectorAll('.timelapse-select').forEach(select => {
         select.addEventListener('change', (event) => {
             const newSrc        = event.target.value;
             const selectedOption = event.target.options[event.target.selectedIndex];
-            const fmt           = selectedOption.dataset.format || '';
             const videoPlayerId = event.target.dataset.videoTarget;
-            const downloadBtnId = event.target.dataset.downloadTarget;
             const typeName      = videoPlayerId.replace('video-', '');
             const player        = vjsInstances.get(typeName);
 
             if (player) {
                 // Video.js handles format switching (HLS ↔ mp4 ↔ webm) natively
                 player.src({ src: newSrc, type: mimeForSrc(newSrc) });
+                setThumbnails(player, selectedOption.dataset.thumbnails);
+                // The animated preview, where there is one, stands in as the poster
+                if (selectedOption.dataset.poster) player.poster(selectedOption.dataset.poster);
             }
 
-            const downloadBtn = document.getElementById(downloadBtnId);
-            if (downloadBtn) {
-                downloadBtn.href = newSrc;
-                downloadBtn.style.display = fmt === 'hls' ? 'none' : '';
-            }
-            const shareBtn = event.target.closest('.card-body').querySelector('.share-btn');
+            // Every MP4 or WebM copy of the timelapse is offered for download,
+            // whichever format is playing
+            const cardBody = event.target.closest('.card-body');
+            cardBody.querySelectorAll('.download-btn').forEach(btn => {
+                const href = btn.dataset.format === 'mp4' ? selectedOption.dataset.downloadMp4 : selectedOption.dataset.downloadWebm;
+                btn.href = href || '';
+                btn.classList.toggle('d-none', !href);
+            });
+            const shareBtn = cardBody.querySelector('.share-btn');
             if (shareBtn) shareBtn.dataset.path = newSrc;
         });
     });
@@ -153,10 +272,18 @@ document.addEventListener('DOMContentLoaded', () => {
             const sel = dateSelect.options[dateSelect.selectedIndex];
             renderGallery(initialGalleryData, sel ? sel.textContent : defaultDate);
         }
-        dateSelect.addEventListener('change', (event) => {
-            const sel = event.target.options[event.target.selectedIndex];
-            fetchGallery(event.target.value, sel.textContent);
-        });
+        const galleryFilter = document.getElementById('gallery-filter');
+        const refreshGallery = () => {
+            const sel = dateSelect.options[dateSelect.selectedIndex];
+            const display = sel ? sel.textContent : dateSelect.value;
+            if (galleryFilter && galleryFilter.value) {
+                fetchEventGallery(dateSelect.value, display, galleryFilter.value);
+            } else {
+                fetchGallery(dateSelect.value, display);
+            }
+        };
+        dateSelect.addEventListener('change', refreshGallery);
+        if (galleryFilter) galleryFilter.addEventListener('change', refreshGallery);
     }
 
     // --- Logout handler ---
@@ -209,7 +336,7 @@ async function fetchGallery(date, displayDate) {
 
     galleryGrid.innerHTML = '<div class="text-center text-primary-highlight py-4"><i class="fas fa-sync fa-spin me-2"></i> Loading Gallery...</div>';
     try {
-        const response = await fetch(`/api/gallery?date=${date}`);
+        const response = await fetch(`/api/gallery?date=${date}&camera=${encodeURIComponent(selectedCamera)}`);
         if (!response.ok) throw new Error(`HTTP error! status: ${response.status}`);
         const data = await response.json();
         galleryInfo.innerHTML = `Displaying hourly snapshots for <span class="text-primary-highlight" id="current-gallery-date">${displayDate}</span>.`;
@@ -219,3 +346,48 @@ async function fetchGallery(date, displayDate) {
         galleryGrid.innerHTML = '<div class="alert alert-danger">Failed to load gallery for this date.</div>';
     }
 }
+
+function renderEventGallery(events) {
+    const galleryGrid = document.getElementById('gallery-grid');
+    if (!galleryGrid) return;
+
+    galleryGrid.innerHTML = '';
+    if (events.length === 0) {
+        galleryGrid.innerHTML = '<div class="text-center text-secondary py-4 w-100">No event snapshots for this date.</div>';
+        return;
+    }
+    events.forEach(item => {
+        const col     = document.createElement('div');
+        col.className = 'col text-center';
+        const tags    = item.tags.split(',').map(tag => `<span class="badge bg-secondary me-1">${tag}</span>`).join('');
+        col.innerHTML = `
+            <small class="text-secondary">${item.time}</small>
+            <div class="gallery-image-container">
+                <a href="${item.url}" target="_blank">
+                    <img src="${item.url}" class="gallery-image" loading="lazy" decoding="async" alt="Event at ${item.time}">
+                </a>
+            </div>
+            <div>${tags}</div>`;
+        galleryGrid.appendChild(col);
+    });
+}
+
+async function fetchEventGallery(date, displayDate, tag) {
+    const galleryGrid = document.getElementById('gallery-grid');
+    const galleryInfo = document.getElementById('gallery-info');
+    if (!galleryGrid || !galleryInfo) return;
+
+    galleryGrid.innerHTML = '<div class="text-center text-primary-highlight py-4"><i class="fas fa-sync fa-spin me-2"></i> Loading Events...</div>';
+    const tagParam = tag === 'all' ? '' : tag;
+    try {
+        const response = await fetch(`/api/events?date=${date}&tag=${encodeURIComponent(tagParam)}&camera=${encodeURIComponent(selectedCamera)}`);
+        if (!response.ok) throw new Error(`HTTP error! status: ${response.status}`);
+        const data = await response.json();
+        const what = tagParam ? `${tagParam} event` : 'event';
+        galleryInfo.innerHTML = `Displaying ${what} snapshots for <span class="text-primary-highlight" id="current-gallery-date">${displayDate}</span>.`;
+        renderEventGallery(data.images);
+    } catch (error) {
+        console.error('Error fetching event gallery:', error);
+        galleryGrid.innerHTML = '<div class="alert alert-danger">Failed to load event snapshots for this date.</div>';
+    }
+}
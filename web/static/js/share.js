@@ -19,6 +19,7 @@ document.querySelectorAll('.share-btn').forEach(button => {
                 } else {
                     shareLinkExpiry.textContent = `This link is valid until ${new Date(data.expiresAt).toLocaleString()}.`;
                 }
+                showSharePreview(data.previewLinks || {});
                 const shareLinkModal = new bootstrap.Modal(document.getElementById('shareLinkModal'));
                 shareLinkModal.show();
             }
@@ -31,3 +32,34 @@ document.getElementById('copyShareLinkBtn').addEventListener('click', () => {
     shareLinkInput.select();
     navigator.clipboard.writeText(shareLinkInput.value);
 });
+
+// A timelapse's animated previews are shared through the same token; chat
+// apps inline them where they will not inline the video. WebP is offered
+// first, with GIF for apps that cannot show animated WebP.
+function showSharePreview(previewLinks) {
+    const container = document.getElementById('sharePreview');
+    const kindSelect = document.getElementById('sharePreviewKind');
+    const kinds = ['webp', 'gif'].filter(kind => previewLinks[kind]);
+    container.classList.toggle('d-none', kinds.length === 0);
+    kindSelect.innerHTML = '';
+    kinds.forEach(kind => kindSelect.add(new Option(kind.toUpperCase(), previewLinks[kind])));
+    if (kinds.length > 0) {
+        selectSharePreview(kindSelect.value);
+    }
+}
+
+function selectSharePreview(link) {
+    document.getElementById('sharePreviewInput').value = link;
+    // Share links carry the host without a scheme.
+    document.getElementById('sharePreviewImage').src = `//${link}`;
+}
+
+document.getElementById('sharePreviewKind').addEventListener('change', (event) => {
+    selectSharePreview(event.target.value);
+});
+
+document.getElementById('copySharePreviewBtn').addEventListener('click', () => {
+    const sharePreviewInput = document.getElementById('sharePreviewInput');
+    sharePreviewInput.select();
+    navigator.clipboard.writeText(sharePreviewInput.value);
+});